@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newAlarmCmd(flags *globalFlags) *cobra.Command {
+	var alarm rotator.BillingAlarm
+
+	cmd := &cobra.Command{
+		Use:   "alarm",
+		Short: "Set up a CloudWatch alarm on the API Gateway charges of the month",
+		Long: `Create or update a CloudWatch alarm on the estimated API Gateway charges of
+the month and the SNS topic it notifies, in us-east-1 of every account. The
+billing alerts must be enabled in the billing preferences of the accounts.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+			setups, err := ag.SetupBillingAlarm(cmd.Context(), alarm)
+			for _, s := range setups {
+				account := s.Account
+				if account == "" {
+					account = "default"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%s\n", account, s.AlarmName, s.TopicARN)
+			}
+			if err == nil && alarm.Email != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "confirm the subscription sent to %s to receive the alarms\n", alarm.Email)
+			}
+			return err
+		},
+	}
+	cmd.Flags().Float64Var(&alarm.Threshold, "threshold", 10, "USD of API Gateway charges in a month the alarm goes off at")
+	cmd.Flags().StringVar(&alarm.Email, "email", "", "email address notified by the alarm")
+	cmd.Flags().StringVar(&alarm.Name, "alarm-name", rotator.DefaultBillingAlarmName, "name of the alarm and of its SNS topic")
+	return cmd
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newCostCmd(flags *globalFlags) *cobra.Command {
+	var (
+		requests   uint64
+		transferGB float64
+		endpoints  int
+		output     string
+		pricing    = rotator.DefaultPricing
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Estimate the monthly cost of a pool",
+		Long: `Estimate the monthly cost of sending --requests requests and --transfer-gb GB
+of responses a month through a pool of the --backend kind. API Gateway only
+bills traffic: the number of endpoints, one per region by default, only splits
+the cost between them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q, want table or json", output)
+			}
+			backend := rotator.Backend(flags.backend)
+			if backend != rotator.BackendREST && backend != rotator.BackendHTTP {
+				return fmt.Errorf("invalid --backend %q, want rest or http", flags.backend)
+			}
+			if endpoints <= 0 {
+				ag, err := flags.gateway(cmd.Context(), "")
+				if err != nil {
+					return err
+				}
+				endpoints = len(ag.Regions)
+			}
+
+			cost := pricing.Estimate(rotator.Usage{
+				Backend:       backend,
+				Endpoints:     endpoints,
+				Requests:      requests,
+				TransferBytes: uint64(transferGB * 1e9),
+			})
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(cost)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "requests\t%d\t$%.2f\n", requests, cost.Requests)
+			fmt.Fprintf(w, "transfer\t%.1f GB\t$%.2f\n", transferGB, cost.Transfer)
+			fmt.Fprintf(w, "total per month\t\t$%.2f\n", cost.Total)
+			fmt.Fprintf(w, "per request\t\t$%.8f\n", cost.PerRequest)
+			fmt.Fprintf(w, "per endpoint\t%d endpoints\t$%.2f\n", endpoints, cost.PerEndpoint)
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Uint64Var(&requests, "requests", 1_000_000, "requests per month")
+	cmd.Flags().Float64Var(&transferGB, "transfer-gb", 10, "GB of responses per month")
+	cmd.Flags().IntVar(&endpoints, "endpoints", 0, "number of endpoints of the pool, one per region of --regions by default")
+	cmd.Flags().Float64Var(&pricing.RESTPerMillion, "rest-price", pricing.RESTPerMillion, "USD per million REST API requests")
+	cmd.Flags().Float64Var(&pricing.HTTPPerMillion, "http-price", pricing.HTTPPerMillion, "USD per million HTTP API requests")
+	cmd.Flags().Float64Var(&pricing.TransferPerGB, "transfer-price", pricing.TransferPerGB, "USD per GB of data transfer out")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/provider/cloudflare"
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newCreateCmd(flags *globalFlags) *cobra.Command {
+	var site string
+	var workers int
+	var ttl time.Duration
+	var adopt bool
+	var checkQuota, spill bool
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a gateway for a site in every region",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun && workers > 0 {
+				return errors.New("--dry-run does not support --cloudflare-workers")
+			}
+			opts := []rotator.Option{rotator.WithTTL(ttl)}
+			if adopt {
+				opts = append(opts, rotator.WithAdopt())
+			}
+			if checkQuota || spill {
+				opts = append(opts, rotator.WithQuotaCheck(spill))
+			}
+			ag, err := flags.gateway(cmd.Context(), site, opts...)
+			if err != nil {
+				return err
+			}
+
+			// reuse the gateways of the state file and only create the
+			// regions it does not cover yet
+			if _, err := flags.loadState(cmd.Context(), ag); err != nil {
+				return err
+			}
+			covered := make(map[string]bool)
+			for _, d := range ag.Deployments() {
+				covered[d.Region] = true
+			}
+			var regions []string
+			for _, region := range ag.Regions {
+				if !covered[region] {
+					regions = append(regions, region)
+				}
+			}
+			ag.Regions = regions
+
+			err = ag.InitializeAll(cmd.Context())
+			if workers > 0 {
+				cf := flags.cloudflare(ag.Site)
+				if cf == nil {
+					return errors.New("--cloudflare-workers needs --cloudflare-account")
+				}
+				var errs []error
+				for i := 0; i < workers; i++ {
+					errs = append(errs, ag.InitializeWith(cf, cloudflare.Region, cmd.Context()))
+				}
+				err = errors.Join(append(errs, err)...)
+			}
+			for _, endpoint := range ag.Endpoints.Snapshot() {
+				fmt.Fprintln(cmd.OutOrStdout(), endpoint.Host)
+			}
+			if saveErr := flags.saveState(cmd.Context(), ag); saveErr != nil {
+				if errors.Is(saveErr, rotator.ErrStateConflict) {
+					// another process created gateways for this pool at the
+					// same time, remove ours instead of keeping duplicates
+					for _, d := range ag.SessionDeployments() {
+						saveErr = errors.Join(saveErr, ag.DeleteDeployment(cmd.Context(), d))
+					}
+				}
+				return errors.Join(err, saveErr)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&site, "site", "", "target site, e.g. https://example.com")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "tag the gateways to be deleted by rotator janitor after this long")
+	cmd.Flags().BoolVar(&adopt, "adopt", false, "reuse and repair existing gateways with the same name instead of failing")
+	cmd.Flags().BoolVar(&checkQuota, "check-quota", true, "check the REST API quota of every region before creating anything")
+	cmd.Flags().BoolVar(&spill, "spill", false, "create the gateways of the regions at their quota in other regions instead of failing")
+	cmd.Flags().IntVar(&workers, "cloudflare-workers", 0, "also deploy this many Cloudflare Workers")
+	cmd.MarkFlagRequired("site")
+	return cmd
+}
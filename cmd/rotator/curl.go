@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newCurlCmd(flags *globalFlags) *cobra.Command {
+	var (
+		method, data, output, site string
+		headers                    []string
+		include, verbose, location bool
+		create                     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "curl URL",
+		Short: "Send one request through the gateways and print the response",
+		Long: `Send one request through the gateways of the site of URL, like curl, and
+print the body of the response. -i prints the status and headers first, -v
+also prints the request sent and the endpoint and region it went through to
+stderr. -d sends data as the body, @file to read it from file and @- from
+stdin; the method is POST with a body and GET without, unless -X is given.
+
+The existing gateways of the site are used, or new ones are created with
+--create and deleted afterwards.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return errors.New("--dry-run cannot send requests through gateways it does not create")
+			}
+			target, err := url.Parse(args[0])
+			if err != nil || target.Host == "" {
+				return fmt.Errorf("invalid URL %q", args[0])
+			}
+			if site == "" {
+				site = target.Scheme + "://" + target.Host
+			}
+			body, err := curlData(cmd, data)
+			if err != nil {
+				return err
+			}
+			if method == "" {
+				method = http.MethodGet
+				if body != nil {
+					method = http.MethodPost
+				}
+			}
+			req, err := http.NewRequestWithContext(cmd.Context(), strings.ToUpper(method), target.String(), nil)
+			if err != nil {
+				return err
+			}
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+				req.ContentLength = int64(len(body))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			for _, h := range headers {
+				name, value, ok := strings.Cut(h, ":")
+				if !ok {
+					return fmt.Errorf("invalid header %q, use 'Name: value'", h)
+				}
+				req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+
+			ag, err := flags.openPool(cmd.Context(), site, create)
+			if err != nil {
+				if create && ag != nil {
+					return errors.Join(err, teardown(cmd, ag))
+				}
+				return err
+			}
+			if create {
+				defer func() { teardown(cmd, ag) }()
+			}
+
+			client := ag.Client()
+			if !location {
+				client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+			}
+			if verbose {
+				writeHeaders(cmd.ErrOrStderr(), "> ", fmt.Sprintf("%s %s %s", req.Method, req.URL.RequestURI(), req.Proto), req.Header)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if verbose {
+				endpoint := ag.EndpointOf(resp)
+				if endpoint == "" {
+					fmt.Fprintln(cmd.ErrOrStderr(), "* sent directly, not through a gateway")
+				}
+				for _, d := range ag.Deployments() {
+					if d.Host == endpoint {
+						fmt.Fprintf(cmd.ErrOrStderr(), "* through %s in %s (%s)\n", endpoint, d.Region, d.Provider)
+					}
+				}
+				writeHeaders(cmd.ErrOrStderr(), "< ", resp.Proto+" "+resp.Status, resp.Header)
+			}
+			out := cmd.OutOrStdout()
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			if include {
+				writeHeaders(out, "", resp.Proto+" "+resp.Status, resp.Header)
+			}
+			_, err = io.Copy(out, resp.Body)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&method, "request", "X", "", "request method, GET or POST with -d by default")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "request header, as 'Name: value'; can be repeated")
+	cmd.Flags().StringVarP(&data, "data", "d", "", "request body, @file to read it from file or @- from stdin")
+	cmd.Flags().BoolVarP(&include, "include", "i", false, "print the status and headers of the response before its body")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print the request, the response headers and the endpoint used to stderr")
+	cmd.Flags().BoolVarP(&location, "location", "L", false, "follow redirects")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write the body to this file instead of stdout")
+	cmd.Flags().StringVar(&site, "site", "", "site of the gateways, the origin of URL if empty")
+	cmd.Flags().BoolVar(&create, "create", false, "create gateways for the site and delete them afterwards")
+	return cmd
+}
+
+// curlData returns the body given by -d, nil without one.
+func curlData(cmd *cobra.Command, data string) ([]byte, error) {
+	switch {
+	case !cmd.Flags().Changed("data"):
+		return nil, nil
+	case data == "@-":
+		return io.ReadAll(cmd.InOrStdin())
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+// writeHeaders prints a status line and headers, sorted, with prefix, and a
+// blank line after them.
+func writeHeaders(w io.Writer, prefix, status string, header http.Header) {
+	fmt.Fprintf(w, "%s%s\n", prefix, status)
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+	fmt.Fprintln(w, strings.TrimSpace(prefix))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newDeleteCmd(flags *globalFlags) *cobra.Command {
+	var (
+		all         bool
+		concurrency int
+		site        string
+		namePrefix  string
+		olderThan   time.Duration
+		tags        []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the REST APIs created by rotator in every region",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+			if _, err := flags.loadState(cmd.Context(), ag); err != nil {
+				return err
+			}
+			ag.Concurrency = concurrency
+
+			opts := rotator.DeleteOptions{Filters: []rotator.GatewayFilter{rotator.OwnedGateways}}
+			if all {
+				opts.Filters = []rotator.GatewayFilter{rotator.AllGateways}
+			}
+			if site != "" {
+				// accept a URL as well as a host
+				if u, err := url.Parse(site); err == nil && u.Host != "" {
+					site = u.Host
+				}
+				opts.Filters = append(opts.Filters, rotator.SiteGateways(site))
+			}
+			if namePrefix != "" {
+				opts.Filters = append(opts.Filters, rotator.NamePrefixGateways(namePrefix))
+			}
+			if olderThan > 0 {
+				opts.Filters = append(opts.Filters, rotator.OlderThanGateways(olderThan))
+			}
+			for _, tag := range tags {
+				key, value, _ := strings.Cut(tag, "=")
+				if key == "" {
+					return fmt.Errorf("invalid --tag %q, want key or key=value", tag)
+				}
+				opts.Filters = append(opts.Filters, rotator.TagGateways(key, value))
+			}
+			var mu sync.Mutex
+			opts.Progress = func(region, id string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\tfailed: %s\n", region, id, err)
+					return
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", region, id)
+			}
+
+			deployments := ag.Deployments()
+			results, deleteErr := ag.DeleteAll(cmd.Context(), opts)
+			for _, r := range results {
+				// the stage of the pool is gone from the shared APIs kept
+				for _, id := range append(r.Deleted, r.Kept...) {
+					for _, d := range deployments {
+						if d.Region == r.Region && d.ID == id {
+							ag.RemoveEndpoint(d.Host)
+						}
+					}
+				}
+				if len(r.Deleted) > 0 || len(r.Failed) > 0 || len(r.ListErrors) > 0 {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %d deleted, %d failed\n", r.Region, len(r.Deleted), len(r.Failed))
+				}
+				if len(r.Kept) > 0 {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %d shared APIs kept for other pools\n", r.Region, len(r.Kept))
+				}
+			}
+			return errors.Join(deleteErr, flags.saveState(cmd.Context(), ag))
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "delete every REST API of the regions, not only those created by rotator")
+	cmd.Flags().StringVar(&site, "site", "", "only delete the REST APIs created for this site host")
+	cmd.Flags().StringVar(&namePrefix, "name-prefix", "", "only delete the REST APIs whose name starts with this prefix")
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "only delete the REST APIs created longer ago than this, e.g. 24h")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "only delete the REST APIs with this tag, key or key=value; repeatable")
+	cmd.Flags().IntVar(&concurrency, "concurrency", rotator.DefaultConcurrency, "number of regions deleted from at once")
+	return cmd
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// exportedEndpoint is an endpoint of the json format of export.
+type exportedEndpoint struct {
+	URL string `json:"url"`
+	rotator.Deployment
+}
+
+func newExportCmd(flags *globalFlags) *cobra.Command {
+	var format, output, site, proxyAddr, proxyType string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the endpoints or the local proxy in the formats of other tools",
+		Long: `Write the pool in a format other tools consume:
+
+  plain        the URL of every endpoint, one per line, e.g. for ffuf -w
+  json         the endpoints with their URL, region, provider and API key
+  proxychains  a [ProxyList] of the local proxy of rotator proxy
+  burp         Burp Suite project options using the local proxy upstream
+
+The endpoints are those of the --state store or found in the account for
+--site. The proxychains and burp formats point at --proxy, the address rotator
+proxy listens on, since those tools need a proxy rather than URLs. Endpoints
+that require an API key or IAM authentication only answer requests sent
+through rotator.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if proxyType != "http" && proxyType != "socks5" {
+				return fmt.Errorf("invalid --proxy-type %q, want http or socks5", proxyType)
+			}
+			out := cmd.OutOrStdout()
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+
+			switch format {
+			case "proxychains", "burp":
+				host, port, err := proxyAddress(proxyAddr)
+				if err != nil {
+					return err
+				}
+				if format == "proxychains" {
+					fmt.Fprintf(out, "[ProxyList]\n%s %s %d\n", proxyType, host, port)
+					return nil
+				}
+				return writeBurpOptions(out, proxyType, host, port)
+			case "plain", "json":
+			default:
+				return fmt.Errorf("invalid --format %q, want plain, json, proxychains or burp", format)
+			}
+
+			if flags.dryRun {
+				return errors.New("--dry-run cannot list gateways it does not create")
+			}
+			ag, err := flags.openPool(cmd.Context(), site, false)
+			if err != nil {
+				return err
+			}
+			deployments := ag.Deployments()
+			if format == "plain" {
+				for _, d := range deployments {
+					fmt.Fprintln(out, endpointURL(d))
+				}
+				return nil
+			}
+			endpoints := make([]exportedEndpoint, 0, len(deployments))
+			for _, d := range deployments {
+				endpoints = append(endpoints, exportedEndpoint{URL: endpointURL(d), Deployment: d})
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(endpoints)
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "plain", "output format: plain, json, proxychains or burp")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write to this file instead of stdout")
+	cmd.Flags().StringVar(&site, "site", "", "site of the gateways")
+	cmd.Flags().StringVar(&proxyAddr, "proxy", "127.0.0.1:8080", "address of the local proxy, the --listen or --socks-listen of rotator proxy")
+	cmd.Flags().StringVar(&proxyType, "proxy-type", "http", "type of the local proxy: http, or socks5 for --socks-listen")
+	return cmd
+}
+
+// endpointURL returns the URL requests through d are sent to.
+func endpointURL(d rotator.Deployment) string {
+	return "https://" + d.Host + d.BasePath
+}
+
+// proxyAddress splits addr into a host and port other tools can connect to,
+// the loopback address when addr listens on every interface.
+func proxyAddress(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid --proxy %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid --proxy port %q", portStr)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return host, port, nil
+}
+
+// writeBurpOptions writes Burp Suite project options sending every request
+// through the proxy at host and port, to load in Settings > Project.
+func writeBurpOptions(w io.Writer, proxyType, host string, port int) error {
+	connections := map[string]any{}
+	if proxyType == "socks5" {
+		connections["socks_proxy"] = map[string]any{
+			"use_proxy":        true,
+			"host":             host,
+			"port":             port,
+			"dns_over_socks":   true,
+			"use_user_options": false,
+		}
+	} else {
+		connections["upstream_proxy"] = map[string]any{
+			"use_user_options": false,
+			"servers": []map[string]any{{
+				"enabled":             true,
+				"destination_host":    "*",
+				"proxy_host":          host,
+				"proxy_port":          port,
+				"authentication_type": "none",
+			}},
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"project_options": map[string]any{"connections": connections}})
+}
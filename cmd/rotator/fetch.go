@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// manifestFile is the name of the results manifest in --output-dir.
+const manifestFile = "manifest.jsonl"
+
+// fetchResult is a line of the results manifest of fetch.
+type fetchResult struct {
+	URL       string  `json:"url"`
+	Status    int     `json:"status,omitempty"`
+	Endpoint  string  `json:"endpoint,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Bytes     int64   `json:"bytes"`
+	File      string  `json:"file,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func newFetchCmd(flags *globalFlags) *cobra.Command {
+	var (
+		input, outputDir, site string
+		concurrency, retries   int
+		timeout                time.Duration
+		create                 bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "Fetch a list of URLs through the gateways",
+		Long: `Read URLs, one per line, from --input or stdin and fetch them through the
+gateways of the site, --concurrency at a time. With --output-dir, the body of
+every response is written to a file named after the line of its URL, and a
+manifest.jsonl with the status, endpoint, latency and size of every URL is
+written next to them; without, the manifest is written to stdout. Blank lines
+and lines starting with # are skipped.
+
+The site is the origin of the first URL unless --site is given; URLs of other
+hosts are refused. The existing gateways of the site are used, or new ones
+are created with --create and deleted once every URL was fetched.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return errors.New("--dry-run cannot fetch through gateways it does not create")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("invalid --concurrency %d", concurrency)
+			}
+			in := cmd.InOrStdin()
+			if input != "-" {
+				f, err := os.Open(input)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			urls := readURLs(in)
+
+			// the first URL gives the site, and is fetched like the others
+			first, ok := <-urls
+			if !ok {
+				return nil
+			}
+			if site == "" {
+				u, err := url.Parse(first.url)
+				if err != nil || u.Host == "" {
+					return fmt.Errorf("invalid URL %q on line %d", first.url, first.line)
+				}
+				site = u.Scheme + "://" + u.Host
+			}
+
+			manifest := cmd.OutOrStdout()
+			if outputDir != "" {
+				if err := os.MkdirAll(outputDir, 0o755); err != nil {
+					return err
+				}
+				f, err := os.OpenFile(filepath.Join(outputDir, manifestFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				manifest = f
+			}
+
+			var opts []rotator.Option
+			if retries > 0 {
+				policy := rotator.DefaultRetryPolicy
+				policy.MaxAttempts = retries + 1
+				opts = append(opts, rotator.WithRetry(policy))
+			}
+			ag, err := flags.openPool(cmd.Context(), site, create, opts...)
+			if err != nil {
+				if create && ag != nil {
+					return errors.Join(err, teardown(cmd, ag))
+				}
+				return err
+			}
+
+			run := func(ctx context.Context) error {
+				return fetchAll(ctx, ag, first, urls, fetchSettings{
+					concurrency: concurrency,
+					timeout:     timeout,
+					outputDir:   outputDir,
+					manifest:    manifest,
+				})
+			}
+			if create {
+				return rotator.NewLifecycle(ag).Run(cmd.Context(), run)
+			}
+			return run(cmd.Context())
+		},
+	}
+	cmd.Flags().StringVarP(&input, "input", "i", "-", "file of URLs to fetch, one per line, - for stdin")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", "", "directory to write the bodies and manifest.jsonl to, the manifest goes to stdout if empty")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 10, "number of URLs fetched at once")
+	cmd.Flags().IntVar(&retries, "retries", 0, "send failed requests again through other endpoints up to this many times")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "timeout of every URL, body included")
+	cmd.Flags().StringVar(&site, "site", "", "site of the gateways, the origin of the first URL if empty")
+	cmd.Flags().BoolVar(&create, "create", false, "create gateways for the site and delete them once done")
+	return cmd
+}
+
+// inputURL is a URL read on line of the input.
+type inputURL struct {
+	url  string
+	line int
+}
+
+// readURLs streams the URLs of r, as they are read.
+func readURLs(r io.Reader) <-chan inputURL {
+	urls := make(chan inputURL)
+	go func() {
+		defer close(urls)
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			urls <- inputURL{url: text, line: line}
+		}
+	}()
+	return urls
+}
+
+type fetchSettings struct {
+	concurrency int
+	timeout     time.Duration
+	outputDir   string
+	manifest    io.Writer
+}
+
+// fetchAll fetches first and the URLs of urls through ag and writes their
+// results to the manifest. It stops reading URLs once ctx is done.
+func fetchAll(ctx context.Context, ag *rotator.ApiGateway, first inputURL, urls <-chan inputURL, s fetchSettings) error {
+	client := ag.Client()
+	enc := json.NewEncoder(s.manifest)
+	var mu sync.Mutex
+	var failed int
+
+	jobs := make(chan inputURL)
+	var wg sync.WaitGroup
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for in := range jobs {
+				result := fetchOne(ctx, client, ag, in, s)
+				mu.Lock()
+				if result.Error != "" {
+					failed++
+				}
+				enc.Encode(result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	jobs <- first
+feed:
+	for in := range urls {
+		select {
+		case jobs <- in:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d URLs could not be fetched", failed)
+	}
+	return ctx.Err()
+}
+
+// fetchOne fetches in and writes its body to the output directory.
+func fetchOne(ctx context.Context, client *http.Client, ag *rotator.ApiGateway, in inputURL, s fetchSettings) fetchResult {
+	result := fetchResult{URL: in.url}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+	result.Endpoint = ag.EndpointOf(resp)
+
+	out := io.Discard
+	if s.outputDir != "" {
+		result.File = fmt.Sprintf("%06d.body", in.line)
+		f, err := os.Create(filepath.Join(s.outputDir, result.File))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		defer f.Close()
+		out = f
+	}
+	result.Bytes, err = io.Copy(out, resp.Body)
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
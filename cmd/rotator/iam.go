@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// policyFlags are the features the IAM policy of iam-policy and doctor
+// allows, on top of the global flags.
+type policyFlags struct {
+	quotas    bool
+	alarmName string
+}
+
+func (p *policyFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&p.quotas, "check-quota", true, "allow reading the REST API quota before creating gateways")
+	cmd.Flags().StringVar(&p.alarmName, "alarm-name", "", "allow setting up the billing alarm of this name, see the alarm command")
+}
+
+// options returns the policy options of the global flags and of p for
+// regions, every region when nil.
+func (p *policyFlags) options(flags *globalFlags, regions []string) rotator.PolicyOptions {
+	return rotator.PolicyOptions{
+		Regions:        regions,
+		Backend:        rotator.Backend(flags.backend),
+		AutoRegions:    slices.ContainsFunc(flags.regions, func(spec string) bool { return slices.Contains(strings.Split(spec, ","), rotator.RegionsAuto) }),
+		ResourcePolicy: len(flags.sourceIPs) > 0,
+		IAMAuth:        flags.iamAuth,
+		WebACL:         len(flags.webACLs) > 0,
+		CustomDomain:   flags.domainZone != "",
+		Quotas:         p.quotas,
+		BillingAlarm:   p.alarmName,
+		State:          flags.statePath,
+		RoleARN:        flags.roleARN,
+	}
+}
+
+func newIAMPolicyCmd(flags *globalFlags) *cobra.Command {
+	var policy policyFlags
+
+	cmd := &cobra.Command{
+		Use:   "iam-policy",
+		Short: "Print the IAM policy rotator needs",
+		Long: `Print the least privileged IAM policy allowing rotator to manage gateways in
+the regions of --regions, with the --backend, --state and --role-arn given.
+With --regions auto, the policy allows every region.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := rotator.LoadConfig(flags.configPath)
+			if err != nil {
+				return err
+			}
+			opts := []rotator.Option{rotator.WithConfig(config)}
+			if len(flags.regions) > 0 {
+				opts = append(opts, rotator.WithRegions(flags.regions...))
+			}
+			// only to resolve the regions, no AWS call is made
+			ag, err := rotator.NewApiGateway("", flags.name, opts...)
+			if err != nil {
+				return err
+			}
+			regions := ag.Regions
+			if slices.Contains(regions, rotator.RegionsAuto) {
+				regions = nil
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(rotator.IAMPolicy(policy.options(flags, regions)))
+		},
+	}
+	policy.register(cmd)
+	return cmd
+}
+
+func newDoctorCmd(flags *globalFlags) *cobra.Command {
+	var policy policyFlags
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that the AWS credentials have the permissions rotator needs",
+		Long: `Exercise every permission of iam-policy with a harmless call in every region
+and account, and report those that are missing. Nothing is created, changed or
+deleted: the calls target resources that do not exist.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return fmt.Errorf("doctor cannot run with --dry-run")
+			}
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+			checks, err := ag.Doctor(cmd.Context(), policy.options(flags, ag.Regions))
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ACCOUNT\tREGION\tPERMISSION\tSTATUS")
+			failed := 0
+			for _, c := range checks {
+				account, region := c.Account, c.Region
+				if account == "" {
+					account = "default"
+				}
+				if region == "" {
+					region = "-"
+				}
+				if c.Err != nil {
+					failed++
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", account, region, c.Permission, c)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d permission checks failed, see rotator iam-policy for the policy to attach", failed, len(checks))
+			}
+			return nil
+		},
+	}
+	policy.register(cmd)
+	return cmd
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newJanitorCmd(flags *globalFlags) *cobra.Command {
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "janitor",
+		Short: "Delete gateways whose TTL expired, once or periodically",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			janitor := rotator.NewJanitor(ag)
+			if interval > 0 {
+				janitor.Interval = interval
+				janitor.Run(cmd.Context())
+				return nil
+			}
+
+			deleted, err := janitor.Sweep(cmd.Context())
+			for _, d := range deleted {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%s\n", d.Region, d.ID, d.Provider)
+			}
+			return err
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", 0, "keep running and sweep at this interval instead of once")
+	return cmd
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newListCmd(flags *globalFlags) *cobra.Command {
+	var (
+		output string
+		owned  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the REST APIs in every region",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q, want table or json", output)
+			}
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			var filters []rotator.GatewayFilter
+			if owned {
+				filters = append(filters, rotator.OwnedGateways)
+			}
+			// print what could be listed even if some regions failed
+			infos, listErr := ag.ListAll(cmd.Context(), filters...)
+
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if infos == nil {
+					infos = []rotator.GatewayInfo{}
+				}
+				if err := enc.Encode(infos); err != nil {
+					return err
+				}
+				return listErr
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REGION\tID\tNAME\tTARGET\tCREATED\tENDPOINT")
+			for _, info := range infos {
+				target := info.Target
+				if target == "" {
+					target = "-"
+				}
+				created := "-"
+				if !info.CreatedAt.IsZero() {
+					created = info.CreatedAt.UTC().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Region, info.ID, info.Name, target, created, info.Endpoint)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return listErr
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	cmd.Flags().BoolVar(&owned, "owned", false, "only list the REST APIs created by rotator")
+	return cmd
+}
@@ -0,0 +1,12 @@
+// Command rotator manages API Gateway proxy pools from the command line.
+package main
+
+import (
+	"os"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newNukeCmd(flags *globalFlags) *cobra.Command {
+	var all, execute, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "nuke",
+		Short: "Delete every REST API created by rotator in every region",
+		Long: `Delete every REST API created by rotator, in every region unless --regions
+is given. Nothing is deleted by default: nuke shows the APIs it would delete.
+With --execute it asks to type a confirmation phrase first, --yes deletes
+without asking.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ag, err := flags.gateway(cmd.Context(), "", rotator.WithRegions("all"))
+			if err != nil {
+				return err
+			}
+
+			filter := rotator.OwnedGateways
+			if all {
+				filter = rotator.AllGateways
+			}
+			infos, listErr := ag.ListAll(cmd.Context(), filter)
+			if listErr != nil {
+				// a partial plan is not what the user would confirm
+				return fmt.Errorf("cannot list the APIs to delete: %w", listErr)
+			}
+			if len(infos) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "nothing to delete")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REGION\tID\tNAME\tTARGET")
+			for _, info := range infos {
+				target := info.Target
+				if target == "" {
+					target = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Region, info.ID, info.Name, target)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if !execute && !yes {
+				fmt.Fprintf(cmd.ErrOrStderr(), "dry run: %d REST APIs would be deleted, run again with --execute to delete them\n", len(infos))
+				return nil
+			}
+			if !yes {
+				phrase := fmt.Sprintf("delete %d apis", len(infos))
+				fmt.Fprintf(cmd.ErrOrStderr(), "type %q to delete these REST APIs: ", phrase)
+				line, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if strings.TrimSpace(line) != phrase {
+					return errors.New("not confirmed, nothing was deleted")
+				}
+			}
+
+			// delete exactly the APIs shown, not those created since
+			planned := make(map[string]bool, len(infos))
+			for _, info := range infos {
+				planned[info.ID] = true
+			}
+			var mu sync.Mutex
+			results, err := ag.DeleteAll(cmd.Context(), rotator.DeleteOptions{
+				SharedApis: true,
+				Filters: []rotator.GatewayFilter{filter, func(api types.RestApi) bool {
+					return planned[aws.ToString(api.Id)]
+				}},
+				Progress: func(region, id string, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\tfailed: %s\n", region, id, err)
+						return
+					}
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s\t%s\tdeleted\n", region, id)
+				},
+			})
+			deleted := 0
+			for _, r := range results {
+				deleted += len(r.Deleted)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "%d of %d REST APIs deleted\n", deleted, len(infos))
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "delete every REST API of the regions, not only those created by rotator")
+	cmd.Flags().BoolVar(&execute, "execute", false, "delete the APIs after typing the confirmation phrase")
+	cmd.Flags().BoolVar(&yes, "yes", false, "delete the APIs without asking for confirmation")
+	return cmd
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/provider/cloudflare"
+	"github.com/mductran/apigateway-rotator/pkg/proxy"
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newProxyCmd(flags *globalFlags) *cobra.Command {
+	var listen, socksListen, strategy, site string
+	var sticky, healthInterval, maxLatency time.Duration
+	var replaceAfter int
+	var create, cleanup bool
+	var xff string
+	var xffSession time.Duration
+	var xffEvery int
+	var auth proxyAuth
+	var mitm mitmFlags
+	var userAgents string
+	var userAgentSession time.Duration
+	var keepAWSHeaders, rawResponses bool
+	var retries int
+	var retryStatus []int
+	var breakerThreshold int
+	var breakerCooldown time.Duration
+	var detectBans, printStats bool
+	var longRunningDirect, upgradeDirect bool
+	var budget rotator.Budget
+	var conns rotator.ConnPool
+	var hedgeAfter time.Duration
+	var fallback string
+	var fallbackWait time.Duration
+	var endpointRate, hostRate float64
+	var endpointBurst, hostBurst int
+	var rateLimit string
+	var jitter []time.Duration
+	var pace time.Duration
+	var auditPath string
+	var auditHeaders bool
+	var record, replay string
+	var cache string
+	var cacheSize int64
+	var cacheTTL time.Duration
+	var autoscaleMax int
+	var autoscaleRate float64
+	var autoscaleGrace time.Duration
+	var minEndpoints int
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Serve a local HTTP proxy that forwards requests through the gateways",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return errors.New("--dry-run cannot proxy requests through gateways it does not create")
+			}
+			ips, err := rotator.ParseIPGenerator(xff)
+			if err != nil {
+				return err
+			}
+			if xffEvery > 1 {
+				ips = rotator.RotateEvery(ips, xffEvery)
+			}
+			if xffSession > 0 {
+				ips = rotator.NewSessionIPs(ips, xffSession)
+			}
+			opts := []rotator.Option{
+				rotator.WithIPGenerator(ips),
+				rotator.WithStickySessions(sticky),
+				rotator.WithAWSHeaders(keepAWSHeaders),
+				rotator.WithResponseRewriting(!rawResponses),
+				rotator.WithConnPool(conns),
+			}
+			switch userAgents {
+			case "":
+			case "builtin":
+				opts = append(opts, rotator.WithUserAgents(rotator.NewUserAgentRotator(userAgentSession)))
+			default:
+				agents, err := rotator.LoadUserAgents(userAgents)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, rotator.WithUserAgents(rotator.NewUserAgentRotator(userAgentSession, agents...)))
+			}
+			// without --strategy the strategy of the config file is used
+			if cmd.Flags().Changed("strategy") {
+				selector, err := rotator.NewSelector(strategy)
+				if err != nil {
+					return err
+				}
+				if strategy == rotator.StrategyLatency {
+					selector = rotator.NewLatencySelector(maxLatency)
+				}
+				opts = append(opts, rotator.WithSelector(selector))
+			}
+			if retries > 0 {
+				policy := rotator.DefaultRetryPolicy
+				policy.MaxAttempts = retries + 1
+				policy.StatusCodes = retryStatus
+				opts = append(opts, rotator.WithRetry(policy))
+			}
+			if detectBans {
+				opts = append(opts, rotator.WithBanDetection())
+			}
+			if longRunningDirect {
+				opts = append(opts, rotator.WithLongRunningFallback())
+			}
+			if fallback != "" {
+				opts = append(opts, rotator.WithFallback(rotator.FallbackPolicy(fallback), fallbackWait))
+			}
+			if endpointRate > 0 {
+				opts = append(opts, rotator.WithEndpointRateLimit(endpointRate, endpointBurst))
+			}
+			if hostRate > 0 {
+				opts = append(opts, rotator.WithHostRateLimit(hostRate, hostBurst))
+			}
+			opts = append(opts, rotator.WithRateLimitPolicy(rotator.RateLimitPolicy(rateLimit)))
+			switch len(jitter) {
+			case 0:
+			case 1:
+				opts = append(opts, rotator.WithJitter(0, jitter[0]))
+			case 2:
+				opts = append(opts, rotator.WithJitter(jitter[0], jitter[1]))
+			default:
+				return errors.New("--jitter takes a maximum delay or min,max")
+			}
+			if pace > 0 {
+				opts = append(opts, rotator.WithPace(pace))
+			}
+			switch cache {
+			case "":
+			case "memory":
+				opts = append(opts, rotator.WithCache(rotator.NewMemoryCache(cacheSize<<20), cacheTTL))
+			default:
+				disk, err := rotator.NewDiskCache(cache)
+				if err != nil {
+					return fmt.Errorf("cannot open cache: %w", err)
+				}
+				opts = append(opts, rotator.WithCache(disk, cacheTTL))
+			}
+			switch auditPath {
+			case "":
+			case "-":
+				opts = append(opts, rotator.WithAuditLog(cmd.OutOrStdout(), auditHeaders))
+			default:
+				audit, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+				if err != nil {
+					return fmt.Errorf("cannot open audit log: %w", err)
+				}
+				defer audit.Close()
+				opts = append(opts, rotator.WithAuditLog(audit, auditHeaders))
+			}
+			if hedgeAfter > 0 {
+				opts = append(opts, rotator.WithHedging(hedgeAfter))
+			}
+			if upgradeDirect {
+				opts = append(opts, rotator.WithUpgradeDirect())
+			}
+			if breakerThreshold > 0 {
+				opts = append(opts, rotator.WithCircuitBreaker(breakerThreshold, breakerCooldown))
+			}
+			if budget.Limit > 0 {
+				opts = append(opts, rotator.WithBudget(budget))
+			}
+			policy, err := flags.hostPolicy()
+			if err != nil {
+				return err
+			}
+			// without --site every allowed host gets its own pool
+			perHost := site == "" && len(policy.Allow) > 0
+			if replaceAfter > 0 {
+				if site == "" && !perHost {
+					return errors.New("--replace-after needs --site or --allow-host to create replacement gateways")
+				}
+				opts = append(opts, rotator.WithAutoReplace(replaceAfter))
+			}
+			if create && site == "" {
+				return errors.New("--create needs --site")
+			}
+			if autoscaleMax > 0 && site == "" {
+				return errors.New("--autoscale-max needs --site")
+			}
+			if minEndpoints > 0 && site == "" {
+				return errors.New("--min-endpoints needs --site")
+			}
+			authenticator, err := auth.authenticator()
+			if err != nil {
+				return err
+			}
+			ca, err := mitm.ca(cmd)
+			if err != nil {
+				return err
+			}
+
+			// serve runs the proxy listeners until ctx is done
+			serve := func(ctx context.Context, transport http.RoundTripper) (err error) {
+				if record != "" {
+					recorder, err := proxy.NewRecorder(transport, record)
+					if err != nil {
+						return err
+					}
+					defer func() { err = errors.Join(err, recorder.Close()) }()
+					transport = recorder
+				}
+				errs := make(chan error, 2)
+				server := proxy.NewServer(listen, transport)
+				server.Auth = authenticator
+				server.MITM = ca
+				go func() { errs <- server.ListenAndServe() }()
+				socks := proxy.NewSOCKS5Server(socksListen, transport)
+				socks.Auth = authenticator
+				socks.MITM = ca
+				if socksListen != "" {
+					go func() { errs <- socks.ListenAndServe() }()
+					fmt.Fprintf(cmd.OutOrStdout(), "socks5 proxy on %s\n", socksListen)
+				}
+
+				select {
+				case err := <-errs:
+					return err
+				case <-ctx.Done():
+				}
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				err = errors.Join(server.Shutdown(shutdownCtx), socks.Close())
+				if errors.Is(err, http.ErrServerClosed) {
+					err = nil
+				}
+				return err
+			}
+
+			// a replay needs no gateway, nor AWS
+			if replay != "" {
+				replayer, err := proxy.LoadReplayer(replay)
+				if err != nil {
+					return err
+				}
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				fmt.Fprintf(cmd.OutOrStdout(), "replaying %d responses on %s\n", replayer.Len(), listen)
+				return serve(ctx, replayer)
+			}
+
+			if perHost {
+				return serveManager(cmd, flags, opts, policy, managerSettings{
+					healthInterval: healthInterval,
+					cleanup:        cleanup,
+					printStats:     printStats,
+					listen:         listen,
+				}, serve)
+			}
+
+			ag, err := flags.gateway(cmd.Context(), site, opts...)
+			if err != nil {
+				return err
+			}
+
+			loaded, err := flags.loadState(cmd.Context(), ag)
+			if err != nil {
+				return err
+			}
+			switch {
+			case create:
+				if err := ag.InitializeAll(cmd.Context()); err != nil {
+					if !cleanup {
+						return err
+					}
+					return errors.Join(err, teardown(cmd, ag))
+				}
+			case !loaded:
+				if err := ag.Discover(cmd.Context()); err != nil {
+					return err
+				}
+			}
+			if cf := flags.cloudflare(ag.Site); cf != nil {
+				if err := ag.DiscoverWith(cf, cmd.Context(), cloudflare.Region); err != nil {
+					return err
+				}
+			}
+			if ag.Endpoints.Len() == 0 {
+				return fmt.Errorf("no gateways named %s found, run rotator create first", flags.name)
+			}
+
+			if printStats {
+				defer func() { writeStats(cmd.ErrOrStderr(), ag) }()
+			}
+
+			servePool := func(ctx context.Context) error {
+				if healthInterval > 0 {
+					checker := rotator.NewHealthChecker(ag)
+					checker.Interval = healthInterval
+					go checker.Run(ctx)
+				} else if strategy == rotator.StrategyLatency {
+					// without health checks the latency is only measured once
+					ag.ProbeLatency(ctx)
+				}
+				if autoscaleMax > 0 {
+					scaler := rotator.NewAutoscaler(ag, autoscaleMax)
+					scaler.RequestsPerEndpoint = autoscaleRate
+					scaler.GracePeriod = autoscaleGrace
+					go scaler.Run(ctx)
+				}
+				if minEndpoints > 0 {
+					go rotator.NewReconciler(ag, minEndpoints).Run(ctx)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "proxying %d endpoints on %s\n", ag.Endpoints.Len(), listen)
+				return serve(ctx, ag.Transport())
+			}
+
+			if !cleanup {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return servePool(ctx)
+			}
+			err = rotator.NewLifecycle(ag).Run(cmd.Context(), servePool)
+			return errors.Join(err, flags.saveState(context.Background(), ag))
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "address to listen on")
+	cmd.Flags().StringVar(&site, "site", "", "target site of the gateways, needed to create replacements")
+	cmd.Flags().StringVar(&strategy, "strategy", rotator.StrategyRandom, "endpoint selection strategy: round-robin, random, lru, weighted or latency")
+	cmd.Flags().DurationVar(&maxLatency, "max-latency", 0, "with --strategy latency, leave out the regions further than this round-trip time while others are closer")
+	cmd.Flags().DurationVar(&sticky, "sticky", 0, "pin each host and "+rotator.SessionHeader+" session to one endpoint for this long")
+	cmd.Flags().DurationVar(&healthInterval, "health-interval", rotator.DefaultHealthInterval, "interval between endpoint health checks, 0 disables them")
+	cmd.Flags().IntVar(&replaceAfter, "replace-after", 0, "replace an endpoint after this many 403/429 responses in a row, 0 disables it")
+	cmd.Flags().StringVar(&socksListen, "socks-listen", "", "also serve a SOCKS5 proxy on this address")
+	auth.register(cmd)
+	mitm.register(cmd)
+	cmd.Flags().StringVar(&xff, "xff", "public", "X-Forwarded-For spoofing: off, public, public6, mixed:<IPv6 ratio>, fixed:<ip> or cidr:<network>,...")
+	cmd.Flags().DurationVar(&xffSession, "xff-session", 0, "keep the spoofed address of each "+rotator.SessionHeader+" session until it is idle this long")
+	cmd.Flags().IntVar(&xffEvery, "xff-rotate-every", 1, "keep the spoofed address for this many requests before changing it")
+	cmd.Flags().StringVar(&userAgents, "user-agents", "", "rotate the User-Agent of requests: builtin, or a file with one user agent per line")
+	cmd.Flags().DurationVar(&userAgentSession, "user-agent-session", 30*time.Minute, "keep the user agent of each "+rotator.SessionHeader+" session until it is idle this long")
+	cmd.Flags().BoolVar(&keepAWSHeaders, "keep-aws-headers", false, "keep the x-amzn-* and CloudFront headers the gateways add to responses")
+	cmd.Flags().BoolVar(&rawResponses, "no-rewrite", false, "pass Location and Set-Cookie headers through without mapping them back to the requested host")
+	cmd.Flags().IntVar(&retries, "retries", 0, "send failed requests again through other endpoints up to this many times")
+	cmd.Flags().IntSliceVar(&retryStatus, "retry-status", rotator.DefaultRetryPolicy.StatusCodes, "response status codes that are retried")
+	cmd.Flags().IntVar(&breakerThreshold, "breaker-threshold", 0, "stop using an endpoint after this many failed requests in a row, 0 disables it")
+	cmd.Flags().DurationVar(&breakerCooldown, "breaker-cooldown", rotator.DefaultBreakerCooldown, "how long a tripped endpoint is left out before it is probed again")
+	cmd.Flags().BoolVar(&detectBans, "detect-bans", false, "treat Cloudflare and Akamai block pages and CAPTCHAs as failures of the endpoint")
+	cmd.Flags().Float64Var(&budget.Limit, "budget", 0, "refuse requests once their estimated cost reaches this many USD per --budget-period, for each pool; 0 disables it")
+	cmd.Flags().DurationVar(&budget.Period, "budget-period", rotator.DefaultBudgetPeriod, "period of --budget, starting over at multiples of it since midnight UTC")
+	cmd.Flags().BoolVar(&budget.Direct, "budget-direct", false, "send the requests over --budget directly to their destination instead of refusing them")
+	cmd.Flags().BoolVar(&longRunningDirect, "long-running-direct", false, "send requests with the "+rotator.LongRunningHeader+" header directly to their destination when a gateway times out on them after 29s")
+	cmd.Flags().StringVar(&fallback, "fallback", string(rotator.FallbackFail), "what to do with requests when no endpoint is available: fail, wait for one up to --fallback-wait, or direct to send them bypassing the gateways")
+	cmd.Flags().DurationVar(&fallbackWait, "fallback-wait", rotator.DefaultFallbackWait, "how long --fallback wait holds requests for an endpoint")
+	cmd.Flags().Float64Var(&endpointRate, "endpoint-rate", 0, "requests per second sent through each endpoint, 0 disables the limit")
+	cmd.Flags().IntVar(&endpointBurst, "endpoint-burst", 1, "requests sent at once through an endpoint under --endpoint-rate")
+	cmd.Flags().Float64Var(&hostRate, "host-rate", 0, "requests per second sent to each host of the site, 0 disables the limit")
+	cmd.Flags().IntVar(&hostBurst, "host-burst", 1, "requests sent at once to a host under --host-rate")
+	cmd.Flags().DurationSliceVar(&jitter, "jitter", nil, "delay every request by a random time up to this, or between min,max, e.g. 100ms,2s")
+	cmd.Flags().DurationVar(&pace, "pace", 0, "space the requests sent through the pool by at least this, 0 disables it")
+	cmd.Flags().StringVar(&cache, "cache", "", "answer repeated GET requests from a cache while the site says they are fresh: memory, or a directory to keep them in")
+	cmd.Flags().Int64Var(&cacheSize, "cache-size", rotator.DefaultCacheSize>>20, "megabytes of responses --cache memory keeps")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "how long --cache keeps the responses the site gives no freshness for, 0 to not cache them")
+	cmd.Flags().StringVar(&record, "record", "", "record the requests and responses to this file, a HAR document if it ends in .har and a HAR entry per line otherwise")
+	cmd.Flags().StringVar(&replay, "replay", "", "answer requests with the responses recorded in this file by --record or in a HAR file, without creating or using any gateway")
+	cmd.Flags().StringVar(&auditPath, "audit-log", "", "append a JSON line for every request sent to the site to this file, - for stdout")
+	cmd.Flags().BoolVar(&auditHeaders, "audit-headers", false, "record the request headers in --audit-log, credentials and cookies redacted")
+	cmd.Flags().StringVar(&rateLimit, "rate-limit", string(rotator.RateLimitWait), "what to do with requests over --endpoint-rate or --host-rate: wait, or shed them")
+	cmd.Flags().DurationVar(&hedgeAfter, "hedge-after", 0, "send GET and HEAD requests again through a second endpoint when the first did not answer within this long, 0 disables it")
+	cmd.Flags().BoolVar(&upgradeDirect, "upgrade-direct", false, "send WebSocket handshakes and other upgrade requests directly to their destination when no endpoint can upgrade connections")
+	cmd.Flags().IntVar(&conns.MaxIdlePerHost, "max-idle-per-host", rotator.DefaultConnPool.MaxIdlePerHost, "idle connections kept open to each endpoint")
+	cmd.Flags().DurationVar(&conns.IdleTimeout, "idle-timeout", rotator.DefaultConnPool.IdleTimeout, "close connections to endpoints left idle for longer, 0 keeps them")
+	cmd.Flags().IntVar(&conns.TLSSessions, "tls-sessions", rotator.DefaultConnPool.TLSSessions, "TLS sessions cached to resume handshakes with endpoints, 0 disables resumption")
+	cmd.Flags().BoolVar(&conns.DisableHTTP2, "no-http2", false, "keep connections to endpoints on HTTP/1.1 instead of negotiating HTTP/2")
+	cmd.Flags().DurationVar(&conns.DNSCacheTTL, "dns-cache-ttl", rotator.DefaultConnPool.DNSCacheTTL, "reuse the resolved addresses of endpoints for this long, 0 resolves them for every connection")
+	cmd.Flags().BoolVar(&conns.ParallelDial, "parallel-dial", false, "race the addresses of endpoints, IPv6 and IPv4, instead of dialing them in turn")
+	cmd.Flags().IntVar(&autoscaleMax, "autoscale-max", 0, "create more gateways, up to this many endpoints, while the traffic is sustained or throttled and delete them once it is idle; 0 disables it")
+	cmd.Flags().Float64Var(&autoscaleRate, "autoscale-rate", rotator.DefaultRequestsPerEndpoint, "requests per second and endpoint --autoscale-max scales up over")
+	cmd.Flags().DurationVar(&autoscaleGrace, "autoscale-grace", rotator.DefaultScaleGrace, "how long the traffic has to be idle before a gateway added by --autoscale-max is deleted")
+	cmd.Flags().IntVar(&minEndpoints, "min-endpoints", 0, "create gateways whenever fewer endpoints than this are available, 0 disables it")
+	cmd.Flags().BoolVar(&printStats, "stats", false, "print the requests, errors and latency of every endpoint on exit")
+	cmd.Flags().BoolVar(&create, "create", false, "create the gateways for --site on startup instead of using existing ones")
+	cmd.Flags().BoolVar(&cleanup, "cleanup-on-exit", false, "delete the gateways created by this process on exit or SIGINT/SIGTERM")
+	return cmd
+}
+
+// proxyAuth are the flags of the proxy credentials.
+type proxyAuth struct {
+	credentials []string
+	usersPath   string
+}
+
+func (a *proxyAuth) register(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&a.credentials, "auth", nil, "require proxy clients to authenticate as user:password; can be repeated")
+	cmd.Flags().StringVar(&a.usersPath, "auth-users", "", "YAML file of the users allowed to use the proxy, with passwords or tokens and rate limits")
+}
+
+// authenticator returns the authenticator of the proxy, nil when clients
+// need no credentials.
+func (a *proxyAuth) authenticator() (*proxy.Authenticator, error) {
+	var users []proxy.User
+	for _, c := range a.credentials {
+		u, err := proxy.ParseUser(c)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if a.usersPath != "" {
+		loaded, err := proxy.LoadUsers(a.usersPath)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, loaded...)
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return proxy.NewAuthenticator(users...), nil
+}
+
+// mitmFlags are the flags of the interception of HTTPS tunnels.
+type mitmFlags struct {
+	enabled bool
+	dir     string
+}
+
+func (m *mitmFlags) register(cmd *cobra.Command) {
+	dir := ""
+	if config, err := os.UserConfigDir(); err == nil {
+		dir = filepath.Join(config, "rotator", "ca")
+	}
+	cmd.Flags().BoolVar(&m.enabled, "mitm", false, "accept CONNECT and intercept HTTPS with a local CA, so that HTTPS requests go through the gateways too")
+	cmd.Flags().StringVar(&m.dir, "mitm-ca", dir, "directory of the CA used by --mitm, created on first use")
+}
+
+// ca returns the CA of --mitm, nil when HTTPS is not intercepted.
+func (m *mitmFlags) ca(cmd *cobra.Command) (*proxy.CA, error) {
+	if !m.enabled {
+		return nil, nil
+	}
+	if m.dir == "" {
+		return nil, errors.New("--mitm needs --mitm-ca")
+	}
+	ca, err := proxy.LoadCA(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "intercepting HTTPS, clients must trust %s\n", filepath.Join(m.dir, proxy.CACertFile))
+	return ca, nil
+}
+
+// managerSettings are the proxy flags serveManager needs.
+type managerSettings struct {
+	healthInterval time.Duration
+	cleanup        bool
+	printStats     bool
+	listen         string
+}
+
+// serveManager runs the proxy with a pool per destination host, set up on
+// the first request to each host policy allows.
+func serveManager(cmd *cobra.Command, flags *globalFlags, opts []rotator.Option, policy rotator.HostPolicy, s managerSettings, serve func(context.Context, http.RoundTripper) error) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the gateways of each host get their own name so that the pools of
+	// different hosts never pick up each other's gateways
+	factory := func(site string) (*rotator.ApiGateway, error) {
+		host := strings.NewReplacer("://", "-", ":", "-").Replace(site)
+		return flags.gatewayNamed(ctx, flags.name+"-"+host, site, opts...)
+	}
+	manager := rotator.NewManager(ctx, factory, policy)
+	manager.HealthInterval = s.healthInterval
+
+	fmt.Fprintf(cmd.OutOrStdout(), "proxying %s on %s\n", strings.Join(policy.Allow, ", "), s.listen)
+	err := serve(ctx, manager)
+	if s.printStats {
+		for _, ag := range manager.Pools() {
+			fmt.Fprintln(cmd.ErrOrStderr(), ag.CurrentSite())
+			writeStats(cmd.ErrOrStderr(), ag)
+		}
+	}
+	if s.cleanup {
+		report := manager.Teardown(context.Background())
+		if len(report.Failed) > 0 {
+			err = errors.Join(err, &rotator.TeardownError{Report: report})
+		}
+	}
+	return err
+}
+
+// writeStats prints the requests sent through each endpoint and region of ag
+// and their estimated cost.
+func writeStats(out io.Writer, ag *rotator.ApiGateway) {
+	stats := ag.Stats()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tENDPOINT\tREQUESTS\tERRORS\tTHROTTLED\tMEAN\tP95")
+	for _, e := range stats.Endpoints {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\n", e.Region, e.Endpoint, e.Requests, e.Errors, e.Throttled, e.Latency.Mean().Round(time.Millisecond), e.Latency.Quantile(0.95))
+	}
+	for _, r := range stats.Regions {
+		fmt.Fprintf(w, "%s\t*\t%d\t%d\t%d\t%s\t%s\n", r.Region, r.Requests, r.Errors, r.Throttled, r.Latency.Mean().Round(time.Millisecond), r.Latency.Quantile(0.95))
+	}
+	cost := ag.SessionCost(rotator.DefaultPricing)
+	fmt.Fprintf(w, "\n%d requests, %.1f MB, about $%.4f\n", stats.Requests, float64(stats.Bytes)/1e6, cost.Total)
+	w.Flush()
+}
+
+// teardown deletes the gateways created so far by ag. The error lists the
+// ones that are left.
+func teardown(cmd *cobra.Command, ag *rotator.ApiGateway) error {
+	report := rotator.NewLifecycle(ag).Teardown(cmd.Context())
+	if len(report.Failed) == 0 {
+		return nil
+	}
+	return &rotator.TeardownError{Report: report}
+}
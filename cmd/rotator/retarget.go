@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/provider/cloudflare"
+)
+
+func newRetargetCmd(flags *globalFlags) *cobra.Command {
+	var (
+		site         string
+		variableOnly bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "retarget",
+		Short: "Point the existing gateways at another site without recreating them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ag, err := flags.gateway(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+			loaded, err := flags.loadState(cmd.Context(), ag)
+			if err != nil {
+				return err
+			}
+			if !loaded {
+				if err := ag.Discover(cmd.Context()); err != nil {
+					return err
+				}
+			}
+			if cf := flags.cloudflare(ag.Site); cf != nil {
+				if err := ag.DiscoverWith(cf, cmd.Context(), cloudflare.Region); err != nil {
+					return err
+				}
+			}
+			if ag.Endpoints.Len() == 0 {
+				return fmt.Errorf("no gateways named %s found", flags.name)
+			}
+
+			if variableOnly {
+				err = ag.SetTarget(cmd.Context(), site)
+			} else {
+				err = ag.Retarget(cmd.Context(), site)
+			}
+			if err == nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "%d gateways now proxy to %s\n", ag.Endpoints.Len(), ag.CurrentSite())
+			}
+			return errors.Join(err, flags.saveState(cmd.Context(), ag))
+		},
+	}
+	cmd.Flags().StringVar(&site, "site", "", "new target site, e.g. https://example.org")
+	cmd.Flags().BoolVar(&variableOnly, "stage-variable", false, "only change the stage variable the gateways read the site from: applies within seconds, but keeps the scheme and fails for gateways that do not use it yet")
+	cmd.MarkFlagRequired("site")
+	return cmd
+}
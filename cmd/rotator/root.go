@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/provider/cloudflare"
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// globalFlags are shared by every subcommand.
+type globalFlags struct {
+	name        string
+	regions     []string
+	configPath  string
+	logLevel    string
+	dumpHeaders bool
+	backend     string
+
+	profile    string
+	roleARN    string
+	externalID string
+	endpoint   string
+
+	stage         string
+	randomNames   bool
+	nameTemplate  string
+	stageTemplate string
+
+	cloudflareAccount string
+	statePath         string
+	otlpEndpoint      string
+
+	allowHosts []string
+	denyHosts  []string
+
+	awsRetries int
+	awsRate    float64
+	dryRun     bool
+
+	readyTimeout time.Duration
+	apiKey       bool
+	sourceIPs    []string
+	iamAuth      bool
+	webACLs      []string
+	domainZone   string
+	sharedApi    string
+	payload      string
+	geoTarget    string
+	geoRegions   int
+	excludes     []string
+	perRegion    int
+	webhooks     []string
+	slackHooks   []string
+
+	stopTracing func(context.Context) error
+	// notifiers are stopped once the command is done, sending the events left
+	mu        sync.Mutex
+	notifiers []func()
+	// clients is shared by every pool of the process
+	clients *rotator.ClientCache
+}
+
+func newRootCmd() *cobra.Command {
+	flags := &globalFlags{clients: rotator.NewClientCache()}
+
+	cmd := &cobra.Command{
+		Use:          "rotator",
+		Short:        "Rotate requests through AWS API Gateway proxies",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			stop, err := setupTracing(cmd.Context(), flags.otlpEndpoint)
+			flags.stopTracing = stop
+			return err
+		},
+	}
+	// flush the spans whether or not the command failed
+	cobra.OnFinalize(func() {
+		if flags.stopTracing != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			flags.stopTracing(ctx)
+		}
+		flags.mu.Lock()
+		defer flags.mu.Unlock()
+		for _, stop := range flags.notifiers {
+			stop()
+		}
+	})
+	cmd.PersistentFlags().StringVar(&flags.name, "name", "apigateway-rotator", "name of the REST APIs managed by rotator")
+	cmd.PersistentFlags().StringSliceVar(&flags.regions, "regions", nil, "comma separated list of regions and region sets (us, eu, apac, all...) or auto for the enabled regions of the account, defaults to $"+rotator.RegionsEnv+", the config file or "+strings.Join(rotator.DefaultRegions, ","))
+	cmd.PersistentFlags().StringVar(&flags.configPath, "config", rotator.DefaultConfigPath(), "YAML config file with regions, region_sets and accounts")
+	cmd.PersistentFlags().StringVar(&flags.backend, "backend", string(rotator.BackendREST), "kind of API gateways to manage: rest or http")
+	cmd.PersistentFlags().StringVar(&flags.profile, "profile", "", "AWS profile to use instead of the default credential chain")
+	cmd.PersistentFlags().StringVar(&flags.roleARN, "role-arn", "", "IAM role to assume for every AWS call")
+	cmd.PersistentFlags().StringVar(&flags.externalID, "external-id", "", "external id required by --role-arn")
+	cmd.PersistentFlags().IntVar(&flags.awsRetries, "aws-retries", rotator.DefaultAWSMaxAttempts, "attempts of every AWS API call, throttled calls are retried with an adaptive backoff")
+	cmd.PersistentFlags().Float64Var(&flags.awsRate, "aws-rate", rotator.DefaultAWSRate, "AWS API calls per second in each account and region, 0 for no limit")
+	cmd.PersistentFlags().BoolVar(&flags.dryRun, "dry-run", false, "log the AWS calls that would create, change or delete resources instead of making them")
+	cmd.PersistentFlags().DurationVar(&flags.readyTimeout, "ready-timeout", rotator.DefaultReadyTimeout, "how long new gateways are probed until they answer before requests are sent through them, 0 to not wait")
+	cmd.PersistentFlags().BoolVar(&flags.apiKey, "api-key", false, "require an API key on new REST APIs and send it with every request, so that their URLs cannot be used by others")
+	cmd.PersistentFlags().StringSliceVar(&flags.sourceIPs, "allow-source-ip", nil, "only let these IPs or CIDR blocks invoke new REST APIs, auto for the public IP of this machine")
+	cmd.PersistentFlags().BoolVar(&flags.iamAuth, "iam-auth", false, "require IAM authorization on new REST APIs and sign every request with SigV4 using the AWS credentials")
+	cmd.PersistentFlags().StringSliceVar(&flags.webACLs, "web-acl", nil, "associate the stage of new REST APIs with this WAF web ACL, by ARN or by name in every region")
+	cmd.PersistentFlags().StringVar(&flags.sharedApi, "shared-api", "", "deploy the gateways as stages of the REST APIs of this name shared with other pools, one per region")
+	cmd.PersistentFlags().StringVar(&flags.domainZone, "custom-domain", "", "give new REST APIs a custom domain name in this Route 53 hosted zone and disable their execute-api endpoint")
+	cmd.PersistentFlags().StringVar(&flags.payload, "oversized", string(rotator.PayloadReject), "what to do with payloads over the 10 MB API Gateway allows: reject, direct to send them bypassing the gateways, or ranged to also download GET responses in ranges")
+	cmd.PersistentFlags().StringSliceVar(&flags.excludes, "exclude-regions", nil, "leave these regions or region sets out of --regions")
+	cmd.PersistentFlags().IntVar(&flags.perRegion, "endpoints-per-region", 1, "number of gateways to create in every region")
+	cmd.PersistentFlags().StringArrayVar(&flags.webhooks, "webhook", nil, "post the lifecycle events of the pools as JSON to this URL; can be repeated")
+	cmd.PersistentFlags().StringArrayVar(&flags.slackHooks, "slack-webhook", nil, "post a summary of the lifecycle events of the pools to this Slack incoming webhook; can be repeated")
+	cmd.PersistentFlags().StringVar(&flags.geoTarget, "geo-target", "", "only use the --geo-regions regions nearest to the site: auto to locate it by GeoIP, a country code, a region or latitude,longitude")
+	cmd.PersistentFlags().IntVar(&flags.geoRegions, "geo-regions", 3, "number of regions --geo-target keeps among --regions, 0 for all of them nearest first")
+	cmd.PersistentFlags().StringVar(&flags.endpoint, "endpoint-url", "", "send AWS API calls to this URL, e.g. http://localhost:4566 for LocalStack")
+	cmd.PersistentFlags().StringVar(&flags.stage, "stage", rotator.DefaultStageName, "stage of new REST APIs")
+	cmd.PersistentFlags().BoolVar(&flags.randomNames, "random-names", false, "give new APIs and stages random names from --name-template and --stage-template")
+	cmd.PersistentFlags().StringVar(&flags.nameTemplate, "name-template", rotator.DefaultNameTemplate, "template of random API names, with {word}, {env}, {hex} and {num} placeholders")
+	cmd.PersistentFlags().StringVar(&flags.stageTemplate, "stage-template", rotator.DefaultStageTemplate, "template of random stage names")
+	cmd.PersistentFlags().StringVar(&flags.cloudflareAccount, "cloudflare-account", "", "Cloudflare account id for Workers endpoints, the API token is read from CLOUDFLARE_API_TOKEN")
+	cmd.PersistentFlags().StringVar(&flags.statePath, "state", "", "where the pool is saved: a JSON file, s3://bucket/key or dynamodb://table/key")
+	cmd.PersistentFlags().StringVar(&flags.otlpEndpoint, "otlp-endpoint", "", "export traces over OTLP/HTTP to this URL, e.g. http://localhost:4318, defaults to $OTEL_EXPORTER_OTLP_ENDPOINT")
+	cmd.PersistentFlags().StringSliceVar(&flags.allowHosts, "allow-host", nil, "only create gateways for and proxy these destinations: example.com, *.example.com, IPs or CIDRs; proxy without --site sets up a pool for each allowed host")
+	cmd.PersistentFlags().StringSliceVar(&flags.denyHosts, "deny-host", nil, "never create gateways for or proxy these destinations, even if allowed")
+	cmd.PersistentFlags().StringVar(&flags.logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	cmd.PersistentFlags().BoolVar(&flags.dumpHeaders, "dump-headers", false, "log request headers at debug level")
+
+	cmd.AddCommand(
+		newCreateCmd(flags),
+		newListCmd(flags),
+		newExportCmd(flags),
+		newDeleteCmd(flags),
+		newNukeCmd(flags),
+		newCostCmd(flags),
+		newAlarmCmd(flags),
+		newIAMPolicyCmd(flags),
+		newDoctorCmd(flags),
+		newTestCmd(flags),
+		newProxyCmd(flags),
+		newFetchCmd(flags),
+		newCurlCmd(flags),
+		newJanitorCmd(flags),
+		newRetargetCmd(flags),
+		newServeCmd(flags),
+	)
+	return cmd
+}
+
+// gateway builds an ApiGateway for site from the global flags and opts. ctx
+// bounds the lookup of the enabled regions.
+func (f *globalFlags) gateway(ctx context.Context, site string, opts ...rotator.Option) (*rotator.ApiGateway, error) {
+	return f.gatewayNamed(ctx, f.name, site, opts...)
+}
+
+// gatewayNamed is gateway for the APIs named name instead of --name.
+func (f *globalFlags) gatewayNamed(ctx context.Context, name, site string, opts ...rotator.Option) (*rotator.ApiGateway, error) {
+	logger, err := f.logger()
+	if err != nil {
+		return nil, err
+	}
+	config, err := rotator.LoadConfig(f.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]rotator.Option{
+		rotator.WithClientCache(f.clients),
+		rotator.WithConfig(config),
+		rotator.WithLogger(logger),
+		rotator.WithHeaderDump(f.dumpHeaders),
+		rotator.WithBackend(rotator.Backend(f.backend)),
+		rotator.WithStageName(f.stage),
+		rotator.WithHostPolicy(rotator.HostPolicy{Allow: f.allowHosts, Deny: f.denyHosts}),
+		rotator.WithAWSRetries(f.awsRetries),
+		rotator.WithAWSRateLimit(f.awsRate, rotator.DefaultAWSBurst),
+		rotator.WithReadyTimeout(f.readyTimeout),
+		rotator.WithPayloadStrategy(rotator.PayloadStrategy(f.payload)),
+	}, opts...)
+	if f.profile != "" {
+		opts = append(opts, rotator.WithProfile(f.profile))
+	}
+	if f.endpoint != "" {
+		opts = append(opts, rotator.WithEndpointURL(f.endpoint))
+	}
+	if f.roleARN != "" {
+		opts = append(opts, rotator.WithAssumeRole(f.roleARN, f.externalID))
+	}
+	if f.dryRun {
+		opts = append(opts, rotator.WithDryRun())
+	}
+	if f.apiKey {
+		opts = append(opts, rotator.WithAPIKey())
+	}
+	if f.iamAuth {
+		opts = append(opts, rotator.WithIAMAuth())
+	}
+	if len(f.webACLs) > 0 {
+		opts = append(opts, rotator.WithWebACL(f.webACLs...))
+	}
+	if f.domainZone != "" {
+		opts = append(opts, rotator.WithCustomDomain(f.domainZone))
+	}
+	if f.sharedApi != "" {
+		opts = append(opts, rotator.WithSharedApi(f.sharedApi))
+	}
+	if len(f.sourceIPs) > 0 {
+		sourceIPs, err := f.resolveSourceIPs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, rotator.WithSourceIPs(sourceIPs...))
+	}
+	if len(f.regions) > 0 {
+		opts = append(opts, rotator.WithRegions(f.regions...))
+	}
+	if f.randomNames {
+		opts = append(opts, rotator.WithRandomNames(f.nameTemplate, f.stageTemplate))
+	}
+	if len(f.excludes) > 0 {
+		opts = append(opts, rotator.WithExcludeRegions(f.excludes...))
+	}
+	if f.perRegion > 1 {
+		opts = append(opts, rotator.WithEndpointsPerRegion(f.perRegion))
+	}
+	if f.geoTarget != "" {
+		opts = append(opts, rotator.WithGeoTarget(f.geoTarget, f.geoRegions))
+	}
+	ag, err := rotator.NewApiGateway(site, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ag.ResolveAutoRegions(ctx); err != nil {
+		return nil, err
+	}
+	f.notify(ctx, ag)
+	return ag, nil
+}
+
+// notify posts the events of ag to --webhook and --slack-webhook until the
+// command is done.
+func (f *globalFlags) notify(ctx context.Context, ag *rotator.ApiGateway) {
+	var webhooks []*rotator.Webhook
+	for _, url := range f.webhooks {
+		webhooks = append(webhooks, &rotator.Webhook{URL: url, Format: rotator.WebhookJSON})
+	}
+	for _, url := range f.slackHooks {
+		webhooks = append(webhooks, &rotator.Webhook{URL: url, Format: rotator.WebhookSlack})
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	// the teardown after a signal is notified too
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	events := ag.Subscribe(ctx, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rotator.NewNotifier(ag, webhooks...).Deliver(ctx, events)
+	}()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notifiers = append(f.notifiers, func() {
+		cancel()
+		<-done
+	})
+}
+
+// resolveSourceIPs returns --allow-source-ip with auto replaced by the
+// public IP of this machine.
+func (f *globalFlags) resolveSourceIPs(ctx context.Context) ([]string, error) {
+	sourceIPs := make([]string, 0, len(f.sourceIPs))
+	for _, ip := range f.sourceIPs {
+		if ip != "auto" {
+			sourceIPs = append(sourceIPs, ip)
+			continue
+		}
+		egress, err := rotator.EgressIP(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sourceIPs = append(sourceIPs, egress.String())
+	}
+	return sourceIPs, nil
+}
+
+// hostPolicy returns the host policy of the config file and the
+// --allow-host and --deny-host flags.
+func (f *globalFlags) hostPolicy() (rotator.HostPolicy, error) {
+	config, err := rotator.LoadConfig(f.configPath)
+	if err != nil {
+		return rotator.HostPolicy{}, err
+	}
+	policy := config.HostPolicy().With(rotator.HostPolicy{Allow: f.allowHosts, Deny: f.denyHosts})
+	return policy, policy.Validate()
+}
+
+// logger returns a text logger writing to stderr at the configured level.
+func (f *globalFlags) logger() (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.logLevel)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q", f.logLevel)
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})), nil
+}
+
+// cloudflare returns the Cloudflare Workers provider for site, or nil when no
+// account was given.
+func (f *globalFlags) cloudflare(site string) *cloudflare.Provider {
+	if f.cloudflareAccount == "" {
+		return nil
+	}
+	return cloudflare.New(f.cloudflareAccount, os.Getenv("CLOUDFLARE_API_TOKEN"), site, f.name)
+}
+
+// openPool builds the pool of site and fills it with the gateways of the
+// --state store or found in the account, or with new gateways in every
+// region when create is set, which the caller deletes. The pool is returned
+// with the error once it exists, so that the gateways created before a
+// failure can be deleted too.
+func (f *globalFlags) openPool(ctx context.Context, site string, create bool, opts ...rotator.Option) (*rotator.ApiGateway, error) {
+	ag, err := f.gateway(ctx, site, opts...)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := f.loadState(ctx, ag)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case create:
+		if err := ag.InitializeAll(ctx); err != nil {
+			return ag, err
+		}
+	case !loaded:
+		if err := ag.Discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if cf := f.cloudflare(ag.Site); cf != nil {
+		if err := ag.DiscoverWith(cf, ctx, cloudflare.Region); err != nil {
+			return ag, err
+		}
+	}
+	if ag.Endpoints.Len() == 0 {
+		return ag, fmt.Errorf("no gateways named %s found, run rotator create first", f.name)
+	}
+	return ag, nil
+}
+
+// loadState restores ag from the --state store. An empty store is not an
+// error; it reports whether any endpoint was loaded.
+func (f *globalFlags) loadState(ctx context.Context, ag *rotator.ApiGateway) (bool, error) {
+	if f.statePath == "" {
+		return false, nil
+	}
+	store, err := rotator.OpenStateStore(ctx, f.statePath)
+	if err != nil {
+		return false, err
+	}
+	if err := ag.LoadFrom(ctx, store); err != nil {
+		return false, err
+	}
+	return ag.Endpoints.Len() > 0, nil
+}
+
+// saveState writes ag to the --state store, if one was given. It fails with
+// rotator.ErrStateConflict when another process saved since loadState.
+func (f *globalFlags) saveState(ctx context.Context, ag *rotator.ApiGateway) error {
+	// the pool of a dry run holds made up endpoints
+	if f.statePath == "" || f.dryRun {
+		return nil
+	}
+	store, err := rotator.OpenStateStore(ctx, f.statePath)
+	if err != nil {
+		return err
+	}
+	return ag.SaveTo(ctx, store)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/daemon"
+	"github.com/mductran/apigateway-rotator/pkg/proxy"
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newServeCmd(flags *globalFlags) *cobra.Command {
+	var listen, adminListen, grpcListen string
+	var pools []string
+	var healthInterval time.Duration
+	var renewInterval, drainPeriod time.Duration
+	var auth proxyAuth
+	var mitm mitmFlags
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run pools for several sites with an HTTP admin API and a shared proxy",
+		Long: `Run the rotator as a daemon. The admin API creates, lists, rotates and
+deletes pools; the proxy listener sends each request through the pool whose
+site has the host of the request.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return errors.New("--dry-run cannot serve pools of gateways it does not create")
+			}
+			logger, err := flags.logger()
+			if err != nil {
+				return err
+			}
+			authenticator, err := auth.authenticator()
+			if err != nil {
+				return err
+			}
+			ca, err := mitm.ca(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// the gateways of a pool are named after the pool so that pools
+			// with the same site do not find each other's gateways
+			factory := func(name, site string) (*rotator.ApiGateway, error) {
+				return flags.gatewayNamed(ctx, flags.name+"-"+name, site)
+			}
+			d := daemon.New(ctx, factory, logger)
+			d.HealthInterval = healthInterval
+			d.RenewInterval = renewInterval
+			d.DrainPeriod = drainPeriod
+			d.LoadConfig = func() (rotator.Config, error) {
+				return rotator.LoadConfig(flags.configPath)
+			}
+
+			for _, spec := range pools {
+				name, site, ok := strings.Cut(spec, "=")
+				if !ok {
+					return fmt.Errorf("invalid --pool %q, use name=site", spec)
+				}
+				ag, err := factory(name, site)
+				if err != nil {
+					return err
+				}
+				if err := ag.Discover(ctx); err != nil {
+					return fmt.Errorf("pool %s: %w", name, err)
+				}
+				if _, err := d.Add(name, ag); err != nil {
+					return err
+				}
+			}
+
+			// start the pools of the config file, then apply it again on SIGHUP
+			if err := d.Reload(ctx); err != nil {
+				return err
+			}
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-hup:
+						if err := d.Reload(ctx); err != nil {
+							logger.Error("cannot reload config", "error", err)
+						}
+					}
+				}
+			}()
+
+			errs := make(chan error, 3)
+			server := proxy.NewServer(listen, d)
+			server.Auth = authenticator
+			server.MITM = ca
+			go func() { errs <- server.ListenAndServe() }()
+			admin := &http.Server{Addr: adminListen, Handler: d.Handler()}
+			go func() { errs <- admin.ListenAndServe() }()
+			fmt.Fprintf(cmd.OutOrStdout(), "proxy on %s, admin API on %s\n", listen, adminListen)
+			grpcServer := daemon.NewGRPCServer(d)
+			if grpcListen != "" {
+				lis, err := net.Listen("tcp", grpcListen)
+				if err != nil {
+					return err
+				}
+				go func() { errs <- grpcServer.Serve(lis) }()
+				fmt.Fprintf(cmd.OutOrStdout(), "gRPC admin API on %s\n", grpcListen)
+			}
+
+			select {
+			case err = <-errs:
+			case <-ctx.Done():
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			grpcServer.GracefulStop()
+			err = errors.Join(err, server.Shutdown(shutdownCtx), admin.Shutdown(shutdownCtx))
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "address of the proxy listener")
+	auth.register(cmd)
+	mitm.register(cmd)
+	cmd.Flags().StringVar(&adminListen, "admin-listen", "127.0.0.1:8081", "address of the admin API, which has no authentication")
+	cmd.Flags().StringVar(&grpcListen, "grpc-listen", "", "also serve the admin API over gRPC on this address")
+	cmd.Flags().StringArrayVar(&pools, "pool", nil, "run the existing gateways of a pool on startup, as name=site; can be repeated")
+	cmd.Flags().DurationVar(&healthInterval, "health-interval", rotator.DefaultHealthInterval, "interval between endpoint health checks, 0 disables them")
+	cmd.Flags().DurationVar(&renewInterval, "renew-every", 0, "replace every gateway of every pool with a new one at this interval, e.g. 30m; 0 disables it")
+	cmd.Flags().DurationVar(&drainPeriod, "drain-period", rotator.DefaultDrainPeriod, "how long a renewal lets requests through the old gateways finish before deleting them")
+	return cmd
+}
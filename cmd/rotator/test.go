@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+func newTestCmd(flags *globalFlags) *cobra.Command {
+	var (
+		echoURL  string
+		requests int
+		minIPs   int
+		keep     bool
+		output   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Check that requests sent through the gateways come from different addresses",
+		Long: `Create gateways for an IP echo service in every region, named after --name
+with a -test suffix, send requests through them and report the source
+addresses and regions the service saw and the latency of every gateway. The
+gateways are deleted afterwards unless --keep is given. The test fails when
+fewer than --min-ips distinct addresses were seen.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.dryRun {
+				return errors.New("--dry-run cannot send requests through gateways it does not create")
+			}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid --output %q, want table or json", output)
+			}
+			u, err := url.Parse(echoURL)
+			if err != nil || u.Host == "" {
+				return fmt.Errorf("invalid --echo-url %q", echoURL)
+			}
+			site := u.Scheme + "://" + u.Host
+
+			ag, err := flags.gatewayNamed(cmd.Context(), flags.name+"-test", site)
+			if err != nil {
+				return err
+			}
+			if err := ag.InitializeAll(cmd.Context()); err != nil {
+				if ag.Endpoints.Len() == 0 {
+					return errors.Join(err, teardown(cmd, ag))
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "testing the %d gateways that could be created: %s\n", ag.Endpoints.Len(), err)
+			}
+
+			run := func(ctx context.Context) error {
+				result, err := ag.SelfTest(ctx, rotator.SelfTestOptions{Path: u.Path, Requests: requests})
+				if err != nil {
+					return err
+				}
+				if err := writeSelfTest(cmd, result, output); err != nil {
+					return err
+				}
+				if len(result.IPs) < minIPs {
+					return fmt.Errorf("only %d distinct source addresses seen through %d gateways, want at least %d", len(result.IPs), len(result.Endpoints), minIPs)
+				}
+				return nil
+			}
+			if keep {
+				return run(cmd.Context())
+			}
+			return rotator.NewLifecycle(ag).Run(cmd.Context(), run)
+		},
+	}
+	cmd.Flags().StringVar(&echoURL, "echo-url", rotator.DefaultEchoURL, "URL of a service answering the address of the client, as text or as the origin or ip field of a JSON object")
+	cmd.Flags().IntVarP(&requests, "requests", "n", rotator.DefaultSelfTestRequests, "number of requests to send")
+	cmd.Flags().IntVar(&minIPs, "min-ips", 2, "fail when fewer distinct source addresses are seen")
+	cmd.Flags().BoolVar(&keep, "keep", false, "keep the test gateways instead of deleting them")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+// writeSelfTest prints result as a table of the endpoints or as JSON.
+func writeSelfTest(cmd *cobra.Command, result *rotator.SelfTestResult, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tENDPOINT\tREQUESTS\tERRORS\tMEAN\tP95\tSOURCE IPS")
+	for _, e := range result.Endpoints {
+		ips := strings.Join(e.IPs, ",")
+		if ips == "" {
+			ips = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", e.Region, e.Endpoint, e.Requests, e.Errors, e.Latency.Mean().Round(time.Millisecond), e.Latency.Quantile(0.95), ips)
+	}
+	fmt.Fprintf(w, "\n%d requests, %d errors, %d distinct source IPs in %d regions\n", result.Requests, result.Errors, len(result.IPs), len(result.Regions))
+	for message, n := range result.Failures {
+		fmt.Fprintf(w, "%d x %s\n", n, message)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,251 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// PoolInfo is the admin API view of a pool.
+type PoolInfo struct {
+	Name      string         `json:"name"`
+	Site      string         `json:"site"`
+	CreatedAt time.Time      `json:"created_at"`
+	Healthy   int            `json:"healthy"`
+	Endpoints []EndpointInfo `json:"endpoints"`
+}
+
+// DeploymentInfo is the admin API view of a rotator.Deployment. The API key
+// of the endpoint is left out, the admin API is not authenticated.
+type DeploymentInfo struct {
+	Provider  string    `json:"provider"`
+	Region    string    `json:"region"`
+	ID        string    `json:"id"`
+	Host      string    `json:"host"`
+	BasePath  string    `json:"base_path,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	IAMAuth   bool      `json:"iam_auth,omitempty"`
+}
+
+func deploymentInfo(d rotator.Deployment) DeploymentInfo {
+	return DeploymentInfo{
+		Provider:  d.Provider,
+		Region:    d.Region,
+		ID:        d.ID,
+		Host:      d.Host,
+		BasePath:  d.BasePath,
+		CreatedAt: d.CreatedAt,
+		IAMAuth:   d.IAMAuth,
+	}
+}
+
+// EndpointInfo is an endpoint of a pool and whether it is in rotation.
+type EndpointInfo struct {
+	DeploymentInfo
+	Healthy bool `json:"healthy"`
+}
+
+// Info returns the admin API view of p.
+func (p *Pool) Info() PoolInfo {
+	info := PoolInfo{Name: p.Name, Site: p.Gateway.CurrentSite(), CreatedAt: p.CreatedAt, Endpoints: []EndpointInfo{}}
+	for _, d := range p.Gateway.Deployments() {
+		healthy := p.Gateway.Healthy(d.Host)
+		if healthy {
+			info.Healthy++
+		}
+		info.Endpoints = append(info.Endpoints, EndpointInfo{DeploymentInfo: deploymentInfo(d), Healthy: healthy})
+	}
+	return info
+}
+
+// Handler returns the admin API:
+//
+//	GET    /pools                 list the pools
+//	POST   /pools                 create a pool from {"name": ..., "site": ...}
+//	GET    /pools/{name}          show a pool and the health of its endpoints
+//	DELETE /pools/{name}          delete a pool and its gateways
+//	POST   /pools/{name}/rotate   replace every endpoint, or ?endpoint=<host>
+//	POST   /pools/{name}/renew    replace every gateway with a new set at once
+//	GET    /pools/{name}/stats    request stats of the pool
+//	GET    /pools/{name}/events   stream the events of the pool, one JSON per line
+//	POST   /reload                apply the config file again
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pools", d.listPools)
+	mux.HandleFunc("POST /pools", d.createPool)
+	mux.HandleFunc("GET /pools/{name}", d.getPool)
+	mux.HandleFunc("DELETE /pools/{name}", d.deletePool)
+	mux.HandleFunc("POST /pools/{name}/rotate", d.rotatePool)
+	mux.HandleFunc("POST /pools/{name}/renew", d.renewPool)
+	mux.HandleFunc("GET /pools/{name}/stats", d.poolStats)
+	mux.HandleFunc("GET /pools/{name}/events", d.poolEvents)
+	mux.HandleFunc("POST /reload", d.reload)
+	return mux
+}
+
+func (d *Daemon) listPools(w http.ResponseWriter, r *http.Request) {
+	infos := []PoolInfo{}
+	for _, p := range d.Pools() {
+		infos = append(infos, p.Info())
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (d *Daemon) createPool(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+		Site string `json:"site"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	p, err := d.Create(r.Context(), body.Name, body.Site)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p.Info())
+}
+
+func (d *Daemon) getPool(w http.ResponseWriter, r *http.Request) {
+	p, err := d.Pool(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.Info())
+}
+
+func (d *Daemon) deletePool(w http.ResponseWriter, r *http.Request) {
+	report, err := d.Delete(r.Context(), r.PathValue("name"))
+	if err != nil && !errors.As(err, new(*rotator.TeardownError)) {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, teardownView(report))
+}
+
+func (d *Daemon) rotatePool(w http.ResponseWriter, r *http.Request) {
+	replaced, err := d.Rotate(r.Context(), r.PathValue("name"), r.URL.Query().Get("endpoint"))
+	writeReplaced(w, replaced, err)
+}
+
+func (d *Daemon) renewPool(w http.ResponseWriter, r *http.Request) {
+	replaced, err := d.Renew(r.Context(), r.PathValue("name"))
+	writeReplaced(w, replaced, err)
+}
+
+// writeReplaced answers the endpoints replaced by a rotation or a renewal.
+func writeReplaced(w http.ResponseWriter, replaced map[string]string, err error) {
+	if errors.Is(err, ErrPoolNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	result := struct {
+		Replaced map[string]string `json:"replaced"`
+		Error    string            `json:"error,omitempty"`
+	}{Replaced: replaced}
+	status := http.StatusOK
+	if err != nil {
+		result.Error = err.Error()
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, result)
+}
+
+func (d *Daemon) poolStats(w http.ResponseWriter, r *http.Request) {
+	p, err := d.Pool(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.Gateway.Stats())
+}
+
+// eventBuffer is the number of events queued for a slow reader of the events
+// of a pool before the following ones are dropped.
+const eventBuffer = 256
+
+func (d *Daemon) poolEvents(w http.ResponseWriter, r *http.Request) {
+	p, err := d.Pool(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	events := p.Subscribe(r.Context(), eventBuffer)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+	enc := json.NewEncoder(w)
+	for e := range events {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
+
+func (d *Daemon) reload(w http.ResponseWriter, r *http.Request) {
+	if err := d.Reload(r.Context()); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	d.listPools(w, r)
+}
+
+// teardownView is the JSON form of a TeardownReport.
+func teardownView(report rotator.TeardownReport) any {
+	type failure struct {
+		DeploymentInfo
+		Error string `json:"error"`
+	}
+	view := struct {
+		Deleted []DeploymentInfo `json:"deleted"`
+		Failed  []failure        `json:"failed"`
+	}{Deleted: []DeploymentInfo{}, Failed: []failure{}}
+	for _, d := range report.Deleted {
+		view.Deleted = append(view.Deleted, deploymentInfo(d))
+	}
+	for _, f := range report.Failed {
+		view.Failed = append(view.Failed, failure{DeploymentInfo: deploymentInfo(f.Deployment), Error: f.Err.Error()})
+	}
+	return view
+}
+
+// statusOf maps the errors of the daemon and of the rotator to HTTP statuses.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrPoolNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPoolExists), errors.Is(err, rotator.ErrApiExists):
+		return http.StatusConflict
+	case errors.Is(err, rotator.ErrInvalidSite), errors.Is(err, ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, rotator.ErrHostNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, rotator.ErrCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, rotator.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
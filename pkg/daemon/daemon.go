@@ -0,0 +1,373 @@
+// Package daemon runs several gateway pools in one long-lived process and
+// exposes them through an HTTP admin API, so the rotator can be shared
+// infrastructure instead of something every script sets up on its own.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+var (
+	// ErrPoolNotFound is returned for operations on a pool the daemon does not run.
+	ErrPoolNotFound = errors.New("pool not found")
+
+	// ErrPoolExists is returned when adding a pool under a name in use.
+	ErrPoolExists = errors.New("pool already exists")
+
+	// ErrInvalidName is returned for pool names that cannot be used in URLs.
+	ErrInvalidName = errors.New("invalid pool name")
+
+	// ErrNoPool is returned by RoundTrip when no pool targets the request host.
+	ErrNoPool = errors.New("no pool for host")
+)
+
+// poolName is the format of pool names, which are used in admin URLs.
+var poolName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Factory builds the gateway of a new pool named name that proxies site.
+type Factory func(name, site string) (*rotator.ApiGateway, error)
+
+// Daemon holds the pools and routes proxied requests to the pool whose site
+// has the host of the request.
+type Daemon struct {
+	// New builds the gateways of pools created through the admin API.
+	New Factory
+	// HealthInterval is the interval of the health checks of every pool, 0
+	// disables them.
+	HealthInterval time.Duration
+	// RenewInterval is the interval between two renewals of every pool, which
+	// replace all of its gateways with new ones, see rotator.ApiGateway.Renew.
+	// 0 disables them.
+	RenewInterval time.Duration
+	// DrainPeriod is how long a renewal lets the requests through the old
+	// gateways of a pool finish before deleting them.
+	DrainPeriod time.Duration
+	// LoadConfig reads the config file applied by Reload.
+	LoadConfig func() (rotator.Config, error)
+
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	ctx   context.Context
+	pools map[string]*Pool
+}
+
+// Pool is a gateway run by the daemon.
+type Pool struct {
+	Name      string
+	Gateway   *rotator.ApiGateway
+	CreatedAt time.Time
+
+	host      string
+	transport *rotator.Transport
+	ctx       context.Context
+	stop      context.CancelFunc
+}
+
+// Subscribe streams the events of the pool like rotator.ApiGateway.Subscribe,
+// until ctx is done or the pool stops running, so that watchers do not hold
+// up a shutdown.
+func (p *Pool) Subscribe(ctx context.Context, buffer int) <-chan rotator.Event {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+	context.AfterFunc(ctx, func() { stop() })
+	return p.Gateway.Subscribe(ctx, buffer)
+}
+
+// New returns a Daemon creating the gateways of new pools with factory. The
+// health checks of the pools run until ctx is done.
+func New(ctx context.Context, factory Factory, logger *slog.Logger) *Daemon {
+	return &Daemon{
+		New:            factory,
+		HealthInterval: rotator.DefaultHealthInterval,
+		DrainPeriod:    rotator.DefaultDrainPeriod,
+		logger:         logger,
+		ctx:            ctx,
+		pools:          make(map[string]*Pool),
+	}
+}
+
+// Add starts running ag as the pool name.
+func (d *Daemon) Add(name string, ag *rotator.ApiGateway) (*Pool, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	raw := ag.CurrentSite()
+	site, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return nil, fmt.Errorf("%w: pool %s has no site", rotator.ErrInvalidSite, name)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.pools[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolExists, name)
+	}
+	ctx, stop := context.WithCancel(d.ctx)
+	p := &Pool{
+		Name:      name,
+		Gateway:   ag,
+		CreatedAt: time.Now(),
+		host:      strings.ToLower(site.Host),
+		transport: ag.Transport(),
+		ctx:       ctx,
+		stop:      stop,
+	}
+	if d.HealthInterval > 0 {
+		checker := rotator.NewHealthChecker(ag)
+		checker.Interval = d.HealthInterval
+		go checker.Run(ctx)
+	}
+	if d.RenewInterval > 0 {
+		go d.renewEvery(ctx, p, d.RenewInterval)
+	}
+	d.pools[name] = p
+	d.logger.Info("pool added", "pool", name, "site", raw, "endpoints", ag.Endpoints.Len())
+	return p, nil
+}
+
+// Create builds a pool for site with the factory, creates its gateways in
+// every region and starts running it. The gateways are deleted again when
+// they cannot all be created.
+func (d *Daemon) Create(ctx context.Context, name, site string) (*Pool, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	_, exists := d.pools[name]
+	d.mu.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrPoolExists, name)
+	}
+
+	ag, err := d.New(name, site)
+	if err != nil {
+		return nil, err
+	}
+	if err := ag.InitializeAll(ctx); err != nil {
+		return nil, errors.Join(err, teardown(ctx, ag))
+	}
+	p, err := d.Add(name, ag)
+	if err != nil {
+		return nil, errors.Join(err, teardown(ctx, ag))
+	}
+	return p, nil
+}
+
+func validName(name string) error {
+	if !poolName.MatchString(name) {
+		return fmt.Errorf("%w %q, use lower case letters, digits and dashes", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// teardown deletes the endpoints ag created. The error lists those that are left.
+func teardown(ctx context.Context, ag *rotator.ApiGateway) error {
+	report := rotator.NewLifecycle(ag).Teardown(context.WithoutCancel(ctx))
+	if len(report.Failed) > 0 {
+		return &rotator.TeardownError{Report: report}
+	}
+	return nil
+}
+
+// Ensure runs the pool name for site if the daemon does not run it yet. The
+// existing gateways of the pool are used and gateways are only created in the
+// regions that have none.
+func (d *Daemon) Ensure(ctx context.Context, name, site string) (*Pool, error) {
+	if p, err := d.Pool(name); err == nil {
+		return p, nil
+	}
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	ag, err := d.New(name, site)
+	if err != nil {
+		return nil, err
+	}
+	if err := ag.Discover(ctx); err != nil {
+		return nil, err
+	}
+	if err := ag.InitializeMissing(ctx); err != nil {
+		return nil, errors.Join(err, teardown(ctx, ag))
+	}
+	p, err := d.Add(name, ag)
+	if err != nil {
+		return nil, errors.Join(err, teardown(ctx, ag))
+	}
+	return p, nil
+}
+
+// Reload reads the config file again and applies it without stopping the
+// listeners: the regions and strategy of every pool are updated, gateways are
+// created in regions added to the config, and the pools added to it are
+// started. Pools removed from the config keep running until they are deleted.
+func (d *Daemon) Reload(ctx context.Context) error {
+	if d.LoadConfig == nil {
+		return errors.New("the daemon has no config file to reload")
+	}
+	config, err := d.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, p := range d.Pools() {
+		if err := p.Gateway.Reconfigure(ctx, config); err != nil {
+			errs = append(errs, fmt.Errorf("pool %s: %w", p.Name, err))
+		}
+	}
+	for _, pc := range config.Pools {
+		if _, err := d.Ensure(ctx, pc.Name, pc.Site); err != nil {
+			errs = append(errs, fmt.Errorf("pool %s: %w", pc.Name, err))
+		}
+	}
+	d.logger.Info("config reloaded", "pools", len(d.Pools()), "errors", len(errs))
+	return errors.Join(errs...)
+}
+
+// Pool returns the pool name.
+func (d *Daemon) Pool(name string) (*Pool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	p, ok := d.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	return p, nil
+}
+
+// Pools returns the pools sorted by name.
+func (d *Daemon) Pools() []*Pool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	pools := make([]*Pool, 0, len(d.pools))
+	for _, p := range d.pools {
+		pools = append(pools, p)
+	}
+	slices.SortFunc(pools, func(a, b *Pool) int { return strings.Compare(a.Name, b.Name) })
+	return pools
+}
+
+// Remove stops running the pool name without deleting its gateways.
+func (d *Daemon) Remove(name string) (*Pool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+	}
+	p.stop()
+	delete(d.pools, name)
+	d.logger.Info("pool removed", "pool", name)
+	return p, nil
+}
+
+// Delete stops running the pool name and deletes every endpoint of it.
+func (d *Daemon) Delete(ctx context.Context, name string) (rotator.TeardownReport, error) {
+	p, err := d.Remove(name)
+	if err != nil {
+		return rotator.TeardownReport{}, err
+	}
+	var report rotator.TeardownReport
+	for _, dep := range p.Gateway.Deployments() {
+		if err := p.Gateway.DeleteDeployment(ctx, dep); err != nil {
+			report.Failed = append(report.Failed, rotator.TeardownFailure{Deployment: dep, Err: err})
+			continue
+		}
+		report.Deleted = append(report.Deleted, dep)
+	}
+	if len(report.Failed) > 0 {
+		return report, &rotator.TeardownError{Report: report}
+	}
+	return report, nil
+}
+
+// Rotate replaces endpoint of the pool name with a new one, or every endpoint
+// of the pool, one after the other, when endpoint is "". It returns the new
+// endpoint of every endpoint replaced.
+func (d *Daemon) Rotate(ctx context.Context, name, endpoint string) (map[string]string, error) {
+	p, err := d.Pool(name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []string{endpoint}
+	if endpoint == "" {
+		endpoints = endpoints[:0]
+		for _, dep := range p.Gateway.Deployments() {
+			endpoints = append(endpoints, dep.Host)
+		}
+	}
+
+	replaced := make(map[string]string)
+	var errs []error
+	for _, old := range endpoints {
+		replacement, err := p.Gateway.Replace(ctx, old)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", old, err))
+			continue
+		}
+		replaced[old] = replacement
+	}
+	return replaced, errors.Join(errs...)
+}
+
+// Renew replaces every gateway of the pool name with a new one, draining the
+// old ones for DrainPeriod before deleting them. It returns the new endpoint
+// of every old one.
+func (d *Daemon) Renew(ctx context.Context, name string) (map[string]string, error) {
+	p, err := d.Pool(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Gateway.Renew(ctx, d.DrainPeriod)
+}
+
+// renewEvery renews p every interval until ctx is done.
+func (d *Daemon) renewEvery(ctx context.Context, p *Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewed, err := p.Gateway.Renew(ctx, d.DrainPeriod)
+		if err != nil {
+			d.logger.Warn("cannot renew pool", "pool", p.Name, "error", err)
+			continue
+		}
+		d.logger.Info("pool renewed", "pool", p.Name, "endpoints", len(renewed))
+	}
+}
+
+// RoundTrip implements http.RoundTripper by sending req through the pool
+// whose site has the host of req.
+func (d *Daemon) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Host)
+	d.mu.RLock()
+	var transport *rotator.Transport
+	for _, p := range d.pools {
+		if p.host == host {
+			transport = p.transport
+			break
+		}
+	}
+	d.mu.RUnlock()
+	if transport == nil {
+		return nil, fmt.Errorf("%w %s", ErrNoPool, req.URL.Host)
+	}
+	return transport.RoundTrip(req)
+}
@@ -0,0 +1,225 @@
+package daemon
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/mductran/apigateway-rotator --go-grpc_out=../.. --go-grpc_opt=module=github.com/mductran/apigateway-rotator rotator/admin/v1/admin.proto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mductran/apigateway-rotator/pkg/daemon/adminpb"
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// NewGRPCServer returns a gRPC server offering the admin operations of d as
+// the rotator.admin.v1.Admin service of proto/rotator/admin/v1/admin.proto.
+func NewGRPCServer(d *Daemon, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	adminpb.RegisterAdminServer(s, &grpcAdmin{d: d})
+	return s
+}
+
+// grpcAdmin implements adminpb.AdminServer on top of a Daemon.
+type grpcAdmin struct {
+	adminpb.UnimplementedAdminServer
+	d *Daemon
+}
+
+func (g *grpcAdmin) ListPools(ctx context.Context, _ *adminpb.ListPoolsRequest) (*adminpb.ListPoolsResponse, error) {
+	resp := &adminpb.ListPoolsResponse{}
+	for _, p := range g.d.Pools() {
+		resp.Pools = append(resp.Pools, poolProto(p.Info()))
+	}
+	return resp, nil
+}
+
+func (g *grpcAdmin) GetPool(ctx context.Context, req *adminpb.GetPoolRequest) (*adminpb.Pool, error) {
+	p, err := g.d.Pool(req.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return poolProto(p.Info()), nil
+}
+
+func (g *grpcAdmin) CreatePool(ctx context.Context, req *adminpb.CreatePoolRequest) (*adminpb.Pool, error) {
+	p, err := g.d.Create(ctx, req.GetName(), req.GetSite())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return poolProto(p.Info()), nil
+}
+
+func (g *grpcAdmin) DeletePool(ctx context.Context, req *adminpb.DeletePoolRequest) (*adminpb.DeletePoolResponse, error) {
+	report, err := g.d.Delete(ctx, req.GetName())
+	if err != nil && !errors.As(err, new(*rotator.TeardownError)) {
+		return nil, grpcError(err)
+	}
+	resp := &adminpb.DeletePoolResponse{}
+	for _, d := range report.Deleted {
+		resp.Deleted = append(resp.Deleted, endpointProto(EndpointInfo{DeploymentInfo: deploymentInfo(d)}))
+	}
+	for _, f := range report.Failed {
+		resp.Failed = append(resp.Failed, &adminpb.FailedEndpoint{
+			Endpoint: endpointProto(EndpointInfo{DeploymentInfo: deploymentInfo(f.Deployment)}),
+			Error:    f.Err.Error(),
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcAdmin) RotatePool(ctx context.Context, req *adminpb.RotatePoolRequest) (*adminpb.RotatePoolResponse, error) {
+	replaced, err := g.d.Rotate(ctx, req.GetName(), req.GetEndpoint())
+	return replacedProto(replaced, err)
+}
+
+func (g *grpcAdmin) RenewPool(ctx context.Context, req *adminpb.RenewPoolRequest) (*adminpb.RotatePoolResponse, error) {
+	replaced, err := g.d.Renew(ctx, req.GetName())
+	return replacedProto(replaced, err)
+}
+
+// replacedProto answers the endpoints replaced by a rotation or a renewal,
+// like writeReplaced.
+func replacedProto(replaced map[string]string, err error) (*adminpb.RotatePoolResponse, error) {
+	if errors.Is(err, ErrPoolNotFound) {
+		return nil, grpcError(err)
+	}
+	resp := &adminpb.RotatePoolResponse{Replaced: replaced}
+	if err != nil {
+		resp.Errors = []string{err.Error()}
+	}
+	return resp, nil
+}
+
+func (g *grpcAdmin) GetStats(ctx context.Context, req *adminpb.GetStatsRequest) (*adminpb.Stats, error) {
+	p, err := g.d.Pool(req.GetName())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	stats := p.Gateway.Stats()
+	resp := &adminpb.Stats{
+		Since:     timestamppb.New(stats.Since),
+		Requests:  stats.Requests,
+		Errors:    stats.Errors,
+		Throttled: stats.Throttled,
+		Bytes:     stats.Bytes,
+	}
+	for _, e := range stats.Endpoints {
+		resp.Endpoints = append(resp.Endpoints, &adminpb.EndpointStats{
+			Endpoint:  e.Endpoint,
+			Region:    e.Region,
+			Provider:  e.Provider,
+			Requests:  e.Requests,
+			Errors:    e.Errors,
+			Throttled: e.Throttled,
+			Bytes:     e.Bytes,
+			Latency:   histogramProto(e.Latency),
+		})
+	}
+	for _, r := range stats.Regions {
+		resp.Regions = append(resp.Regions, &adminpb.RegionStats{
+			Region:    r.Region,
+			Requests:  r.Requests,
+			Errors:    r.Errors,
+			Throttled: r.Throttled,
+			Bytes:     r.Bytes,
+			Latency:   histogramProto(r.Latency),
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcAdmin) WatchEvents(req *adminpb.WatchEventsRequest, stream grpc.ServerStreamingServer[adminpb.Event]) error {
+	p, err := g.d.Pool(req.GetName())
+	if err != nil {
+		return grpcError(err)
+	}
+	for e := range p.Subscribe(stream.Context(), eventBuffer) {
+		if err := stream.Send(eventProto(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *grpcAdmin) Reload(ctx context.Context, _ *adminpb.ReloadRequest) (*adminpb.ListPoolsResponse, error) {
+	if err := g.d.Reload(ctx); err != nil {
+		return nil, grpcError(err)
+	}
+	return g.ListPools(ctx, &adminpb.ListPoolsRequest{})
+}
+
+func poolProto(info PoolInfo) *adminpb.Pool {
+	p := &adminpb.Pool{
+		Name:      info.Name,
+		Site:      info.Site,
+		CreatedAt: timestamppb.New(info.CreatedAt),
+		Healthy:   int32(info.Healthy),
+	}
+	for _, e := range info.Endpoints {
+		p.Endpoints = append(p.Endpoints, endpointProto(e))
+	}
+	return p
+}
+
+func endpointProto(e EndpointInfo) *adminpb.Endpoint {
+	return &adminpb.Endpoint{
+		Provider:  e.Provider,
+		Region:    e.Region,
+		Id:        e.ID,
+		Host:      e.Host,
+		BasePath:  e.BasePath,
+		CreatedAt: timestamppb.New(e.CreatedAt),
+		Healthy:   e.Healthy,
+	}
+}
+
+func eventProto(e rotator.Event) *adminpb.Event {
+	return &adminpb.Event{
+		Type:     string(e.Type),
+		Time:     timestamppb.New(e.Time),
+		Pool:     e.Pool,
+		Endpoint: e.Endpoint,
+		Region:   e.Region,
+		Provider: e.Provider,
+		Id:       e.ID,
+		Url:      e.URL,
+		Status:   int32(e.Status),
+		Count:    int32(e.Count),
+		Error:    e.Error,
+	}
+}
+
+func histogramProto(h rotator.Histogram) *adminpb.Histogram {
+	p := &adminpb.Histogram{Counts: h.Counts, Count: h.Count, Sum: durationpb.New(h.Sum)}
+	for _, b := range h.Buckets {
+		p.Buckets = append(p.Buckets, durationpb.New(b))
+	}
+	return p
+}
+
+// grpcError maps the errors of the daemon and of the rotator to gRPC codes,
+// like statusOf does for the HTTP admin API.
+func grpcError(err error) error {
+	code := codes.Internal
+	switch statusOf(err) {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,310 @@
+// Package cloudflare implements a rotator.Provider that deploys small
+// fetch-proxy Workers and routes requests through their workers.dev
+// subdomains, for accounts where API Gateway quotas or billing get in the way.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+const (
+	// ProviderName identifies Cloudflare Workers deployments.
+	ProviderName = "cloudflare-workers"
+
+	// Region is the region of every worker. Workers run on the whole
+	// Cloudflare network, so the provider only ever uses this one.
+	Region = "global"
+
+	// DefaultBaseURL is the Cloudflare v4 API.
+	DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+)
+
+// workerScript forwards every request to the TARGET binding, keeping the path
+// and query, and replaces X-Forwarded-For with the value the rotator put in
+// X-Forwarded-For-Temp, like the API Gateway integrations do. WebSocket
+// upgrades go through as well: the response of fetch carries the upgraded
+// connection back to the client.
+const workerScript = `export default {
+  async fetch(request, env) {
+    const url = new URL(request.url);
+    const target = new URL(env.TARGET);
+    target.pathname = target.pathname.replace(/\/$/, "") + url.pathname;
+    target.search = url.search;
+
+    const headers = new Headers(request.headers);
+    const forwarded = headers.get("X-Forwarded-For-Temp");
+    headers.delete("X-Forwarded-For-Temp");
+    if (forwarded) {
+      headers.set("X-Forwarded-For", forwarded);
+    }
+
+    return fetch(target.toString(), {
+      method: request.method,
+      headers: headers,
+      body: request.body,
+      redirect: "manual",
+    });
+  },
+};
+`
+
+// Provider deploys one Worker per endpoint in a Cloudflare account.
+type Provider struct {
+	AccountID string
+	APIToken  string
+	// Site is the target every worker forwards to.
+	Site string
+	// ScriptPrefix starts the script name of every worker, followed by a random suffix.
+	ScriptPrefix string
+
+	// BaseURL of the Cloudflare API, DefaultBaseURL if empty.
+	BaseURL string
+	// Client sends the API calls, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	subdomain string
+}
+
+// New returns a Provider deploying workers named prefix-<suffix> that forward to site.
+func New(accountID, apiToken, site, prefix string) *Provider {
+	return &Provider{AccountID: accountID, APIToken: apiToken, Site: site, ScriptPrefix: prefix}
+}
+
+// Name implements rotator.Provider.
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Upgrades implements rotator.Upgrader: workers pass WebSocket upgrades through.
+func (p *Provider) Upgrades() bool {
+	return true
+}
+
+// CreateEndpoint uploads a new worker and enables its workers.dev route.
+func (p *Provider) CreateEndpoint(ctx context.Context, region string) (rotator.Deployment, error) {
+	site := p.site()
+	if site == "" {
+		return rotator.Deployment{}, fmt.Errorf("%w: no site to create a worker for", rotator.ErrInvalidSite)
+	}
+	subdomain, err := p.accountSubdomain(ctx)
+	if err != nil {
+		return rotator.Deployment{}, err
+	}
+
+	script := p.ScriptPrefix + "-" + randomSuffix()
+	if err := p.upload(ctx, script, site); err != nil {
+		return rotator.Deployment{}, err
+	}
+
+	body := strings.NewReader(`{"enabled":true}`)
+	if err := p.call(ctx, http.MethodPost, "/workers/scripts/"+script+"/subdomain", "application/json", body, nil); err != nil {
+		err = fmt.Errorf("cannot enable workers.dev route of %s: %w", script, err)
+		// an unreachable worker is useless, do not leave it behind
+		if delErr := p.DeleteEndpoint(context.WithoutCancel(ctx), region, script); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return rotator.Deployment{}, err
+	}
+
+	return p.deployment(script, subdomain, time.Now()), nil
+}
+
+// ListEndpoints returns the workers whose name starts with p.ScriptPrefix.
+func (p *Provider) ListEndpoints(ctx context.Context, region string) ([]rotator.Deployment, error) {
+	subdomain, err := p.accountSubdomain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var scripts []struct {
+		ID        string    `json:"id"`
+		CreatedOn time.Time `json:"created_on"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/workers/scripts", "", nil, &scripts); err != nil {
+		return nil, fmt.Errorf("cannot list workers: %w", err)
+	}
+
+	var deployments []rotator.Deployment
+	for _, s := range scripts {
+		if strings.HasPrefix(s.ID, p.ScriptPrefix+"-") {
+			deployments = append(deployments, p.deployment(s.ID, subdomain, s.CreatedOn))
+		}
+	}
+	return deployments, nil
+}
+
+// DeleteEndpoint deletes the worker script id.
+func (p *Provider) DeleteEndpoint(ctx context.Context, region, id string) error {
+	if err := p.call(ctx, http.MethodDelete, "/workers/scripts/"+id, "", nil, nil); err != nil {
+		return fmt.Errorf("cannot delete worker %s: %w", id, err)
+	}
+	return nil
+}
+
+// RetargetEndpoint uploads the worker id again with site as its target, and
+// makes the workers created from now on forward to site too.
+func (p *Provider) RetargetEndpoint(ctx context.Context, region, id, site string) error {
+	if err := p.upload(ctx, id, site); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.Site = site
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Provider) site() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Site
+}
+
+func (p *Provider) deployment(script, subdomain string, created time.Time) rotator.Deployment {
+	return rotator.Deployment{
+		Provider:  ProviderName,
+		Region:    Region,
+		ID:        script,
+		Host:      script + "." + subdomain + ".workers.dev",
+		CreatedAt: created,
+	}
+}
+
+// upload puts the worker module for script, with site bound as a plain text
+// variable.
+func (p *Provider) upload(ctx context.Context, script, site string) error {
+	metadata, err := json.Marshal(map[string]any{
+		"main_module": "worker.js",
+		"bindings": []map[string]string{
+			{"type": "plain_text", "name": "TARGET", "text": site},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("metadata", string(metadata)); err != nil {
+		return err
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="worker.js"; filename="worker.js"`)
+	header.Set("Content-Type", "application/javascript+module")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(part, workerScript); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	if err := p.call(ctx, http.MethodPut, "/workers/scripts/"+script, mw.FormDataContentType(), &buf, nil); err != nil {
+		return fmt.Errorf("cannot upload worker %s: %w", script, err)
+	}
+	return nil
+}
+
+// accountSubdomain returns the workers.dev subdomain of the account, which is
+// looked up once.
+func (p *Provider) accountSubdomain(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subdomain != "" {
+		return p.subdomain, nil
+	}
+
+	var result struct {
+		Subdomain string `json:"subdomain"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/workers/subdomain", "", nil, &result); err != nil {
+		return "", fmt.Errorf("cannot get workers.dev subdomain: %w", err)
+	}
+	if result.Subdomain == "" {
+		return "", errors.New("the account has no workers.dev subdomain, register one in the dashboard first")
+	}
+	p.subdomain = result.Subdomain
+	return p.subdomain, nil
+}
+
+// apiResponse is the envelope of every Cloudflare API response.
+type apiResponse struct {
+	Success bool            `json:"success"`
+	Errors  []apiError      `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// call sends an account scoped API request and decodes the result into out.
+func (p *Provider) call(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	base := p.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+"/accounts/"+p.AccountID+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("cannot decode response: %s: %w", resp.Status, err)
+	}
+	if !envelope.Success {
+		msgs := make([]string, 0, len(envelope.Errors))
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		err := fmt.Errorf("%s: %s", resp.Status, strings.Join(msgs, "; "))
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %w", rotator.ErrCredentials, err)
+		}
+		return err
+	}
+	if out != nil && len(envelope.Result) > 0 {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// errUnauthenticated is returned for clients without valid credentials.
+	errUnauthenticated = errors.New("proxy authentication required")
+	// errRateLimited is returned for requests over the rate limit of their user.
+	errRateLimited = errors.New("rate limit exceeded")
+)
+
+// authRealm is the realm of the Proxy-Authenticate challenge.
+const authRealm = "rotator"
+
+// User is an account of the proxy. It authenticates either with Basic
+// credentials, Name and Password, or with Token as a Bearer token; over
+// SOCKS5 the token is sent as the password with any user name.
+type User struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	// Rate limits the requests of the user per second, 0 is unlimited.
+	Rate float64 `yaml:"rate"`
+	// Burst is the number of requests allowed at once, Rate if 0.
+	Burst int `yaml:"burst"`
+}
+
+// Authenticator checks the credentials of the clients of a proxy and applies
+// the rate limits of their users.
+type Authenticator struct {
+	users []User
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewAuthenticator returns an Authenticator accepting users.
+func NewAuthenticator(users ...User) *Authenticator {
+	return &Authenticator{users: users, buckets: make(map[string]*bucket)}
+}
+
+// LoadUsers reads the users of a YAML file:
+//
+//	users:
+//	  - name: alice
+//	    password: s3cret
+//	  - name: ci
+//	    token: 0ff1ce
+//	    rate: 5
+func LoadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read users: %w", err)
+	}
+	var file struct {
+		Users []User `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse users %s: %w", path, err)
+	}
+	for _, u := range file.Users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user without a name in %s", path)
+		}
+		if u.Password == "" && u.Token == "" {
+			return nil, fmt.Errorf("user %s has neither a password nor a token", u.Name)
+		}
+	}
+	return file.Users, nil
+}
+
+// ParseUser parses name:password credentials.
+func ParseUser(s string) (User, error) {
+	name, password, ok := strings.Cut(s, ":")
+	if !ok || name == "" || password == "" {
+		return User{}, fmt.Errorf("invalid credentials %q, want name:password", s)
+	}
+	return User{Name: name, Password: password}, nil
+}
+
+// Password returns the user with name and password, or nil. A password
+// matching the token of a user authenticates it too.
+func (a *Authenticator) Password(name, password string) *User {
+	for i := range a.users {
+		u := &a.users[i]
+		if u.Password != "" && u.Name == name && equal(u.Password, password) {
+			return u
+		}
+		if u.Token != "" && equal(u.Token, password) {
+			return u
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the user of the Proxy-Authorization header of req.
+func (a *Authenticator) Authenticate(req *http.Request) (*User, error) {
+	scheme, credentials, _ := strings.Cut(req.Header.Get("Proxy-Authorization"), " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return nil, errUnauthenticated
+		}
+		name, password, _ := strings.Cut(string(decoded), ":")
+		if u := a.Password(name, password); u != nil {
+			return u, nil
+		}
+	case "bearer":
+		for i := range a.users {
+			if u := &a.users[i]; u.Token != "" && equal(u.Token, credentials) {
+				return u, nil
+			}
+		}
+	}
+	return nil, errUnauthenticated
+}
+
+// Allow spends one request of the rate limit of u, and reports whether the
+// request may be sent.
+func (a *Authenticator) Allow(u *User) bool {
+	if u.Rate <= 0 {
+		return true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.buckets[u.Name]
+	if !ok {
+		burst := float64(u.Burst)
+		if burst <= 0 {
+			burst = max(u.Rate, 1)
+		}
+		b = &bucket{rate: u.Rate, burst: burst, tokens: burst, last: time.Now()}
+		a.buckets[u.Name] = b
+	}
+	return b.take(time.Now())
+}
+
+// limit wraps transport so that every request spends the rate limit of u.
+func (a *Authenticator) limit(u *User, transport http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !a.Allow(u) {
+			return nil, errRateLimited
+		}
+		return transport.RoundTrip(req)
+	})
+}
+
+// challenge answers a request without valid credentials.
+func challenge(w http.ResponseWriter) {
+	w.Header().Set("Proxy-Authenticate", `Basic realm="`+authRealm+`"`)
+	http.Error(w, errUnauthenticated.Error(), http.StatusProxyAuthRequired)
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// bucket is a token bucket refilled at rate tokens per second up to burst.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(now time.Time) bool {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
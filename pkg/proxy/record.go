@@ -0,0 +1,358 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotRecorded is returned by Replayer for requests it has no response for.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// harExt is the extension of the recordings written as one HAR document.
+const harExt = ".har"
+
+// HAR is an HTTP Archive, the format browsers export their network activity
+// in. Only the fields the rotator records are declared.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log of a HAR.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the program that wrote a HAR.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a request and its response.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is the request of a HAREntry.
+type HARRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []HARHeader  `json:"headers"`
+	QueryString []HARHeader  `json:"queryString"`
+	PostData    *HARPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+// HARResponse is the response of a HAREntry.
+type HARResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []HARHeader `json:"headers"`
+	Content     HARContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+// HARHeader is a header or a query parameter.
+type HARHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a request.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is the body of a response, base64 encoded when it is not text.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings are the durations of the phases of a HAREntry in milliseconds.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Recorder is a http.RoundTripper that records the requests sent through
+// Transport and their responses. Files ending in .har get one HAR document,
+// written by Close; any other file gets a HAREntry per line as they happen,
+// which survives a crash. Response bodies are read whole before they are
+// returned, so streams are not recorded as they arrive, and upgraded
+// connections are not recorded.
+type Recorder struct {
+	Transport http.RoundTripper
+
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	enc     *json.Encoder
+	entries []HAREntry
+}
+
+// NewRecorder returns a Recorder for transport writing to path, which is
+// created or appended to.
+func NewRecorder(transport http.RoundTripper, path string) (*Recorder, error) {
+	r := &Recorder{Transport: transport, path: path}
+	if strings.HasSuffix(path, harExt) {
+		return r, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open recording: %w", err)
+	}
+	r.file, r.enc = f, json.NewEncoder(f)
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, err
+	}
+	wait := time.Since(start)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	receive := time.Since(start) - wait
+
+	entry := HAREntry{
+		StartedDateTime: start,
+		Time:            millis(wait + receive),
+		Request:         harRequest(req, reqBody),
+		Response:        harResponse(resp, body),
+		Timings:         HARTimings{Wait: millis(wait), Receive: millis(receive)},
+	}
+	if err := r.record(entry); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) record(entry HAREntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enc == nil {
+		r.entries = append(r.entries, entry)
+		return nil
+	}
+	if err := r.enc.Encode(entry); err != nil {
+		return fmt.Errorf("cannot write recording: %w", err)
+	}
+	return nil
+}
+
+// Close writes the HAR document, or closes the file of the entries.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		return r.file.Close()
+	}
+	har := HAR{Log: HARLog{Version: "1.2", Creator: HARCreator{Name: "apigateway-rotator", Version: "1"}, Entries: r.entries}}
+	if har.Log.Entries == nil {
+		har.Log.Entries = []HAREntry{}
+	}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0o600)
+}
+
+func harRequest(req *http.Request, body []byte) HARRequest {
+	h := HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Headers:     harHeaders(req.Header),
+		QueryString: []HARHeader{},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			h.QueryString = append(h.QueryString, HARHeader{name, value})
+		}
+	}
+	if len(body) > 0 {
+		h.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}
+	}
+	return h
+}
+
+func harResponse(resp *http.Response, body []byte) HARResponse {
+	content := HARContent{Size: int64(len(body)), MimeType: resp.Header.Get("Content-Type")}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text, content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Content:     content,
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+func harHeaders(header http.Header) []HARHeader {
+	headers := []HARHeader{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, HARHeader{name, value})
+		}
+	}
+	return headers
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Replayer is a http.RoundTripper that answers requests with the responses of
+// a recording instead of sending them. A request is matched by its method
+// and URL; when it was recorded several times, the responses are served in
+// the order they were recorded, the last one again once they are all served.
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]HAREntry
+	served  map[string]int
+}
+
+// LoadReplayer reads a recording of Recorder, or any HAR file.
+func LoadReplayer(path string) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recording: %w", err)
+	}
+	var entries []HAREntry
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte(`{"log"`)) || strings.HasSuffix(path, harExt) {
+		var har HAR
+		if err := json.Unmarshal(data, &har); err != nil {
+			return nil, fmt.Errorf("cannot decode recording %s: %w", path, err)
+		}
+		entries = har.Log.Entries
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var entry HAREntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				return nil, fmt.Errorf("cannot decode recording %s line %d: %w", path, line, err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	r := &Replayer{entries: make(map[string][]HAREntry), served: make(map[string]int)}
+	for _, entry := range entries {
+		key := replayKey(entry.Request.Method, entry.Request.URL)
+		r.entries[key] = append(r.entries[key], entry)
+	}
+	return r, nil
+}
+
+// Len returns the number of recorded responses.
+func (r *Replayer) Len() int {
+	n := 0
+	for _, entries := range r.entries {
+		n += len(entries)
+	}
+	return n
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := replayKey(req.Method, req.URL.String())
+	r.mu.Lock()
+	entries := r.entries[key]
+	i := min(r.served[key], len(entries)-1)
+	r.served[key]++
+	r.mu.Unlock()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, req.Method, req.URL.Redacted())
+	}
+
+	recorded := entries[i].Response
+	body := []byte(recorded.Content.Text)
+	if recorded.Content.Encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(recorded.Content.Text); err != nil {
+			return nil, fmt.Errorf("cannot decode recorded response for %s %s: %w", req.Method, req.URL.Redacted(), err)
+		}
+	}
+	header := make(http.Header, len(recorded.Headers))
+	for _, h := range recorded.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func replayKey(method, url string) string {
+	return method + " " + url
+}
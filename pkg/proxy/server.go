@@ -0,0 +1,167 @@
+// Package proxy serves a local forward proxy that sends every request it
+// receives through a rotating transport, so tools that only know how to talk to
+// an HTTP proxy can use the API Gateway pool.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// Server is an HTTP forward proxy. Clients send absolute-form requests
+// ("GET http://example.com/path HTTP/1.1") and the server replays them through
+// Transport, streaming the response back.
+type Server struct {
+	// Addr is the address to listen on, ":8080" if empty.
+	Addr string
+
+	// Transport performs the proxied requests, typically a *rotator.Transport.
+	Transport http.RoundTripper
+
+	// ErrorLog receives transport errors. The standard logger is used when nil.
+	ErrorLog *log.Logger
+
+	// Auth, if set, requires every request, CONNECT included, to carry the
+	// Proxy-Authorization of one of its users.
+	Auth *Authenticator
+
+	// MITM, if set, accepts CONNECT tunnels and terminates their TLS with
+	// certificates it issues, so that HTTPS requests can be routed too.
+	// CONNECT is refused otherwise.
+	MITM *CA
+
+	once  sync.Once
+	proxy *httputil.ReverseProxy
+
+	mu  sync.Mutex
+	srv *http.Server
+}
+
+// NewServer returns a Server listening on addr that forwards through transport.
+func NewServer(addr string, transport http.RoundTripper) *Server {
+	return &Server{Addr: addr, Transport: transport}
+}
+
+// ListenAndServe listens on s.Addr and serves proxy requests until it fails.
+// It returns http.ErrServerClosed after Shutdown.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+	s.mu.Lock()
+	s.srv = &http.Server{Addr: addr, Handler: s}
+	srv := s.srv
+	s.mu.Unlock()
+	return srv.ListenAndServe()
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests
+// to finish or ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// transportKey is the context key of the transport a plain request is sent
+// with, which spends the rate limit of its user.
+type transportKey struct{}
+
+// ServeHTTP implements http.Handler. With Auth, the rate limit of the user is
+// spent by each request sent, those of a CONNECT tunnel included, rather than
+// by the CONNECT itself.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	transport := s.Transport
+	if s.Auth != nil {
+		u, err := s.Auth.Authenticate(r)
+		if err != nil {
+			challenge(w)
+			return
+		}
+		transport = s.Auth.limit(u, transport)
+	}
+	if r.Method == http.MethodConnect {
+		if s.MITM == nil {
+			http.Error(w, "CONNECT is not supported without a MITM CA", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveConnect(w, r, transport)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request, use an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	s.once.Do(func() { s.proxy = s.newReverseProxy() })
+	s.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), transportKey{}, transport)))
+}
+
+// serveConnect takes over the connection of a CONNECT request and serves the
+// tunnel the client opens over it.
+func (s *Server) serveConnect(w http.ResponseWriter, r *http.Request, transport http.RoundTripper) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "CONNECT is not supported over this connection", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		s.logf("cannot take over CONNECT to %s: %s", r.Host, err)
+		return
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	if err := serveTunnel(&bufferedConn{Conn: conn, r: rw.Reader}, r.Host, transport, s.MITM); err != nil {
+		s.logf("tunnel to %s failed: %s", r.Host, err)
+	}
+}
+
+// newReverseProxy builds the httputil.ReverseProxy used to relay requests. The
+// outbound URL is already absolute so Rewrite only has to keep the target Host;
+// Rewrite mode also drops inbound X-Forwarded-* headers so the local client
+// address never reaches the target. Requests are sent with the transport
+// ServeHTTP put in their context.
+func (s *Server) newReverseProxy() *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.Host = pr.In.URL.Host
+		},
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if transport, ok := req.Context().Value(transportKey{}).(http.RoundTripper); ok {
+				return transport.RoundTrip(req)
+			}
+			return s.Transport.RoundTrip(req)
+		}),
+		FlushInterval: -1,
+		ErrorLog:      s.ErrorLog,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// rate limited clients would fill the log
+			if !errors.Is(err, errRateLimited) {
+				s.logf("proxy error for %s: %s", r.URL, err)
+			}
+			http.Error(w, fmt.Sprintf("proxy error: %s", err), errorStatus(err))
+		},
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
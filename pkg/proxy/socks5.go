@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// SOCKS5 protocol constants, see RFC 1928.
+const (
+	socksVersion = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodPassword     = 0x02
+	socksMethodNoAcceptable = 0xff
+
+	// username/password subnegotiation, see RFC 1929
+	socksPasswordVersion = 0x01
+	socksPasswordOK      = 0x00
+	socksPasswordFailed  = 0x01
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksRepSucceeded        = 0x00
+	socksRepCmdNotSupported  = 0x07
+	socksRepAtypNotSupported = 0x08
+)
+
+// SOCKS5Server accepts SOCKS5 CONNECT tunnels and routes the HTTP requests
+// sent over them through Transport. Only plain HTTP can be rewritten, so
+// tunnels that start a TLS handshake are closed unless MITM is set.
+type SOCKS5Server struct {
+	// Addr is the address to listen on, ":1080" if empty.
+	Addr string
+
+	// Transport performs the proxied requests, typically a *rotator.Transport.
+	Transport http.RoundTripper
+
+	// ErrorLog receives connection errors. The standard logger is used when nil.
+	ErrorLog *log.Logger
+
+	// Auth, if set, requires username/password authentication by one of its
+	// users, whose rate limit applies to the requests of the tunnel.
+	Auth *Authenticator
+
+	// MITM, if set, terminates the TLS of HTTPS tunnels with certificates it
+	// issues, so that their requests can be routed too.
+	MITM *CA
+
+	mu        sync.Mutex
+	listeners []net.Listener
+}
+
+// NewSOCKS5Server returns a SOCKS5Server listening on addr that forwards
+// through transport.
+func NewSOCKS5Server(addr string, transport http.RoundTripper) *SOCKS5Server {
+	return &SOCKS5Server{Addr: addr, Transport: transport}
+}
+
+// ListenAndServe listens on s.Addr and serves SOCKS5 clients until it fails.
+func (s *SOCKS5Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":1080"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until it is closed.
+func (s *SOCKS5Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close closes the listeners, so that Serve returns. Open tunnels are left to
+// finish.
+func (s *SOCKS5Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, ln := range s.listeners {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	s.listeners = nil
+	return errors.Join(errs...)
+}
+
+func (s *SOCKS5Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	target, user, err := s.handshake(br, conn)
+	if err != nil {
+		s.logf("socks5 handshake with %s failed: %s", conn.RemoteAddr(), err)
+		return
+	}
+
+	transport := s.Transport
+	if user != nil {
+		transport = s.Auth.limit(user, transport)
+	}
+	if err := serveTunnel(&bufferedConn{Conn: conn, r: br}, target, transport, s.MITM); err != nil {
+		s.logf("socks5 tunnel to %s failed: %s", target, err)
+	}
+}
+
+// handshake negotiates the authentication method and reads the CONNECT
+// request, returning the requested target as host:port and the authenticated
+// user, if s.Auth is set.
+func (s *SOCKS5Server) handshake(br *bufio.Reader, w io.Writer) (string, *User, error) {
+	// greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return "", nil, err
+	}
+	if header[0] != socksVersion {
+		return "", nil, fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return "", nil, err
+	}
+	var user *User
+	if s.Auth != nil {
+		if !containsByte(methods, socksMethodPassword) {
+			w.Write([]byte{socksVersion, socksMethodNoAcceptable})
+			return "", nil, errors.New("client does not support username/password authentication")
+		}
+		if _, err := w.Write([]byte{socksVersion, socksMethodPassword}); err != nil {
+			return "", nil, err
+		}
+		var err error
+		if user, err = s.authenticate(br, w); err != nil {
+			return "", nil, err
+		}
+	} else {
+		if !containsByte(methods, socksMethodNoAuth) {
+			w.Write([]byte{socksVersion, socksMethodNoAcceptable})
+			return "", nil, errors.New("client does not support unauthenticated access")
+		}
+		if _, err := w.Write([]byte{socksVersion, socksMethodNoAuth}); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(br, request); err != nil {
+		return "", nil, err
+	}
+	if request[1] != socksCmdConnect {
+		writeSocksReply(w, socksRepCmdNotSupported)
+		return "", nil, fmt.Errorf("unsupported socks command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := net.IPv4len
+		if request[3] == socksAtypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return "", nil, err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		size, err := br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		domain := make([]byte, size)
+		if _, err := io.ReadFull(br, domain); err != nil {
+			return "", nil, err
+		}
+		host = string(domain)
+	default:
+		writeSocksReply(w, socksRepAtypNotSupported)
+		return "", nil, fmt.Errorf("unsupported socks address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(br, port); err != nil {
+		return "", nil, err
+	}
+
+	if err := writeSocksReply(w, socksRepSucceeded); err != nil {
+		return "", nil, err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), user, nil
+}
+
+// authenticate reads the username/password subnegotiation and returns the
+// user of the credentials.
+func (s *SOCKS5Server) authenticate(br *bufio.Reader, w io.Writer) (*User, error) {
+	// VER ULEN UNAME PLEN PASSWD
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != socksPasswordVersion {
+		return nil, fmt.Errorf("unsupported username/password version %d", version)
+	}
+	var fields [2][]byte
+	for i := range fields {
+		size, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = make([]byte, size)
+		if _, err := io.ReadFull(br, fields[i]); err != nil {
+			return nil, err
+		}
+	}
+	user := s.Auth.Password(string(fields[0]), string(fields[1]))
+	if user == nil {
+		w.Write([]byte{socksPasswordVersion, socksPasswordFailed})
+		return nil, fmt.Errorf("%w for %q", errUnauthenticated, fields[0])
+	}
+	if _, err := w.Write([]byte{socksPasswordVersion, socksPasswordOK}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// writeSocksReply sends a reply with an unspecified bind address; clients do
+// not need it because the tunnel never leaves this process.
+func writeSocksReply(w io.Writer, rep byte) error {
+	_, err := w.Write([]byte{socksVersion, rep, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func containsByte(b []byte, c byte) bool {
+	for _, v := range b {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SOCKS5Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// bufferedConn is a net.Conn whose reads go through a bufio.Reader that may
+// already hold bytes read during the handshake.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// errTLSTunnel is returned when a tunnel carries TLS instead of plain HTTP and
+// there is no CA to intercept it. Encrypted requests cannot be rewritten to go
+// through a gateway.
+var errTLSTunnel = errors.New("tunnel carries TLS, only plain HTTP can be routed through the gateways without a MITM CA")
+
+// tlsHandshake is the first byte of a TLS ClientHello record.
+const tlsHandshake = 0x16
+
+// serveTunnel reads HTTP requests from conn, which the client opened to target
+// (host:port), and answers each one by sending it through transport. A tunnel
+// starting a TLS handshake is terminated with a certificate issued by ca, or
+// refused if ca is nil.
+func serveTunnel(conn net.Conn, target string, transport http.RoundTripper, ca *CA) error {
+	br := bufio.NewReader(conn)
+
+	first, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	scheme, defaultPort := "http", "80"
+	if first[0] == tlsHandshake {
+		if ca == nil {
+			return errTLSTunnel
+		}
+		tlsConn := tls.Server(&bufferedConn{Conn: conn, r: br}, ca.tlsConfig(target))
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("cannot intercept TLS to %s: %w", target, err)
+		}
+		conn, br = tlsConn, bufio.NewReader(tlsConn)
+		scheme, defaultPort = "https", "443"
+	}
+
+	host := target
+	if h, port, err := net.SplitHostPort(target); err == nil && port == defaultPort {
+		host = h
+	}
+
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("cannot read tunneled request: %w", err)
+		}
+
+		req.URL.Scheme = scheme
+		req.URL.Host = host
+		req.RequestURI = ""
+		upgrade := upgradeType(req.Header)
+		removeHopHeaders(req.Header)
+		if upgrade != "" {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", upgrade)
+		}
+
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			resp = errorResponse(req, errorStatus(err), err)
+		}
+		if upgraded, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+			return spliceUpgrade(conn, br, resp, upgraded)
+		}
+		removeHopHeaders(resp.Header)
+		err = resp.Write(conn)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("cannot write tunneled response: %w", err)
+		}
+
+		if req.Close {
+			return nil
+		}
+	}
+}
+
+// hopHeaders are meaningful only for a single connection and must not be
+// forwarded by proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// upgradeType returns the protocol the Upgrade header in h asks for when the
+// Connection header asks for an upgrade, "" otherwise.
+func upgradeType(h http.Header) string {
+	for _, value := range h.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return h.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// spliceUpgrade writes resp, a 101 Switching Protocols, to conn and then
+// copies between conn, read through br, and the upgraded connection until
+// either side ends. The Upgrade and Connection headers of resp are kept.
+func spliceUpgrade(conn net.Conn, br *bufio.Reader, resp *http.Response, upgraded io.ReadWriteCloser) error {
+	defer upgraded.Close()
+	upgrade := resp.Header.Get("Upgrade")
+	removeHopHeaders(resp.Header)
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Upgrade", upgrade)
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode)); err != nil {
+		return fmt.Errorf("cannot write tunneled response: %w", err)
+	}
+	if err := resp.Header.Write(conn); err != nil {
+		return fmt.Errorf("cannot write tunneled response: %w", err)
+	}
+	if _, err := io.WriteString(conn, "\r\n"); err != nil {
+		return fmt.Errorf("cannot write tunneled response: %w", err)
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upgraded, br)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upgraded)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
+
+// errorStatus is the status answered to the client for the transport error
+// err: 429 for rate limited clients, 504 for timeouts, 502 otherwise.
+func errorStatus(err error) int {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, errRateLimited):
+		return http.StatusTooManyRequests
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// errorResponse builds a plain text response reporting err to the client.
+func errorResponse(req *http.Request, status int, err error) *http.Response {
+	body := fmt.Sprintf("proxy error: %s\n", err)
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		Request:       req,
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp
+}
@@ -0,0 +1,114 @@
+package rotator
+
+import (
+	"fmt"
+)
+
+// Account is a set of AWS credentials gateways can be created with. Only one
+// of Profile and the static keys is used; RoleARN is assumed on top of them.
+type Account struct {
+	// Name identifies the account in provider names, e.g. "aws-rest@Name".
+	Name string `yaml:"name"`
+
+	Profile         string `yaml:"profile"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+
+	RoleARN    string `yaml:"role_arn"`
+	ExternalID string `yaml:"external_id"`
+}
+
+// account is an Account ready to build clients.
+type account struct {
+	name  string
+	creds *credentialSet
+}
+
+// WithAccounts spreads the pool over several AWS accounts: InitializeAll
+// creates a gateway in every region of every account and Discover lists them
+// all, multiplying the per-account quotas. The credentials of WithProfile,
+// WithStaticCredentials and WithAssumeRole are then only used for the calls
+// that are not tied to a gateway, such as region discovery.
+func WithAccounts(accounts ...Account) Option {
+	return func(ag *ApiGateway) {
+		ag.accountConfigs = append(ag.accountConfigs, accounts...)
+	}
+}
+
+// setupAccounts registers a provider of the backend for every account.
+func (ag *ApiGateway) setupAccounts() error {
+	seen := make(map[string]bool)
+	for _, a := range ag.accountConfigs {
+		if a.Name == "" {
+			return fmt.Errorf("account without a name")
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("duplicate account %q", a.Name)
+		}
+		seen[a.Name] = true
+
+		creds := &credentialSet{roleARN: a.RoleARN, externalID: a.ExternalID}
+		if a.Profile != "" {
+			creds.profile(a.Profile)
+		}
+		if a.AccessKeyID != "" {
+			creds.static(a.AccessKeyID, a.SecretAccessKey, a.SessionToken)
+		}
+		acct := account{name: a.Name, creds: creds}
+		ag.accounts = append(ag.accounts, acct)
+
+		ag.register(restProvider{ag: ag, account: acct})
+		ag.register(httpProvider{ag: ag, account: acct})
+	}
+	return nil
+}
+
+// awsAccounts returns the accounts gateways are managed in: those of
+// WithAccounts, or the default credentials.
+func (ag *ApiGateway) awsAccounts() []account {
+	if len(ag.accounts) > 0 {
+		return ag.accounts
+	}
+	return []account{{creds: ag.creds}}
+}
+
+// creationProviders returns the providers InitializeAll creates endpoints
+// with: the default provider, or one per account when the default provider is
+// an API Gateway backend and accounts are configured.
+func (ag *ApiGateway) creationProviders() []Provider {
+	if len(ag.accounts) == 0 || !ag.defaultIsAWS {
+		return []Provider{ag.provider}
+	}
+	providers := make([]Provider, 0, len(ag.accounts))
+	for _, a := range ag.accounts {
+		providers = append(providers, ag.awsProvider(a))
+	}
+	return providers
+}
+
+// isCreationProvider reports whether InitializeAll creates endpoints with p.
+func (ag *ApiGateway) isCreationProvider(p Provider) bool {
+	for _, c := range ag.creationProviders() {
+		if c.Name() == p.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// awsProvider returns the provider of the backend in account a.
+func (ag *ApiGateway) awsProvider(a account) Provider {
+	if ag.backend == BackendHTTP {
+		return httpProvider{ag: ag, account: a}
+	}
+	return restProvider{ag: ag, account: a}
+}
+
+// providerName qualifies name with the account, if any.
+func providerName(name string, a account) string {
+	if a.name == "" {
+		return name
+	}
+	return name + "@" + a.name
+}
@@ -0,0 +1,254 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	v2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+// WithAdopt makes Initialize reuse an API that already has the pool name
+// instead of failing with ErrApiExists. Missing methods, integrations and
+// stages are recreated; an API that proxies to another site is not touched.
+// Adopted APIs are not deleted by a Lifecycle teardown, since the session did
+// not create them.
+func WithAdopt() Option {
+	return func(ag *ApiGateway) {
+		ag.adopt = true
+	}
+}
+
+// findRestApi returns the first REST API in region that match selects, or nil.
+func findRestApi(ctx context.Context, client RestAPIClient, region string, match func(types.RestApi) bool) (*types.RestApi, error) {
+	apis, err := listRestApis(ctx, client, region, ListOptions{Filters: []GatewayFilter{match}, Limit: 1})
+	if err != nil || len(apis) == 0 {
+		return nil, err
+	}
+	return &apis[0], nil
+}
+
+// adoptRestGateway checks that api proxies to site, directly or through
+// targetVariable, repairs the parts createRestGateway would have created and
+// redeploys the stage if anything changed.
+func (ag *ApiGateway) adoptRestGateway(ctx context.Context, creds *credentialSet, client RestAPIClient, region string, api types.RestApi, site string) (Deployment, error) {
+	ag.logger.Info("adopting gateway", "region", region, "id", *api.Id)
+
+	resources, err := restResources(ctx, client, *api.Id)
+	if err != nil {
+		return Deployment{}, err
+	}
+	var root, wildcard string
+	for _, r := range resources {
+		switch aws.ToString(r.Path) {
+		case "/":
+			root = *r.Id
+		case "/{proxy+}":
+			wildcard = *r.Id
+		}
+	}
+	if root == "" {
+		return Deployment{}, fmt.Errorf("api %s has no root resource", *api.Id)
+	}
+
+	repaired := false
+	if wildcard == "" {
+		resource, err := client.CreateResource(ctx, &apigateway.CreateResourceInput{
+			RestApiId: api.Id,
+			ParentId:  &root,
+			PathPart:  aws.String("{proxy+}"),
+		})
+		if err != nil {
+			return Deployment{}, fmt.Errorf("cannot create wildcard handler: %w", classify(err))
+		}
+		wildcard = *resource.Id
+		repaired = true
+	}
+
+	// integrations created before SetTarget proxy to the site itself
+	rootURI, wildcardURI, variables := targetURIs(site)
+	literal := map[string]string{root: site + "/", wildcard: site + "/{proxy}"}
+	readsTarget := false
+	for id, uri := range map[string]string{root: rootURI, wildcard: wildcardURI} {
+		integration, err := client.GetIntegration(ctx, &apigateway.GetIntegrationInput{
+			RestApiId:  api.Id,
+			ResourceId: &id,
+			HttpMethod: aws.String("ANY"),
+		})
+		var notFound *types.NotFoundException
+		switch {
+		case errors.As(err, &notFound):
+			if err := ag.putProxyMethod(ctx, client, *api.Id, id, uri); err != nil {
+				return Deployment{}, err
+			}
+			readsTarget, repaired = true, true
+		case err != nil:
+			return Deployment{}, fmt.Errorf("cannot get integration of api %s: %w", *api.Id, classify(err))
+		case aws.ToString(integration.Uri) == uri:
+			readsTarget = true
+		case aws.ToString(integration.Uri) != literal[id]:
+			return Deployment{}, fmt.Errorf("%w: api %s in region %s proxies to %s, not %s", ErrApiExists, *api.Id, region, aws.ToString(integration.Uri), literal[id])
+		}
+	}
+
+	if !slices.Contains(api.BinaryMediaTypes, binaryMediaType) {
+		// a slash in a patch path is escaped as ~1
+		_, err := client.UpdateRestApi(ctx, &apigateway.UpdateRestApiInput{
+			RestApiId: api.Id,
+			PatchOperations: []types.PatchOperation{{
+				Op:   types.OpAdd,
+				Path: aws.String("/binaryMediaTypes/" + strings.ReplaceAll(binaryMediaType, "/", "~1")),
+			}},
+		})
+		if err != nil {
+			return Deployment{}, fmt.Errorf("cannot set binary media types of api %s: %w", *api.Id, classify(err))
+		}
+		repaired = true
+	}
+
+	stage := restStage(api)
+	current, err := client.GetStage(ctx, &apigateway.GetStageInput{RestApiId: api.Id, StageName: &stage})
+	var notFound *types.NotFoundException
+	switch {
+	case errors.As(err, &notFound):
+		repaired = true
+	case err != nil:
+		return Deployment{}, fmt.Errorf("cannot get stage of api %s: %w", *api.Id, classify(err))
+	case readsTarget:
+		target, ok := current.Variables[targetVariable]
+		if ok && target != variables[targetVariable] {
+			return Deployment{}, fmt.Errorf("%w: api %s in region %s proxies to %s, not %s", ErrApiExists, *api.Id, region, target, variables[targetVariable])
+		}
+		repaired = repaired || !ok
+	}
+
+	if repaired {
+		ag.logger.Info("redeploying repaired gateway", "region", region, "id", *api.Id)
+		_, err := client.CreateDeployment(ctx, &apigateway.CreateDeploymentInput{
+			RestApiId: api.Id,
+			StageName: &stage,
+			Variables: variables,
+		})
+		if err != nil {
+			return Deployment{}, fmt.Errorf("cannot create deployment: %w", classify(err))
+		}
+	}
+
+	d := restDeployment(region, *api.Id, stage, aws.ToTime(api.CreatedDate))
+	d.IAMAuth = ag.iamAuth
+	if ag.apiKeys {
+		if d.APIKey, err = findAPIKey(ctx, client, *api.Id); err != nil {
+			return Deployment{}, err
+		}
+	}
+	if ag.domainZone != "" {
+		domain, err := ag.createCustomDomain(ctx, creds, region, *api.Id, stage, site)
+		if err != nil {
+			return Deployment{}, err
+		}
+		useDomain(&d, domain)
+	}
+	ag.markAdopted(d)
+	return d, nil
+}
+
+// findHttpApi returns the first HTTP API in region that match selects, or nil,
+// paging through the APIs until one matches.
+func findHttpApi(ctx context.Context, client *apigatewayv2.Client, region string, match func(v2types.Api) bool) (*v2types.Api, error) {
+	input := &apigatewayv2.GetApisInput{}
+	for {
+		output, err := client.GetApis(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get http apis in %s: %w", region, classify(err))
+		}
+		for _, api := range output.Items {
+			if match(api) {
+				return &api, nil
+			}
+		}
+		if output.NextToken == nil {
+			return nil, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// adoptHttpGateway checks that the $default route of api proxies to site
+// and recreates the route and stage when they are missing.
+func (ag *ApiGateway) adoptHttpGateway(ctx context.Context, client *apigatewayv2.Client, region string, api v2types.Api, site string) (Deployment, error) {
+	ag.logger.Info("adopting gateway", "region", region, "id", *api.ApiId)
+
+	routes, err := client.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{ApiId: api.ApiId})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("cannot get routes of api %s: %w", *api.ApiId, classify(err))
+	}
+	var route *v2types.Route
+	for i := range routes.Items {
+		if aws.ToString(routes.Items[i].RouteKey) == "$default" {
+			route = &routes.Items[i]
+		}
+	}
+
+	healthy := false
+	if route != nil && strings.HasPrefix(aws.ToString(route.Target), "integrations/") {
+		integration, err := client.GetIntegration(ctx, &apigatewayv2.GetIntegrationInput{
+			ApiId:         api.ApiId,
+			IntegrationId: aws.String(strings.TrimPrefix(*route.Target, "integrations/")),
+		})
+		var notFound *v2types.NotFoundException
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return Deployment{}, fmt.Errorf("cannot get integration of api %s: %w", *api.ApiId, classify(err))
+		case aws.ToString(integration.IntegrationUri) != site:
+			return Deployment{}, fmt.Errorf("%w: api %s in region %s proxies to %s, not %s", ErrApiExists, *api.ApiId, region, aws.ToString(integration.IntegrationUri), site)
+		default:
+			healthy = true
+		}
+	}
+	if !healthy {
+		if route != nil {
+			if _, err := client.DeleteRoute(ctx, &apigatewayv2.DeleteRouteInput{ApiId: api.ApiId, RouteId: route.RouteId}); err != nil {
+				return Deployment{}, fmt.Errorf("cannot delete broken default route: %w", classify(err))
+			}
+		}
+		if err := ag.putHttpProxyRoute(ctx, client, *api.ApiId, site); err != nil {
+			return Deployment{}, err
+		}
+	}
+
+	_, err = client.GetStage(ctx, &apigatewayv2.GetStageInput{ApiId: api.ApiId, StageName: aws.String(httpStageName)})
+	var notFound *v2types.NotFoundException
+	if errors.As(err, &notFound) {
+		_, err = client.CreateStage(ctx, &apigatewayv2.CreateStageInput{
+			ApiId:      api.ApiId,
+			StageName:  aws.String(httpStageName),
+			AutoDeploy: aws.Bool(true),
+		})
+		if err != nil {
+			return Deployment{}, fmt.Errorf("cannot create stage: %w", classify(err))
+		}
+	} else if err != nil {
+		return Deployment{}, fmt.Errorf("cannot get stage of api %s: %w", *api.ApiId, classify(err))
+	}
+
+	d := httpDeployment(region, *api.ApiId, aws.ToTime(api.CreatedDate))
+	ag.markAdopted(d)
+	return d, nil
+}
+
+// markAdopted records that d existed before this session.
+func (ag *ApiGateway) markAdopted(d Deployment) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.adopted == nil {
+		ag.adopted = make(map[string]bool)
+	}
+	ag.adopted[d.Host] = true
+}
@@ -0,0 +1,121 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+const (
+	// DefaultBillingAlarmName names the alarm and the topic of a
+	// BillingAlarm without a name.
+	DefaultBillingAlarmName = "apigateway-rotator-billing"
+
+	// billingRegion is the only region with the AWS/Billing metrics.
+	billingRegion = "us-east-1"
+	// billingPeriod is how often the estimated charges are published.
+	billingPeriod = 6 * 60 * 60
+)
+
+// BillingAlarm is a CloudWatch alarm on the estimated API Gateway charges of
+// the month, notifying an SNS topic. The billing alerts must be enabled in the
+// billing preferences of the account for the metric to exist.
+type BillingAlarm struct {
+	// Threshold is the amount in USD the alarm goes off at.
+	Threshold float64
+	// Email, if set, is subscribed to the topic. AWS sends it a message to
+	// confirm the subscription first.
+	Email string
+	// Name of the alarm and of the topic, DefaultBillingAlarmName if empty.
+	Name string
+}
+
+// BillingAlarmSetup is a BillingAlarm created in an account of the pool.
+type BillingAlarmSetup struct {
+	// Account is the name of the account, empty for the default one.
+	Account   string
+	AlarmName string
+	TopicARN  string
+}
+
+// SetupBillingAlarm creates or updates alarm in every account of the pool.
+// It can be called again to change the threshold or add an email. The
+// accounts that could be set up are returned along with a joined error of
+// the others.
+func (ag *ApiGateway) SetupBillingAlarm(ctx context.Context, alarm BillingAlarm) ([]BillingAlarmSetup, error) {
+	if alarm.Threshold <= 0 {
+		return nil, errors.New("billing alarm threshold must be positive")
+	}
+	if alarm.Name == "" {
+		alarm.Name = DefaultBillingAlarmName
+	}
+
+	var setups []BillingAlarmSetup
+	var errs []error
+	for _, a := range ag.awsAccounts() {
+		topic, err := ag.setupBillingAlarm(ctx, a.creds, alarm)
+		if err != nil {
+			if a.name != "" {
+				err = fmt.Errorf("account %s: %w", a.name, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		ag.logger.Info("billing alarm set up", "account", a.name, "alarm", alarm.Name, "threshold", alarm.Threshold, "topic", topic)
+		setups = append(setups, BillingAlarmSetup{Account: a.name, AlarmName: alarm.Name, TopicARN: topic})
+	}
+	return setups, errors.Join(errs...)
+}
+
+// setupBillingAlarm creates alarm and its topic with creds and returns the ARN
+// of the topic.
+func (ag *ApiGateway) setupBillingAlarm(ctx context.Context, creds *credentialSet, alarm BillingAlarm) (string, error) {
+	cfg, err := ag.awsConfig(ctx, creds, billingRegion)
+	if err != nil {
+		return "", err
+	}
+
+	// topics are created once per name, creating it again returns its ARN
+	topics := sns.NewFromConfig(cfg)
+	topic, err := topics.CreateTopic(ctx, &sns.CreateTopicInput{Name: &alarm.Name})
+	if err != nil {
+		return "", fmt.Errorf("cannot create topic %s: %w", alarm.Name, classify(err))
+	}
+	if alarm.Email != "" {
+		_, err := topics.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn: topic.TopicArn,
+			Protocol: aws.String("email"),
+			Endpoint: &alarm.Email,
+		})
+		if err != nil {
+			return "", fmt.Errorf("cannot subscribe %s to topic %s: %w", alarm.Email, alarm.Name, classify(err))
+		}
+	}
+
+	_, err = cloudwatch.NewFromConfig(cfg).PutMetricAlarm(ctx, &cloudwatch.PutMetricAlarmInput{
+		AlarmName:        &alarm.Name,
+		AlarmDescription: aws.String("Estimated API Gateway charges of the month, set up by apigateway-rotator"),
+		Namespace:        aws.String("AWS/Billing"),
+		MetricName:       aws.String("EstimatedCharges"),
+		Dimensions: []cwtypes.Dimension{
+			{Name: aws.String("ServiceName"), Value: aws.String("AmazonApiGateway")},
+			{Name: aws.String("Currency"), Value: aws.String("USD")},
+		},
+		Statistic:          cwtypes.StatisticMaximum,
+		Period:             aws.Int32(billingPeriod),
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          &alarm.Threshold,
+		ComparisonOperator: cwtypes.ComparisonOperatorGreaterThanOrEqualToThreshold,
+		TreatMissingData:   aws.String("notBreaching"),
+		AlarmActions:       []string{aws.ToString(topic.TopicArn)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot create alarm %s: %w", alarm.Name, classify(err))
+	}
+	return aws.ToString(topic.TopicArn), nil
+}
@@ -0,0 +1,147 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+// APIKeyHeader is the header carrying the API key of a gateway created with
+// WithAPIKey.
+const APIKeyHeader = "X-Api-Key"
+
+// WithAPIKey makes the REST APIs created for the pool require an API key, so
+// that nobody who finds their URL can use them. Each API gets its own key and
+// usage plan, named after the API and deleted with it, and requests rerouted
+// through the pool carry the key in APIKeyHeader. Gateways discovered or
+// adopted by the pool use the key created with them, if any. HTTP APIs have
+// no API keys.
+func WithAPIKey() Option {
+	return func(ag *ApiGateway) {
+		ag.apiKeys = true
+	}
+}
+
+// apiKeyName is the name of the API key and of the usage plan of the REST API
+// id.
+func apiKeyName(id string) string {
+	return "apigateway-rotator-" + id
+}
+
+// createAPIKey creates the API key of the REST API id proxying to site and a
+// usage plan allowing it on stage, and returns the value of the key.
+func (ag *ApiGateway) createAPIKey(ctx context.Context, client RestAPIClient, id, stage, site string) (string, error) {
+	name := apiKeyName(id)
+	key, err := client.CreateApiKey(ctx, &apigateway.CreateApiKeyInput{
+		Name:        &name,
+		Description: aws.String("API key of a gateway of apigateway-rotator"),
+		Enabled:     true,
+		Tags:        ag.tags(site),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot create api key: %w", classify(err))
+	}
+	plan, err := client.CreateUsagePlan(ctx, &apigateway.CreateUsagePlanInput{
+		Name:      &name,
+		ApiStages: []types.ApiStage{{ApiId: &id, Stage: &stage}},
+		Tags:      ag.tags(site),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot create usage plan: %w", classify(err))
+	}
+	_, err = client.CreateUsagePlanKey(ctx, &apigateway.CreateUsagePlanKeyInput{
+		UsagePlanId: plan.Id,
+		KeyId:       key.Id,
+		KeyType:     aws.String("API_KEY"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot add api key to usage plan: %w", classify(err))
+	}
+	return aws.ToString(key.Value), nil
+}
+
+// findAPIKey returns the value of the API key of the REST API id, "" if it has
+// none.
+func findAPIKey(ctx context.Context, client RestAPIClient, id string) (string, error) {
+	name := apiKeyName(id)
+	output, err := client.GetApiKeys(ctx, &apigateway.GetApiKeysInput{NameQuery: &name, IncludeValues: aws.Bool(true)})
+	if err != nil {
+		return "", fmt.Errorf("cannot get api keys: %w", classify(err))
+	}
+	for _, key := range output.Items {
+		if aws.ToString(key.Name) == name {
+			return aws.ToString(key.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// deleteAPIKey deletes the usage plan and the API key of the REST API id, if
+// it has them. It must be called before the API is deleted, a usage plan
+// cannot be deleted while it has stages.
+func deleteAPIKey(ctx context.Context, client RestAPIClient, id string) error {
+	name := apiKeyName(id)
+	output, err := client.GetApiKeys(ctx, &apigateway.GetApiKeysInput{NameQuery: &name})
+	if err != nil {
+		return fmt.Errorf("cannot get api keys: %w", classify(err))
+	}
+	var keys []types.ApiKey
+	for _, key := range output.Items {
+		if aws.ToString(key.Name) == name {
+			keys = append(keys, key)
+		}
+	}
+	// the usage plan is created after the key, most APIs have neither
+	if len(keys) == 0 {
+		return nil
+	}
+
+	paginator := apigateway.NewGetUsagePlansPaginator(client, &apigateway.GetUsagePlansInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot get usage plans: %w", classify(err))
+		}
+		for _, plan := range page.Items {
+			if aws.ToString(plan.Name) != name {
+				continue
+			}
+			var remove []types.PatchOperation
+			for _, stage := range plan.ApiStages {
+				remove = append(remove, types.PatchOperation{
+					Op:    types.OpRemove,
+					Path:  aws.String("/apiStages"),
+					Value: aws.String(aws.ToString(stage.ApiId) + ":" + aws.ToString(stage.Stage)),
+				})
+			}
+			if len(remove) > 0 {
+				if _, err := client.UpdateUsagePlan(ctx, &apigateway.UpdateUsagePlanInput{UsagePlanId: plan.Id, PatchOperations: remove}); err != nil {
+					return fmt.Errorf("cannot remove stages from usage plan %s: %w", name, classify(err))
+				}
+			}
+			if _, err := client.DeleteUsagePlan(ctx, &apigateway.DeleteUsagePlanInput{UsagePlanId: plan.Id}); ignoreNotFound(err) != nil {
+				return fmt.Errorf("cannot delete usage plan %s: %w", name, classify(err))
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if _, err := client.DeleteApiKey(ctx, &apigateway.DeleteApiKeyInput{ApiKey: key.Id}); ignoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete api key %s: %w", name, classify(err))
+		}
+	}
+	return nil
+}
+
+// ignoreNotFound returns nil for the error of a resource that is already gone.
+func ignoreNotFound(err error) error {
+	var notFound *types.NotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	return err
+}
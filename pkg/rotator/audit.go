@@ -0,0 +1,97 @@
+package rotator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// auditRedacted are the request headers whose value the audit log never
+// records.
+var auditRedacted = []string{"Authorization", "Proxy-Authorization", "Cookie", APIKeyHeader}
+
+// AuditRecord is a line of the audit log: a request sent to the site,
+// through an endpoint or directly.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Pool   string    `json:"pool"`
+	Method string    `json:"method"`
+	URL    string    `json:"url"`
+	// Endpoint, Region and Provider are those of the gateway the request was
+	// sent through, empty when it was sent directly.
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Direct   bool   `json:"direct,omitempty"`
+	// Status is 0 when no response was received.
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	BytesOut  int64   `json:"bytes_out"`
+	BytesIn   int64   `json:"bytes_in"`
+	Error     string  `json:"error,omitempty"`
+	// Headers of the request, with WithAuditLog and headers set.
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// WithAuditLog writes an AuditRecord for every request sent to the site to w,
+// as one JSON object per line, to keep a record of the activity of an
+// engagement. The bodies are never recorded and the request headers only
+// when headers is set, credentials and cookies redacted. Lines are written
+// whole, w can be shared by several pools.
+func WithAuditLog(w io.Writer, headers bool) Option {
+	return func(ag *ApiGateway) {
+		ag.audit = &auditLog{enc: json.NewEncoder(w), headers: headers}
+	}
+}
+
+// auditLog serializes the records written to its writer.
+type auditLog struct {
+	headers bool
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// auditRequest records req, sent to the site through endpoint, or directly
+// when endpoint is "".
+func (ag *ApiGateway) auditRequest(req *http.Request, d Deployment, endpoint string, resp *http.Response, err error, latency time.Duration) {
+	a := ag.audit
+	if a == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:      time.Now().Add(-latency),
+		Pool:      ag.Name,
+		Method:    req.Method,
+		URL:       req.URL.Redacted(),
+		Endpoint:  endpoint,
+		Region:    d.Region,
+		Provider:  d.Provider,
+		Direct:    endpoint == "",
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		BytesOut:  max(req.ContentLength, 0),
+	}
+	if resp != nil {
+		r.Status = resp.StatusCode
+		r.BytesIn = max(resp.ContentLength, 0)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if a.headers {
+		r.Headers = req.Header.Clone()
+		for _, name := range auditRedacted {
+			if r.Headers.Get(name) != "" {
+				r.Headers.Set(name, "REDACTED")
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(r); err != nil {
+		ag.logger.Warn("cannot write audit log", "error", err)
+	}
+}
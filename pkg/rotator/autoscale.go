@@ -0,0 +1,215 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults used by Autoscaler when its fields are zero.
+const (
+	DefaultScaleInterval       = 30 * time.Second
+	DefaultScaleWindow         = 2 * time.Minute
+	DefaultScaleGrace          = 10 * time.Minute
+	DefaultRequestsPerEndpoint = 5
+	DefaultThrottleRatio       = 0.05
+)
+
+type extraKey struct{}
+
+// Autoscaler adds endpoints to Gateway while its traffic is sustained, and
+// deletes them once it is idle. Every Interval it looks at the requests sent
+// since the previous look: when they were over RequestsPerEndpoint per
+// second and endpoint, or more than ThrottleRatio of them were answered 429,
+// for Window, it creates an endpoint in the region of Gateway with the fewest.
+// When they were under a quarter of RequestsPerEndpoint for GracePeriod, it
+// deletes the last endpoint it added. Endpoints are neither added over Max
+// nor while the budget of the pool is spent, and the endpoints the pool had
+// are never deleted.
+type Autoscaler struct {
+	Gateway *ApiGateway
+
+	// Max is the number of endpoints the pool is not scaled over.
+	Max int
+	// RequestsPerEndpoint is the rate of requests per second and endpoint
+	// the pool is scaled up over.
+	RequestsPerEndpoint float64
+	// ThrottleRatio is the share of throttled requests the pool is scaled up
+	// over.
+	ThrottleRatio float64
+	// Interval between two looks at the traffic.
+	Interval time.Duration
+	// Window is how long the traffic has to be over before an endpoint is
+	// added, and between two additions.
+	Window time.Duration
+	// GracePeriod is how long the traffic has to be idle before an added
+	// endpoint is deleted, and between two deletions.
+	GracePeriod time.Duration
+
+	mu        sync.Mutex
+	last      Stats
+	lastAt    time.Time
+	overSince time.Time
+	idleSince time.Time
+	added     []Deployment
+}
+
+// NewAutoscaler returns an Autoscaler for ag scaling up to max endpoints with
+// the default settings.
+func NewAutoscaler(ag *ApiGateway, max int) *Autoscaler {
+	return &Autoscaler{
+		Gateway:             ag,
+		Max:                 max,
+		RequestsPerEndpoint: DefaultRequestsPerEndpoint,
+		ThrottleRatio:       DefaultThrottleRatio,
+		Interval:            DefaultScaleInterval,
+		Window:              DefaultScaleWindow,
+		GracePeriod:         DefaultScaleGrace,
+	}
+}
+
+// Run scales the pool every Interval until ctx is done.
+func (a *Autoscaler) Run(ctx context.Context) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultScaleInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Scale(ctx); err != nil {
+			a.Gateway.logger.Warn("cannot scale pool", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scale looks at the traffic since the previous call and adds or deletes an
+// endpoint if it has been over or idle for long enough.
+func (a *Autoscaler) Scale(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	current := a.Gateway.Stats()
+	last, lastAt := a.last, a.lastAt
+	a.last, a.lastAt = current, now
+	if lastAt.IsZero() {
+		return nil
+	}
+	endpoints := a.Gateway.Endpoints.Len()
+	requests := float64(current.Requests - last.Requests)
+	throttled := float64(current.Throttled - last.Throttled)
+	rate := requests / now.Sub(lastAt).Seconds() / float64(max(endpoints, 1))
+
+	perEndpoint := a.RequestsPerEndpoint
+	if perEndpoint <= 0 {
+		perEndpoint = DefaultRequestsPerEndpoint
+	}
+	ratio := a.ThrottleRatio
+	if ratio <= 0 {
+		ratio = DefaultThrottleRatio
+	}
+	over := rate > perEndpoint || (requests > 0 && throttled/requests > ratio)
+	idle := rate < perEndpoint/4
+	if !over {
+		a.overSince = time.Time{}
+	} else if a.overSince.IsZero() {
+		a.overSince = now
+	}
+	if !idle {
+		a.idleSince = time.Time{}
+	} else if a.idleSince.IsZero() {
+		a.idleSince = now
+	}
+
+	switch {
+	case over && now.Sub(a.overSince) >= orDefault(a.Window, DefaultScaleWindow):
+		a.overSince = now
+		if endpoints >= a.Max {
+			a.Gateway.logger.Debug("pool at its maximum size, not scaling up", "endpoints", endpoints, "max", a.Max)
+			return nil
+		}
+		if b := a.Gateway.budget; b != nil {
+			if err := b.exceeded(now); err != nil {
+				a.Gateway.logger.Debug("budget spent, not scaling up", "error", err)
+				return nil
+			}
+		}
+		d, err := a.Gateway.createExtra(ctx)
+		if err != nil {
+			return err
+		}
+		a.added = append(a.added, d)
+		a.Gateway.logger.Info("pool scaled up", "region", d.Region, "endpoint", d.Host, "rate", rate, "throttled", throttled/max(requests, 1), "endpoints", a.Gateway.Endpoints.Len())
+		return nil
+	case idle && len(a.added) > 0 && now.Sub(a.idleSince) >= orDefault(a.GracePeriod, DefaultScaleGrace):
+		a.idleSince = now
+		return a.scaleDown(ctx, rate)
+	}
+	return nil
+}
+
+// createExtra creates an endpoint on top of those of the regions, in the
+// region with the fewest, trying the others in turn if it fails, and adds it
+// to the pool.
+func (ag *ApiGateway) createExtra(ctx context.Context) (Deployment, error) {
+	count := make(map[string]int)
+	for _, d := range ag.Deployments() {
+		count[d.Region]++
+	}
+	regions := slices.Clone(ag.Regions)
+	slices.SortStableFunc(regions, func(a, b string) int { return count[a] - count[b] })
+
+	var errs []error
+	for _, region := range regions {
+		if ag.quotaCheck {
+			if _, err := ag.checkQuotas(ctx, []Provider{ag.provider}, []string{region}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		d, err := ag.createWith(ag.provider, region, context.WithValue(ctx, extraKey{}, true))
+		if err != nil {
+			errs = append(errs, &RegionError{Region: region, Err: err})
+			continue
+		}
+		ag.mu.Lock()
+		ag.addDeployment(d)
+		ag.mu.Unlock()
+		return d, nil
+	}
+	return Deployment{}, errors.Join(errs...)
+}
+
+// scaleDown deletes the last endpoint added.
+func (a *Autoscaler) scaleDown(ctx context.Context, rate float64) error {
+	d := a.added[len(a.added)-1]
+	if err := a.Gateway.DeleteDeployment(ctx, d); err != nil {
+		return err
+	}
+	a.added = a.added[:len(a.added)-1]
+	a.Gateway.logger.Info("pool scaled down", "region", d.Region, "endpoint", d.Host, "rate", rate, "endpoints", a.Gateway.Endpoints.Len())
+	return nil
+}
+
+// extraEndpoint reports whether ctx creates an endpoint on top of those of
+// the regions, for an Autoscaler or a Reconciler.
+func extraEndpoint(ctx context.Context) bool {
+	extra, _ := ctx.Value(extraKey{}).(bool)
+	return extra
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
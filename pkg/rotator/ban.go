@@ -0,0 +1,162 @@
+package rotator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// banSnippetSize is how much of a response body is shown to ban detectors.
+const banSnippetSize = 8 << 10
+
+// BanDetector recognizes responses showing that the target blocked the
+// endpoint a request went through, such as WAF block pages or CAPTCHAs.
+// Implementations must be safe for concurrent use.
+type BanDetector interface {
+	// DetectBan gets the status and headers of a response and at most the
+	// first 8 KiB of its body, which is nil for compressed and non-text
+	// content, for event streams and for bodies of unknown length. It returns
+	// why the response is a ban, or "" when it is not.
+	DetectBan(status int, header http.Header, body []byte) string
+}
+
+// BanDetectorFunc adapts a function to a BanDetector.
+type BanDetectorFunc func(status int, header http.Header, body []byte) string
+
+// DetectBan implements BanDetector.
+func (f BanDetectorFunc) DetectBan(status int, header http.Header, body []byte) string {
+	return f(status, header, body)
+}
+
+// SignatureDetector is a BanDetector matching known block pages. A response
+// matches when its status is one of Statuses, if any are set, and any of the
+// Headers or Body signatures is found.
+type SignatureDetector struct {
+	Reason   string
+	Statuses []int
+	// Headers maps a header name to a substring of its value, matched without
+	// regard to case. An empty substring only requires the header to be set.
+	Headers map[string]string
+	// Body are substrings of the body, matched as they are.
+	Body []string
+}
+
+// DetectBan implements BanDetector.
+func (d *SignatureDetector) DetectBan(status int, header http.Header, body []byte) string {
+	if len(d.Statuses) > 0 && !slices.Contains(d.Statuses, status) {
+		return ""
+	}
+	for name, want := range d.Headers {
+		if values := header.Values(name); len(values) > 0 &&
+			strings.Contains(strings.ToLower(strings.Join(values, ",")), strings.ToLower(want)) {
+			return d.Reason
+		}
+	}
+	for _, want := range d.Body {
+		if bytes.Contains(body, []byte(want)) {
+			return d.Reason
+		}
+	}
+	return ""
+}
+
+// Built-in detectors.
+var (
+	// CloudflareDetector matches Cloudflare block pages and JS challenges.
+	CloudflareDetector = &SignatureDetector{
+		Reason:   "cloudflare block",
+		Statuses: []int{http.StatusForbidden, http.StatusServiceUnavailable, http.StatusTooManyRequests},
+		Headers:  map[string]string{"Cf-Mitigated": "challenge"},
+		Body:     []string{"Attention Required! | Cloudflare", "cf-error-details", "/cdn-cgi/challenge-platform/", "Just a moment..."},
+	}
+
+	// AkamaiDetector matches the Access Denied page of Akamai edge servers.
+	AkamaiDetector = &SignatureDetector{
+		Reason:   "akamai block",
+		Statuses: []int{http.StatusForbidden},
+		Body:     []string{"errors.edgesuite.net", "You don't have permission to access"},
+	}
+
+	// CaptchaDetector matches CAPTCHA interstitials of common bot protections,
+	// whatever the status.
+	CaptchaDetector = &SignatureDetector{
+		Reason: "captcha",
+		Body: []string{
+			"g-recaptcha", "hcaptcha.com/1/api.js", "challenges.cloudflare.com/turnstile",
+			"captcha-delivery.com", "px-captcha", "geo.captcha-delivery.com",
+		},
+	}
+
+	// DefaultBanDetectors are used by WithBanDetection when no detector is given.
+	DefaultBanDetectors = []BanDetector{CloudflareDetector, AkamaiDetector, CaptchaDetector}
+)
+
+// WithBanDetection makes Transport run detectors, or DefaultBanDetectors when
+// none are given, on every response. A detected ban counts as a failure for the
+// selector and the circuit breaker, and as a blocked response for
+// WithAutoReplace, like a 403 or 429.
+func WithBanDetection(detectors ...BanDetector) Option {
+	return func(ag *ApiGateway) {
+		if len(detectors) == 0 {
+			detectors = DefaultBanDetectors
+		}
+		ag.banDetectors = detectors
+	}
+}
+
+// detectBan returns why resp is a ban, or "". The body snippet given to the
+// detectors, decompressed if the body is gzipped, is put back in front of
+// resp.Body as it was read. Streamed bodies are not read, the snippet would
+// hold the response back until enough of the stream arrived.
+func (ag *ApiGateway) detectBan(resp *http.Response) string {
+	if len(ag.banDetectors) == 0 || resp == nil {
+		return ""
+	}
+
+	var snippet []byte
+	if textual(resp.Header.Get("Content-Type")) && resp.Body != nil && !streamed(resp) {
+		switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+		case "", "identity":
+			snippet, _ = io.ReadAll(io.LimitReader(resp.Body, banSnippetSize))
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(snippet), resp.Body), resp.Body}
+		case "gzip":
+			// the caller asked for the compressed body, it gets back the
+			// bytes read to decompress the snippet followed by the rest
+			var raw bytes.Buffer
+			if zr, err := gzip.NewReader(io.TeeReader(resp.Body, &raw)); err == nil {
+				snippet, _ = io.ReadAll(io.LimitReader(zr, banSnippetSize))
+			}
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(&raw, resp.Body), resp.Body}
+		}
+		// other encodings, like br, are passed through without a look
+	}
+	for _, detector := range ag.banDetectors {
+		if reason := detector.DetectBan(resp.StatusCode, resp.Header, snippet); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// streamed reports whether the body of resp may arrive in parts over time: an
+// event stream or a body of unknown length.
+func streamed(resp *http.Response) bool {
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return resp.ContentLength < 0 || strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream")
+}
+
+// textual reports whether a Content-Type is worth looking into for block pages.
+func textual(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" || strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") || strings.Contains(contentType, "xml")
+}
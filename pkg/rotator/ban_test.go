@@ -0,0 +1,53 @@
+package rotator
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDetectBanStreams(t *testing.T) {
+	ag := &ApiGateway{banDetectors: DefaultBanDetectors}
+	const page = `<div class="g-recaptcha"></div>`
+
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          io.NopCloser(strings.NewReader(page)),
+		ContentLength: int64(len(page)),
+	}
+	if reason := ag.detectBan(resp); reason != "captcha" {
+		t.Errorf("detectBan = %q for a captcha page, want captcha", reason)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != page {
+		t.Errorf("body is %q after detectBan, want %q", body, page)
+	}
+
+	// a stream that sent nothing yet must not be waited for
+	streams := []struct {
+		contentType string
+		length      int64
+	}{
+		{contentType: "text/event-stream; charset=utf-8", length: 1 << 20},
+		{contentType: "text/html", length: -1},
+	}
+	for _, s := range streams {
+		r, w := io.Pipe()
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {s.contentType}},
+			Body:          r,
+			ContentLength: s.length,
+		}
+		if reason := ag.detectBan(resp); reason != "" {
+			t.Errorf("detectBan = %q for a stream, want no ban", reason)
+		}
+		go w.Write([]byte(page))
+		buf := make([]byte, len(page))
+		if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != page {
+			t.Errorf("read %q, %v from the stream after detectBan, want %q", buf, err, page)
+		}
+		w.Close()
+	}
+}
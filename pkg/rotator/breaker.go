@@ -0,0 +1,116 @@
+package rotator
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown is how long a tripped endpoint stays out of
+// selection when WithCircuitBreaker is given no cool-down.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// WithCircuitBreaker takes an endpoint out of selection for cooldown once
+// threshold requests in a row failed through it. After the cool-down a single
+// probe request is let through: the circuit closes again if it succeeds and
+// stays open for another cool-down if it fails.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(ag *ApiGateway) {
+		if cooldown <= 0 {
+			cooldown = DefaultBreakerCooldown
+		}
+		ag.breaker = &breaker{threshold: threshold, cooldown: cooldown, circuits: make(map[string]*circuit)}
+	}
+}
+
+// breaker keeps a circuit per endpoint.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	// openUntil is set while the circuit is open. Once it has passed the
+	// circuit is half-open and probe marks the request probing it.
+	openUntil time.Time
+	probe     time.Time
+}
+
+// available returns the endpoints whose circuit is closed, or half-open with
+// no probe in flight. Probes that never reported expire after a cool-down.
+func (b *breaker) available(endpoints []string) []string {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var result []string
+	for _, endpoint := range endpoints {
+		c := b.circuits[endpoint]
+		if c == nil || c.openUntil.IsZero() ||
+			(now.After(c.openUntil) && now.Sub(c.probe) > b.cooldown) {
+			result = append(result, endpoint)
+		}
+	}
+	return result
+}
+
+// selected marks the request about to go through endpoint as the probe of
+// its circuit when the circuit is half-open.
+func (b *breaker) selected(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[endpoint]; c != nil && !c.openUntil.IsZero() {
+		c.probe = time.Now()
+	}
+}
+
+// report records the outcome of a request through endpoint and reports
+// whether it changed the state of the circuit to open (tripped) or closed.
+func (b *breaker) report(endpoint string, success bool) (tripped, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[endpoint]
+	if success {
+		if c != nil {
+			closed = !c.openUntil.IsZero()
+			delete(b.circuits, endpoint)
+		}
+		return false, closed
+	}
+
+	if c == nil {
+		c = &circuit{}
+		b.circuits[endpoint] = c
+	}
+	c.failures++
+	halfOpen := !c.openUntil.IsZero()
+	if halfOpen || c.failures >= b.threshold {
+		c.openUntil = time.Now().Add(b.cooldown)
+		c.probe = time.Time{}
+		return !halfOpen, false
+	}
+	return false, false
+}
+
+// reportCircuit feeds the outcome of a request through endpoint to the
+// circuit breaker, if there is one.
+func (ag *ApiGateway) reportCircuit(endpoint string, success bool) {
+	if ag.breaker == nil {
+		return
+	}
+	switch tripped, closed := ag.breaker.report(endpoint, success); {
+	case tripped:
+		ag.logger.Warn("circuit opened", "endpoint", endpoint, "cooldown", ag.breaker.cooldown)
+	case closed:
+		ag.logger.Info("circuit closed", "endpoint", endpoint)
+	}
+}
+
+// remove forgets the circuit of an endpoint that left the pool.
+func (b *breaker) remove(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.circuits, endpoint)
+}
@@ -0,0 +1,149 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is in the *BudgetError of the requests refused because
+// the budget of the pool is spent.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// DefaultBudgetPeriod is the period of a Budget without one.
+const DefaultBudgetPeriod = 24 * time.Hour
+
+// Budget caps the estimated cost of the requests sent through a pool.
+type Budget struct {
+	// Limit is the most USD spent per Period.
+	Limit float64
+	// Period is how often the spending starts over, on multiples of Period
+	// since the zero time: a day starts at midnight UTC. DefaultBudgetPeriod
+	// when 0.
+	Period time.Duration
+	// Pricing prices the requests, DefaultPricing when zero.
+	Pricing Pricing
+	// Direct sends the requests over the budget straight to their
+	// destination, without the gateways, instead of refusing them.
+	Direct bool
+}
+
+// BudgetError is returned by Transport for the requests over the budget.
+type BudgetError struct {
+	Limit float64
+	Spent float64
+	// Reset is when the spending starts over.
+	Reset time.Time
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("budget of $%.2f exceeded with $%.2f spent, until %s", e.Limit, e.Spent, e.Reset.Format(time.RFC3339))
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// WithBudget makes Transport stop sending requests through the gateways once
+// their estimated cost reaches budget. The cost is estimated from the number
+// of requests and the bytes of their response bodies, charged once a body is
+// read or closed.
+func WithBudget(budget Budget) Option {
+	return func(ag *ApiGateway) {
+		if budget.Period <= 0 {
+			budget.Period = DefaultBudgetPeriod
+		}
+		if budget.Pricing == (Pricing{}) {
+			budget.Pricing = DefaultPricing
+		}
+		ag.budget = &budgetTracker{budget: budget}
+	}
+}
+
+// Spent returns the estimated cost of the requests sent in the current
+// period of the budget, and when the period ends. It is 0 without a budget.
+func (ag *ApiGateway) Spent() (float64, time.Time) {
+	if ag.budget == nil {
+		return 0, time.Time{}
+	}
+	b := ag.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(time.Now())
+	return b.spent, b.start.Add(b.budget.Period)
+}
+
+// budgetTracker adds up the cost of the requests of the current period.
+type budgetTracker struct {
+	budget Budget
+
+	mu     sync.Mutex
+	start  time.Time
+	spent  float64
+	warned bool
+}
+
+// roll starts a new period if the current one is over. b.mu must be held.
+func (b *budgetTracker) roll(now time.Time) {
+	if start := now.Truncate(b.budget.Period); start.After(b.start) {
+		b.start = start
+		b.spent = 0
+		b.warned = false
+	}
+}
+
+// check returns a *BudgetError once the budget is spent. The first time in a
+// period, it also reports that the caller should say so.
+func (b *budgetTracker) check(now time.Time) (*BudgetError, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(now)
+	if b.spent < b.budget.Limit {
+		return nil, false
+	}
+	first := !b.warned
+	b.warned = true
+	return &BudgetError{Limit: b.budget.Limit, Spent: b.spent, Reset: b.start.Add(b.budget.Period)}, first
+}
+
+// exceeded returns a *BudgetError once the budget is spent, like check, but
+// leaves saying so to the requests.
+func (b *budgetTracker) exceeded(now time.Time) *BudgetError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(now)
+	if b.spent < b.budget.Limit {
+		return nil
+	}
+	return &BudgetError{Limit: b.budget.Limit, Spent: b.spent, Reset: b.start.Add(b.budget.Period)}
+}
+
+// charge adds a request sent through an endpoint of provider that answered
+// bytes.
+func (b *budgetTracker) charge(provider string, bytes int64) {
+	backend, ok := backendOf(provider)
+	if !ok {
+		return
+	}
+	cost := b.budget.Pricing.request(backend, bytes)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(time.Now())
+	b.spent += cost
+}
+
+// overBudget handles a request sent when the budget is spent: it is sent
+// directly with Budget.Direct, refused otherwise.
+func (t *Transport) overBudget(req *http.Request, err *BudgetError, first bool) (*http.Response, error) {
+	direct := t.Gateway.budget.budget.Direct
+	if first {
+		t.Gateway.logger.Warn("budget exceeded", "limit", err.Limit, "spent", err.Spent, "reset", err.Reset, "direct", direct)
+		t.Gateway.emit(Event{Type: EventBudgetExceeded, Error: err.Error()})
+	}
+	if !direct {
+		return nil, err
+	}
+	return t.direct(req)
+}
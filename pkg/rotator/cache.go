@@ -0,0 +1,321 @@
+package rotator
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the size in bytes of the bodies a MemoryCache keeps.
+const DefaultCacheSize = 256 << 20
+
+// MaxCachedBody is the size of the largest body cached, larger responses are
+// passed through as they arrive.
+const MaxCachedBody = 10 << 20
+
+// cacheableStatus are the statuses that are cached, those RFC 9111 lets a
+// cache store without an explicit freshness. Refusals like 403 and 429 are
+// never cached, whatever the site says.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// CachedResponse is a response stored in a Cache.
+type CachedResponse struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+	Stored  time.Time   `json:"stored"`
+	Expires time.Time   `json:"expires"`
+}
+
+// Cache stores responses by key. Implementations must be safe for
+// concurrent use; they may drop responses at any time.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, r *CachedResponse)
+}
+
+// WithCache answers GET and HEAD requests from c while the response they got
+// is fresh, so that repeated fetches of the same assets are not sent through
+// the gateways and paid again. Freshness follows the Cache-Control max-age,
+// s-maxage and Expires of the site; responses without any are kept for ttl,
+// or not cached if ttl is 0. Responses marked no-store, no-cache or private,
+// requests that ask for no-cache or carry credentials, and responses that
+// vary on anything but Accept-Encoding are never answered from the cache.
+func WithCache(c Cache, ttl time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.cache = c
+		ag.cacheTTL = ttl
+	}
+}
+
+// cacheKey returns the key of the response to req, and false if req cannot
+// be answered from the cache.
+func cacheKey(req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return "", false
+	}
+	if req.Body != nil && req.Body != http.NoBody || upgradeType(req) != "" {
+		return "", false
+	}
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" || req.Header.Get("Range") != "" {
+		return "", false
+	}
+	directives := cacheDirectives(req.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return "", false
+	}
+	if _, ok := directives["no-store"]; ok {
+		return "", false
+	}
+	if req.Header.Get("Pragma") == "no-cache" {
+		return "", false
+	}
+	return req.Method + " " + req.URL.String() + " " + req.Header.Get("Accept-Encoding"), true
+}
+
+// cacheDirectives parses the Cache-Control of h.
+func cacheDirectives(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// freshUntil returns until when resp may be answered from the cache, the zero
+// time if it must not be cached.
+func freshUntil(resp *http.Response, now time.Time, ttl time.Duration) time.Time {
+	if !cacheableStatus[resp.StatusCode] {
+		return time.Time{}
+	}
+	directives := cacheDirectives(resp.Header)
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return time.Time{}
+		}
+	}
+	for _, vary := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept-Encoding") {
+				return time.Time{}
+			}
+		}
+	}
+	if resp.Header.Get("Set-Cookie") != "" {
+		return time.Time{}
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if arg, ok := directives[d]; ok {
+			seconds, err := strconv.Atoi(arg)
+			if err != nil || seconds <= 0 {
+				return time.Time{}
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			return time.Time{}
+		}
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			// the clock of the site may differ from ours
+			return now.Add(at.Sub(date))
+		}
+		return at
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// cached answers req from the cache of the pool if it can, and caches the
+// response of forward otherwise.
+func (t *Transport) cached(req *http.Request, forward func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	ag := t.Gateway
+	key, ok := cacheKey(req)
+	if !ok {
+		return forward(req)
+	}
+	now := time.Now()
+	if c, ok := ag.cache.Get(key); ok && now.Before(c.Expires) {
+		ag.logger.Debug("response from cache", "url", req.URL.Redacted())
+		header := c.Header.Clone()
+		header.Set("Age", strconv.Itoa(int(now.Sub(c.Stored).Seconds())))
+		return &http.Response{
+			Status:        strconv.Itoa(c.Status) + " " + http.StatusText(c.Status),
+			StatusCode:    c.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(c.Body)),
+			ContentLength: int64(len(c.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := forward(req)
+	if err != nil {
+		return resp, err
+	}
+	expires := freshUntil(resp, now, ag.cacheTTL)
+	if expires.IsZero() || resp.ContentLength > MaxCachedBody {
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > MaxCachedBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	ag.cache.Set(key, &CachedResponse{Status: resp.StatusCode, Header: resp.Header.Clone(), Body: body, Stored: now, Expires: expires})
+	return resp, nil
+}
+
+// MemoryCache is a Cache in memory that drops the least recently used
+// responses once their bodies take more than its size.
+type MemoryCache struct {
+	size int64
+
+	mu    sync.Mutex
+	used  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewMemoryCache returns a MemoryCache keeping size bytes of bodies,
+// DefaultCacheSize if 0.
+func NewMemoryCache(size int64) *MemoryCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &MemoryCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).response, true
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(key string, r *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	c.items[key] = c.order.PushFront(&memoryEntry{key, r})
+	c.used += int64(len(r.Body))
+	for c.used > c.size && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *MemoryCache) remove(e *list.Element) {
+	entry := c.order.Remove(e).(*memoryEntry)
+	delete(c.items, entry.key)
+	c.used -= int64(len(entry.response.Body))
+}
+
+// DiskCache is a Cache keeping a file per response in a directory, so that
+// the cache survives the process. Expired responses are deleted when they
+// are looked up.
+type DiskCache struct {
+	Dir string
+}
+
+// NewDiskCache returns a DiskCache in dir, which is created if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements Cache.
+func (c *DiskCache) Get(key string) (*CachedResponse, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var r CachedResponse
+	if err := json.Unmarshal(data, &r); err != nil || !time.Now().Before(r.Expires) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return &r, true
+}
+
+// Set implements Cache. The response is written to a temporary file first so
+// that readers never see half of it.
+func (c *DiskCache) Set(key string, r *CachedResponse) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp(c.Dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err = errors.Join(err, f.Close()); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
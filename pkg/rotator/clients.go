@@ -0,0 +1,105 @@
+package rotator
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ClientCache keeps the AWS configuration and the clients of every account
+// and region, so that credentials and metadata are loaded once instead of for
+// every call. Every pool has its own cache unless WithClientCache shares one,
+// for example between the pools of a Manager. Clients carry the tracing and
+// dry run middlewares of the pool that built them, so a shared cache only
+// hands them to pools with the same tracer provider, and never shares those
+// of dry run pools.
+type ClientCache struct {
+	mu      sync.Mutex
+	entries map[clientKey]any
+}
+
+// clientKey identifies a cached value: its kind, the account, the endpoint
+// URL, the region and the owner of the middlewares of the value.
+type clientKey struct {
+	kind     string
+	account  string
+	endpoint string
+	region   string
+	owner    any
+}
+
+// NewClientCache returns an empty ClientCache.
+func NewClientCache() *ClientCache {
+	return &ClientCache{entries: make(map[clientKey]any)}
+}
+
+// WithClientCache makes the pool take its AWS clients from cache.
+func WithClientCache(cache *ClientCache) Option {
+	return func(ag *ApiGateway) {
+		ag.clients = cache
+	}
+}
+
+// Clear drops every cached configuration and client, for example after the
+// credentials changed.
+func (c *ClientCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// cached returns the value of key in c, building it on a miss. Errors are not
+// cached. The lock is not held while building, so two callers may build the
+// same value; the first one stored wins.
+func cached[T any](c *ClientCache, key clientKey, build func() (T, error)) (T, error) {
+	c.mu.Lock()
+	v, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return v.(T), nil
+	}
+
+	built, err := build()
+	if err != nil {
+		return built, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.entries[key]; ok {
+		return v.(T), nil
+	}
+	c.entries[key] = built
+	return built, nil
+}
+
+// clientKey returns the key of a value of kind for creds in region.
+func (ag *ApiGateway) clientKey(kind string, creds *credentialSet, region string) clientKey {
+	key := clientKey{kind: kind, account: creds.key(), endpoint: ag.endpointURL, region: region}
+	switch {
+	case ag.dryRun:
+		// the dry run middleware fakes the calls and logs them to ag
+		key.owner = ag
+	case ag.tracerProvider == nil:
+	case reflect.TypeOf(ag.tracerProvider).Comparable():
+		key.owner = ag.tracerProvider
+	default:
+		// a provider that cannot be a map key cannot be shared
+		key.owner = ag
+	}
+	return key
+}
+
+// baseConfig returns the cached AWS configuration of creds in region. Its
+// rate limit is shared by every client of the account and region.
+func (ag *ApiGateway) baseConfig(ctx context.Context, creds *credentialSet, region string) (aws.Config, error) {
+	return cached(ag.clients, ag.clientKey("config", creds, region), func() (aws.Config, error) {
+		cfg, err := creds.config(ctx, region)
+		if err != nil {
+			return cfg, err
+		}
+		ag.throttleAWS(&cfg)
+		return cfg, nil
+	})
+}
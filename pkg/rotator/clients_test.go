@@ -0,0 +1,27 @@
+package rotator
+
+import "testing"
+
+func TestClientKeyDryRun(t *testing.T) {
+	cache := NewClientCache()
+	live, err := NewApiGateway("https://example.com", "live", WithClientCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewApiGateway("https://example.com", "other", WithClientCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dryRun, err := NewApiGateway("https://example.com", "dry-run", WithClientCache(cache), WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(ag *ApiGateway) clientKey { return ag.clientKey("rest", ag.creds, "us-east-1") }
+	if key(live) != key(other) {
+		t.Error("pools with the same tracer provider do not share their clients")
+	}
+	if key(live) == key(dryRun) {
+		t.Error("a dry run pool shares the clients of a live pool")
+	}
+}
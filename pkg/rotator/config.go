@@ -0,0 +1,129 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv names the environment variable holding the path of the config file.
+const ConfigEnv = "ROTATOR_CONFIG"
+
+// Config is the content of a rotator config file:
+//
+//	regions: [eu, us-east-1]
+//	region_sets:
+//	  cheap: [us-east-1, us-east-2, eu-west-1]
+//	accounts:
+//	  - name: scan-1
+//	    profile: scan-1
+//	  - name: scan-2
+//	    role_arn: arn:aws:iam::123456789012:role/rotator
+//	strategy: round-robin
+//	allow_hosts: ["*.example.com"]
+//	deny_hosts: [admin.example.com, 10.0.0.0/8]
+//	pools:
+//	  - name: shop
+//	    site: https://shop.example.com
+type Config struct {
+	// Regions of the pool, region and set names alike.
+	Regions []string `yaml:"regions"`
+	// RegionSets defines extra region sets, taking precedence over RegionSets.
+	RegionSets map[string][]string `yaml:"region_sets"`
+	// Accounts to spread the gateways over, see WithAccounts.
+	Accounts []Account `yaml:"accounts"`
+	// Strategy is the endpoint selection strategy, see NewSelector.
+	Strategy string `yaml:"strategy"`
+	// Pools are the sites the daemon runs pools for.
+	Pools []PoolConfig `yaml:"pools"`
+	// AllowHosts and DenyHosts restrict the destinations, see HostPolicy.
+	AllowHosts []string `yaml:"allow_hosts"`
+	DenyHosts  []string `yaml:"deny_hosts"`
+}
+
+// PoolConfig is a pool of the daemon.
+type PoolConfig struct {
+	Name string `yaml:"name"`
+	Site string `yaml:"site"`
+}
+
+// DefaultConfigPath returns the path of the config file: $ROTATOR_CONFIG if
+// set, otherwise rotator/config.yaml in the user config directory.
+func DefaultConfigPath() string {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rotator", "config.yaml")
+}
+
+// LoadConfig reads the YAML config file at path. A missing file is an empty
+// config.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("cannot read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// WithConfig uses the regions, region sets, accounts, strategy and host
+// policy of c.
+// Regions given with WithRegions or RegionsEnv take precedence over c.Regions,
+// and a selector given with WithSelector over c.Strategy.
+func WithConfig(c Config) Option {
+	return func(ag *ApiGateway) {
+		ag.regionSets = c.RegionSets
+		ag.configRegions = c.Regions
+		ag.configStrategy = c.Strategy
+		ag.accountConfigs = append(ag.accountConfigs, c.Accounts...)
+		ag.hostPolicy = ag.hostPolicy.With(c.HostPolicy())
+	}
+}
+
+// HostPolicy returns the host policy of c.
+func (c Config) HostPolicy() HostPolicy {
+	return HostPolicy{Allow: c.AllowHosts, Deny: c.DenyHosts}
+}
+
+// Reconfigure applies the regions, region sets and strategy of c to a running
+// pool, as WithConfig would have, and creates gateways in the regions that have
+// none yet. In-flight requests are not affected. Accounts cannot be changed.
+func (ag *ApiGateway) Reconfigure(ctx context.Context, c Config) error {
+	if c.Strategy != "" && !ag.explicitSelector {
+		selector, err := NewSelector(c.Strategy)
+		if err != nil {
+			return err
+		}
+		ag.setSelector(selector)
+	}
+
+	ag.mu.Lock()
+	regionSets, configRegions := ag.regionSets, ag.configRegions
+	ag.regionSets, ag.configRegions = c.RegionSets, c.Regions
+	err := ag.resolveRegions()
+	if err != nil {
+		ag.regionSets, ag.configRegions = regionSets, configRegions
+	}
+	ag.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if ag.Site == "" {
+		return nil
+	}
+	return ag.InitializeMissing(ctx)
+}
@@ -0,0 +1,76 @@
+package rotator
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// ConnPool tunes the connections Transport keeps to the endpoints. Every
+// request of a scan goes to one of a few execute-api hosts, so keeping their
+// connections open, multiplexed over HTTP/2 where the endpoint offers it,
+// saves a TCP and TLS handshake per request.
+type ConnPool struct {
+	// MaxIdlePerHost is the number of idle connections kept to each host.
+	MaxIdlePerHost int
+	// IdleTimeout closes connections left idle for longer, 0 keeps them.
+	IdleTimeout time.Duration
+	// TLSSessions is the number of TLS sessions cached to resume handshakes
+	// of new connections, 0 disables resumption.
+	TLSSessions int
+	// DisableHTTP2 keeps every connection on HTTP/1.1.
+	DisableHTTP2 bool
+	// DNSCacheTTL is how long the addresses of a host are dialed without
+	// resolving it again, 0 resolves it for every connection. Hosts none of
+	// whose addresses can be reached are resolved again.
+	DNSCacheTTL time.Duration
+	// ParallelDial races the addresses of a host, IPv6 and IPv4 alternating,
+	// starting the next one when the previous ones did not connect within
+	// 250ms, instead of dialing them one after the other.
+	ParallelDial bool
+}
+
+// DefaultConnPool is the connection pool of gateways without WithConnPool.
+var DefaultConnPool = ConnPool{
+	MaxIdlePerHost: 64,
+	IdleTimeout:    90 * time.Second,
+	TLSSessions:    256,
+	DNSCacheTTL:    time.Minute,
+}
+
+// WithConnPool sets the connection pool Transport sends requests with, when
+// its Base is nil, instead of DefaultConnPool.
+func WithConnPool(pool ConnPool) Option {
+	return func(ag *ApiGateway) {
+		ag.conns = pool.transport()
+	}
+}
+
+// transport returns an http.Transport with the settings of p and those of
+// http.DefaultTransport for the rest, like proxies from the environment.
+func (p ConnPool) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 0
+	t.MaxIdleConnsPerHost = p.MaxIdlePerHost
+	t.IdleConnTimeout = p.IdleTimeout
+	if p.DNSCacheTTL > 0 || p.ParallelDial {
+		t.DialContext = newDialer(p.DNSCacheTTL, p.ParallelDial).DialContext
+	}
+	t.TLSClientConfig = &tls.Config{}
+	if p.TLSSessions > 0 {
+		t.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(p.TLSSessions)
+	}
+	// upgrade requests are always sent over HTTP/1.1
+	t.ForceAttemptHTTP2 = !p.DisableHTTP2
+	if p.DisableHTTP2 {
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// CloseIdleConnections closes the idle connections of the base transport.
+func (t *Transport) CloseIdleConnections() {
+	if c, ok := t.base().(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
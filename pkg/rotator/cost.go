@@ -0,0 +1,137 @@
+package rotator
+
+import (
+	"math"
+	"strings"
+)
+
+// Pricing are the API Gateway prices in USD costs are estimated with.
+type Pricing struct {
+	// RESTPerMillion and HTTPPerMillion are the prices of a million REST
+	// and HTTP API requests.
+	RESTPerMillion float64
+	HTTPPerMillion float64
+	// TransferPerGB is the price of a GB of responses sent to the internet.
+	TransferPerGB float64
+}
+
+// DefaultPricing are the us-east-1 prices of the first tier of requests.
+// Other regions cost up to about a third more.
+var DefaultPricing = Pricing{
+	RESTPerMillion: 3.50,
+	HTTPPerMillion: 1.00,
+	TransferPerGB:  0.09,
+}
+
+// httpMeteringBytes is the increment HTTP API requests are metered in: a
+// request and its response of 600 KB are billed as two requests.
+const httpMeteringBytes = 512 * 1024
+
+// Usage is the traffic of a pool over some period, a month for a monthly
+// estimate.
+type Usage struct {
+	Backend   Backend
+	Endpoints int
+	Requests  uint64
+	// TransferBytes adds up the size of the responses.
+	TransferBytes uint64
+}
+
+// Cost is the estimated cost of a Usage in USD. API Gateway endpoints are
+// only billed for their traffic, PerEndpoint is the share of each one.
+type Cost struct {
+	Requests    float64 `json:"requests"`
+	Transfer    float64 `json:"transfer"`
+	Total       float64 `json:"total"`
+	PerRequest  float64 `json:"per_request"`
+	PerEndpoint float64 `json:"per_endpoint"`
+}
+
+// Add returns the sum of c and o. The per request and per endpoint costs
+// are those of c.
+func (c Cost) Add(o Cost) Cost {
+	c.Requests += o.Requests
+	c.Transfer += o.Transfer
+	c.Total += o.Total
+	return c
+}
+
+// Estimate returns the cost of u.
+func (p Pricing) Estimate(u Usage) Cost {
+	perMillion := p.RESTPerMillion
+	billed := float64(u.Requests)
+	if u.Backend == BackendHTTP {
+		perMillion = p.HTTPPerMillion
+		if u.Requests > 0 {
+			average := float64(u.TransferBytes) / float64(u.Requests)
+			billed *= math.Max(1, math.Ceil(average/httpMeteringBytes))
+		}
+	}
+
+	c := Cost{
+		Requests: billed / 1e6 * perMillion,
+		Transfer: float64(u.TransferBytes) / 1e9 * p.TransferPerGB,
+	}
+	c.Total = c.Requests + c.Transfer
+	if u.Requests > 0 {
+		c.PerRequest = c.Total / float64(u.Requests)
+	}
+	if u.Endpoints > 0 {
+		c.PerEndpoint = c.Total / float64(u.Endpoints)
+	}
+	return c
+}
+
+// request returns the cost of one request of backend answering bytes.
+func (p Pricing) request(backend Backend, bytes int64) float64 {
+	bytes = max(bytes, 0)
+	perMillion := p.RESTPerMillion
+	billed := 1.0
+	if backend == BackendHTTP {
+		perMillion = p.HTTPPerMillion
+		billed = math.Max(1, math.Ceil(float64(bytes)/httpMeteringBytes))
+	}
+	return billed/1e6*perMillion + float64(bytes)/1e9*p.TransferPerGB
+}
+
+// backendOf returns the backend of the endpoints of provider, if it is an
+// API Gateway provider.
+func backendOf(provider string) (Backend, bool) {
+	switch {
+	case strings.HasPrefix(provider, ProviderREST):
+		return BackendREST, true
+	case strings.HasPrefix(provider, ProviderHTTP):
+		return BackendHTTP, true
+	}
+	return "", false
+}
+
+// SessionCost estimates the cost of the requests Transport sent since the
+// pool was created, with the backend of each endpoint. Requests sent
+// through other providers, like Cloudflare Workers, are not priced.
+func (ag *ApiGateway) SessionCost(p Pricing) Cost {
+	usage := map[Backend]*Usage{
+		BackendREST: {Backend: BackendREST},
+		BackendHTTP: {Backend: BackendHTTP},
+	}
+	for _, e := range ag.Stats().Endpoints {
+		backend, ok := backendOf(e.Provider)
+		if !ok {
+			continue
+		}
+		u := usage[backend]
+		u.Endpoints++
+		u.Requests += e.Requests
+		u.TransferBytes += e.Bytes
+	}
+
+	rest, http := usage[BackendREST], usage[BackendHTTP]
+	c := p.Estimate(*rest).Add(p.Estimate(*http))
+	if requests := rest.Requests + http.Requests; requests > 0 {
+		c.PerRequest = c.Total / float64(requests)
+	}
+	if endpoints := rest.Endpoints + http.Endpoints; endpoints > 0 {
+		c.PerEndpoint = c.Total / float64(endpoints)
+	}
+	return c
+}
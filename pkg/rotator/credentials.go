@@ -0,0 +1,136 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// RoleSessionName names the sessions of WithAssumeRole.
+const RoleSessionName = "apigateway-rotator"
+
+// credentialSet is how the AWS clients of one account are configured.
+type credentialSet struct {
+	opts       []func(*config.LoadOptions) error
+	sources    []string
+	roleARN    string
+	externalID string
+
+	mu        sync.Mutex
+	roleCreds aws.CredentialsProvider
+}
+
+// WithProfile uses the named profile of the shared AWS config and
+// credentials files instead of the default one.
+func WithProfile(name string) Option {
+	return func(ag *ApiGateway) {
+		ag.creds.profile(name)
+	}
+}
+
+// WithStaticCredentials uses the given access key instead of the default
+// credential chain. sessionToken may be empty for long-term keys.
+func WithStaticCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(ag *ApiGateway) {
+		ag.creds.static(accessKeyID, secretAccessKey, sessionToken)
+	}
+}
+
+// WithAssumeRole assumes roleARN with the configured credentials and uses the
+// role for every API call. externalID may be empty.
+func WithAssumeRole(roleARN, externalID string) Option {
+	return func(ag *ApiGateway) {
+		ag.creds.roleARN = roleARN
+		ag.creds.externalID = externalID
+	}
+}
+
+// profile loads the credentials of the named profile.
+func (c *credentialSet) profile(name string) {
+	c.opts = append(c.opts, config.WithSharedConfigProfile(name))
+	c.sources = append(c.sources, "profile="+name)
+}
+
+// static uses the given access key.
+func (c *credentialSet) static(accessKeyID, secretAccessKey, sessionToken string) {
+	provider := credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)
+	c.opts = append(c.opts, config.WithCredentialsProvider(provider))
+	c.sources = append(c.sources, "key="+accessKeyID)
+}
+
+// key identifies the account and role of c, without secrets, so that pools
+// configured alike share cached clients.
+func (c *credentialSet) key() string {
+	return strings.Join(append(slices.Clone(c.sources), "role="+c.roleARN, "external-id="+c.externalID), ";")
+}
+
+// config loads the AWS configuration for region.
+func (c *credentialSet) config(ctx context.Context, region string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, c.opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("%w: cannot load AWS config: %w", ErrCredentials, err)
+	}
+	if c.roleARN != "" {
+		cfg.Credentials = c.roleCredentials(cfg)
+	}
+	cfg.Region = region
+	return cfg, nil
+}
+
+// WithEndpointURL sends every AWS API call of the pool to url instead of the
+// AWS endpoints, e.g. "http://localhost:4566" for LocalStack or a moto server.
+// Only the control plane moves: the endpoints of the pool keep their
+// execute-api hostnames.
+func WithEndpointURL(url string) Option {
+	return func(ag *ApiGateway) {
+		ag.endpointURL = url
+	}
+}
+
+// roleCredentials returns the cached credentials of the assumed role, so that
+// the role is only assumed again when its credentials expire.
+func (c *credentialSet) roleCredentials(base aws.Config) aws.CredentialsProvider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.roleCreds == nil {
+		if base.Region == "" {
+			base.Region = "us-east-1"
+		}
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(base), c.roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = RoleSessionName
+			if c.externalID != "" {
+				o.ExternalID = aws.String(c.externalID)
+			}
+		})
+		c.roleCreds = aws.NewCredentialsCache(provider)
+	}
+	return c.roleCreds
+}
+
+// awsConfig loads the AWS configuration for region with creds, or with the
+// default credentials of ag when creds is nil.
+func (ag *ApiGateway) awsConfig(ctx context.Context, creds *credentialSet, region string) (aws.Config, error) {
+	if creds == nil {
+		creds = ag.creds
+	}
+	cfg, err := ag.baseConfig(ctx, creds, region)
+	if err != nil {
+		return cfg, err
+	}
+	// the cached config is shared, copy what is changed below
+	cfg.APIOptions = slices.Clone(cfg.APIOptions)
+	if ag.endpointURL != "" {
+		cfg.BaseEndpoint = aws.String(ag.endpointURL)
+	}
+	ag.traceAWS(&cfg)
+	ag.dryRunAWS(&cfg, region)
+	return cfg, nil
+}
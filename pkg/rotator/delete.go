@@ -0,0 +1,205 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+)
+
+const (
+	// deleteAttempts is the number of times the deletion of a REST API is
+	// tried when AWS keeps throttling it.
+	deleteAttempts = 4
+	// deleteThrottleDelay is the wait before trying a throttled deletion
+	// again; API Gateway allows one DeleteRestApi call every 30 seconds.
+	deleteThrottleDelay = 30 * time.Second
+)
+
+// DeleteOptions select the REST APIs deleted by DeleteAll.
+type DeleteOptions struct {
+	// Filters select the APIs to delete, the APIs created by the rotator
+	// when empty; pass AllGateways to delete every REST API.
+	Filters []GatewayFilter
+	// Progress, if set, is called after every deletion with its error. It is
+	// called from several goroutines at once.
+	Progress func(region, id string, err error)
+	// SharedApis deletes REST APIs shared by pools, see WithSharedApi, with
+	// the stages of every pool. By default only the stage of the pool is
+	// deleted, and a shared API with its last stage.
+	SharedApis bool
+}
+
+// DeleteResult is the outcome of DeleteAll in one region.
+type DeleteResult struct {
+	Region string
+	// Deleted are the IDs of the REST APIs deleted.
+	Deleted []string
+	// Kept are the IDs of the shared REST APIs whose stage of the pool was
+	// deleted but that other pools still have stages in.
+	Kept []string
+	// Failed are the errors of the REST APIs that could not be deleted, by ID.
+	Failed map[string]error
+	// ListErrors are the errors of the accounts whose REST APIs could not be
+	// listed.
+	ListErrors []error
+}
+
+// err joins the errors of r.
+func (r *DeleteResult) err() error {
+	errs := append([]error(nil), r.ListErrors...)
+	for id, err := range r.Failed {
+		errs = append(errs, fmt.Errorf("cannot delete rest api %s: %w", id, err))
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteAll deletes the REST APIs selected by opts in every region of ag and
+// every account of the pool. Regions are worked on ag.Concurrency at a time,
+// the APIs of a region one after the other since API Gateway throttles
+// deletions per account and region. A failure does not stop the others: the
+// results of every region are returned, in the order of ag.Regions, along
+// with a joined error of *RegionError.
+func (ag *ApiGateway) DeleteAll(ctx context.Context, opts DeleteOptions) ([]DeleteResult, error) {
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	type job struct {
+		creds  *credentialSet
+		region int
+	}
+	var queue []job
+	results := make([]DeleteResult, len(ag.Regions))
+	for i, region := range ag.Regions {
+		results[i].Region = region
+		for _, a := range ag.awsAccounts() {
+			queue = append(queue, job{creds: a.creds, region: i})
+		}
+	}
+	// the accounts of a region add to the same result
+	locks := make([]sync.Mutex, len(ag.Regions))
+
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var result DeleteResult
+				result.Region = ag.Regions[j.region]
+				ag.deleteGateways(ctx, j.creds, opts, &result)
+
+				locks[j.region].Lock()
+				r := &results[j.region]
+				r.Deleted = append(r.Deleted, result.Deleted...)
+				r.Kept = append(r.Kept, result.Kept...)
+				r.ListErrors = append(r.ListErrors, result.ListErrors...)
+				for id, err := range result.Failed {
+					if r.Failed == nil {
+						r.Failed = make(map[string]error)
+					}
+					r.Failed[id] = err
+				}
+				locks[j.region].Unlock()
+			}
+		}()
+	}
+	for _, j := range queue {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []error
+	for i := range results {
+		if err := results[i].err(); err != nil {
+			errs = append(errs, &RegionError{Region: results[i].Region, Err: err})
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// deleteGateways deletes the REST APIs of result.Region selected by opts with
+// creds, adding the outcome to result. It goes on after a failed deletion and
+// stops when ctx is done.
+func (ag *ApiGateway) deleteGateways(ctx context.Context, creds *credentialSet, opts DeleteOptions, result *DeleteResult) {
+	filters := opts.Filters
+	if len(filters) == 0 {
+		filters = []GatewayFilter{OwnedGateways}
+	}
+	region := result.Region
+
+	client, err := ag.newClient(ctx, creds, region)
+	if err != nil {
+		result.ListErrors = append(result.ListErrors, err)
+		return
+	}
+	apis, err := listRestApis(ctx, client, region, ListOptions{Filters: filters})
+	if err != nil {
+		// delete what could be listed
+		result.ListErrors = append(result.ListErrors, err)
+	}
+
+	for _, api := range apis {
+		id := *api.Id
+		// the stages of other pools are left in a shared API
+		left := 0
+		err := ctx.Err()
+		switch {
+		case err != nil:
+		case api.Tags[TagShared] != "" && !opts.SharedApis:
+			_, left, err = ag.deleteSharedStage(ctx, client, id)
+		default:
+			err = ag.deleteCustomDomain(ctx, creds, region, restDomain(api))
+			if err == nil {
+				err = deleteRestApi(ctx, client, id)
+			}
+		}
+		if err == nil && left > 0 {
+			result.Kept = append(result.Kept, id)
+			ag.logger.Info("stage deleted from shared api", "region", region, "id", id, "stages", left)
+			continue
+		}
+		if opts.Progress != nil {
+			opts.Progress(region, id, err)
+		}
+		if err != nil {
+			if result.Failed == nil {
+				result.Failed = make(map[string]error)
+			}
+			result.Failed[id] = err
+			ag.logger.Warn("cannot delete gateway", "region", region, "id", id, "error", err)
+			continue
+		}
+		result.Deleted = append(result.Deleted, id)
+		ag.logger.Info("gateway deleted", "region", region, "id", id)
+	}
+}
+
+// deleteRestApi deletes REST API id and its API key, trying again while AWS
+// throttles the call after the retries of the SDK.
+func deleteRestApi(ctx context.Context, client RestAPIClient, id string) error {
+	if err := deleteAPIKey(ctx, client, id); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		_, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: &id})
+		err = classify(err)
+		if err == nil || !errors.Is(err, ErrThrottled) || attempt == deleteAttempts {
+			return err
+		}
+		timer := time.NewTimer(deleteThrottleDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
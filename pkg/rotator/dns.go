@@ -0,0 +1,192 @@
+package rotator
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// parallelDialDelay is how long a dial waits for the connection to an address
+// before racing the next one, the delay RFC 8305 recommends.
+const parallelDialDelay = 250 * time.Millisecond
+
+// dialer dials the hosts of the endpoints with the addresses resolved within
+// ttl, resolving a host again when none of its addresses can be reached.
+type dialer struct {
+	net.Dialer
+	ttl      time.Duration
+	parallel bool
+
+	mu    sync.Mutex
+	hosts map[string]resolved
+}
+
+type resolved struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDialer(ttl time.Duration, parallel bool) *dialer {
+	return &dialer{
+		Dialer:   net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		ttl:      ttl,
+		parallel: parallel,
+		hosts:    make(map[string]resolved),
+	}
+}
+
+// DialContext implements the DialContext of http.Transport.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, address)
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		addrs[i] = net.JoinHostPort(addr, port)
+	}
+
+	var conn net.Conn
+	if d.parallel {
+		conn, err = d.dialParallel(ctx, network, addrs)
+	} else {
+		conn, err = d.dialSerial(ctx, network, addrs)
+	}
+	if err != nil {
+		d.forget(host)
+	}
+	return conn, err
+}
+
+// lookup returns the addresses of host, from the cache while they are fresh,
+// IPv6 and IPv4 addresses interleaved.
+func (d *dialer) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	r, ok := d.hosts[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(r.expires) {
+		return append([]string(nil), r.addrs...), nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs = interleave(addrs)
+	if d.ttl > 0 {
+		d.mu.Lock()
+		d.hosts[host] = resolved{addrs: addrs, expires: time.Now().Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return append([]string(nil), addrs...), nil
+}
+
+func (d *dialer) forget(host string) {
+	d.mu.Lock()
+	delete(d.hosts, host)
+	d.mu.Unlock()
+}
+
+// dialSerial dials addrs in turn and returns the first connection made.
+func (d *dialer) dialSerial(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var first error
+	for _, addr := range addrs {
+		conn, err := d.Dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, first
+}
+
+// dialParallel dials addrs like happy eyeballs: the next address is dialed
+// when the previous ones failed or did not connect within parallelDialDelay,
+// and the first connection made wins, the others are closed.
+func (d *dialer) dialParallel(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	dial := func(addr string) {
+		conn, err := d.Dialer.DialContext(ctx, network, addr)
+		select {
+		case results <- result{conn, err}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	var first error
+	var wait <-chan time.Time
+	next, pending := 0, 0
+	for next < len(addrs) || pending > 0 {
+		if pending == 0 {
+			go dial(addrs[next])
+			next, pending = next+1, pending+1
+			wait = time.After(parallelDialDelay)
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			if first == nil {
+				first = r.err
+			}
+		case <-wait:
+			if next < len(addrs) {
+				go dial(addrs[next])
+				next, pending = next+1, pending+1
+				wait = time.After(parallelDialDelay)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, first
+}
+
+// interleave orders addrs alternating IPv6 and IPv4 addresses, starting with
+// the family of the first one, so that an unreachable family only delays a
+// dial by one attempt.
+func interleave(addrs []string) []string {
+	var v4, v6 []string
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	first, second := v4, v6
+	if len(addrs) > 0 && len(v6) > 0 && addrs[0] == v6[0] {
+		first, second = v6, v4
+	}
+	out := make([]string, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
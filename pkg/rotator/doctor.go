@@ -0,0 +1,343 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/wafv2"
+	waftypes "github.com/aws/aws-sdk-go-v2/service/wafv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// doctorID is the id of the resources Doctor makes calls on. Nothing has this
+// id, so the calls that are allowed fail without changing anything.
+const doctorID = "rotator-doctor"
+
+// Check is a permission checked by Doctor.
+type Check struct {
+	// Account is the name of the account, empty for the default one.
+	Account    string
+	Region     string
+	Permission string
+	// Err is nil when the permission is granted. It wraps ErrAccessDenied
+	// when the permission is missing and is any other error when it could
+	// not be checked.
+	Err error
+}
+
+// Missing reports whether the permission is not granted.
+func (c Check) Missing() bool {
+	return errors.Is(c.Err, ErrAccessDenied)
+}
+
+// String describes the state of c.
+func (c Check) String() string {
+	switch {
+	case c.Err == nil:
+		return "ok"
+	case c.Missing():
+		return "missing"
+	}
+	return fmt.Sprintf("error: %s", c.Err)
+}
+
+// Doctor checks that the credentials of every account of the pool have the
+// permissions of IAMPolicy(opts), the regions and the backend of ag being
+// used when opts has none. Every permission is exercised with a harmless
+// call: changes are made on resources that do not exist or with invalid
+// parameters, which AWS refuses after checking the permission. The state
+// store is checked with the default AWS configuration, like OpenStateStore.
+func (ag *ApiGateway) Doctor(ctx context.Context, opts PolicyOptions) ([]Check, error) {
+	if ag.dryRun {
+		return nil, errors.New("doctor cannot check permissions in dry run")
+	}
+	if len(opts.Regions) == 0 {
+		opts.Regions = ag.Regions
+	}
+	if opts.Backend == "" {
+		opts.Backend = ag.backend
+	}
+	if len(opts.Regions) == 0 {
+		return nil, errors.New("no region to check")
+	}
+
+	type job struct {
+		account account
+		region  string
+	}
+	var jobs []job
+	for _, a := range ag.awsAccounts() {
+		for _, region := range opts.Regions {
+			jobs = append(jobs, job{a, region})
+		}
+	}
+
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	results := make([][]Check, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = ag.checkGateways(ctx, jobs[i].account, jobs[i].region, opts.Backend)
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var checks []Check
+	// the fake clients of WithRestClients go with no AWS account
+	if ag.restClients == nil {
+		for _, a := range ag.awsAccounts() {
+			checks = append(checks, ag.checkAccount(ctx, a, opts)...)
+		}
+		checks = append(checks, checkState(ctx, opts.State)...)
+	}
+	for _, r := range results {
+		checks = append(checks, r...)
+	}
+	return checks, nil
+}
+
+// probe runs a call on a resource that does not exist and returns the error
+// of the permission it needs, if any. An error of AWS other than a denied
+// access means that the call was allowed.
+func probe(call func() error) error {
+	err := call()
+	if err == nil || errors.Is(err, ErrStateNotFound) || errors.Is(err, ErrStateConflict) {
+		return nil
+	}
+	err = classify(err)
+	if errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrCredentials) || errors.Is(err, ErrThrottled) {
+		return err
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return nil
+	}
+	return err
+}
+
+// checkGateways checks the API Gateway permissions of a in region.
+func (ag *ApiGateway) checkGateways(ctx context.Context, a account, region string, backend Backend) []Check {
+	check := func(permission string, call func() error) Check {
+		return Check{Account: a.name, Region: region, Permission: permission, Err: probe(call)}
+	}
+
+	if backend == BackendHTTP {
+		client, err := ag.newV2Client(ctx, a.creds, region)
+		if err != nil {
+			return []Check{{Account: a.name, Region: region, Permission: "apigateway", Err: err}}
+		}
+		return []Check{
+			check("apigateway:GET /apis", func() error {
+				_, err := client.GetApis(ctx, &apigatewayv2.GetApisInput{MaxResults: aws.String("1")})
+				return err
+			}),
+			check("apigateway:POST /apis/*", func() error {
+				_, err := client.CreateStage(ctx, &apigatewayv2.CreateStageInput{ApiId: aws.String(doctorID), StageName: aws.String(doctorID)})
+				return err
+			}),
+			check("apigateway:PATCH /apis/*", func() error {
+				_, err := client.UpdateIntegration(ctx, &apigatewayv2.UpdateIntegrationInput{ApiId: aws.String(doctorID), IntegrationId: aws.String(doctorID)})
+				return err
+			}),
+			check("apigateway:DELETE /apis/*", func() error {
+				_, err := client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{ApiId: aws.String(doctorID)})
+				return err
+			}),
+			check("apigateway:POST /tags/*", func() error {
+				_, err := client.TagResource(ctx, &apigatewayv2.TagResourceInput{ResourceArn: aws.String(apiARN(region, "/apis/"+doctorID)), Tags: map[string]string{doctorID: doctorID}})
+				return err
+			}),
+		}
+	}
+
+	client, err := ag.newClient(ctx, a.creds, region)
+	if err != nil {
+		return []Check{{Account: a.name, Region: region, Permission: "apigateway", Err: err}}
+	}
+	return []Check{
+		check("apigateway:GET /restapis", func() error {
+			_, err := client.GetRestApis(ctx, &apigateway.GetRestApisInput{Limit: aws.Int32(1)})
+			return err
+		}),
+		check("apigateway:POST /restapis/*", func() error {
+			_, err := client.CreateDeployment(ctx, &apigateway.CreateDeploymentInput{RestApiId: aws.String(doctorID), StageName: aws.String(doctorID)})
+			return err
+		}),
+		check("apigateway:PUT /restapis/*", func() error {
+			_, err := client.PutMethod(ctx, &apigateway.PutMethodInput{
+				RestApiId:         aws.String(doctorID),
+				ResourceId:        aws.String(doctorID),
+				HttpMethod:        aws.String("ANY"),
+				AuthorizationType: aws.String("NONE"),
+			})
+			return err
+		}),
+		check("apigateway:PATCH /restapis/*", func() error {
+			_, err := client.UpdateIntegration(ctx, &apigateway.UpdateIntegrationInput{RestApiId: aws.String(doctorID), ResourceId: aws.String(doctorID), HttpMethod: aws.String("ANY")})
+			return err
+		}),
+		check("apigateway:DELETE /restapis/*", func() error {
+			_, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: aws.String(doctorID)})
+			return err
+		}),
+		check("apigateway:POST /tags/*", func() error {
+			_, err := client.TagResource(ctx, &apigateway.TagResourceInput{ResourceArn: aws.String(apiARN(region, "/restapis/"+doctorID)), Tags: map[string]string{doctorID: doctorID}})
+			return err
+		}),
+		check("apigateway:GET /apikeys", func() error {
+			_, err := client.GetApiKeys(ctx, &apigateway.GetApiKeysInput{NameQuery: aws.String(doctorID)})
+			return err
+		}),
+		check("apigateway:DELETE /usageplans/*", func() error {
+			_, err := client.DeleteUsagePlan(ctx, &apigateway.DeleteUsagePlanInput{UsagePlanId: aws.String(doctorID)})
+			return err
+		}),
+	}
+}
+
+// checkAccount checks the permissions of a that are not tied to the regions
+// of the gateways.
+func (ag *ApiGateway) checkAccount(ctx context.Context, a account, opts PolicyOptions) []Check {
+	var checks []Check
+	check := func(region, permission string, call func(cfg aws.Config) error) {
+		cfg, err := ag.awsConfig(ctx, a.creds, region)
+		if err == nil {
+			err = probe(func() error { return call(cfg) })
+		}
+		checks = append(checks, Check{Account: a.name, Region: region, Permission: permission, Err: err})
+	}
+	region := opts.Regions[0]
+
+	// always allowed, it fails only if the credentials do
+	check(region, "sts:GetCallerIdentity", func(cfg aws.Config) error {
+		_, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	})
+	if opts.AutoRegions {
+		check(region, "ec2:DescribeRegions", func(cfg aws.Config) error {
+			_, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{DryRun: aws.Bool(true)})
+			return err
+		})
+	}
+	if opts.Quotas && opts.Backend != BackendHTTP {
+		check(region, "servicequotas:ListServiceQuotas", func(cfg aws.Config) error {
+			_, err := servicequotas.NewFromConfig(cfg).ListServiceQuotas(ctx, &servicequotas.ListServiceQuotasInput{ServiceCode: aws.String("apigateway"), MaxResults: aws.Int32(1)})
+			return err
+		})
+	}
+	if opts.WebACL && opts.Backend != BackendHTTP {
+		check(region, "wafv2:ListWebACLs", func(cfg aws.Config) error {
+			_, err := wafv2.NewFromConfig(cfg).ListWebACLs(ctx, &wafv2.ListWebACLsInput{Scope: waftypes.ScopeRegional, Limit: aws.Int32(1)})
+			return err
+		})
+		// also needs apigateway:SetWebACL on the stage
+		check(region, "wafv2:AssociateWebACL", func(cfg aws.Config) error {
+			_, err := wafv2.NewFromConfig(cfg).AssociateWebACL(ctx, &wafv2.AssociateWebACLInput{
+				WebACLArn:   aws.String(policyARN("wafv2", region, ag.accountID(ctx, cfg), "regional/webacl/"+doctorID+"/"+doctorID)),
+				ResourceArn: aws.String(apiARN(region, "/restapis/"+doctorID+"/stages/"+doctorID)),
+			})
+			return err
+		})
+	}
+	if opts.CustomDomain && opts.Backend != BackendHTTP {
+		check(region, "apigateway:GET /domainnames", func(cfg aws.Config) error {
+			_, err := apigateway.NewFromConfig(cfg).GetDomainName(ctx, &apigateway.GetDomainNameInput{DomainName: aws.String(doctorID + ".invalid")})
+			return err
+		})
+		check(region, "acm:ListCertificates", func(cfg aws.Config) error {
+			_, err := acm.NewFromConfig(cfg).ListCertificates(ctx, &acm.ListCertificatesInput{MaxItems: aws.Int32(1)})
+			return err
+		})
+		check(route53Region, "route53:ListHostedZonesByName", func(cfg aws.Config) error {
+			_, err := route53.NewFromConfig(cfg).ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{MaxItems: aws.Int32(1)})
+			return err
+		})
+	}
+	if name := opts.BillingAlarm; name != "" {
+		// the calls are made on the alarm and topic the policy allows, with
+		// parameters SNS and CloudWatch refuse
+		check(billingRegion, "sns:CreateTopic", func(cfg aws.Config) error {
+			_, err := sns.NewFromConfig(cfg).CreateTopic(ctx, &sns.CreateTopicInput{Name: &name, Attributes: map[string]string{doctorID: doctorID}})
+			return err
+		})
+		check(billingRegion, "sns:Subscribe", func(cfg aws.Config) error {
+			topic := policyARN("sns", billingRegion, ag.accountID(ctx, cfg), name)
+			_, err := sns.NewFromConfig(cfg).Subscribe(ctx, &sns.SubscribeInput{TopicArn: &topic, Protocol: aws.String(doctorID)})
+			return err
+		})
+		check(billingRegion, "cloudwatch:PutMetricAlarm", func(cfg aws.Config) error {
+			_, err := cloudwatch.NewFromConfig(cfg).PutMetricAlarm(ctx, &cloudwatch.PutMetricAlarmInput{
+				AlarmName:          &name,
+				ComparisonOperator: cwtypes.ComparisonOperatorGreaterThanOrEqualToThreshold,
+				EvaluationPeriods:  aws.Int32(0),
+			})
+			return err
+		})
+	}
+	return checks
+}
+
+// accountID returns the id of the account of cfg, or a wildcard if it cannot
+// be read.
+func (ag *ApiGateway) accountID(ctx context.Context, cfg aws.Config) string {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "*"
+	}
+	return aws.ToString(identity.Account)
+}
+
+// checkState checks the permissions of the state store at location, if it is
+// in AWS. The state is saved with a version no save ever has, so nothing is
+// written.
+func checkState(ctx context.Context, location string) []Check {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "dynamodb") {
+		return nil
+	}
+	read, write := "s3:GetObject", "s3:PutObject"
+	if u.Scheme == "dynamodb" {
+		read, write = "dynamodb:GetItem", "dynamodb:PutItem"
+	}
+
+	store, err := OpenStateStore(ctx, location)
+	if err != nil {
+		return []Check{{Permission: read, Err: err}, {Permission: write, Err: err}}
+	}
+	return []Check{
+		{Permission: read, Err: probe(func() error {
+			_, _, err := store.Load(ctx)
+			return err
+		})},
+		{Permission: write, Err: probe(func() error {
+			_, err := store.Save(ctx, State{}, "0")
+			return err
+		})},
+	}
+}
@@ -0,0 +1,345 @@
+package rotator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// route53Region is the region of the global Route 53 endpoint.
+	route53Region = "us-east-1"
+
+	// certificateTimeout is how long a new certificate is waited for while
+	// ACM validates it through DNS.
+	certificateTimeout = 10 * time.Minute
+
+	// validationRecordDelay is how often a new certificate is described until
+	// ACM gives the DNS record validating it, for validationRecordAttempts.
+	validationRecordDelay    = 2 * time.Second
+	validationRecordAttempts = 30
+)
+
+// WithCustomDomain gives every REST API created for the pool a custom domain
+// name under zone, a public Route 53 hosted zone of the default credentials:
+// a regional domain named after the ID of the API, mapped to its stage and
+// aliased in the zone. The execute-api endpoint of the API is disabled, so
+// requests only go through the custom domain and nothing resolves to
+// execute-api.amazonaws.com. A wildcard ACM certificate of zone, looked up or
+// requested and validated through DNS the first time, which takes a few
+// minutes, covers the gateways of every region and account, so Certificate
+// Transparency logs do not list them. The domains and their records are
+// deleted with the APIs; the certificates are kept. Adopted gateways get a
+// domain too but keep their execute-api endpoint. HTTP APIs are not
+// supported.
+func WithCustomDomain(zone string) Option {
+	return func(ag *ApiGateway) {
+		ag.domainZone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	}
+}
+
+// restDomain returns the custom domain name of the REST API api, "" if it has
+// none.
+func restDomain(api types.RestApi) string {
+	if zone := api.Tags[TagDomain]; zone != "" {
+		return *api.Id + "." + zone
+	}
+	return ""
+}
+
+// useDomain makes d go through the custom domain name domain, if any, which
+// maps its root to the stage.
+func useDomain(d *Deployment, domain string) {
+	if domain != "" {
+		d.Host = domain
+		d.BasePath = ""
+	}
+}
+
+// createCustomDomain creates the custom domain name of the REST API id in
+// region proxying to site, maps it to stage and aliases it in the hosted zone of the pool. It
+// returns the domain name, also with an error once the domain name exists, so
+// that it can be deleted. An existing domain or mapping is kept, so it can be
+// called again for an adopted API.
+func (ag *ApiGateway) createCustomDomain(ctx context.Context, creds *credentialSet, region, id, stage, site string) (string, error) {
+	domain := id + "." + ag.domainZone
+	// the fake clients of WithRestClients have no ACM or Route 53
+	if ag.restClients != nil {
+		return domain, nil
+	}
+	cert, err := ag.certificate(ctx, creds, region)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := ag.awsConfig(ctx, creds, region)
+	if err != nil {
+		return "", err
+	}
+	client := apigateway.NewFromConfig(cfg)
+
+	var target, targetZone *string
+	created, err := client.CreateDomainName(ctx, &apigateway.CreateDomainNameInput{
+		DomainName:             &domain,
+		RegionalCertificateArn: &cert,
+		EndpointConfiguration: &types.EndpointConfiguration{
+			Types: []types.EndpointType{types.EndpointTypeRegional},
+		},
+		SecurityPolicy: types.SecurityPolicyTls12,
+		Tags:           ag.tags(site),
+	})
+	var conflict *types.ConflictException
+	switch {
+	case errors.As(err, &conflict):
+		existing, err := client.GetDomainName(ctx, &apigateway.GetDomainNameInput{DomainName: &domain})
+		if err != nil {
+			return domain, fmt.Errorf("cannot get domain name %s: %w", domain, classify(err))
+		}
+		target, targetZone = existing.RegionalDomainName, existing.RegionalHostedZoneId
+	case err != nil:
+		return "", fmt.Errorf("cannot create domain name %s: %w", domain, classify(err))
+	default:
+		target, targetZone = created.RegionalDomainName, created.RegionalHostedZoneId
+	}
+
+	_, err = client.CreateBasePathMapping(ctx, &apigateway.CreateBasePathMappingInput{
+		DomainName: &domain,
+		RestApiId:  &id,
+		Stage:      &stage,
+	})
+	if err != nil && !errors.As(err, &conflict) {
+		return domain, fmt.Errorf("cannot map domain name %s: %w", domain, classify(err))
+	}
+
+	err = ag.changeRecord(ctx, ag.domainZone, r53types.ChangeActionUpsert, r53types.ResourceRecordSet{
+		Name: aws.String(domain),
+		Type: r53types.RRTypeA,
+		AliasTarget: &r53types.AliasTarget{
+			DNSName:      target,
+			HostedZoneId: targetZone,
+		},
+	})
+	if err != nil {
+		return domain, err
+	}
+	ag.logger.Debug("custom domain created", "region", region, "id", id, "domain", domain)
+	return domain, nil
+}
+
+// deleteCustomDomain deletes the custom domain name domain in region, with
+// its base path mapping and its alias record. Nothing is done for "".
+func (ag *ApiGateway) deleteCustomDomain(ctx context.Context, creds *credentialSet, region, domain string) error {
+	if domain == "" || ag.restClients != nil {
+		return nil
+	}
+	_, zone, _ := strings.Cut(domain, ".")
+	client, id, err := ag.route53(ctx, zone)
+	if err != nil {
+		return err
+	}
+	records, err := client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    &id,
+		StartRecordName: &domain,
+		StartRecordType: r53types.RRTypeA,
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list records of %s: %w", domain, classify(err))
+	}
+	for _, record := range records.ResourceRecordSets {
+		if aws.ToString(record.Name) == domain+"." && record.Type == r53types.RRTypeA {
+			if err := ag.changeRecord(ctx, zone, r53types.ChangeActionDelete, record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cfg, err := ag.awsConfig(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+	// the base path mapping goes with the domain name
+	_, err = apigateway.NewFromConfig(cfg).DeleteDomainName(ctx, &apigateway.DeleteDomainNameInput{DomainName: &domain})
+	var notFound *types.NotFoundException
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("cannot delete domain name %s: %w", domain, classify(err))
+	}
+	return nil
+}
+
+// certificate returns the ARN of the wildcard certificate of the hosted zone
+// of the pool in region, requesting it and waiting for its validation if
+// there is none yet.
+func (ag *ApiGateway) certificate(ctx context.Context, creds *credentialSet, region string) (string, error) {
+	if creds == nil {
+		creds = ag.creds
+	}
+	wildcard := "*." + ag.domainZone
+	return cached(ag.clients, ag.clientKey("certificate "+wildcard, creds, region), func() (string, error) {
+		cfg, err := ag.awsConfig(ctx, creds, region)
+		if err != nil {
+			return "", err
+		}
+		client := acm.NewFromConfig(cfg)
+
+		cert, err := findCertificate(ctx, client, wildcard)
+		if err != nil {
+			return "", err
+		}
+		if cert != nil && cert.Status == acmtypes.CertificateStatusIssued {
+			return *cert.CertificateArn, nil
+		}
+		var arn string
+		if cert != nil {
+			arn = *cert.CertificateArn
+		} else {
+			// the same token within an hour returns the same certificate,
+			// for the gateways created at the same time
+			sum := sha256.Sum256([]byte(wildcard))
+			requested, err := client.RequestCertificate(ctx, &acm.RequestCertificateInput{
+				DomainName:       &wildcard,
+				ValidationMethod: acmtypes.ValidationMethodDns,
+				IdempotencyToken: aws.String(hex.EncodeToString(sum[:16])),
+				Tags: []acmtypes.Tag{
+					{Key: aws.String(TagCreatedBy), Value: aws.String(CreatedByValue)},
+				},
+			})
+			if err != nil {
+				return "", fmt.Errorf("cannot request certificate %s: %w", wildcard, classify(err))
+			}
+			arn = *requested.CertificateArn
+			if ag.dryRun {
+				return arn, nil
+			}
+			ag.logger.Info("certificate requested, waiting for its validation", "region", region, "domain", wildcard)
+		}
+		if err := ag.validateCertificate(ctx, client, arn); err != nil {
+			return "", err
+		}
+		return arn, nil
+	})
+}
+
+// findCertificate returns the issued certificate of domain, or else one
+// pending validation, or nil.
+func findCertificate(ctx context.Context, client *acm.Client, domain string) (*acmtypes.CertificateSummary, error) {
+	var pending *acmtypes.CertificateSummary
+	input := &acm.ListCertificatesInput{
+		CertificateStatuses: []acmtypes.CertificateStatus{acmtypes.CertificateStatusIssued, acmtypes.CertificateStatusPendingValidation},
+	}
+	for {
+		output, err := client.ListCertificates(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list certificates: %w", classify(err))
+		}
+		for _, cert := range output.CertificateSummaryList {
+			if aws.ToString(cert.DomainName) != domain {
+				continue
+			}
+			if cert.Status == acmtypes.CertificateStatusIssued {
+				return &cert, nil
+			}
+			pending = &cert
+		}
+		if output.NextToken == nil {
+			return pending, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// validateCertificate adds the DNS record validating the certificate arn to
+// the hosted zone of the pool and waits for ACM to issue it.
+func (ag *ApiGateway) validateCertificate(ctx context.Context, client *acm.Client, arn string) error {
+	input := &acm.DescribeCertificateInput{CertificateArn: &arn}
+	var record *acmtypes.ResourceRecord
+	// ACM takes a few seconds to give the record of a new certificate
+	for attempt := 1; record == nil; attempt++ {
+		output, err := client.DescribeCertificate(ctx, input)
+		if err != nil {
+			return fmt.Errorf("cannot describe certificate %s: %w", arn, classify(err))
+		}
+		if options := output.Certificate.DomainValidationOptions; len(options) > 0 {
+			record = options[0].ResourceRecord
+		}
+		if record != nil {
+			break
+		}
+		if attempt == validationRecordAttempts {
+			return fmt.Errorf("no validation record for certificate %s", arn)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(validationRecordDelay):
+		}
+	}
+
+	err := ag.changeRecord(ctx, ag.domainZone, r53types.ChangeActionUpsert, r53types.ResourceRecordSet{
+		Name:            record.Name,
+		Type:            r53types.RRType(record.Type),
+		TTL:             aws.Int64(300),
+		ResourceRecords: []r53types.ResourceRecord{{Value: record.Value}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := acm.NewCertificateValidatedWaiter(client).Wait(ctx, input, certificateTimeout); err != nil {
+		return fmt.Errorf("cannot validate certificate %s: %w", arn, classify(err))
+	}
+	return nil
+}
+
+// route53 returns the Route 53 client of the default credentials and the ID
+// of their public hosted zone named zone.
+func (ag *ApiGateway) route53(ctx context.Context, zone string) (*route53.Client, string, error) {
+	cfg, err := ag.awsConfig(ctx, nil, route53Region)
+	if err != nil {
+		return nil, "", err
+	}
+	client := route53.NewFromConfig(cfg)
+	id, err := cached(ag.clients, ag.clientKey("hosted zone "+zone, ag.creds, ""), func() (string, error) {
+		// zones are sorted by name, those named zone come first
+		name := zone + "."
+		output, err := client.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{DNSName: &name})
+		if err != nil {
+			return "", fmt.Errorf("cannot list hosted zones: %w", classify(err))
+		}
+		for _, hosted := range output.HostedZones {
+			if aws.ToString(hosted.Name) == name && (hosted.Config == nil || !hosted.Config.PrivateZone) {
+				return *hosted.Id, nil
+			}
+		}
+		return "", fmt.Errorf("no public hosted zone %s", zone)
+	})
+	return client, id, err
+}
+
+// changeRecord applies action to record in the hosted zone zone.
+func (ag *ApiGateway) changeRecord(ctx context.Context, zone string, action r53types.ChangeAction, record r53types.ResourceRecordSet) error {
+	client, id, err := ag.route53(ctx, zone)
+	if err != nil {
+		return err
+	}
+	_, err = client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: &id,
+		ChangeBatch: &r53types.ChangeBatch{
+			Changes: []r53types.Change{{Action: action, ResourceRecordSet: &record}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot change record %s: %w", aws.ToString(record.Name), classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/wafv2"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrDryRun is returned by the AWS calls a dry run cannot simulate.
+var ErrDryRun = errors.New("not sent in dry run")
+
+// WithDryRun logs the AWS calls that would create, change or delete
+// resources instead of sending them; calls reading resources are still sent,
+// which checks the credentials and the configuration. Created APIs get made
+// up IDs starting with "dryrun", so a dry run Initialize adds endpoints to
+// the pool that do not exist. Calls the rotator makes without the AWS SDK,
+// like those of WithRestClients clients, are not affected.
+func WithDryRun() Option {
+	return func(ag *ApiGateway) {
+		ag.dryRun = true
+	}
+}
+
+// DryRun reports whether ag only logs the AWS calls changing resources.
+func (ag *ApiGateway) DryRun() bool {
+	return ag.dryRun
+}
+
+// dryRunIDs numbers the resources made up by dry runs.
+var dryRunIDs atomic.Int64
+
+func dryRunID() *string {
+	return aws.String(fmt.Sprintf("dryrun%04d", dryRunIDs.Add(1)))
+}
+
+// dryRunAWS makes the AWS calls made with cfg, in region, log what they
+// would do instead of changing resources.
+func (ag *ApiGateway) dryRunAWS(cfg *aws.Config, region string) {
+	if !ag.dryRun {
+		return
+	}
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		operation := stack.ID()
+		for _, read := range []string{"Get", "List", "Describe"} {
+			if strings.HasPrefix(operation, read) {
+				return nil
+			}
+		}
+		// after the validation of the input, before anything is sent
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RotatorDryRun", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			result, attrs := dryRunResult(in.Parameters)
+			if result == nil {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("%s: %w", operation, ErrDryRun)
+			}
+			ag.logger.Info("dry run", append([]any{"operation", operation, "region", region}, attrs...)...)
+			return middleware.InitializeOutput{Result: result}, middleware.Metadata{}, nil
+		}), middleware.After)
+	})
+}
+
+// dryRunResult returns the output of the call with params as if it
+// succeeded, and the attributes logged for it, or nil if the call is not
+// simulated.
+func dryRunResult(params any) (any, []any) {
+	switch p := params.(type) {
+	case *apigateway.CreateRestApiInput:
+		return &apigateway.CreateRestApiOutput{
+			Id:             dryRunID(),
+			RootResourceId: dryRunID(),
+			Name:           p.Name,
+			Tags:           p.Tags,
+			CreatedDate:    aws.Time(time.Now()),
+		}, []any{"name", aws.ToString(p.Name), "tags", p.Tags}
+	case *apigateway.DeleteRestApiInput:
+		return &apigateway.DeleteRestApiOutput{}, []any{"api", aws.ToString(p.RestApiId)}
+	case *apigateway.CreateResourceInput:
+		return &apigateway.CreateResourceOutput{Id: dryRunID(), PathPart: p.PathPart}, []any{"api", aws.ToString(p.RestApiId), "path", aws.ToString(p.PathPart)}
+	case *apigateway.PutMethodInput:
+		return &apigateway.PutMethodOutput{}, []any{"api", aws.ToString(p.RestApiId), "method", aws.ToString(p.HttpMethod)}
+	case *apigateway.PutIntegrationInput:
+		return &apigateway.PutIntegrationOutput{Uri: p.Uri}, []any{"api", aws.ToString(p.RestApiId), "uri", aws.ToString(p.Uri)}
+	case *apigateway.UpdateRestApiInput:
+		return &apigateway.UpdateRestApiOutput{Id: p.RestApiId}, []any{"api", aws.ToString(p.RestApiId)}
+	case *apigateway.UpdateIntegrationInput:
+		return &apigateway.UpdateIntegrationOutput{}, []any{"api", aws.ToString(p.RestApiId), "resource", aws.ToString(p.ResourceId)}
+	case *apigateway.CreateDeploymentInput:
+		return &apigateway.CreateDeploymentOutput{Id: dryRunID()}, []any{"api", aws.ToString(p.RestApiId), "stage", aws.ToString(p.StageName)}
+	case *apigateway.UpdateStageInput:
+		return &apigateway.UpdateStageOutput{StageName: p.StageName}, []any{"api", aws.ToString(p.RestApiId), "stage", aws.ToString(p.StageName)}
+	case *apigateway.DeleteStageInput:
+		return &apigateway.DeleteStageOutput{}, []any{"api", aws.ToString(p.RestApiId), "stage", aws.ToString(p.StageName)}
+	case *apigateway.TagResourceInput:
+		return &apigateway.TagResourceOutput{}, []any{"resource", aws.ToString(p.ResourceArn), "tags", p.Tags}
+	case *apigateway.CreateApiKeyInput:
+		return &apigateway.CreateApiKeyOutput{Id: dryRunID(), Name: p.Name, Value: dryRunID()}, []any{"name", aws.ToString(p.Name)}
+	case *apigateway.CreateUsagePlanInput:
+		return &apigateway.CreateUsagePlanOutput{Id: dryRunID(), Name: p.Name}, []any{"name", aws.ToString(p.Name)}
+	case *apigateway.CreateUsagePlanKeyInput:
+		return &apigateway.CreateUsagePlanKeyOutput{Id: p.KeyId}, []any{"plan", aws.ToString(p.UsagePlanId), "key", aws.ToString(p.KeyId)}
+	case *apigateway.UpdateUsagePlanInput:
+		return &apigateway.UpdateUsagePlanOutput{Id: p.UsagePlanId}, []any{"plan", aws.ToString(p.UsagePlanId)}
+	case *apigateway.DeleteUsagePlanInput:
+		return &apigateway.DeleteUsagePlanOutput{}, []any{"plan", aws.ToString(p.UsagePlanId)}
+	case *apigateway.DeleteApiKeyInput:
+		return &apigateway.DeleteApiKeyOutput{}, []any{"key", aws.ToString(p.ApiKey)}
+
+	case *apigatewayv2.CreateApiInput:
+		return &apigatewayv2.CreateApiOutput{
+			ApiId:       dryRunID(),
+			Name:        p.Name,
+			Tags:        p.Tags,
+			CreatedDate: aws.Time(time.Now()),
+		}, []any{"name", aws.ToString(p.Name), "tags", p.Tags}
+	case *apigatewayv2.DeleteApiInput:
+		return &apigatewayv2.DeleteApiOutput{}, []any{"api", aws.ToString(p.ApiId)}
+	case *apigatewayv2.CreateIntegrationInput:
+		return &apigatewayv2.CreateIntegrationOutput{IntegrationId: dryRunID(), IntegrationUri: p.IntegrationUri}, []any{"api", aws.ToString(p.ApiId), "uri", aws.ToString(p.IntegrationUri)}
+	case *apigatewayv2.UpdateIntegrationInput:
+		return &apigatewayv2.UpdateIntegrationOutput{}, []any{"api", aws.ToString(p.ApiId), "uri", aws.ToString(p.IntegrationUri)}
+	case *apigatewayv2.CreateRouteInput:
+		return &apigatewayv2.CreateRouteOutput{RouteId: dryRunID()}, []any{"api", aws.ToString(p.ApiId), "route", aws.ToString(p.RouteKey)}
+	case *apigatewayv2.DeleteRouteInput:
+		return &apigatewayv2.DeleteRouteOutput{}, []any{"api", aws.ToString(p.ApiId), "route", aws.ToString(p.RouteId)}
+	case *apigatewayv2.CreateStageInput:
+		return &apigatewayv2.CreateStageOutput{StageName: p.StageName}, []any{"api", aws.ToString(p.ApiId), "stage", aws.ToString(p.StageName)}
+	case *apigatewayv2.TagResourceInput:
+		return &apigatewayv2.TagResourceOutput{}, []any{"resource", aws.ToString(p.ResourceArn), "tags", p.Tags}
+
+	case *apigateway.CreateDomainNameInput:
+		return &apigateway.CreateDomainNameOutput{
+			DomainName:           p.DomainName,
+			RegionalDomainName:   aws.String("d-" + *dryRunID() + ".execute-api.amazonaws.com"),
+			RegionalHostedZoneId: dryRunID(),
+		}, []any{"domain", aws.ToString(p.DomainName), "certificate", aws.ToString(p.RegionalCertificateArn)}
+	case *apigateway.CreateBasePathMappingInput:
+		return &apigateway.CreateBasePathMappingOutput{RestApiId: p.RestApiId, Stage: p.Stage}, []any{"domain", aws.ToString(p.DomainName), "api", aws.ToString(p.RestApiId), "stage", aws.ToString(p.Stage)}
+	case *apigateway.DeleteDomainNameInput:
+		return &apigateway.DeleteDomainNameOutput{}, []any{"domain", aws.ToString(p.DomainName)}
+	case *acm.RequestCertificateInput:
+		return &acm.RequestCertificateOutput{CertificateArn: aws.String("arn:aws:acm:us-east-1:000000000000:certificate/" + *dryRunID())}, []any{"domain", aws.ToString(p.DomainName)}
+	case *route53.ChangeResourceRecordSetsInput:
+		var records []string
+		for _, change := range p.ChangeBatch.Changes {
+			records = append(records, string(change.Action)+" "+aws.ToString(change.ResourceRecordSet.Name))
+		}
+		return &route53.ChangeResourceRecordSetsOutput{}, []any{"zone", aws.ToString(p.HostedZoneId), "changes", records}
+
+	case *wafv2.AssociateWebACLInput:
+		return &wafv2.AssociateWebACLOutput{}, []any{"resource", aws.ToString(p.ResourceArn), "acl", aws.ToString(p.WebACLArn)}
+
+	case *sns.CreateTopicInput:
+		return &sns.CreateTopicOutput{TopicArn: aws.String("arn:aws:sns:" + billingRegion + ":000000000000:" + aws.ToString(p.Name))}, []any{"name", aws.ToString(p.Name)}
+	case *sns.SubscribeInput:
+		return &sns.SubscribeOutput{}, []any{"topic", aws.ToString(p.TopicArn), "endpoint", aws.ToString(p.Endpoint)}
+	case *cloudwatch.PutMetricAlarmInput:
+		return &cloudwatch.PutMetricAlarmOutput{}, []any{"alarm", aws.ToString(p.AlarmName), "metric", aws.ToString(p.MetricName), "threshold", aws.ToFloat64(p.Threshold)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+package rotator
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Endpoint is an endpoint of a pool.
+type Endpoint struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Region   string `json:"region"`
+	// Host is the hostname requests are sent to.
+	Host string `json:"host"`
+	// Stage is the stage of REST API endpoints.
+	Stage     string    `json:"stage,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Healthy and Stats are the state of the endpoint when it was listed by
+	// EndpointStatus or GetEndpoints; they are not kept up to date in the
+	// EndpointPool.
+	Healthy bool          `json:"healthy"`
+	Stats   EndpointStats `json:"stats"`
+}
+
+func endpointOf(d Deployment) Endpoint {
+	return Endpoint{
+		ID:        d.ID,
+		Provider:  d.Provider,
+		Region:    d.Region,
+		Host:      d.Host,
+		Stage:     strings.TrimPrefix(d.BasePath, "/"),
+		CreatedAt: d.CreatedAt,
+	}
+}
+
+// EndpointStatus returns the endpoints of the pool with their health and the
+// requests sent through them.
+func (ag *ApiGateway) EndpointStatus() []Endpoint {
+	stats := make(map[string]EndpointStats)
+	for _, s := range ag.Stats().Endpoints {
+		stats[s.Endpoint] = s
+	}
+
+	pooled := ag.Endpoints.Snapshot()
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	endpoints := make([]Endpoint, 0, len(pooled))
+	for _, e := range pooled {
+		e.Healthy = !ag.unhealthy[e.Host]
+		e.Stats = stats[e.Host]
+		endpoints = append(endpoints, e)
+	}
+	return endpoints
+}
+
+// EndpointPool is the list of endpoints of an ApiGateway. It is safe for
+// concurrent use: readers get snapshots that writers replace atomically, so
+// rerouting never waits for an endpoint being added or removed. The zero
+// value is an empty pool.
+type EndpointPool struct {
+	mu        sync.Mutex
+	endpoints atomic.Pointer[[]Endpoint]
+}
+
+// Snapshot returns the endpoints of the pool. The slice is shared and must
+// not be modified.
+func (p *EndpointPool) Snapshot() []Endpoint {
+	if endpoints := p.endpoints.Load(); endpoints != nil {
+		return *endpoints
+	}
+	return nil
+}
+
+// Len returns the number of endpoints of the pool.
+func (p *EndpointPool) Len() int {
+	return len(p.Snapshot())
+}
+
+// Hosts returns the hosts of the endpoints of the pool.
+func (p *EndpointPool) Hosts() []string {
+	snapshot := p.Snapshot()
+	hosts := make([]string, 0, len(snapshot))
+	for _, e := range snapshot {
+		hosts = append(hosts, e.Host)
+	}
+	return hosts
+}
+
+// Add adds the endpoints whose host is not in the pool yet.
+func (p *EndpointPool) Add(endpoints ...Endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := slices.Clone(p.Snapshot())
+	for _, e := range endpoints {
+		if !slices.ContainsFunc(next, func(o Endpoint) bool { return o.Host == e.Host }) {
+			next = append(next, e)
+		}
+	}
+	p.endpoints.Store(&next)
+}
+
+// Remove drops the endpoint of host and reports whether it was in the pool.
+func (p *EndpointPool) Remove(host string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := p.Snapshot()
+	next := slices.DeleteFunc(slices.Clone(current), func(e Endpoint) bool { return e.Host == host })
+	p.endpoints.Store(&next)
+	return len(next) < len(current)
+}
+
+// Store replaces the endpoints of the pool.
+func (p *EndpointPool) Store(endpoints []Endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := slices.Clone(endpoints)
+	p.endpoints.Store(&next)
+}
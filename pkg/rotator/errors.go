@@ -0,0 +1,109 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrCredentials is returned when AWS credentials are missing, expired or
+	// rejected.
+	ErrCredentials = errors.New("invalid or missing AWS credentials")
+
+	// ErrQuotaExceeded is returned when API Gateway refuses a call because an
+	// account limit has been reached.
+	ErrQuotaExceeded = errors.New("API Gateway quota exceeded")
+
+	// ErrThrottled is returned when AWS still throttles a call after every
+	// retry of the SDK.
+	ErrThrottled = errors.New("AWS API call throttled")
+
+	// ErrAccessDenied is returned when the IAM policy of the caller does not
+	// allow an AWS call, see IAMPolicy.
+	ErrAccessDenied = errors.New("AWS API call not allowed")
+
+	// ErrApiExists is returned when a REST API with the gateway name already
+	// exists in the region.
+	ErrApiExists = errors.New("API already exists")
+
+	// ErrInvalidSite is returned when the target site is not an absolute
+	// http or https URL.
+	ErrInvalidSite = errors.New("invalid site")
+
+	// ErrPayloadTooLarge is returned by Transport for request bodies over
+	// the MaxPayloadSize API Gateway allows, see WithPayloadStrategy.
+	ErrPayloadTooLarge = errors.New("payload too large for API Gateway")
+
+	// ErrGatewayTimeout is returned by Transport instead of the 504 answered
+	// by API Gateway when the site takes over MaxIntegrationTimeout.
+	ErrGatewayTimeout = errors.New("API Gateway timed out waiting for the site")
+
+	// ErrUpgradeUnsupported is returned by Transport for upgrade requests,
+	// like WebSocket handshakes, that no endpoint of the pool can carry, see
+	// WithUpgradeDirect.
+	ErrUpgradeUnsupported = errors.New("connection upgrades not supported by the endpoints")
+
+	// ErrRateLimited is returned by Transport for requests over the rate
+	// limits of the pool with RateLimitShed, see WithEndpointRateLimit.
+	ErrRateLimited = errors.New("request over the client-side rate limit")
+)
+
+// credentialErrorCodes are AWS error codes caused by bad credentials.
+var credentialErrorCodes = map[string]bool{
+	"UnrecognizedClientException":         true,
+	"InvalidClientTokenId":                true,
+	"InvalidSignatureException":           true,
+	"SignatureDoesNotMatch":               true,
+	"ExpiredToken":                        true,
+	"ExpiredTokenException":               true,
+	"MissingAuthenticationTokenException": true,
+}
+
+// throttlingErrorCodes are AWS error codes of throttled calls.
+var throttlingErrorCodes = map[string]bool{
+	"TooManyRequestsException": true,
+	"ThrottlingException":      true,
+	"Throttling":               true,
+}
+
+// accessDeniedErrorCodes are AWS error codes of calls the caller has no
+// permission for.
+var accessDeniedErrorCodes = map[string]bool{
+	"AccessDeniedException": true,
+	"AccessDenied":          true,
+	"UnauthorizedOperation": true,
+	"AuthorizationError":    true,
+}
+
+// classify wraps an error returned by the AWS SDK with the sentinel matching
+// its cause, so callers can use errors.Is with the sentinels and errors.As with
+// the SDK error types on the same value. Errors with no known cause are
+// returned unchanged.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var signingErr *v4.SigningError
+	if errors.As(err, &signingErr) {
+		return fmt.Errorf("%w: %w", ErrCredentials, err)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case credentialErrorCodes[apiErr.ErrorCode()]:
+			return fmt.Errorf("%w: %w", ErrCredentials, err)
+		case apiErr.ErrorCode() == "LimitExceededException":
+			return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+		case throttlingErrorCodes[apiErr.ErrorCode()]:
+			return fmt.Errorf("%w: %w", ErrThrottled, err)
+		case accessDeniedErrorCodes[apiErr.ErrorCode()]:
+			return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package rotator
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventEndpointCreated is sent once a gateway was created for the pool.
+	EventEndpointCreated EventType = "endpoint-created"
+	// EventEndpointDeleted is sent once a gateway of the pool was deleted.
+	EventEndpointDeleted EventType = "endpoint-deleted"
+	// EventEndpointUnhealthy is sent when an endpoint is taken out of
+	// rotation.
+	EventEndpointUnhealthy EventType = "endpoint-unhealthy"
+	// EventEndpointBanned is sent when a BanDetector recognized a response
+	// of the site through an endpoint as a ban.
+	EventEndpointBanned EventType = "endpoint-banned"
+	// EventRequestFailed is sent for every attempt of a request that failed,
+	// was throttled or was refused, see Transport.
+	EventRequestFailed EventType = "request-failed"
+	// EventBudgetExceeded is sent when the budget of the pool is spent, once
+	// per period.
+	EventBudgetExceeded EventType = "budget-exceeded"
+	// EventTeardownFinished is sent when a Lifecycle is done deleting the
+	// endpoints of the session.
+	EventTeardownFinished EventType = "teardown-finished"
+)
+
+// Event is a change of the state of a pool or of its traffic.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Pool is the name of the pool.
+	Pool string `json:"pool"`
+
+	// Endpoint, Region, Provider and ID are those of the gateway the event is
+	// about, if any.
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	ID       string `json:"id,omitempty"`
+
+	// URL and Status are those of the failed request of EventRequestFailed,
+	// Status is 0 when no response was received.
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Count is the number of endpoints deleted by EventTeardownFinished.
+	Count int `json:"count,omitempty"`
+	// Error describes what went wrong, if anything.
+	Error string `json:"error,omitempty"`
+}
+
+// events are the functions registered with OnEvent and Subscribe.
+type events struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]func(Event)
+}
+
+// OnEvent registers fn to be called with every event of the pool, from the
+// goroutine where it happened: fn must not block. It returns a function that
+// unregisters fn.
+func (ag *ApiGateway) OnEvent(fn func(Event)) func() {
+	ag.events.mu.Lock()
+	defer ag.events.mu.Unlock()
+	if ag.events.handlers == nil {
+		ag.events.handlers = make(map[int]func(Event))
+	}
+	id := ag.events.next
+	ag.events.next++
+	ag.events.handlers[id] = fn
+	return func() {
+		ag.events.mu.Lock()
+		defer ag.events.mu.Unlock()
+		delete(ag.events.handlers, id)
+	}
+}
+
+// Subscribe returns a channel receiving the events of the pool until ctx is
+// done, when it is closed. Up to buffer events are queued for a slow reader,
+// the following ones are dropped.
+func (ag *ApiGateway) Subscribe(ctx context.Context, buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+	var mu sync.Mutex
+	done := false
+	cancel := ag.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		cancel()
+		mu.Lock()
+		done = true
+		close(ch)
+		mu.Unlock()
+	}()
+	return ch
+}
+
+// emit sends e to the handlers of the pool.
+func (ag *ApiGateway) emit(e Event) {
+	ag.events.mu.RLock()
+	defer ag.events.mu.RUnlock()
+	if len(ag.events.handlers) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	e.Pool = ag.Name
+	for _, fn := range ag.events.handlers {
+		fn(e)
+	}
+}
+
+// emitDeployment sends an event of type t about d.
+func (ag *ApiGateway) emitDeployment(t EventType, d Deployment) {
+	ag.emit(Event{Type: t, Endpoint: d.Host, Region: d.Region, Provider: d.Provider, ID: d.ID})
+}
+
+// emitFailure sends EventRequestFailed for req, sent through endpoint.
+func (ag *ApiGateway) emitFailure(req *http.Request, d Deployment, endpoint string, resp *http.Response, err error) {
+	e := Event{Type: EventRequestFailed, Endpoint: endpoint, Region: d.Region, Provider: d.Provider, ID: d.ID, URL: req.URL.Redacted()}
+	if resp != nil {
+		e.Status = resp.StatusCode
+		e.Error = resp.Status
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	ag.emit(e)
+}
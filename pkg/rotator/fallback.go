@@ -0,0 +1,84 @@
+package rotator
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultFallbackWait is how long FallbackWait waits for an endpoint when
+// WithFallback is given no timeout.
+const DefaultFallbackWait = 30 * time.Second
+
+// fallbackPoll is how often FallbackWait looks for an endpoint again.
+const fallbackPoll = 250 * time.Millisecond
+
+// FallbackPolicy is what Transport does with requests when the pool has no
+// endpoint to send them through: none were created, or every one is
+// unhealthy or has its circuit open.
+type FallbackPolicy string
+
+const (
+	// FallbackFail fails requests with ErrNoEndpoints. It is the default.
+	FallbackFail FallbackPolicy = "fail"
+
+	// FallbackWait holds requests until an endpoint is available again, like
+	// a circuit that can be probed after its cool-down, and fails them with
+	// ErrNoEndpoints when none is within the timeout.
+	FallbackWait FallbackPolicy = "wait"
+
+	// FallbackDirect sends requests straight to the site, bypassing the
+	// gateways: the site sees the address of this machine.
+	FallbackDirect FallbackPolicy = "direct"
+)
+
+// WithFallback sets what Transport does with requests when the pool has no
+// endpoint available, see FallbackPolicy. Timeout bounds the wait of
+// FallbackWait, DefaultFallbackWait if 0.
+func WithFallback(policy FallbackPolicy, timeout time.Duration) Option {
+	return func(ag *ApiGateway) {
+		if timeout <= 0 {
+			timeout = DefaultFallbackWait
+		}
+		ag.fallback = policy
+		ag.fallbackWait = timeout
+	}
+}
+
+// availableEndpoints returns the endpoints requests can be sent through: the
+// healthy ones whose circuit is not open.
+func (ag *ApiGateway) availableEndpoints() []string {
+	endpoints := ag.HealthyEndpoints()
+	if ag.breaker != nil {
+		endpoints = ag.breaker.available(endpoints)
+	}
+	return endpoints
+}
+
+// noEndpoint sends req, for which the pool has no endpoint available, the way
+// the fallback policy of the pool says. It returns false when an endpoint
+// became available and req must be sent through it.
+func (t *Transport) noEndpoint(req *http.Request) (*http.Response, bool, error) {
+	switch t.Gateway.fallback {
+	case FallbackDirect:
+		t.Gateway.logger.Warn("no endpoint available, sending request directly", "url", req.URL.Redacted())
+		resp, err := t.direct(req)
+		return resp, true, err
+	case FallbackWait:
+		deadline := time.NewTimer(t.Gateway.fallbackWait)
+		defer deadline.Stop()
+		poll := time.NewTicker(fallbackPoll)
+		defer poll.Stop()
+		for len(t.Gateway.availableEndpoints()) == 0 {
+			select {
+			case <-req.Context().Done():
+				return nil, true, req.Context().Err()
+			case <-deadline.C:
+				return nil, true, fmt.Errorf("%w after waiting %s", ErrNoEndpoints, t.Gateway.fallbackWait)
+			case <-poll.C:
+			}
+		}
+		return nil, false, nil
+	}
+	return nil, true, ErrNoEndpoints
+}
@@ -0,0 +1,60 @@
+package rotator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AWSResponseHeaders are the headers API Gateway and CloudFront add to
+// responses, which give away that the traffic went through a gateway.
+var AWSResponseHeaders = []string{
+	"X-Amzn-Requestid",
+	"X-Amzn-Trace-Id",
+	"X-Amzn-Errortype",
+	"X-Amz-Apigw-Id",
+	"X-Amz-Cf-Id",
+	"X-Amz-Cf-Pop",
+	"Apigw-Requestid",
+}
+
+// remappedPrefix starts the headers of the target that API Gateway renamed
+// because it sets them itself, such as x-amzn-Remapped-Server.
+const remappedPrefix = "X-Amzn-Remapped-"
+
+// WithAWSHeaders controls whether Transport keeps the AWSResponseHeaders and
+// the CloudFront Via and X-Cache headers in responses. They are removed by
+// default, and the x-amzn-Remapped- headers get their original names back.
+func WithAWSHeaders(keep bool) Option {
+	return func(ag *ApiGateway) {
+		ag.keepAWSHeaders = keep
+	}
+}
+
+// sanitize removes the gateway fingerprint from the headers of resp.
+func (ag *ApiGateway) sanitize(resp *http.Response) {
+	if ag.keepAWSHeaders {
+		return
+	}
+	header := resp.Header
+	for _, name := range AWSResponseHeaders {
+		header.Del(name)
+	}
+	if strings.Contains(header.Get("Via"), "cloudfront") {
+		header.Del("Via")
+	}
+	if strings.Contains(header.Get("X-Cache"), "cloudfront") {
+		header.Del("X-Cache")
+	}
+	for name, values := range header {
+		if !strings.HasPrefix(name, remappedPrefix) {
+			continue
+		}
+		original := http.CanonicalHeaderKey(strings.TrimPrefix(name, remappedPrefix))
+		delete(header, name)
+		// the gateway's own value, e.g. its Date or Content-Length, is the
+		// one that matches the response it sends
+		if _, ok := header[original]; !ok {
+			header[original] = values
+		}
+	}
+}
@@ -0,0 +1,936 @@
+// Package rotator creates AWS API Gateway proxies in front of a target site and
+// reroutes requests through them so that each request leaves from a different IP.
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// DefaultRegions are the regions used by a new ApiGateway when no regions
+	// are configured.
+	DefaultRegions = []string{
+		"us-east-1", "us-east-2",
+	}
+
+	// DefaultStageName is the stage REST APIs are deployed to unless
+	// WithStageName or WithRandomNames is used.
+	DefaultStageName = "ProxyStage"
+
+	// DefaultConcurrency is the number of regions InitializeAll sets up at once.
+	DefaultConcurrency = 4
+)
+
+// ApiGateway is a pool of API Gateway proxies that forward traffic to Site.
+type ApiGateway struct {
+	Site      string
+	Name      string
+	Endpoints EndpointPool
+	Regions   []string
+
+	// Concurrency bounds how many regions InitializeAll works on in parallel.
+	Concurrency int
+
+	logger      *slog.Logger
+	dumpHeaders bool
+	selector    EndpointSelector
+	ipGenerator IPGenerator
+	userAgents  *UserAgentRotator
+	stickyTTL   time.Duration
+	replacer    *replacer
+	backend     Backend
+	provider    Provider
+	ttl         time.Duration
+	hooks       hooks
+	events      events
+	stats       stats
+	retrier     *retrier
+	breaker     *breaker
+
+	banDetectors []BanDetector
+
+	explicitSelector bool
+	configStrategy   string
+
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+
+	keepAWSHeaders bool
+	rawResponses   bool
+
+	hostPolicy HostPolicy
+
+	mu          sync.RWMutex
+	unhealthy   map[string]bool
+	deployments map[string]Deployment
+	providers   map[string]Provider
+	session     []Deployment
+	adopted     map[string]bool
+	adopt       bool
+
+	regionSpecs   []string
+	configRegions []string
+	regionSets    map[string][]string
+
+	stageName     string
+	nameTemplate  string
+	stageTemplate string
+
+	creds          *credentialSet
+	clients        *ClientCache
+	awsMaxAttempts int
+	awsRate        float64
+	awsBurst       int
+	endpointURL    string
+	restClients    RestClientFactory
+	accountConfigs []Account
+	accounts       []account
+	defaultIsAWS   bool
+	dryRun         bool
+	budget         *budgetTracker
+	quotaCheck     bool
+	quotaSpill     bool
+	readyTimeout   time.Duration
+	apiKeys        bool
+	sourceIPs      []string
+	resourcePolicy string
+	iamAuth        bool
+	webACLs        []string
+	payloads       PayloadStrategy
+	longDirect     bool
+	domainZone     string
+	sharedApi      string
+	upgradeDirect  bool
+	conns          *http.Transport
+	hedgeDelay     time.Duration
+	fallback       FallbackPolicy
+	fallbackWait   time.Duration
+	geoHint        string
+	geoCount       int
+	geolocator     Geolocator
+	geoResolved    bool
+	excludeSpecs   []string
+	excluded       map[string]bool
+	perRegion      int
+	endpointLimit  *rateLimiter
+	hostLimit      *rateLimiter
+	limitPolicy    RateLimitPolicy
+	jitterMin      time.Duration
+	jitterMax      time.Duration
+	pacer          *tokenBucket
+	audit          *auditLog
+	cache          Cache
+	cacheTTL       time.Duration
+
+	stateVersion string
+}
+
+// NewApiGateway returns an ApiGateway for site. Name is used as the name of every
+// REST API created for the pool. Site must be an http or https URL, optionally
+// with a port and a base path; it may be empty for a pool that only manages or
+// routes through existing gateways.
+func NewApiGateway(site, name string, opts ...Option) (*ApiGateway, error) {
+	site, err := normalizeSite(site)
+	if err != nil {
+		return nil, err
+	}
+
+	ag := &ApiGateway{
+		Site:         site,
+		Name:         name,
+		Concurrency:  DefaultConcurrency,
+		logger:       slog.New(discardHandler{}),
+		dumpHeaders:  true,
+		selector:     NewRandomSelector(),
+		ipGenerator:  PublicIPv4(),
+		backend:      BackendREST,
+		creds:        &credentialSet{},
+		clients:      NewClientCache(),
+		awsRate:      DefaultAWSRate,
+		awsBurst:     DefaultAWSBurst,
+		readyTimeout: DefaultReadyTimeout,
+		stats:        stats{since: time.Now()},
+	}
+	for _, opt := range opts {
+		opt(ag)
+	}
+	if ag.conns == nil {
+		ag.conns = DefaultConnPool.transport()
+	}
+	ag.setupTracing()
+	if err := ag.resolveRegions(); err != nil {
+		return nil, err
+	}
+	if err := ag.validateNames(); err != nil {
+		return nil, err
+	}
+	if err := ag.hostPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if site != "" {
+		if err := ag.checkSite(context.Background(), site); err != nil {
+			return nil, err
+		}
+	}
+	if ag.configStrategy != "" && !ag.explicitSelector {
+		if ag.selector, err = NewSelector(ag.configStrategy); err != nil {
+			return nil, err
+		}
+	}
+	ag.setSelector(ag.selector)
+	ag.register(ag.RESTProvider())
+	ag.register(ag.HTTPProvider())
+	if err := ag.setupAccounts(); err != nil {
+		return nil, err
+	}
+	if ag.apiKeys && ag.backend == BackendHTTP {
+		return nil, errors.New("HTTP APIs have no API keys, use the rest backend")
+	}
+	switch ag.payloads {
+	case "", PayloadReject, PayloadDirect, PayloadRanged:
+	default:
+		return nil, fmt.Errorf("unknown payload strategy %q", ag.payloads)
+	}
+	switch ag.fallback {
+	case "", FallbackFail, FallbackWait, FallbackDirect:
+	default:
+		return nil, fmt.Errorf("unknown fallback policy %q", ag.fallback)
+	}
+	switch ag.limitPolicy {
+	case "", RateLimitWait, RateLimitShed:
+	default:
+		return nil, fmt.Errorf("unknown rate limit policy %q", ag.limitPolicy)
+	}
+	if ag.jitterMin < 0 || ag.jitterMin > ag.jitterMax && ag.jitterMax > 0 {
+		return nil, fmt.Errorf("invalid jitter between %s and %s", ag.jitterMin, ag.jitterMax)
+	}
+	if len(ag.webACLs) > 0 && ag.backend == BackendHTTP {
+		return nil, errors.New("HTTP APIs cannot be associated with web ACLs, use the rest backend")
+	}
+	if ag.iamAuth && ag.backend == BackendHTTP {
+		return nil, errors.New("IAM authorization is only supported by REST APIs, use the rest backend")
+	}
+	if ag.domainZone != "" && ag.backend == BackendHTTP {
+		return nil, errors.New("custom domains are only supported for REST APIs, use the rest backend")
+	}
+	if ag.sharedApi != "" {
+		switch {
+		case ag.backend == BackendHTTP:
+			return nil, errors.New("HTTP APIs cannot be shared, use the rest backend")
+		case ag.domainZone != "" || ag.apiKeys:
+			return nil, errors.New("shared REST APIs cannot have custom domains or API keys")
+		case ag.Site != "" && !strings.HasPrefix(ag.Site, "https://"):
+			return nil, fmt.Errorf("%w: shared REST APIs only proxy to https sites", ErrInvalidSite)
+		case ag.perRegion > 1:
+			return nil, errors.New("a pool has one stage per shared REST API, it cannot have several endpoints per region")
+		}
+	}
+	if len(ag.sourceIPs) > 0 {
+		if ag.backend == BackendHTTP {
+			return nil, errors.New("HTTP APIs have no resource policies, use the rest backend")
+		}
+		if ag.resourcePolicy, err = sourceIPPolicy(ag.sourceIPs); err != nil {
+			return nil, err
+		}
+	}
+	if ag.provider == nil {
+		switch ag.backend {
+		case BackendREST:
+			ag.provider = ag.RESTProvider()
+		case BackendHTTP:
+			ag.provider = ag.HTTPProvider()
+		default:
+			return nil, fmt.Errorf("unknown backend %q", ag.backend)
+		}
+		ag.defaultIsAWS = true
+		if len(ag.accounts) > 0 {
+			ag.provider = ag.awsProvider(ag.accounts[0])
+		}
+	}
+	return ag, nil
+}
+
+// normalizeSite validates site and returns it with a lower case scheme and host
+// and no trailing slash.
+func normalizeSite(site string) (string, error) {
+	if site == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(site)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidSite, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: %s must start with http:// or https://", ErrInvalidSite, site)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("%w: %s has no host", ErrInvalidSite, site)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%w: %s must not have a query or fragment", ErrInvalidSite, site)
+	}
+	u.Host = strings.ToLower(u.Host)
+
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// ApiExistsInRegion check if an api already exists in region
+func ApiExistsInRegion(client RestAPIClient, name string, region string, ctx context.Context) (bool, error) {
+	api, err := findRestApi(ctx, client, region, func(api types.RestApi) bool {
+		return aws.ToString(api.Name) == name
+	})
+	return api != nil, err
+}
+
+// newClient builds an API Gateway client for region with creds, or with the
+// default credentials of ag when creds is nil.
+func (ag *ApiGateway) newClient(ctx context.Context, creds *credentialSet, region string) (RestAPIClient, error) {
+	if ag.restClients != nil {
+		return ag.restClients(region)
+	}
+	if creds == nil {
+		creds = ag.creds
+	}
+	return cached(ag.clients, ag.clientKey("rest", creds, region), func() (RestAPIClient, error) {
+		cfg, err := ag.awsConfig(ctx, creds, region)
+		if err != nil {
+			return nil, err
+		}
+		return apigateway.NewFromConfig(cfg), nil
+	})
+}
+
+// Initialize create a gateway resource in specified region.
+func (ag *ApiGateway) Initialize(region string, ctx context.Context) error {
+	return ag.InitializeWith(ag.provider, region, ctx)
+}
+
+// InitializeAll creates a gateway, or those of WithEndpointsPerRegion, in
+// every region of ag.Regions, and of every
+// account given to WithAccounts, working on at most ag.Concurrency regions at a
+// time. Endpoints of the regions that succeeded are added to the pool together
+// once all regions are done; failures are returned as a joined error of
+// *RegionError.
+func (ag *ApiGateway) InitializeAll(ctx context.Context) error {
+	if err := ag.ResolveAutoRegions(ctx); err != nil {
+		return err
+	}
+	return ag.initializeRegions(ctx, ag.Regions, nil)
+}
+
+// InitializeMissing is InitializeAll for the regions of ag.Regions in which
+// the pool has fewer endpoints than WithEndpointsPerRegion, one by default,
+// creating those missing.
+func (ag *ApiGateway) InitializeMissing(ctx context.Context) error {
+	if err := ag.ResolveAutoRegions(ctx); err != nil {
+		return err
+	}
+	covered := make(map[string]int)
+	for _, d := range ag.Deployments() {
+		covered[d.Region]++
+	}
+	var missing []string
+	counts := make(map[string]int)
+	for _, region := range ag.Regions {
+		if n := ag.endpointsPerRegion() - covered[region]; n > 0 {
+			missing = append(missing, region)
+			counts[region] = n
+		}
+	}
+	return ag.initializeRegions(ctx, missing, counts)
+}
+
+// initializeRegions creates the endpoints of every creation provider in
+// regions, counts[region] of them or those of WithEndpointsPerRegion. The
+// endpoints of a region are created one after the other.
+func (ag *ApiGateway) initializeRegions(ctx context.Context, regions []string, counts map[string]int) error {
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	if ag.quotaCheck {
+		checked, err := ag.checkQuotas(ctx, ag.creationProviders(), regions)
+		if err != nil {
+			return err
+		}
+		regions = checked
+	}
+
+	type job struct {
+		provider Provider
+		region   string
+		count    int
+	}
+	var queue []job
+	for _, p := range ag.creationProviders() {
+		for _, region := range regions {
+			count, ok := counts[region]
+			if !ok {
+				count = ag.endpointsPerRegion()
+			}
+			queue = append(queue, job{provider: p, region: region, count: count})
+		}
+	}
+	deployments := make([][]Deployment, len(queue))
+	errs := make([]error, len(queue))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				for n := 0; n < queue[i].count; n++ {
+					d, err := ag.createWith(queue[i].provider, queue[i].region, ctx)
+					if err != nil {
+						errs[i] = &RegionError{Region: queue[i].region, Err: fmt.Errorf("%s: %w", queue[i].provider.Name(), err)}
+						break
+					}
+					deployments[i] = append(deployments[i], d)
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range queue {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for ; i < len(queue); i++ {
+				errs[i] = &RegionError{Region: queue[i].region, Err: ctx.Err()}
+			}
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// the endpoints created before a failure in their region are kept
+	created := slices.Concat(deployments...)
+
+	// a canceled initialization must not leave gateways behind that the
+	// caller does not know about
+	if ctx.Err() != nil {
+		return errors.Join(append(errs, ag.discard(ctx, created, make([]error, len(created))))...)
+	}
+
+	ag.mu.Lock()
+	for _, d := range created {
+		ag.addDeployment(d)
+	}
+	ag.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// discard deletes the deployments created by a canceled initialization,
+// those whose error is nil. Adopted gateways existed before and are kept out
+// of the pool only.
+func (ag *ApiGateway) discard(ctx context.Context, deployments []Deployment, errs []error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	var failed []error
+	for i, d := range deployments {
+		ag.mu.RLock()
+		adopted := ag.adopted[d.Host]
+		ag.mu.RUnlock()
+		if errs[i] != nil || adopted {
+			continue
+		}
+		ag.logger.Warn("initialization canceled, deleting gateway", "region", d.Region, "id", d.ID)
+		if err := ag.DeleteDeployment(ctx, d); err != nil {
+			failed = append(failed, fmt.Errorf("cannot delete %s in region %s, delete it by hand: %w", d.ID, d.Region, err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// knownApi reports whether the API id in region is an endpoint of the pool or
+// was created by it, rather than one left to adopt.
+func (ag *ApiGateway) knownApi(region, id string) bool {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	for _, d := range ag.deployments {
+		if d.Region == region && d.ID == id {
+			return true
+		}
+	}
+	for _, d := range ag.session {
+		if d.Region == region && d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RegionError reports a failure that happened while working on a single region.
+type RegionError struct {
+	Region string
+	Err    error
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Region, e.Err)
+}
+
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// binaryMediaType makes a REST API pass every request and response body through
+// as it is. Without it, API Gateway converts bodies to UTF-8 text, which
+// corrupts images, PDFs and compressed responses.
+const binaryMediaType = "*/*"
+
+// createRestGateway creates and deploys a REST API in region.
+func (ag *ApiGateway) createRestGateway(creds *credentialSet, region string, ctx context.Context) (_ Deployment, err error) {
+	site := ag.CurrentSite()
+	if site == "" {
+		return Deployment{}, fmt.Errorf("%w: no site to create a gateway for", ErrInvalidSite)
+	}
+
+	client, err := ag.newClient(ctx, creds, region)
+	if err != nil {
+		return Deployment{}, err
+	}
+	if ag.sharedApi != "" {
+		return ag.createSharedStage(ctx, creds, client, region, site)
+	}
+
+	existing, err := listRestApis(ctx, client, region, ListOptions{Filters: []GatewayFilter{func(api types.RestApi) bool {
+		return ag.inPool(aws.ToString(api.Name), api.Tags)
+	}}})
+	if err != nil {
+		return Deployment{}, err
+	}
+	adoptable := slices.IndexFunc(existing, func(api types.RestApi) bool { return !ag.knownApi(region, *api.Id) })
+	if adoptable >= 0 && ag.adopt {
+		return ag.adoptRestGateway(ctx, creds, client, region, existing[adoptable], site)
+	}
+	if adoptable >= 0 || (len(existing) >= ag.endpointsPerRegion() && !extraEndpoint(ctx)) {
+		return Deployment{}, fmt.Errorf("%w: an API already exists with name: %s in region %s", ErrApiExists, ag.Name, region)
+	}
+
+	// create new REST API
+	name, stageName := ag.newNames()
+	tags := ag.tags(site)
+	tags[TagStage] = stageName
+	if ag.domainZone != "" {
+		tags[TagDomain] = ag.domainZone
+	}
+	newApi, err := ag.createRestApi(ctx, client, region, name, site, tags)
+	if err != nil {
+		return Deployment{}, err
+	}
+	// deleting the API removes the deployments created below, so a failed
+	// step does not leave a half-configured API behind
+	var domain string
+	defer func() {
+		if err != nil {
+			err = ag.rollback(ctx, region, *newApi.Id, err, func(ctx context.Context) error {
+				if err := ag.deleteCustomDomain(ctx, creds, region, domain); err != nil {
+					return err
+				}
+				if err := deleteAPIKey(ctx, client, *newApi.Id); err != nil {
+					return err
+				}
+				_, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: newApi.Id})
+				return err
+			})
+		}
+	}()
+
+	// create deployment resource so the new API is callable
+	_, _, variables := targetURIs(site)
+	_, err = client.CreateDeployment(ctx, &apigateway.CreateDeploymentInput{
+		RestApiId: newApi.Id,
+		StageName: &stageName,
+		Variables: variables,
+	})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("cannot create deployment: %w", classify(err))
+	}
+	if err := ag.associateWebACL(ctx, creds, region, *newApi.Id, stageName); err != nil {
+		return Deployment{}, err
+	}
+
+	d := restDeployment(region, *newApi.Id, stageName, aws.ToTime(newApi.CreatedDate))
+	d.IAMAuth = ag.iamAuth
+	if ag.domainZone != "" {
+		if domain, err = ag.createCustomDomain(ctx, creds, region, *newApi.Id, stageName, site); err != nil {
+			return Deployment{}, err
+		}
+		useDomain(&d, domain)
+	}
+	if ag.apiKeys {
+		// the usage plan needs the stage to exist
+		if d.APIKey, err = ag.createAPIKey(ctx, client, *newApi.Id, stageName, site); err != nil {
+			return Deployment{}, err
+		}
+	}
+	return d, nil
+}
+
+// createRestApi creates the REST API name with tags and its methods proxying
+// every request to site. It deletes the API again if a method cannot be
+// created.
+func (ag *ApiGateway) createRestApi(ctx context.Context, client RestAPIClient, region, name, site string, tags map[string]string) (_ *apigateway.CreateRestApiOutput, err error) {
+	input := &apigateway.CreateRestApiInput{
+		Name: &name,
+		Tags: tags,
+		EndpointConfiguration: &types.EndpointConfiguration{
+			Types: []types.EndpointType{
+				types.EndpointTypeRegional,
+			},
+		},
+		BinaryMediaTypes:          []string{binaryMediaType},
+		DisableExecuteApiEndpoint: ag.domainZone != "",
+	}
+	if ag.resourcePolicy != "" {
+		input.Policy = &ag.resourcePolicy
+	}
+	newApi, err := client.CreateRestApi(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new API: %w", classify(err))
+	}
+	// deleting the API removes the methods and resources created below
+	defer func() {
+		if err != nil {
+			err = ag.rollback(ctx, region, *newApi.Id, err, func(ctx context.Context) error {
+				_, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: newApi.Id})
+				return err
+			})
+		}
+	}()
+
+	// the integrations read the site from a stage variable, see SetTarget
+	rootURI, wildcardURI, _ := targetURIs(site)
+	if err := ag.putProxyMethod(ctx, client, *newApi.Id, *newApi.RootResourceId, rootURI); err != nil {
+		return nil, err
+	}
+
+	wildcardPath := "{proxy+}"
+	wildcardHandler, err := client.CreateResource(ctx, &apigateway.CreateResourceInput{
+		RestApiId: newApi.Id,
+		ParentId:  newApi.RootResourceId,
+		PathPart:  &wildcardPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create wildcard handler: %w", classify(err))
+	}
+
+	// handle requests received for the wildcard handler
+	if err := ag.putProxyMethod(ctx, client, *newApi.Id, *wildcardHandler.Id, wildcardURI); err != nil {
+		return nil, err
+	}
+	return newApi, nil
+}
+
+// putProxyMethod allows every method on resource id of api and proxies it to
+// uri. With WithAPIKey, requests need the API key of a usage plan of api, and
+// with WithIAMAuth a SigV4 signature.
+func (ag *ApiGateway) putProxyMethod(ctx context.Context, client RestAPIClient, api, id, uri string) error {
+	allowedHttpMethod := "ANY"
+	authorizationType := "NONE"
+	if ag.iamAuth {
+		authorizationType = "AWS_IAM"
+	}
+	params := make(map[string]bool)
+	params["method.request.path.proxy"] = true                  // ensures the path portion of the incoming request URL gets forwarded to the target site
+	params["method.request.header.X-Forwarded-For-Temp"] = true // preserve X-Forwarded-For header by using a temp header X-My-X-Forwarded-For
+
+	// allow all methods to new resource
+	_, err := client.PutMethod(ctx, &apigateway.PutMethodInput{
+		RestApiId:         &api,
+		ResourceId:        &id,
+		HttpMethod:        &allowedHttpMethod,
+		AuthorizationType: &authorizationType,
+		ApiKeyRequired:    ag.apiKeys,
+		RequestParameters: params,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create method: %w", classify(err))
+	}
+
+	// make new resource route traffic to new host
+	integrationParams := make(map[string]string)
+	integrationParams["integration.request.path.proxy"] = "method.request.path.proxy"
+	integrationParams["integration.request.header.X-Forwarded-For"] = "method.request.header.X-Forwarded-For-Temp"
+	_, err = client.PutIntegration(ctx, &apigateway.PutIntegrationInput{
+		RestApiId:             &api,
+		ResourceId:            &id,
+		Type:                  types.IntegrationTypeHttpProxy,
+		HttpMethod:            &allowedHttpMethod,
+		IntegrationHttpMethod: &allowedHttpMethod,
+		Uri:                   &uri,
+		ConnectionType:        types.ConnectionTypeInternet,
+		RequestParameters:     integrationParams,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create integration: %w", classify(err))
+	}
+	return nil
+}
+
+// rollbackTimeout bounds the deletion of a partially created API.
+const rollbackTimeout = 30 * time.Second
+
+// rollback deletes the partially created API id after cause made its creation
+// fail. It runs even when ctx is cancelled, and reports the leaked API when the
+// deletion fails too.
+func (ag *ApiGateway) rollback(ctx context.Context, region, id string, cause error, del func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	ag.logger.Warn("rolling back gateway", "region", region, "id", id, "error", cause)
+	if err := del(ctx); err != nil {
+		return errors.Join(cause, fmt.Errorf("cannot roll back api %s in region %s, delete it by hand: %w", id, region, classify(err)))
+	}
+	return cause
+}
+
+// Reroute sends the original request through a proxy. The request is returned
+// unchanged when it cannot be rerouted.
+func (ag *ApiGateway) Reroute(request *http.Request) *http.Request {
+	rerouted, _, err := ag.reroute(request, nil)
+	if err != nil {
+		ag.logger.Warn("cannot reroute request", "url", request.URL.String(), "error", err)
+		return request
+	}
+	return rerouted
+}
+
+// reroute rewrites request to go through an endpoint picked by the selector
+// and returns the endpoint used. The endpoints in exclude are only picked when
+// there is no other one. Upgrade requests only go through endpoints that can
+// upgrade connections.
+func (ag *ApiGateway) reroute(request *http.Request, exclude map[string]bool) (*http.Request, string, error) {
+	if ag.dumpHeaders {
+		ag.logger.Debug("request headers before reroute", "headers", request.Header)
+	}
+
+	endpoints := ag.availableEndpoints()
+	if upgrade := upgradeType(request); upgrade != "" {
+		endpoints = slices.DeleteFunc(slices.Clone(endpoints), func(endpoint string) bool { return !ag.upgrades(endpoint) })
+		if len(endpoints) == 0 {
+			return request, "", fmt.Errorf("%w: no endpoint of the pool passes %s upgrades through", ErrUpgradeUnsupported, upgrade)
+		}
+	}
+	if len(exclude) > 0 {
+		others := slices.DeleteFunc(slices.Clone(endpoints), func(endpoint string) bool { return exclude[endpoint] })
+		if len(others) > 0 {
+			endpoints = others
+		}
+	}
+	endpoints = ag.endpointLimit.under(endpoints)
+
+	endpoint, err := ag.endpointSelector().Select(request, endpoints)
+	if err != nil {
+		return request, "", err
+	}
+	if ag.breaker != nil {
+		ag.breaker.selected(endpoint)
+	}
+	request.URL = proxyURL(endpoint, ag.basePath(endpoint), request.URL)
+	request.Host = endpoint
+
+	// generate X-Forwarded-For header if original request does not have it
+	// and move original X-Forwarded-For to a temp header
+	val := request.Header.Get("X-Forwarded-For")
+	if val == "" {
+		if ip := ag.ipGenerator.NextIP(request); ip != nil {
+			request.Header.Add("X-Forwarded-For-Temp", ip.String())
+		}
+	} else {
+		request.Header.Add("X-Forwarded-For-Temp", val)
+	}
+	request.Header.Del("X-Forwarded-For")
+	request.Header.Del(SessionHeader)
+	request.Header.Del(TimeoutHeader)
+	request.Header.Del(LongRunningHeader)
+	if key := ag.apiKey(endpoint); key != "" {
+		request.Header.Set(APIKeyHeader, key)
+	}
+
+	if ag.dumpHeaders {
+		ag.logger.Debug("request headers after reroute", "headers", request.Header, "endpoint", endpoint)
+	}
+
+	return request, endpoint, nil
+}
+
+// proxyURL returns the URL that sends target through endpoint. The stage path
+// is prepended to the path, which the gateway forwards to the site, and
+// the escaped path, query and fragment of target are kept as they are.
+func proxyURL(endpoint, stage string, target *url.URL) *url.URL {
+	path, rawPath := target.Path, target.RawPath
+	if path == "" {
+		path = "/"
+	}
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     endpoint,
+		Path:     stage + path,
+		RawQuery: target.RawQuery,
+		Fragment: target.Fragment,
+	}
+	if rawPath != "" {
+		u.RawPath = stage + rawPath
+	}
+	if target.RawFragment != "" {
+		u.RawFragment = target.RawFragment
+	}
+	return u
+}
+
+// ListOptions narrow down the REST APIs returned by ListGateways.
+type ListOptions struct {
+	// Filters select the APIs returned, every API when empty.
+	Filters []GatewayFilter
+	// Limit is the maximum number of APIs returned per account, 0 for no
+	// limit. Listing stops as soon as it is reached.
+	Limit int
+}
+
+// GetGateways lists every REST API in region, in every account of the pool.
+func (ag *ApiGateway) GetGateways(region string, ctx context.Context) (*[]types.RestApi, error) {
+	apis, err := ag.ListGateways(region, ctx, ListOptions{})
+	return &apis, err
+}
+
+// ListGateways lists the REST APIs in region selected by opts, in every
+// account of the pool.
+func (ag *ApiGateway) ListGateways(region string, ctx context.Context, opts ListOptions) ([]types.RestApi, error) {
+	var result []types.RestApi
+	for _, a := range ag.awsAccounts() {
+		apis, err := ag.listGateways(a.creds, region, ctx, opts)
+		result = append(result, apis...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// getGateways lists every REST API in region with creds.
+func (ag *ApiGateway) getGateways(creds *credentialSet, region string, ctx context.Context) (*[]types.RestApi, error) {
+	apis, err := ag.listGateways(creds, region, ctx, ListOptions{})
+	return &apis, err
+}
+
+// listGateways lists the REST APIs in region selected by opts with creds.
+func (ag *ApiGateway) listGateways(creds *credentialSet, region string, ctx context.Context, opts ListOptions) ([]types.RestApi, error) {
+	client, err := ag.newClient(ctx, creds, region)
+	if err != nil {
+		return nil, err
+	}
+	return listRestApis(ctx, client, region, opts)
+}
+
+// restApisPageSize is the largest page GetRestApis returns.
+const restApisPageSize = 500
+
+// listRestApis pages through the REST APIs of client and returns those
+// selected by opts.
+func listRestApis(ctx context.Context, client RestAPIClient, region string, opts ListOptions) ([]types.RestApi, error) {
+	var result []types.RestApi
+	paginator := apigateway.NewGetRestApisPaginator(client, &apigateway.GetRestApisInput{
+		Limit: aws.Int32(restApisPageSize),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("cannot get rest apis in %s: %w", region, classify(err))
+		}
+		for _, api := range page.Items {
+			if !matchAll(api, opts.Filters) {
+				continue
+			}
+			result = append(result, api)
+			if opts.Limit > 0 && len(result) == opts.Limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// restResources pages through the resources of the REST API id.
+func restResources(ctx context.Context, client RestAPIClient, id string) ([]types.Resource, error) {
+	var result []types.Resource
+	paginator := apigateway.NewGetResourcesPaginator(client, &apigateway.GetResourcesInput{
+		RestApiId: &id,
+		Limit:     aws.Int32(restApisPageSize),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get resources of api %s: %w", id, classify(err))
+		}
+		result = append(result, page.Items...)
+	}
+	return result, nil
+}
+
+// GetEndpoints returns the execute-api endpoints of every REST API in region.
+// The endpoints that are in the pool carry their health and stats.
+func (ag *ApiGateway) GetEndpoints(region string, ctx context.Context) (*[]Endpoint, error) {
+	apis, err := ag.GetGateways(region, ctx)
+	if err != nil {
+		return &[]Endpoint{}, err
+	}
+
+	pooled := make(map[string]Endpoint)
+	for _, e := range ag.EndpointStatus() {
+		pooled[e.Host] = e
+	}
+	var endpoints []Endpoint
+	for _, i := range *apis {
+		host := ExecuteAPIHost(*i.Id, region)
+		e, ok := pooled[host]
+		if !ok {
+			e = Endpoint{
+				ID:       *i.Id,
+				Provider: ag.RESTProvider().Name(),
+				Region:   region,
+				Host:     host,
+				Stage:    ag.restStageName(),
+			}
+			if i.CreatedDate != nil {
+				e.CreatedAt = *i.CreatedDate
+			}
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	return &endpoints, nil
+}
+
+// DeleteGateways deletes the REST APIs in region selected by filters and
+// returns the deleted IDs. Without filters only the APIs created by the rotator
+// are deleted; pass AllGateways to delete every REST API of the region. APIs
+// that cannot be deleted are skipped and returned in the joined error.
+func (ag *ApiGateway) DeleteGateways(region string, ctx context.Context, filters ...GatewayFilter) (*[]string, error) {
+	result := DeleteResult{Region: region}
+	for _, a := range ag.awsAccounts() {
+		ag.deleteGateways(ctx, a.creds, DeleteOptions{Filters: filters}, &result)
+	}
+	return &result.Deleted, result.err()
+}
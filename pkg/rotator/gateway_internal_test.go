@@ -0,0 +1,96 @@
+package rotator
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestProxyURL(t *testing.T) {
+	const endpoint = "abc123.execute-api.us-east-1.amazonaws.com"
+	tests := []struct {
+		name   string
+		stage  string
+		target string
+		want   string
+		// wantRawPath is checked when set, to make sure the escaping of the
+		// target is kept rather than recomputed from the decoded path
+		wantRawPath string
+	}{
+		{
+			name:        "encoded slash",
+			target:      "https://example.com/a%2Fb/c",
+			want:        "https://" + endpoint + "/a%2Fb/c",
+			wantRawPath: "/a%2Fb/c",
+		},
+		{
+			name:        "encoded slash with stage",
+			stage:       "/ProxyStage",
+			target:      "https://example.com/a%2Fb/c",
+			want:        "https://" + endpoint + "/ProxyStage/a%2Fb/c",
+			wantRawPath: "/ProxyStage/a%2Fb/c",
+		},
+		{
+			name:   "spaces in path and query",
+			target: "https://example.com/with%20space/x?q=a%20b+c&r=%20",
+			want:   "https://" + endpoint + "/with%20space/x?q=a%20b+c&r=%20",
+		},
+		{
+			name:   "empty path",
+			target: "https://example.com",
+			want:   "https://" + endpoint + "/",
+		},
+		{
+			name:   "empty path with stage",
+			stage:  "/ProxyStage",
+			target: "https://example.com?q=1",
+			want:   "https://" + endpoint + "/ProxyStage/?q=1",
+		},
+		{
+			name:   "trailing slash",
+			stage:  "/ProxyStage",
+			target: "https://example.com/dir/",
+			want:   "https://" + endpoint + "/ProxyStage/dir/",
+		},
+		{
+			name:   "literal proxy+ segment",
+			stage:  "/ProxyStage",
+			target: "https://example.com/%7Bproxy+%7D/x",
+			want:   "https://" + endpoint + "/ProxyStage/%7Bproxy+%7D/x",
+		},
+		{
+			name:   "query and fragment",
+			target: "https://example.com/p?a=1&b=%2F#frag%20ment",
+			want:   "https://" + endpoint + "/p?a=1&b=%2F#frag%20ment",
+		},
+		{
+			name:   "stage prefix",
+			stage:  "/v1",
+			target: "http://example.com/api/items?page=2",
+			want:   "https://" + endpoint + "/v1/api/items?page=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := proxyURL(endpoint, tt.stage, target)
+			if got.String() != tt.want {
+				t.Errorf("proxyURL(%q, %q) = %s, want %s", tt.stage, tt.target, got, tt.want)
+			}
+			if tt.wantRawPath != "" && got.RawPath != tt.wantRawPath {
+				t.Errorf("proxyURL(%q, %q) has RawPath %q, want %q", tt.stage, tt.target, got.RawPath, tt.wantRawPath)
+			}
+		})
+	}
+}
+
+func TestProxyURLSpaceInPath(t *testing.T) {
+	// a path decoded by the server, without RawPath, is escaped again
+	target := &url.URL{Scheme: "https", Host: "example.com", Path: "/with space/x"}
+	got := proxyURL("abc123.execute-api.us-east-1.amazonaws.com", "/ProxyStage", target)
+	if want := "https://abc123.execute-api.us-east-1.amazonaws.com/ProxyStage/with%20space/x"; got.String() != want {
+		t.Errorf("proxyURL = %s, want %s", got, want)
+	}
+}
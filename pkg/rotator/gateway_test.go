@@ -0,0 +1,335 @@
+package rotator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+	"github.com/mductran/apigateway-rotator/pkg/rotator/rotatortest"
+)
+
+var testRegions = []string{"us-east-1", "eu-west-1"}
+
+func newTestGateway(t *testing.T, cloud *rotatortest.Cloud, opts ...rotator.Option) *rotator.ApiGateway {
+	t.Helper()
+	return newNamedGateway(t, cloud, "rotator-test", opts...)
+}
+
+func newNamedGateway(t *testing.T, cloud *rotatortest.Cloud, name string, opts ...rotator.Option) *rotator.ApiGateway {
+	t.Helper()
+	opts = append([]rotator.Option{
+		rotator.WithRestClients(cloud.Client),
+		rotator.WithReadyTimeout(0),
+		rotator.WithRegions(testRegions...),
+	}, opts...)
+	ag, err := rotator.NewApiGateway("https://example.com", name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ag
+}
+
+func hosts(deployments []rotator.Deployment) []string {
+	var hosts []string
+	for _, d := range deployments {
+		hosts = append(hosts, d.Host)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+func TestCreateListDelete(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+
+	ag := newTestGateway(t, cloud)
+	if err := ag.InitializeAll(ctx); err != nil {
+		t.Fatalf("InitializeAll: %v", err)
+	}
+	for _, region := range testRegions {
+		if n := len(cloud.Region(region).Apis()); n != 1 {
+			t.Errorf("%d REST APIs in %s after InitializeAll, want 1", n, region)
+		}
+	}
+	created := ag.Deployments()
+	if len(created) != len(testRegions) {
+		t.Fatalf("%d endpoints in the pool, want %d", len(created), len(testRegions))
+	}
+
+	// a new pool of the same name finds them back
+	discovered := newTestGateway(t, cloud)
+	if err := discovered.Discover(ctx); err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if got, want := hosts(discovered.Deployments()), hosts(created); !slices.Equal(got, want) {
+		t.Errorf("Discover found %v, want %v", got, want)
+	}
+
+	report := rotator.NewLifecycle(ag).Teardown(ctx)
+	if len(report.Failed) > 0 {
+		t.Fatalf("Teardown: %v", &rotator.TeardownError{Report: report})
+	}
+	if len(report.Deleted) != len(created) {
+		t.Errorf("Teardown deleted %d endpoints, want %d", len(report.Deleted), len(created))
+	}
+	for _, region := range testRegions {
+		if apis := cloud.Region(region).Apis(); len(apis) != 0 {
+			t.Errorf("%d REST APIs left in %s after Teardown", len(apis), region)
+		}
+	}
+}
+
+func TestCreateFailure(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	injected := errors.New("injected failure")
+	cloud.Region("eu-west-1").Err = func(operation string) error {
+		if operation == "CreateRestApi" {
+			return injected
+		}
+		return nil
+	}
+
+	ag := newTestGateway(t, cloud)
+	err := ag.InitializeAll(ctx)
+	var regionErr *rotator.RegionError
+	if !errors.As(err, &regionErr) || regionErr.Region != "eu-west-1" {
+		t.Fatalf("InitializeAll returned %v, want a RegionError for eu-west-1", err)
+	}
+	if !errors.Is(err, injected) {
+		t.Errorf("InitializeAll returned %v, want it to wrap the create error", err)
+	}
+
+	// the region that worked is still in the pool
+	deployments := ag.Deployments()
+	if len(deployments) != 1 || deployments[0].Region != "us-east-1" {
+		t.Errorf("pool has %v, want the endpoint of us-east-1 only", deployments)
+	}
+	if apis := cloud.Region("eu-west-1").Apis(); len(apis) != 0 {
+		t.Errorf("%d REST APIs left in eu-west-1 after the failed create", len(apis))
+	}
+}
+
+// seedApis creates n REST APIs named api-00, api-01... in region, and makes the
+// fake return them pageSize at a time. It returns a counter of the
+// GetRestApis calls.
+func seedApis(t *testing.T, cloud *rotatortest.Cloud, region string, n, pageSize int) *int {
+	t.Helper()
+	r := cloud.Region(region)
+	for i := 0; i < n; i++ {
+		_, err := r.CreateRestApi(context.Background(), &apigateway.CreateRestApiInput{Name: aws.String(fmt.Sprintf("api-%02d", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.PageSize = pageSize
+	calls := new(int)
+	r.Err = func(operation string) error {
+		if operation == "GetRestApis" {
+			*calls++
+		}
+		return nil
+	}
+	return calls
+}
+
+func TestListGatewaysPages(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	calls := seedApis(t, cloud, "us-east-1", 12, 5)
+	ag := newTestGateway(t, cloud)
+
+	apis, err := ag.ListGateways("us-east-1", ctx, rotator.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 12 {
+		t.Errorf("listed %d REST APIs, want the 12 of every page", len(apis))
+	}
+	if *calls != 3 {
+		t.Errorf("GetRestApis called %d times, want 3 pages", *calls)
+	}
+	seen := make(map[string]bool)
+	for _, api := range apis {
+		if seen[*api.Id] {
+			t.Errorf("REST API %s listed twice", *api.Id)
+		}
+		seen[*api.Id] = true
+	}
+}
+
+func TestListGatewaysLimit(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	calls := seedApis(t, cloud, "us-east-1", 12, 5)
+	ag := newTestGateway(t, cloud)
+
+	apis, err := ag.ListGateways("us-east-1", ctx, rotator.ListOptions{Limit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 4 {
+		t.Errorf("listed %d REST APIs, want the limit of 4", len(apis))
+	}
+	if *calls != 1 {
+		t.Errorf("GetRestApis called %d times, want 1 as the first page holds the limit", *calls)
+	}
+
+	*calls = 0
+	apis, err = ag.ListGateways("us-east-1", ctx, rotator.ListOptions{Limit: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 7 || *calls != 2 {
+		t.Errorf("listed %d REST APIs in %d calls, want 7 in 2", len(apis), *calls)
+	}
+}
+
+func TestListGatewaysFilters(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	calls := seedApis(t, cloud, "us-east-1", 12, 5)
+	ag := newTestGateway(t, cloud)
+
+	even := func(api types.RestApi) bool {
+		var n int
+		fmt.Sscanf(strings.TrimPrefix(*api.Name, "api-"), "%d", &n)
+		return n%2 == 0
+	}
+	apis, err := ag.ListGateways("us-east-1", ctx, rotator.ListOptions{Filters: []rotator.GatewayFilter{even}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 6 {
+		t.Errorf("listed %d REST APIs, want the 6 even ones", len(apis))
+	}
+	for _, api := range apis {
+		if !even(api) {
+			t.Errorf("REST API %s does not match the filter", *api.Name)
+		}
+	}
+	if *calls != 3 {
+		t.Errorf("GetRestApis called %d times, want 3 pages", *calls)
+	}
+
+	// the fake pages in id order: with a limit, listing goes on through the
+	// pages until enough APIs match, the last one being on the last page
+	var ids []string
+	for _, api := range cloud.Region("us-east-1").Apis() {
+		ids = append(ids, *api.Id)
+	}
+	wanted := []string{ids[1], ids[11]}
+	match := func(api types.RestApi) bool { return slices.Contains(wanted, *api.Id) }
+	*calls = 0
+	apis, err = ag.ListGateways("us-east-1", ctx, rotator.ListOptions{Filters: []rotator.GatewayFilter{match}, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, api := range apis {
+		got = append(got, *api.Id)
+	}
+	if !slices.Equal(got, wanted) {
+		t.Errorf("listed %v, want %v", got, wanted)
+	}
+	if *calls != 3 {
+		t.Errorf("GetRestApis called %d times, want 3 pages", *calls)
+	}
+}
+
+func TestRetargetPagesResources(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	ag := newTestGateway(t, cloud, rotator.WithRegions("us-east-1"))
+	if err := ag.InitializeAll(ctx); err != nil {
+		t.Fatalf("InitializeAll: %v", err)
+	}
+
+	// one resource per page: the wildcard resource is only on the second
+	r := cloud.Region("us-east-1")
+	r.PageSize = 1
+	calls := 0
+	r.Err = func(operation string) error {
+		if operation == "GetResources" {
+			calls++
+		}
+		return nil
+	}
+	if err := ag.Retarget(ctx, "https://example.org"); err != nil {
+		t.Fatalf("Retarget: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("GetResources called %d times, want 2 pages", calls)
+	}
+	if site := ag.CurrentSite(); site != "https://example.org" {
+		t.Errorf("site is %s after Retarget, want https://example.org", site)
+	}
+
+	d := ag.Deployments()[0]
+	stage, err := r.GetStage(ctx, &apigateway.GetStageInput{RestApiId: &d.ID, StageName: aws.String(strings.TrimPrefix(d.BasePath, "/"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target := stage.Variables["target"]; target != "example.org" {
+		t.Errorf("stage targets %q, want example.org", target)
+	}
+}
+
+func TestDeleteAllSharedApi(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	opts := []rotator.Option{rotator.WithRegions("us-east-1"), rotator.WithSharedApi("rotator-shared")}
+	first := newNamedGateway(t, cloud, "first", opts...)
+	second := newNamedGateway(t, cloud, "second", opts...)
+	for _, ag := range []*rotator.ApiGateway{first, second} {
+		if err := ag.InitializeAll(ctx); err != nil {
+			t.Fatalf("InitializeAll of %s: %v", ag.Name, err)
+		}
+	}
+	r := cloud.Region("us-east-1")
+	apis := r.Apis()
+	if len(apis) != 1 {
+		t.Fatalf("%d REST APIs for two pools on a shared API, want 1", len(apis))
+	}
+	id := *apis[0].Id
+
+	// the stage of the second pool is left alone
+	results, err := first.DeleteAll(ctx, rotator.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("DeleteAll of the first pool: %v", err)
+	}
+	if len(results[0].Deleted) != 0 || !slices.Equal(results[0].Kept, []string{id}) {
+		t.Errorf("DeleteAll deleted %v and kept %v, want %s kept", results[0].Deleted, results[0].Kept, id)
+	}
+	stages, err := r.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: &id})
+	if err != nil {
+		t.Fatalf("GetStages after deleting the first pool: %v", err)
+	}
+	var names []string
+	for _, stage := range stages.Item {
+		names = append(names, *stage.StageName)
+	}
+	if !slices.Equal(names, []string{"second"}) {
+		t.Errorf("shared API has stages %v, want those of the second pool", names)
+	}
+
+	// the last stage goes with the API
+	results, err = second.DeleteAll(ctx, rotator.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("DeleteAll of the second pool: %v", err)
+	}
+	if !slices.Equal(results[0].Deleted, []string{id}) {
+		t.Errorf("DeleteAll deleted %v, want the shared API %s", results[0].Deleted, id)
+	}
+	if apis := r.Apis(); len(apis) != 0 {
+		t.Errorf("%d REST APIs left after deleting both pools", len(apis))
+	}
+}
@@ -0,0 +1,269 @@
+package rotator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GeoAuto is the geo target hint that locates the site by the GeoIP of its
+// addresses, see WithGeoTarget.
+const GeoAuto = "auto"
+
+// DefaultGeoIPURL is the service HTTPGeolocator asks without a URL. {ip} is
+// replaced by the address looked up.
+const DefaultGeoIPURL = "https://ipinfo.io/{ip}/json"
+
+// Location is where a site or a region is.
+type Location struct {
+	// Country is the ISO 3166 alpha-2 code of the country, upper case.
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// regionLocations are the countries and approximate coordinates of the AWS
+// regions.
+var regionLocations = map[string]Location{
+	"us-east-1":      {"US", 38.9, -77.4},
+	"us-east-2":      {"US", 40.0, -83.0},
+	"us-west-1":      {"US", 37.4, -121.9},
+	"us-west-2":      {"US", 45.8, -119.7},
+	"ca-central-1":   {"CA", 45.5, -73.6},
+	"ca-west-1":      {"CA", 51.0, -114.1},
+	"sa-east-1":      {"BR", -23.5, -46.6},
+	"eu-central-1":   {"DE", 50.1, 8.7},
+	"eu-central-2":   {"CH", 47.4, 8.5},
+	"eu-west-1":      {"IE", 53.3, -6.3},
+	"eu-west-2":      {"GB", 51.5, -0.1},
+	"eu-west-3":      {"FR", 48.9, 2.4},
+	"eu-north-1":     {"SE", 59.3, 18.1},
+	"eu-south-1":     {"IT", 45.5, 9.2},
+	"eu-south-2":     {"ES", 41.6, -0.9},
+	"ap-east-1":      {"HK", 22.3, 114.2},
+	"ap-south-1":     {"IN", 19.1, 72.9},
+	"ap-south-2":     {"IN", 17.4, 78.5},
+	"ap-northeast-1": {"JP", 35.7, 139.7},
+	"ap-northeast-2": {"KR", 37.6, 127.0},
+	"ap-northeast-3": {"JP", 34.7, 135.5},
+	"ap-southeast-1": {"SG", 1.3, 103.8},
+	"ap-southeast-2": {"AU", -33.9, 151.2},
+	"ap-southeast-3": {"ID", -6.2, 106.8},
+	"ap-southeast-4": {"AU", -37.8, 145.0},
+	"ap-southeast-5": {"MY", 3.1, 101.7},
+	"me-south-1":     {"BH", 26.1, 50.6},
+	"me-central-1":   {"AE", 25.2, 55.3},
+	"il-central-1":   {"IL", 32.1, 34.8},
+	"af-south-1":     {"ZA", -33.9, 18.4},
+	"cn-north-1":     {"CN", 39.9, 116.4},
+	"cn-northwest-1": {"CN", 37.5, 105.2},
+	"us-gov-west-1":  {"US", 45.8, -119.7},
+	"us-gov-east-1":  {"US", 40.0, -83.0},
+}
+
+var countryPattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// Geolocator locates IP addresses.
+type Geolocator interface {
+	Locate(ctx context.Context, ip net.IP) (Location, error)
+}
+
+// HTTPGeolocator locates addresses with a GeoIP web service answering in the
+// JSON of ipinfo.io: {"country": "DE", "loc": "50.1,8.7"}. The addresses
+// looked up are sent to the service.
+type HTTPGeolocator struct {
+	// URL of the service with {ip} in place of the address, DefaultGeoIPURL
+	// if empty.
+	URL string
+	// Client sends the lookups, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Locate implements Geolocator.
+func (g *HTTPGeolocator) Locate(ctx context.Context, ip net.IP) (Location, error) {
+	url := g.URL
+	if url == "" {
+		url = DefaultGeoIPURL
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(url, "{ip}", ip.String()), nil)
+	if err != nil {
+		return Location{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Location{}, fmt.Errorf("cannot locate %s: %w", ip, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Location{}, fmt.Errorf("cannot locate %s: %s", ip, resp.Status)
+	}
+	var body struct {
+		Country string `json:"country"`
+		Loc     string `json:"loc"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Location{}, fmt.Errorf("cannot decode location of %s: %w", ip, err)
+	}
+	loc, err := parseCoordinates(body.Loc)
+	if err != nil {
+		return Location{}, fmt.Errorf("cannot locate %s: %w", ip, err)
+	}
+	loc.Country = strings.ToUpper(body.Country)
+	return loc, nil
+}
+
+// WithGeoTarget restricts the regions of the pool, where gateways are created
+// and looked for, to the count regions nearest to the site, those of its
+// country first; 0 keeps every region, nearest first. Hint tells where the
+// site is: GeoAuto to locate its addresses with the Geolocator, a country
+// code, a region, or "latitude,longitude". Sites behind a CDN are located at
+// the edge they resolve to from here, give a hint for those. The regions are
+// restricted by ResolveAutoRegions.
+func WithGeoTarget(hint string, count int) Option {
+	return func(ag *ApiGateway) {
+		ag.geoHint = hint
+		ag.geoCount = count
+	}
+}
+
+// WithGeolocator sets the Geolocator of WithGeoTarget, an HTTPGeolocator
+// asking DefaultGeoIPURL by default.
+func WithGeolocator(g Geolocator) Option {
+	return func(ag *ApiGateway) {
+		ag.geolocator = g
+	}
+}
+
+// resolveGeoRegions restricts ag.Regions to those nearest to the site with
+// WithGeoTarget, once.
+func (ag *ApiGateway) resolveGeoRegions(ctx context.Context) error {
+	if ag.geoHint == "" || ag.geoResolved {
+		return nil
+	}
+	loc, err := ag.siteLocation(ctx)
+	if err != nil {
+		return err
+	}
+	regions := NearestRegions(loc, ag.Regions)
+	if ag.geoCount > 0 && len(regions) > ag.geoCount {
+		regions = regions[:ag.geoCount]
+	}
+	ag.logger.Info("selected regions near the site", "country", loc.Country, "regions", regions)
+	ag.Regions = regions
+	ag.geoResolved = true
+	return nil
+}
+
+// siteLocation returns where the geo target hint says the site is.
+func (ag *ApiGateway) siteLocation(ctx context.Context) (Location, error) {
+	hint := strings.TrimSpace(ag.geoHint)
+	if loc, ok := regionLocations[strings.ToLower(hint)]; ok {
+		return loc, nil
+	}
+	if countryPattern.MatchString(hint) {
+		country := strings.ToUpper(hint)
+		var regions []string
+		for region, loc := range regionLocations {
+			if loc.Country == country {
+				regions = append(regions, region)
+			}
+		}
+		if len(regions) > 0 {
+			slices.Sort(regions)
+			return regionLocations[regions[0]], nil
+		}
+		return Location{}, fmt.Errorf("no region in country %s, give the coordinates of the site instead", country)
+	}
+	if hint != GeoAuto {
+		return parseCoordinates(hint)
+	}
+
+	host, err := siteHost(ag.CurrentSite())
+	if err != nil {
+		return Location{}, err
+	}
+	if host == "" {
+		return Location{}, fmt.Errorf("%w: no site to locate", ErrInvalidSite)
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return Location{}, fmt.Errorf("cannot resolve %s: %w", host, err)
+	}
+	// IPv4 addresses are the ones GeoIP databases know best
+	slices.SortStableFunc(ips, func(a, b net.IP) int {
+		return boolCompare(a.To4() == nil, b.To4() == nil)
+	})
+	g := ag.geolocator
+	if g == nil {
+		g = &HTTPGeolocator{}
+	}
+	return g.Locate(ctx, ips[0])
+}
+
+// NearestRegions returns regions ordered by their distance to loc, those in
+// the country of loc first. Regions of unknown location come last, in order.
+func NearestRegions(loc Location, regions []string) []string {
+	sorted := slices.Clone(regions)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		la, oka := regionLocations[a]
+		lb, okb := regionLocations[b]
+		if c := boolCompare(!oka, !okb); c != 0 || !oka {
+			return c
+		}
+		if c := boolCompare(la.Country != loc.Country, lb.Country != loc.Country); c != 0 {
+			return c
+		}
+		da, db := distance(loc, la), distance(loc, lb)
+		switch {
+		case da < db:
+			return -1
+		case da > db:
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+// distance is the great-circle distance between a and b in kilometers.
+func distance(a, b Location) float64 {
+	const earthRadius = 6371
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dlat, dlon := rad(b.Latitude-a.Latitude), rad(b.Longitude-a.Longitude)
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// parseCoordinates parses "latitude,longitude".
+func parseCoordinates(s string) (Location, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	latitude, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	longitude, err2 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if !ok || err1 != nil || err2 != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return Location{}, fmt.Errorf("invalid location %q, want auto, a country code, a region or latitude,longitude", s)
+	}
+	return Location{Latitude: latitude, Longitude: longitude}, nil
+}
+
+// boolCompare orders false before true.
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
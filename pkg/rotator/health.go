@@ -0,0 +1,179 @@
+package rotator
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults used by HealthChecker when its fields are zero.
+const (
+	DefaultHealthInterval  = 30 * time.Second
+	DefaultHealthTimeout   = 10 * time.Second
+	DefaultHealthThreshold = 2
+)
+
+// HealthChecker periodically probes every endpoint of Gateway through its
+// stage and takes endpoints out of rotation after Threshold consecutive failed
+// probes. An unhealthy endpoint is put back as soon as a probe succeeds.
+type HealthChecker struct {
+	Gateway *ApiGateway
+
+	// Interval between two rounds of probes.
+	Interval time.Duration
+	// Timeout of a single probe.
+	Timeout time.Duration
+	// Threshold is the number of consecutive failures that mark an endpoint unhealthy.
+	Threshold int
+	// Client sends the probes. A client with no proxy is used when nil.
+	Client *http.Client
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// NewHealthChecker returns a HealthChecker for ag using the default settings.
+func NewHealthChecker(ag *ApiGateway) *HealthChecker {
+	return &HealthChecker{
+		Gateway:   ag,
+		Interval:  DefaultHealthInterval,
+		Timeout:   DefaultHealthTimeout,
+		Threshold: DefaultHealthThreshold,
+	}
+}
+
+// Run probes the endpoints every Interval until ctx is done.
+func (hc *HealthChecker) Run(ctx context.Context) {
+	interval := hc.Interval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hc.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes every endpoint of the pool once, concurrently, and updates
+// their health.
+func (hc *HealthChecker) CheckAll(ctx context.Context) {
+	endpoints := hc.Gateway.Endpoints.Hosts()
+
+	var wg sync.WaitGroup
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			hc.record(endpoint, hc.probe(ctx, endpoint))
+		}(endpoint)
+	}
+	if _, ok := hc.Gateway.endpointSelector().(LatencyObserver); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hc.Gateway.ProbeLatency(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe sends a HEAD request to the stage root of endpoint, see
+// probeEndpoint.
+func (hc *HealthChecker) probe(ctx context.Context, endpoint string) bool {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	client := hc.Client
+	if client == nil {
+		// probes warm the connections requests go through
+		client = &http.Client{Transport: hc.Gateway.conns}
+	}
+	d, _ := hc.Gateway.deployment(endpoint)
+	d.Host = endpoint
+	return hc.Gateway.probeEndpoint(ctx, client, d, hc.Gateway.basePath(endpoint), timeout)
+}
+
+func (hc *HealthChecker) record(endpoint string, ok bool) {
+	threshold := hc.Threshold
+	if threshold <= 0 {
+		threshold = DefaultHealthThreshold
+	}
+
+	hc.mu.Lock()
+	if hc.failures == nil {
+		hc.failures = make(map[string]int)
+	}
+	if ok {
+		delete(hc.failures, endpoint)
+	} else {
+		hc.failures[endpoint]++
+	}
+	failures := hc.failures[endpoint]
+	hc.mu.Unlock()
+
+	switch {
+	case ok && !hc.Gateway.Healthy(endpoint):
+		hc.Gateway.logger.Info("endpoint recovered", "endpoint", endpoint)
+		hc.Gateway.SetHealthy(endpoint, true)
+	case !ok && failures == threshold:
+		hc.Gateway.logger.Warn("endpoint unhealthy", "endpoint", endpoint, "failures", failures)
+		hc.Gateway.SetHealthy(endpoint, false)
+	}
+}
+
+// Healthy reports whether endpoint is in rotation. Endpoints are healthy until
+// marked otherwise.
+func (ag *ApiGateway) Healthy(endpoint string) bool {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return !ag.unhealthy[endpoint]
+}
+
+// SetHealthy puts endpoint back in rotation or takes it out.
+func (ag *ApiGateway) SetHealthy(endpoint string, healthy bool) {
+	ag.mu.Lock()
+	if healthy {
+		delete(ag.unhealthy, endpoint)
+		ag.mu.Unlock()
+		return
+	}
+	if ag.unhealthy == nil {
+		ag.unhealthy = make(map[string]bool)
+	}
+	changed := !ag.unhealthy[endpoint]
+	ag.unhealthy[endpoint] = true
+	ag.mu.Unlock()
+	if changed {
+		d, _ := ag.deployment(endpoint)
+		d.Host = endpoint
+		ag.emitDeployment(EventEndpointUnhealthy, d)
+	}
+}
+
+// HealthyEndpoints returns the endpoints currently in rotation.
+func (ag *ApiGateway) HealthyEndpoints() []string {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return ag.healthyEndpoints()
+}
+
+// healthyEndpoints must be called with ag.mu held.
+func (ag *ApiGateway) healthyEndpoints() []string {
+	endpoints := ag.Endpoints.Snapshot()
+	healthy := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		if !ag.unhealthy[e.Host] {
+			healthy = append(healthy, e.Host)
+		}
+	}
+	return healthy
+}
@@ -0,0 +1,113 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// errHedgeLost cancels the attempt of a hedged request that did not answer
+// first. It is not counted against its endpoint.
+var errHedgeLost = errors.New("hedged request answered through another endpoint")
+
+type pickedKey struct{}
+
+// WithHedging sends GET and HEAD requests without a body again through a
+// second endpoint when the first did not answer within delay, and uses the
+// response that arrives first; the other attempt is canceled. It keeps the
+// tail latency down when a region is slow, at the cost of up to twice the
+// requests. With WithRetry, a hedged pair is one attempt. Long-running
+// requests are not hedged.
+func WithHedging(delay time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.hedgeDelay = delay
+	}
+}
+
+// hedgeable reports whether req is idempotent and can be sent twice at once.
+func hedgeable(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody) && !longRunning(req)
+}
+
+// hedgedRoundTrip is roundTrip, hedged through another endpoint not in
+// exclude when WithHedging applies to req.
+func (t *Transport) hedgedRoundTrip(req *http.Request, exclude map[string]bool) (*http.Response, string, error) {
+	if t.Gateway.hedgeDelay <= 0 || !hedgeable(req) {
+		return t.roundTrip(req, exclude)
+	}
+
+	type result struct {
+		resp     *http.Response
+		endpoint string
+		err      error
+		n        int
+	}
+	results := make(chan result, 2)
+	var cancels []context.CancelCauseFunc
+	send := func(ctx context.Context, exclude map[string]bool) {
+		ctx, cancel := context.WithCancelCause(ctx)
+		n := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, endpoint, err := t.roundTrip(req.WithContext(ctx), exclude)
+			results <- result{resp, endpoint, err, n}
+		}()
+	}
+	picked := make(chan string, 1)
+	send(context.WithValue(req.Context(), pickedKey{}, func(endpoint string) { picked <- endpoint }), exclude)
+
+	timer := time.NewTimer(t.Gateway.hedgeDelay)
+	var r result
+	select {
+	case r = <-results:
+		timer.Stop()
+	case <-timer.C:
+		second := map[string]bool{}
+		for endpoint := range exclude {
+			second[endpoint] = true
+		}
+		select {
+		case endpoint := <-picked:
+			second[endpoint] = true
+		default:
+		}
+		t.Gateway.logger.Debug("hedging request", "url", req.URL.Redacted(), "after", t.Gateway.hedgeDelay)
+		send(req.Context(), second)
+		// a failure is only the answer once the other attempt failed too
+		if r = <-results; r.err != nil {
+			cancels[r.n](nil)
+			r = <-results
+		} else {
+			lost := 1 - r.n
+			cancels[lost](errHedgeLost)
+			go func() {
+				if lost := <-results; lost.resp != nil {
+					lost.resp.Body.Close()
+				}
+			}()
+		}
+	}
+	cancel := cancels[r.n]
+	if r.resp == nil {
+		cancel(nil)
+		return nil, r.endpoint, r.err
+	}
+	r.resp.Body = cancelBody{r.resp.Body, func() { cancel(nil) }}
+	return r.resp, r.endpoint, nil
+}
+
+// endpointPicked tells a hedged request which endpoint its first attempt
+// goes through, so that the second goes through another one.
+func endpointPicked(ctx context.Context, endpoint string) {
+	if picked, ok := ctx.Value(pickedKey{}).(func(string)); ok {
+		picked(endpoint)
+	}
+}
+
+// hedgeLost reports whether ctx is that of an attempt canceled because the
+// other attempt of its hedged request answered first.
+func hedgeLost(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errHedgeLost)
+}
@@ -0,0 +1,47 @@
+package rotator
+
+import (
+	"net/http"
+	"sync"
+)
+
+// hooks are the functions registered with OnRequest and OnResponse.
+type hooks struct {
+	mu       sync.RWMutex
+	request  []func(*http.Request)
+	response []func(*http.Response)
+}
+
+// OnRequest registers fn to be called by Transport with every rerouted
+// request, right before it is sent to the gateway. fn may change the request,
+// e.g. to add headers. Hooks run in the order they were registered.
+func (ag *ApiGateway) OnRequest(fn func(*http.Request)) {
+	ag.hooks.mu.Lock()
+	defer ag.hooks.mu.Unlock()
+	ag.hooks.request = append(ag.hooks.request, fn)
+}
+
+// OnResponse registers fn to be called by Transport with every response of
+// the gateway, before it is returned to the caller. fn may change the
+// response; a hook reading the body must replace it.
+func (ag *ApiGateway) OnResponse(fn func(*http.Response)) {
+	ag.hooks.mu.Lock()
+	defer ag.hooks.mu.Unlock()
+	ag.hooks.response = append(ag.hooks.response, fn)
+}
+
+func (h *hooks) onRequest(req *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.request {
+		fn(req)
+	}
+}
+
+func (h *hooks) onResponse(resp *http.Response) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.response {
+		fn(resp)
+	}
+}
@@ -0,0 +1,209 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	v2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+// Backend is the kind of API Gateway API created for each endpoint.
+type Backend string
+
+const (
+	// BackendREST creates REST APIs (API Gateway v1). It is the default.
+	BackendREST Backend = "rest"
+
+	// BackendHTTP creates HTTP APIs (API Gateway v2), which cost a fraction of
+	// a REST API per request. HTTP APIs reserve the X-Forwarded-For header, so
+	// the target sees the address API Gateway appends instead of the spoofed
+	// one.
+	BackendHTTP Backend = "http"
+)
+
+// httpStageName is the auto-deployed stage of HTTP APIs. It is served at the
+// root of the endpoint, so requests need no stage prefix.
+const httpStageName = "$default"
+
+// WithBackend selects the kind of API created for new endpoints.
+func WithBackend(backend Backend) Option {
+	return func(ag *ApiGateway) {
+		ag.backend = backend
+	}
+}
+
+// stagePath is the path prefix requests need to reach the deployed stage.
+func (ag *ApiGateway) stagePath() string {
+	if ag.backend == BackendHTTP {
+		return ""
+	}
+	return "/" + ag.restStageName()
+}
+
+// newV2Client builds an API Gateway v2 client for region with creds, or with
+// the default credentials of ag when creds is nil.
+func (ag *ApiGateway) newV2Client(ctx context.Context, creds *credentialSet, region string) (*apigatewayv2.Client, error) {
+	if creds == nil {
+		creds = ag.creds
+	}
+	return cached(ag.clients, ag.clientKey("http", creds, region), func() (*apigatewayv2.Client, error) {
+		cfg, err := ag.awsConfig(ctx, creds, region)
+		if err != nil {
+			return nil, err
+		}
+		return apigatewayv2.NewFromConfig(cfg), nil
+	})
+}
+
+// createHttpGateway creates an HTTP API in region whose $default route proxies
+// every request to the site.
+func (ag *ApiGateway) createHttpGateway(creds *credentialSet, region string, ctx context.Context) (_ Deployment, err error) {
+	site := ag.CurrentSite()
+	if site == "" {
+		return Deployment{}, fmt.Errorf("%w: no site to create a gateway for", ErrInvalidSite)
+	}
+
+	client, err := ag.newV2Client(ctx, creds, region)
+	if err != nil {
+		return Deployment{}, err
+	}
+
+	inPool := 0
+	existing, err := findHttpApi(ctx, client, region, func(api v2types.Api) bool {
+		if !ag.inPool(aws.ToString(api.Name), api.Tags) {
+			return false
+		}
+		inPool++
+		return !ag.knownApi(region, *api.ApiId)
+	})
+	if err != nil {
+		return Deployment{}, err
+	}
+	if existing != nil && ag.adopt {
+		return ag.adoptHttpGateway(ctx, client, region, *existing, site)
+	}
+	if existing != nil || (inPool >= ag.endpointsPerRegion() && !extraEndpoint(ctx)) {
+		return Deployment{}, fmt.Errorf("%w: an API already exists with name: %s in region %s", ErrApiExists, ag.Name, region)
+	}
+
+	name, _ := ag.newNames()
+	newApi, err := client.CreateApi(ctx, &apigatewayv2.CreateApiInput{
+		Name:         &name,
+		ProtocolType: v2types.ProtocolTypeHttp,
+		Tags:         ag.tags(site),
+	})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("cannot create new API: %w", classify(err))
+	}
+	defer func() {
+		if err != nil {
+			err = ag.rollback(ctx, region, *newApi.ApiId, err, func(ctx context.Context) error {
+				_, err := client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{ApiId: newApi.ApiId})
+				return err
+			})
+		}
+	}()
+
+	if err := ag.putHttpProxyRoute(ctx, client, *newApi.ApiId, site); err != nil {
+		return Deployment{}, err
+	}
+
+	_, err = client.CreateStage(ctx, &apigatewayv2.CreateStageInput{
+		ApiId:      newApi.ApiId,
+		StageName:  aws.String(httpStageName),
+		AutoDeploy: aws.Bool(true),
+	})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("cannot create stage: %w", classify(err))
+	}
+
+	return httpDeployment(region, *newApi.ApiId, aws.ToTime(newApi.CreatedDate)), nil
+}
+
+// putHttpProxyRoute creates an integration proxying to site and points the
+// $default route of api at it.
+func (ag *ApiGateway) putHttpProxyRoute(ctx context.Context, client *apigatewayv2.Client, api, site string) error {
+	// the $default route has no path parameter, so forward the request path by
+	// overwriting the integration path, keeping any base path of the site
+	u, err := url.Parse(site)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSite, err)
+	}
+	integration, err := client.CreateIntegration(ctx, &apigatewayv2.CreateIntegrationInput{
+		ApiId:                &api,
+		IntegrationType:      v2types.IntegrationTypeHttpProxy,
+		IntegrationMethod:    aws.String("ANY"),
+		IntegrationUri:       &site,
+		PayloadFormatVersion: aws.String("1.0"),
+		RequestParameters: map[string]string{
+			"overwrite:path": u.Path + "$request.path",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create integration: %w", classify(err))
+	}
+
+	_, err = client.CreateRoute(ctx, &apigatewayv2.CreateRouteInput{
+		ApiId:    &api,
+		RouteKey: aws.String("$default"),
+		Target:   aws.String("integrations/" + *integration.IntegrationId),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create default route: %w", classify(err))
+	}
+
+	return nil
+}
+
+// httpDeployment describes the HTTP API id in region.
+func httpDeployment(region, id string, created time.Time) Deployment {
+	return Deployment{
+		Provider:  ProviderHTTP,
+		Region:    region,
+		ID:        id,
+		Host:      ExecuteAPIHost(id, region),
+		CreatedAt: created,
+	}
+}
+
+// listHttpGateways returns the HTTP APIs of the pool in region.
+func (ag *ApiGateway) listHttpGateways(creds *credentialSet, region string, ctx context.Context) ([]Deployment, error) {
+	client, err := ag.newV2Client(ctx, creds, region)
+	if err != nil {
+		return nil, err
+	}
+
+	var deployments []Deployment
+	input := &apigatewayv2.GetApisInput{}
+	for {
+		output, err := client.GetApis(ctx, input)
+		if err != nil {
+			return deployments, fmt.Errorf("cannot get http apis: %w", classify(err))
+		}
+		for _, api := range output.Items {
+			if ag.inPool(aws.ToString(api.Name), api.Tags) {
+				deployments = append(deployments, httpDeployment(region, *api.ApiId, aws.ToTime(api.CreatedDate)))
+			}
+		}
+		if output.NextToken == nil {
+			return deployments, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// deleteHttpGateway deletes the HTTP API id in region.
+func (ag *ApiGateway) deleteHttpGateway(creds *credentialSet, region, id string, ctx context.Context) error {
+	client, err := ag.newV2Client(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{ApiId: &id}); err != nil {
+		return fmt.Errorf("cannot delete http api %s: %w", id, classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package rotator
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement is a statement of a PolicyDocument.
+type PolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// PolicyOptions are the features of the rotator an IAM policy allows.
+type PolicyOptions struct {
+	// Regions the gateways are managed in, every region when empty.
+	Regions []string
+	// Backend is the kind of gateways, REST APIs when empty.
+	Backend Backend
+	// AutoRegions allows looking up the regions enabled in the account.
+	AutoRegions bool
+	// ResourcePolicy allows setting the resource policy of WithSourceIPs.
+	ResourcePolicy bool
+	// IAMAuth allows invoking the gateways of WithIAMAuth.
+	IAMAuth bool
+	// WebACL allows associating the web ACLs of WithWebACL.
+	WebACL bool
+	// CustomDomain allows provisioning the domain names of WithCustomDomain.
+	CustomDomain bool
+	// Quotas allows reading the REST API quota, see WithQuotaCheck.
+	Quotas bool
+	// BillingAlarm is the name of the alarm set up by SetupBillingAlarm, none
+	// when empty.
+	BillingAlarm string
+	// State is the location of an s3:// or dynamodb:// state store.
+	State string
+	// RoleARN is a role to assume, see WithAssumeRole.
+	RoleARN string
+}
+
+// IAMPolicy returns the least privileged IAM policy the rotator needs for
+// opts.
+func IAMPolicy(opts PolicyOptions) PolicyDocument {
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regions = []string{"*"}
+	}
+	// the API keys of WithAPIKey are looked up whenever an API is deleted
+	paths := []string{"/restapis", "/restapis/*", "/apikeys", "/apikeys/*", "/usageplans", "/usageplans/*"}
+	methods := []string{"apigateway:GET", "apigateway:POST", "apigateway:PUT", "apigateway:PATCH", "apigateway:DELETE"}
+	if opts.Backend == BackendHTTP {
+		paths = []string{"/apis", "/apis/*"}
+		methods = slices.DeleteFunc(methods, func(m string) bool { return m == "apigateway:PUT" })
+	}
+	var resources []string
+	for _, region := range regions {
+		for _, path := range append(paths, "/tags/*") {
+			resources = append(resources, policyARN("apigateway", region, "", path))
+		}
+	}
+
+	policy := PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []PolicyStatement{{
+			Sid:      "ManageGateways",
+			Effect:   "Allow",
+			Action:   methods,
+			Resource: resources,
+		}},
+	}
+	add := func(sid string, actions []string, resources ...string) {
+		policy.Statement = append(policy.Statement, PolicyStatement{Sid: sid, Effect: "Allow", Action: actions, Resource: resources})
+	}
+
+	if opts.ResourcePolicy && opts.Backend != BackendHTTP {
+		var apis []string
+		for _, region := range regions {
+			apis = append(apis, policyARN("apigateway", region, "", "/restapis/*"))
+		}
+		add("ResourcePolicy", []string{"apigateway:UpdateRestApiPolicy"}, apis...)
+	}
+	if opts.IAMAuth && opts.Backend != BackendHTTP {
+		var apis []string
+		for _, region := range regions {
+			apis = append(apis, policyARN(invokeService, region, "*", "*/*"))
+		}
+		add("InvokeGateways", []string{"execute-api:Invoke"}, apis...)
+	}
+	if opts.WebACL && opts.Backend != BackendHTTP {
+		var acls, stages []string
+		for _, region := range regions {
+			acls = append(acls, policyARN("wafv2", region, "*", "regional/webacl/*/*"))
+			stages = append(stages, policyARN("apigateway", region, "", "/restapis/*/stages/*"))
+		}
+		add("WebACL", []string{"wafv2:AssociateWebACL"}, acls...)
+		add("WebACLStages", []string{"apigateway:SetWebACL"}, stages...)
+		add("ListWebACLs", []string{"wafv2:ListWebACLs"}, "*")
+	}
+	if opts.CustomDomain && opts.Backend != BackendHTTP {
+		var domains []string
+		for _, region := range regions {
+			domains = append(domains, policyARN("apigateway", region, "", "/domainnames"), policyARN("apigateway", region, "", "/domainnames/*"))
+		}
+		add("DomainNames", []string{"apigateway:GET", "apigateway:POST", "apigateway:DELETE"}, domains...)
+		// ACM cannot scope the listing and the requests to certificates
+		add("Certificates", []string{"acm:ListCertificates", "acm:DescribeCertificate", "acm:RequestCertificate", "acm:AddTagsToCertificate"}, "*")
+		add("DomainRecords", []string{"route53:ChangeResourceRecordSets", "route53:ListResourceRecordSets"}, policyARN("route53", "", "", "hostedzone/*"))
+		add("HostedZones", []string{"route53:ListHostedZonesByName"}, "*")
+	}
+	if opts.AutoRegions {
+		add("DiscoverRegions", []string{"ec2:DescribeRegions"}, "*")
+	}
+	if opts.Quotas && opts.Backend != BackendHTTP {
+		add("ReadQuotas", []string{"servicequotas:ListServiceQuotas"}, "*")
+	}
+	if opts.BillingAlarm != "" {
+		add("BillingAlarmTopic", []string{"sns:CreateTopic", "sns:Subscribe"}, policyARN("sns", billingRegion, "*", opts.BillingAlarm))
+		add("BillingAlarm", []string{"cloudwatch:PutMetricAlarm"}, policyARN("cloudwatch", billingRegion, "*", "alarm:"+opts.BillingAlarm))
+	}
+	if u, err := url.Parse(opts.State); err == nil && u.Host != "" {
+		key := strings.TrimPrefix(u.Path, "/")
+		switch u.Scheme {
+		case "s3":
+			add("State", []string{"s3:GetObject", "s3:PutObject"}, policyARN("s3", "", "", u.Host+"/"+key))
+			// without it, S3 denies reading a state that was not saved yet
+			add("StateBucket", []string{"s3:ListBucket"}, policyARN("s3", "", "", u.Host))
+		case "dynamodb":
+			add("State", []string{"dynamodb:GetItem", "dynamodb:PutItem"}, policyARN("dynamodb", "*", "*", "table/"+u.Host))
+		}
+	}
+	if opts.RoleARN != "" {
+		add("AssumeRole", []string{"sts:AssumeRole"}, opts.RoleARN)
+	}
+	return policy
+}
+
+// policyARN returns the ARN of resource of service in region and account,
+// which may be wildcards.
+func policyARN(service, region, account, resource string) string {
+	partition := "aws"
+	if region != "*" {
+		partition = Partition(region)
+	}
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", partition, service, region, account, resource)
+}
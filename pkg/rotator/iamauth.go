@@ -0,0 +1,105 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// invokeService is the service SigV4 signatures of requests to API Gateway
+// endpoints are scoped to.
+const invokeService = "execute-api"
+
+// WithIAMAuth makes the methods of the REST APIs created for the pool use
+// AWS_IAM authorization: only requests signed with SigV4 by a principal
+// allowed execute-api:Invoke get through. The Transport signs every request
+// with the credentials of the account the gateway belongs to, which replaces
+// any Authorization header of the request; the body is read into memory to
+// be hashed. Gateways discovered or adopted by the pool are signed for too.
+// HTTP APIs are not supported.
+func WithIAMAuth() Option {
+	return func(ag *ApiGateway) {
+		ag.iamAuth = true
+	}
+}
+
+// sign adds the SigV4 signature of the request to the endpoint d, if its
+// methods use IAM authorization. It must be the last change made to req.
+func (ag *ApiGateway) sign(req *http.Request, d Deployment) error {
+	if !d.IAMAuth {
+		return nil
+	}
+	ctx := req.Context()
+	creds, err := ag.invokeCredentials(ctx, d)
+	if err != nil {
+		return err
+	}
+	hash, err := payloadHash(req)
+	if err != nil {
+		return fmt.Errorf("cannot sign request: %w", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hash, invokeService, d.Region, time.Now()); err != nil {
+		return fmt.Errorf("cannot sign request: %w", err)
+	}
+	return nil
+}
+
+// invokeCredentials returns the credentials of the account the provider of d
+// manages gateways in, the credentials of the pool for other providers.
+func (ag *ApiGateway) invokeCredentials(ctx context.Context, d Deployment) (aws.Credentials, error) {
+	set := ag.creds
+	ag.mu.RLock()
+	p := ag.providers[d.Provider]
+	ag.mu.RUnlock()
+	if p, ok := p.(restProvider); ok && p.account.creds != nil {
+		set = p.account.creds
+	}
+	cfg, err := ag.baseConfig(ctx, set, d.Region)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return creds, fmt.Errorf("%w: cannot retrieve credentials to sign requests: %w", ErrCredentials, err)
+	}
+	return creds, nil
+}
+
+// payloadHash returns the hex encoded SHA-256 of the body of req. A body that
+// cannot be read again through GetBody is buffered and put back.
+func payloadHash(req *http.Request) (string, error) {
+	var body []byte
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		if body, err = io.ReadAll(rc); err != nil {
+			return "", err
+		}
+	default:
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
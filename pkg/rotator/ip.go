@@ -0,0 +1,184 @@
+package rotator
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// IPGenerator chooses the address a rerouted request claims to come from in
+// X-Forwarded-For. A nil address leaves the header out.
+type IPGenerator interface {
+	NextIP(req *http.Request) net.IP
+}
+
+// IPGeneratorFunc adapts a function to IPGenerator.
+type IPGeneratorFunc func(req *http.Request) net.IP
+
+func (f IPGeneratorFunc) NextIP(req *http.Request) net.IP {
+	return f(req)
+}
+
+// WithIPGenerator sets how the spoofed X-Forwarded-For address of requests
+// without one is chosen. The default is PublicIPv4. A X-Forwarded-For header
+// set by the client is always forwarded as is.
+func WithIPGenerator(g IPGenerator) Option {
+	return func(ag *ApiGateway) {
+		ag.ipGenerator = g
+	}
+}
+
+// NoSpoofing never sets X-Forwarded-For.
+func NoSpoofing() IPGenerator {
+	return IPGeneratorFunc(func(*http.Request) net.IP { return nil })
+}
+
+// FixedIP always claims ip.
+func FixedIP(ip net.IP) IPGenerator {
+	return IPGeneratorFunc(func(*http.Request) net.IP { return ip })
+}
+
+// reservedIPv4 are the special-purpose IPv4 blocks of RFC 6890 and the
+// multicast and reserved space, which no real client comes from.
+var reservedIPv4 = mustParseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16",
+	"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+)
+
+// PublicIPv4 returns random publicly routable IPv4 addresses.
+func PublicIPv4() IPGenerator {
+	return IPGeneratorFunc(func(*http.Request) net.IP {
+		return randomPublicIPv4()
+	})
+}
+
+func randomPublicIPv4() net.IP {
+	for {
+		n := rand.Uint32()
+		ip := net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4()
+		if !inAny(ip, reservedIPv4) {
+			return ip
+		}
+	}
+}
+
+// globalUnicast is the IPv6 space allocated to the regional registries, and
+// reservedIPv6 the special-purpose blocks inside it.
+var (
+	globalUnicast = mustParseCIDRs("2000::/3")[0]
+	reservedIPv6  = mustParseCIDRs("2001::/23", "2001:db8::/32", "2002::/16", "3fff::/20")
+)
+
+// PublicIPv6 returns random global unicast IPv6 addresses.
+func PublicIPv6() IPGenerator {
+	return IPGeneratorFunc(func(*http.Request) net.IP {
+		for {
+			ip := randomIn(globalUnicast)
+			if !inAny(ip, reservedIPv6) {
+				return ip
+			}
+		}
+	})
+}
+
+// MixedIPs returns addresses of v6 for a ratio of the requests, between 0 and
+// 1, and of v4 for the others.
+func MixedIPs(v4, v6 IPGenerator, ratio float64) IPGenerator {
+	return IPGeneratorFunc(func(req *http.Request) net.IP {
+		if rand.Float64() < ratio {
+			return v6.NextIP(req)
+		}
+		return v4.NextIP(req)
+	})
+}
+
+// CIDRGenerator returns random addresses of a set of networks. Each network
+// is picked with the same probability, whatever its size.
+type CIDRGenerator struct {
+	networks []*net.IPNet
+}
+
+// NewCIDRGenerator returns a CIDRGenerator drawing from cidrs, IPv4 or IPv6
+// networks in CIDR notation.
+func NewCIDRGenerator(cidrs ...string) (*CIDRGenerator, error) {
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("no networks to draw addresses from")
+	}
+	g := &CIDRGenerator{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+		}
+		g.networks = append(g.networks, network)
+	}
+	return g, nil
+}
+
+func (g *CIDRGenerator) NextIP(*http.Request) net.IP {
+	return randomIn(g.networks[rand.Intn(len(g.networks))])
+}
+
+// randomIn returns a random address of network.
+func randomIn(network *net.IPNet) net.IP {
+	ip := make(net.IP, len(network.IP))
+	for i := range ip {
+		ip[i] = network.IP[i]&network.Mask[i] | byte(rand.Intn(256))&^network.Mask[i]
+	}
+	return ip
+}
+
+// ParseIPGenerator parses an X-Forwarded-For policy: "off", "public",
+// "public6", "mixed:<IPv6 ratio>", "fixed:<ip>" or
+// "cidr:<network>[,<network>...]".
+func ParseIPGenerator(spec string) (IPGenerator, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "off":
+		return NoSpoofing(), nil
+	case "public", "":
+		return PublicIPv4(), nil
+	case "public6":
+		return PublicIPv6(), nil
+	case "mixed":
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid IPv6 ratio %q, want a number between 0 and 1", arg)
+		}
+		return MixedIPs(PublicIPv4(), PublicIPv6(), ratio), nil
+	case "fixed":
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid fixed address %q", arg)
+		}
+		return FixedIP(ip), nil
+	case "cidr":
+		return NewCIDRGenerator(strings.Split(arg, ",")...)
+	}
+	return nil, fmt.Errorf("unknown X-Forwarded-For policy %q", spec)
+}
+
+func inAny(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,89 @@
+package rotator
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionIPs keeps the address Base chose for a session until the session has
+// been idle for TTL, for sites that bind sessions to the client address.
+// Requests without a session get a new address every time.
+type SessionIPs struct {
+	Base IPGenerator
+	// TTL is how long an idle session keeps its address.
+	TTL time.Duration
+	// Key names the session of a request. SessionFromRequest is used when nil.
+	Key func(*http.Request) string
+
+	mu        sync.Mutex
+	ips       map[string]sessionIP
+	lastSweep time.Time
+}
+
+type sessionIP struct {
+	ip       net.IP
+	lastUsed time.Time
+}
+
+// NewSessionIPs returns a SessionIPs keeping the addresses of base for ttl.
+func NewSessionIPs(base IPGenerator, ttl time.Duration) *SessionIPs {
+	return &SessionIPs{Base: base, TTL: ttl, ips: make(map[string]sessionIP)}
+}
+
+func (s *SessionIPs) NextIP(req *http.Request) net.IP {
+	keyFunc := s.Key
+	if keyFunc == nil {
+		keyFunc = SessionFromRequest
+	}
+	key := keyFunc(req)
+	if key == "" {
+		return s.Base.NextIP(req)
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ips == nil {
+		s.ips = make(map[string]sessionIP)
+	}
+	entry, ok := s.ips[key]
+	if !ok || now.Sub(entry.lastUsed) > s.TTL {
+		entry.ip = s.Base.NextIP(req)
+	}
+	entry.lastUsed = now
+	s.ips[key] = entry
+	s.sweep(now)
+	return entry.ip
+}
+
+// sweep drops idle sessions, at most once per TTL.
+func (s *SessionIPs) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.TTL {
+		return
+	}
+	for key, entry := range s.ips {
+		if now.Sub(entry.lastUsed) > s.TTL {
+			delete(s.ips, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// RotateEvery returns the same address of base for n requests in a row
+// before asking it for a new one.
+func RotateEvery(base IPGenerator, n int) IPGenerator {
+	var mu sync.Mutex
+	var ip net.IP
+	used := 0
+	return IPGeneratorFunc(func(req *http.Request) net.IP {
+		mu.Lock()
+		defer mu.Unlock()
+		if used == 0 || used >= n {
+			ip, used = base.NextIP(req), 0
+		}
+		used++
+		return ip
+	})
+}
@@ -0,0 +1,181 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+)
+
+// TagExpiresAt holds the RFC 3339 time after which the janitor deletes an API.
+const TagExpiresAt = "rotator-expires-at"
+
+// DefaultJanitorInterval is the time between two sweeps of Janitor.Run.
+const DefaultJanitorInterval = 10 * time.Minute
+
+// WithTTL tags every API created by the pool to expire ttl after its creation,
+// so a Janitor removes it even if the process that created it is gone.
+func WithTTL(ttl time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.ttl = ttl
+	}
+}
+
+// Janitor deletes the APIs created by the rotator whose TagExpiresAt is in the
+// past, in every region of Regions, whatever site or pool they belong to.
+type Janitor struct {
+	// Gateway provides the logger and is cleaned of the endpoints deleted.
+	Gateway *ApiGateway
+	// Regions to sweep, the regions of Gateway if empty.
+	Regions []string
+	// Interval between two sweeps of Run.
+	Interval time.Duration
+}
+
+// NewJanitor returns a Janitor sweeping the regions of ag.
+func NewJanitor(ag *ApiGateway) *Janitor {
+	return &Janitor{Gateway: ag, Interval: DefaultJanitorInterval}
+}
+
+// Run sweeps every Interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	interval := j.Interval
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Sweep(ctx); err != nil {
+			j.Gateway.logger.Warn("janitor sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the expired APIs once and returns what it deleted.
+func (j *Janitor) Sweep(ctx context.Context) ([]Deployment, error) {
+	regions := j.Regions
+	if len(regions) == 0 {
+		regions = j.Gateway.Regions
+	}
+	now := time.Now()
+
+	var deleted []Deployment
+	var errs []error
+	for _, a := range j.Gateway.awsAccounts() {
+		for _, region := range regions {
+			d, err := j.sweepRest(ctx, a, region, now)
+			deleted = append(deleted, d...)
+			if err != nil {
+				errs = append(errs, &RegionError{Region: region, Err: err})
+			}
+			d, err = j.sweepHttp(ctx, a, region, now)
+			deleted = append(deleted, d...)
+			if err != nil {
+				errs = append(errs, &RegionError{Region: region, Err: err})
+			}
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// sweepRest deletes the expired REST APIs of a in region. It goes on after a
+// failed deletion and returns the failures joined.
+func (j *Janitor) sweepRest(ctx context.Context, a account, region string, now time.Time) ([]Deployment, error) {
+	apis, err := j.Gateway.getGateways(a.creds, region, ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := j.Gateway.newClient(ctx, a.creds, region)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Deployment
+	var errs []error
+	for _, api := range *apis {
+		if !expired(api.Tags, now) {
+			continue
+		}
+		err := ctx.Err()
+		if err == nil {
+			err = j.Gateway.deleteCustomDomain(ctx, a.creds, region, restDomain(api))
+		}
+		if err == nil {
+			err = deleteRestApi(ctx, client, *api.Id)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot delete rest api %s: %w", *api.Id, err))
+			j.Gateway.logger.Warn("cannot delete expired gateway", "region", region, "id", *api.Id, "error", err)
+			continue
+		}
+		d := restDeployment(region, *api.Id, restStage(api), aws.ToTime(api.CreatedDate))
+		useDomain(&d, restDomain(api))
+		d.Provider = providerName(ProviderREST, a)
+		j.forget(d)
+		deleted = append(deleted, d)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// sweepHttp deletes the expired HTTP APIs of a in region, going on after a
+// failed deletion like sweepRest.
+func (j *Janitor) sweepHttp(ctx context.Context, a account, region string, now time.Time) ([]Deployment, error) {
+	client, err := j.Gateway.newV2Client(ctx, a.creds, region)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Deployment
+	var errs []error
+	input := &apigatewayv2.GetApisInput{}
+	for {
+		output, err := client.GetApis(ctx, input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot get http apis: %w", classify(err)))
+			return deleted, errors.Join(errs...)
+		}
+		for _, api := range output.Items {
+			if !expired(api.Tags, now) {
+				continue
+			}
+			if _, err := client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{ApiId: api.ApiId}); err != nil {
+				errs = append(errs, fmt.Errorf("cannot delete http api %s: %w", *api.ApiId, classify(err)))
+				j.Gateway.logger.Warn("cannot delete expired gateway", "region", region, "id", *api.ApiId, "error", err)
+				continue
+			}
+			d := httpDeployment(region, *api.ApiId, aws.ToTime(api.CreatedDate))
+			d.Provider = providerName(ProviderHTTP, a)
+			j.forget(d)
+			deleted = append(deleted, d)
+		}
+		if output.NextToken == nil {
+			return deleted, errors.Join(errs...)
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// forget removes a deleted API from the pool and logs it.
+func (j *Janitor) forget(d Deployment) {
+	j.Gateway.RemoveEndpoint(d.Host)
+	j.Gateway.logger.Info("expired gateway deleted", "region", d.Region, "id", d.ID, "provider", d.Provider)
+}
+
+// expired reports whether tags belong to an API of the rotator whose TTL ran out.
+func expired(tags map[string]string, now time.Time) bool {
+	if tags[TagCreatedBy] != CreatedByValue {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, tags[TagExpiresAt])
+	return err == nil && now.After(expiresAt)
+}
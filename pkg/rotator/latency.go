@@ -0,0 +1,169 @@
+package rotator
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StrategyLatency is the name of LatencySelector for NewSelector.
+const StrategyLatency = "latency"
+
+// latencySamples is the number of connections a latency probe opens to an
+// endpoint, of which the fastest is kept.
+const latencySamples = 3
+
+// LatencyObserver is implemented by selectors that pick endpoints by their
+// latency. ProbeLatency hands them the round-trip time to every endpoint.
+type LatencyObserver interface {
+	ObserveLatency(endpoint string, rtt time.Duration)
+}
+
+// ProbeLatency measures the round-trip time from this machine to every
+// region of the pool, as the time it takes to open a TCP connection to one of
+// its endpoints, and returns it by region. When the selector of the pool is a
+// LatencyObserver, every endpoint of a region is given the time of the
+// region. Regions that cannot be reached are left out. HealthChecker probes
+// again at every round for such selectors.
+func (ag *ApiGateway) ProbeLatency(ctx context.Context) map[string]time.Duration {
+	regions := make(map[string][]string)
+	for _, host := range ag.Endpoints.Hosts() {
+		d, _ := ag.deployment(host)
+		regions[d.Region] = append(regions[d.Region], host)
+	}
+
+	var mu sync.Mutex
+	latencies := make(map[string]time.Duration, len(regions))
+	var wg sync.WaitGroup
+	for region, hosts := range regions {
+		wg.Add(1)
+		go func(region string, hosts []string) {
+			defer wg.Done()
+			rtt, err := dialLatency(ctx, hosts[rand.Intn(len(hosts))])
+			if err != nil {
+				ag.logger.Debug("cannot probe latency", "region", region, "error", err)
+				return
+			}
+			mu.Lock()
+			latencies[region] = rtt
+			mu.Unlock()
+		}(region, hosts)
+	}
+	wg.Wait()
+
+	if observer, ok := ag.endpointSelector().(LatencyObserver); ok {
+		for region, hosts := range regions {
+			if rtt, ok := latencies[region]; ok {
+				for _, host := range hosts {
+					observer.ObserveLatency(host, rtt)
+				}
+			}
+		}
+	}
+	return latencies
+}
+
+// dialLatency returns the fastest of latencySamples TCP handshakes with the
+// HTTPS port of host.
+func dialLatency(ctx context.Context, host string) (time.Duration, error) {
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "443")
+	}
+	dialer := net.Dialer{Timeout: DefaultHealthTimeout}
+	var best time.Duration
+	for i := 0; i < latencySamples; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		if best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	return best, nil
+}
+
+// LatencySelector picks endpoints at random, weighted by the inverse of their
+// latency as measured by ProbeLatency, so that an endpoint twice as far is
+// picked half as often. Endpoints with no measure yet weigh as much as the
+// average of the others.
+type LatencySelector struct {
+	// MaxLatency leaves out the endpoints slower than it as long as some are
+	// not, 0 keeps every endpoint.
+	MaxLatency time.Duration
+
+	mu      sync.Mutex
+	latency map[string]time.Duration
+}
+
+// NewLatencySelector returns a LatencySelector with no measure, leaving out
+// endpoints over maxLatency.
+func NewLatencySelector(maxLatency time.Duration) *LatencySelector {
+	return &LatencySelector{MaxLatency: maxLatency, latency: make(map[string]time.Duration)}
+}
+
+// ObserveLatency implements LatencyObserver.
+func (s *LatencySelector) ObserveLatency(endpoint string, rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[endpoint] = max(rtt, time.Millisecond)
+}
+
+// Select implements EndpointSelector.
+func (s *LatencySelector) Select(_ *http.Request, endpoints []string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	candidates := endpoints
+	if s.MaxLatency > 0 {
+		var near []string
+		for _, endpoint := range endpoints {
+			if rtt, ok := s.latency[endpoint]; !ok || rtt <= s.MaxLatency {
+				near = append(near, endpoint)
+			}
+		}
+		if len(near) > 0 {
+			candidates = near
+		}
+	}
+
+	weights := make([]float64, len(candidates))
+	var sum float64
+	known := 0
+	for i, endpoint := range candidates {
+		if rtt, ok := s.latency[endpoint]; ok {
+			weights[i] = 1 / rtt.Seconds()
+			sum += weights[i]
+			known++
+		}
+	}
+	average := 1.0
+	if known > 0 {
+		average = sum / float64(known)
+	}
+	for i, w := range weights {
+		if w == 0 {
+			weights[i] = average
+			sum += average
+		}
+	}
+
+	pick := rand.Float64() * sum
+	for i, w := range weights {
+		if pick < w {
+			return candidates[i], nil
+		}
+		pick -= w
+	}
+	return candidates[len(candidates)-1], nil
+}
@@ -0,0 +1,124 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultTeardownTimeout bounds how long Lifecycle spends deleting endpoints.
+const DefaultTeardownTimeout = 2 * time.Minute
+
+// Lifecycle deletes the endpoints a pool created during the session when the
+// session ends, either because the work is done or because the process got
+// SIGINT or SIGTERM.
+type Lifecycle struct {
+	Gateway *ApiGateway
+	// Timeout of the teardown.
+	Timeout time.Duration
+	// Signals that end the session, SIGINT and SIGTERM if empty.
+	Signals []os.Signal
+}
+
+// NewLifecycle returns a Lifecycle for ag with the default timeout and signals.
+func NewLifecycle(ag *ApiGateway) *Lifecycle {
+	return &Lifecycle{Gateway: ag, Timeout: DefaultTeardownTimeout}
+}
+
+// TeardownReport lists what a teardown deleted and what it could not delete.
+type TeardownReport struct {
+	Deleted []Deployment
+	Failed  []TeardownFailure
+}
+
+// TeardownFailure is an endpoint that is still billable after a teardown.
+type TeardownFailure struct {
+	Deployment Deployment
+	Err        error
+}
+
+// TeardownError is returned when some endpoints could not be deleted.
+type TeardownError struct {
+	Report TeardownReport
+}
+
+func (e *TeardownError) Error() string {
+	lines := make([]string, 0, len(e.Report.Failed))
+	for _, f := range e.Report.Failed {
+		lines = append(lines, fmt.Sprintf("%s %s %s: %s", f.Deployment.Provider, f.Deployment.Region, f.Deployment.ID, f.Err))
+	}
+	return fmt.Sprintf("%d endpoints were not deleted:\n%s", len(lines), strings.Join(lines, "\n"))
+}
+
+// Run calls fn with a context that is cancelled on the first signal, then
+// tears down the session endpoints, whether fn returned by itself or because
+// of a signal. A second signal aborts the teardown.
+func (l *Lifecycle) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	signals := l.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	runCtx, stop := signal.NotifyContext(ctx, signals...)
+	err := fn(runCtx)
+	stop()
+	if errors.Is(err, context.Canceled) && runCtx.Err() != nil {
+		err = nil
+	}
+
+	// the first signal was consumed, a new one interrupts the teardown
+	teardownCtx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+	report := l.Teardown(teardownCtx)
+	if len(report.Failed) > 0 {
+		return errors.Join(err, &TeardownError{Report: report})
+	}
+	return err
+}
+
+// Teardown deletes the endpoints created by the pool during this session that
+// are still in the pool, and reports the outcome.
+func (l *Lifecycle) Teardown(ctx context.Context) TeardownReport {
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTeardownTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var report TeardownReport
+	for _, d := range l.Gateway.SessionDeployments() {
+		if err := l.Gateway.DeleteDeployment(ctx, d); err != nil {
+			l.Gateway.logger.Error("cannot delete endpoint on teardown", "region", d.Region, "id", d.ID, "error", err)
+			report.Failed = append(report.Failed, TeardownFailure{Deployment: d, Err: err})
+			continue
+		}
+		report.Deleted = append(report.Deleted, d)
+	}
+	l.Gateway.logger.Info("teardown finished", "deleted", len(report.Deleted), "failed", len(report.Failed))
+	finished := Event{Type: EventTeardownFinished, Count: len(report.Deleted)}
+	if len(report.Failed) > 0 {
+		finished.Error = fmt.Sprintf("%d endpoints were not deleted", len(report.Failed))
+	}
+	l.Gateway.emit(finished)
+	return report
+}
+
+// SessionDeployments returns the endpoints created by this pool since it was
+// constructed that are still in the pool.
+func (ag *ApiGateway) SessionDeployments() []Deployment {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	var deployments []Deployment
+	for _, d := range ag.session {
+		if _, ok := ag.deployments[d.Host]; ok {
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments
+}
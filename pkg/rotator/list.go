@@ -0,0 +1,90 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+// GatewayInfo describes a REST API found by ListAll.
+type GatewayInfo struct {
+	Region string `json:"region"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	// Target is the host of the site the API proxies, from its TagSite tag.
+	Target    string            `json:"target,omitempty"`
+	Endpoint  string            `json:"endpoint"`
+	CreatedAt time.Time         `json:"created_at"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// gatewayInfo describes api of region.
+func gatewayInfo(region string, api types.RestApi) GatewayInfo {
+	info := GatewayInfo{
+		Region:   region,
+		ID:       aws.ToString(api.Id),
+		Name:     aws.ToString(api.Name),
+		Target:   api.Tags[TagSite],
+		Endpoint: ExecuteAPIHost(aws.ToString(api.Id), region),
+		Tags:     api.Tags,
+	}
+	if api.CreatedDate != nil {
+		info.CreatedAt = *api.CreatedDate
+	}
+	return info
+}
+
+// ListAll lists the REST APIs selected by filters, every API when there is
+// none, in every region of ag and every account of the pool. Regions are
+// queried ag.Concurrency at a time; the APIs are sorted by region and name.
+// The APIs of the regions that could be listed are returned along with a
+// joined error of *RegionError for the others.
+func (ag *ApiGateway) ListAll(ctx context.Context, filters ...GatewayFilter) ([]GatewayInfo, error) {
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	results := make([][]types.RestApi, len(ag.Regions))
+	errs := make([]error, len(ag.Regions))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				apis, err := ag.ListGateways(ag.Regions[i], ctx, ListOptions{Filters: filters})
+				results[i] = apis
+				if err != nil {
+					errs[i] = &RegionError{Region: ag.Regions[i], Err: err}
+				}
+			}
+		}()
+	}
+	for i := range ag.Regions {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var infos []GatewayInfo
+	for i, apis := range results {
+		for _, api := range apis {
+			infos = append(infos, gatewayInfo(ag.Regions[i], api))
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Region != infos[j].Region {
+			return infos[i].Region < infos[j].Region
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, errors.Join(errs...)
+}
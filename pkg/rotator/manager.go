@@ -0,0 +1,239 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPoolTimeout bounds how long Manager may take to set up the pool of a
+// new site.
+const DefaultPoolTimeout = 5 * time.Minute
+
+// ErrHostNotAllowed is returned for destinations a HostPolicy refuses.
+var ErrHostNotAllowed = errors.New("destination not allowed")
+
+// PoolFactory builds the pool of a site for a Manager. The pool must not be
+// initialized yet.
+type PoolFactory func(site string) (*ApiGateway, error)
+
+// Manager owns a pool per target site and sends every request through the pool
+// of its destination. The pool of an allowed host that has none yet is set up
+// by the first request to it, reusing the gateways an earlier run created,
+// which makes Manager suited to forward proxies with varying destinations.
+type Manager struct {
+	// New builds the pools of the hosts requested for the first time.
+	New PoolFactory
+	// Policy restricts the hosts pools are created for. Only hosts matching
+	// Policy.Allow get one, so an empty allow list creates none. Hosts of the
+	// pools added with Add are always allowed for the scheme of their site.
+	Policy HostPolicy
+	// HealthInterval is the interval of the health checks of every pool, 0
+	// disables them.
+	HealthInterval time.Duration
+
+	ctx   context.Context
+	mu    sync.Mutex
+	pools map[string]*managedPool
+}
+
+// managedPool is a pool of a Manager. ready is closed once ag is usable or err
+// is set.
+type managedPool struct {
+	ag        *ApiGateway
+	transport *Transport
+	ready     chan struct{}
+	err       error
+}
+
+// NewManager returns a Manager creating pools with factory. Health checks run
+// until ctx is done.
+func NewManager(ctx context.Context, factory PoolFactory, policy HostPolicy) *Manager {
+	return &Manager{
+		New:            factory,
+		Policy:         policy,
+		HealthInterval: DefaultHealthInterval,
+		ctx:            ctx,
+		pools:          make(map[string]*managedPool),
+	}
+}
+
+// Add makes ag the pool of its site.
+func (m *Manager) Add(ag *ApiGateway) error {
+	key, err := siteKey(ag.CurrentSite())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pools[key]; ok {
+		return fmt.Errorf("manager already has a pool for %s", key)
+	}
+	p := &managedPool{ready: make(chan struct{})}
+	m.pools[key] = p
+	m.ready(p, ag)
+	return nil
+}
+
+// ready makes ag the usable pool p.
+func (m *Manager) ready(p *managedPool, ag *ApiGateway) {
+	p.ag = ag
+	p.transport = ag.Transport()
+	p.transport.managed = true
+	if m.HealthInterval > 0 {
+		checker := NewHealthChecker(ag)
+		checker.Interval = m.HealthInterval
+		go checker.Run(m.ctx)
+	}
+	close(p.ready)
+}
+
+// Pool returns the pool proxying scheme://host, setting it up if the host is
+// allowed and has no pool yet. Concurrent calls for the same site wait for a
+// single setup.
+func (m *Manager) Pool(ctx context.Context, scheme, host string) (*ApiGateway, error) {
+	p, err := m.pool(ctx, scheme, host)
+	if err != nil {
+		return nil, err
+	}
+	return p.ag, nil
+}
+
+func (m *Manager) pool(ctx context.Context, scheme, host string) (*managedPool, error) {
+	scheme, host = strings.ToLower(scheme), strings.ToLower(host)
+	key := scheme + "://" + host
+	m.mu.Lock()
+	p, ok := m.pools[key]
+	m.mu.Unlock()
+	if !ok {
+		// checked without the lock, the policy may resolve host
+		if err := m.allowed(ctx, host); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		if p, ok = m.pools[key]; !ok {
+			p = &managedPool{ready: make(chan struct{})}
+			m.pools[key] = p
+			go m.setup(p, scheme, host)
+		}
+		m.mu.Unlock()
+	}
+
+	select {
+	case <-p.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p, nil
+}
+
+// setup builds and initializes the pool of scheme://host. A failed setup is
+// forgotten so that the next request tries again.
+func (m *Manager) setup(p *managedPool, scheme, host string) {
+	site := scheme + "://" + host
+	ctx, cancel := context.WithTimeout(m.ctx, DefaultPoolTimeout)
+	defer cancel()
+
+	ag, err := m.New(site)
+	if err == nil {
+		err = ag.Discover(ctx)
+	}
+	if err == nil {
+		err = ag.InitializeMissing(ctx)
+	}
+	// with a fallback the pool serves requests without endpoints
+	if err == nil && len(ag.HealthyEndpoints()) == 0 && (ag.fallback == "" || ag.fallback == FallbackFail) {
+		err = fmt.Errorf("no endpoints for %s: %w", site, ErrNoEndpoints)
+	}
+	if err != nil {
+		if ag != nil {
+			for _, d := range ag.SessionDeployments() {
+				err = errors.Join(err, ag.DeleteDeployment(context.WithoutCancel(ctx), d))
+			}
+		}
+		m.mu.Lock()
+		delete(m.pools, site)
+		m.mu.Unlock()
+		p.err = fmt.Errorf("cannot set up pool for %s: %w", site, err)
+		close(p.ready)
+		return
+	}
+	m.ready(p, ag)
+}
+
+// allowed returns ErrHostNotAllowed when no pool can be created for host.
+func (m *Manager) allowed(ctx context.Context, host string) error {
+	if len(m.Policy.Allow) == 0 {
+		return fmt.Errorf("%w: %s is not allowed", ErrHostNotAllowed, host)
+	}
+	return m.Policy.Check(ctx, host)
+}
+
+// Pools returns the pools that are set up, sorted by site.
+func (m *Manager) Pools() []*ApiGateway {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pools []*ApiGateway
+	for _, p := range m.pools {
+		select {
+		case <-p.ready:
+			if p.err == nil {
+				pools = append(pools, p.ag)
+			}
+		default:
+		}
+	}
+	slices.SortFunc(pools, func(a, b *ApiGateway) int { return strings.Compare(a.CurrentSite(), b.CurrentSite()) })
+	return pools
+}
+
+// RoundTrip implements http.RoundTripper by sending req through the pool of
+// its destination.
+func (m *Manager) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, err := m.pool(req.Context(), req.URL.Scheme, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return p.transport.RoundTrip(req)
+}
+
+// Teardown deletes the endpoints every pool created since it was set up, like
+// Lifecycle.Teardown.
+func (m *Manager) Teardown(ctx context.Context) TeardownReport {
+	var report TeardownReport
+	for _, ag := range m.Pools() {
+		r := NewLifecycle(ag).Teardown(ctx)
+		report.Deleted = append(report.Deleted, r.Deleted...)
+		report.Failed = append(report.Failed, r.Failed...)
+	}
+	return report
+}
+
+// siteKey returns the lower case scheme://host of site, which Manager keys its
+// pools by so that the http and https sites of a host get a pool each.
+func siteKey(site string) (string, error) {
+	host, err := siteHost(site)
+	if err != nil {
+		return "", err
+	}
+	scheme, _, _ := strings.Cut(site, "://")
+	return strings.ToLower(scheme) + "://" + host, nil
+}
+
+// siteHost returns the lower case host of site.
+func siteHost(site string) (string, error) {
+	scheme, rest, ok := strings.Cut(site, "://")
+	if !ok || scheme == "" || rest == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidSite, site)
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	return strings.ToLower(host), nil
+}
@@ -0,0 +1,48 @@
+package rotator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+	"github.com/mductran/apigateway-rotator/pkg/rotator/rotatortest"
+)
+
+func TestManagerPoolPerScheme(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cloud := rotatortest.NewCloud()
+	factory := func(site string) (*rotator.ApiGateway, error) {
+		name := "rotator-test-" + strings.NewReplacer("://", "-", ":", "-").Replace(site)
+		return rotator.NewApiGateway(site, name,
+			rotator.WithRestClients(cloud.Client),
+			rotator.WithReadyTimeout(0),
+			rotator.WithRegions("us-east-1"),
+		)
+	}
+	m := rotator.NewManager(ctx, factory, rotator.HostPolicy{Allow: []string{"example.com"}})
+	m.HealthInterval = 0
+
+	for _, scheme := range []string{"https", "http", "HTTPS"} {
+		ag, err := m.Pool(ctx, scheme, "Example.com")
+		if err != nil {
+			t.Fatalf("Pool(%s): %v", scheme, err)
+		}
+		if want := strings.ToLower(scheme) + "://example.com"; ag.CurrentSite() != want {
+			t.Errorf("Pool(%s) proxies to %s, want %s", scheme, ag.CurrentSite(), want)
+		}
+	}
+	if n := len(m.Pools()); n != 2 {
+		t.Errorf("%d pools for the http and https sites of a host, want 2", n)
+	}
+
+	// Add refuses a second pool for a site
+	other, err := factory("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(other); err == nil {
+		t.Error("Add accepted a second pool for https://example.com")
+	}
+}
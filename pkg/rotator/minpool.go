@@ -0,0 +1,80 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultReconcileInterval is the time between two rounds of Reconciler.Run.
+const DefaultReconcileInterval = time.Minute
+
+// Reconciler keeps at least Min endpoints available in Gateway: when bans,
+// failed replacements, expirations or failing health checks leave fewer
+// healthy endpoints with a closed circuit, it creates new ones, in the regions
+// with the fewest endpoints, until the pool is back to Min. Endpoints are not
+// created while the budget of the pool is spent, and the ones that come back
+// are kept.
+type Reconciler struct {
+	Gateway *ApiGateway
+	// Min is the number of available endpoints the pool is topped up to.
+	Min int
+	// Interval between two rounds of Run.
+	Interval time.Duration
+}
+
+// NewReconciler returns a Reconciler keeping min endpoints in ag.
+func NewReconciler(ag *ApiGateway, min int) *Reconciler {
+	return &Reconciler{Gateway: ag, Min: min, Interval: DefaultReconcileInterval}
+}
+
+// Run tops the pool up every Interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			r.Gateway.logger.Warn("cannot top up pool", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile creates endpoints once until Min are available and returns those
+// it created.
+func (r *Reconciler) Reconcile(ctx context.Context) ([]Deployment, error) {
+	ag := r.Gateway
+	available := len(ag.availableEndpoints())
+	if available >= r.Min {
+		return nil, nil
+	}
+	ag.logger.Warn("pool under its minimum size, topping up", "available", available, "min", r.Min)
+
+	var created []Deployment
+	var errs []error
+	for i := available; i < r.Min; i++ {
+		if b := ag.budget; b != nil {
+			if err := b.exceeded(time.Now()); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		d, err := ag.createExtra(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		ag.logger.Info("pool topped up", "region", d.Region, "endpoint", d.Host)
+		created = append(created, d)
+	}
+	return created, errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+package rotator
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// Placeholders of name templates.
+const (
+	// PlaceholderWord is replaced by a common English word.
+	PlaceholderWord = "{word}"
+	// PlaceholderEnv is replaced by an environment name such as prod or v2.
+	PlaceholderEnv = "{env}"
+	// PlaceholderHex is replaced by six random hexadecimal digits.
+	PlaceholderHex = "{hex}"
+	// PlaceholderNum is replaced by a number between 1 and 99.
+	PlaceholderNum = "{num}"
+)
+
+// Default templates of WithRandomNames.
+const (
+	DefaultNameTemplate  = "{word}-{word}-{env}"
+	DefaultStageTemplate = "{env}"
+)
+
+var (
+	nameWords = []string{
+		"api", "app", "auth", "billing", "catalog", "checkout", "content", "core",
+		"data", "edge", "events", "feed", "gateway", "inventory", "media", "orders",
+		"partner", "payments", "profile", "public", "search", "service", "storefront", "web",
+	}
+	nameEnvs = []string{"prod", "production", "live", "staging", "v1", "v2", "v3", "api"}
+
+	placeholderPattern = regexp.MustCompile(`\{[a-z]+\}`)
+	stageNamePattern   = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,128}$`)
+)
+
+// WithStageName deploys new REST APIs to the stage name instead of
+// DefaultStageName. HTTP APIs always use their $default stage.
+func WithStageName(name string) Option {
+	return func(ag *ApiGateway) {
+		ag.stageName = name
+	}
+}
+
+// WithRandomNames names every new API and its stage from templates instead of
+// using the pool name and DefaultStageName, so that the gateways of a pool do
+// not share an obvious fingerprint. Templates may contain PlaceholderWord,
+// PlaceholderEnv, PlaceholderHex and PlaceholderNum; empty templates use
+// DefaultNameTemplate and DefaultStageTemplate. The pool keeps finding its
+// APIs through the TagPool tag.
+func WithRandomNames(nameTemplate, stageTemplate string) Option {
+	return func(ag *ApiGateway) {
+		if nameTemplate == "" {
+			nameTemplate = DefaultNameTemplate
+		}
+		if stageTemplate == "" {
+			stageTemplate = DefaultStageTemplate
+		}
+		ag.nameTemplate = nameTemplate
+		ag.stageTemplate = stageTemplate
+	}
+}
+
+// validateNames checks the stage name and templates of ag.
+func (ag *ApiGateway) validateNames() error {
+	for _, tmpl := range []string{ag.nameTemplate, ag.stageTemplate} {
+		for _, p := range placeholderPattern.FindAllString(tmpl, -1) {
+			switch p {
+			case PlaceholderWord, PlaceholderEnv, PlaceholderHex, PlaceholderNum:
+			default:
+				return fmt.Errorf("unknown placeholder %s in name template %q", p, tmpl)
+			}
+		}
+	}
+	if ag.stageName != "" && !stageNamePattern.MatchString(ag.stageName) {
+		return fmt.Errorf("invalid stage name %q", ag.stageName)
+	}
+	if ag.stageTemplate != "" && !stageNamePattern.MatchString(placeholderPattern.ReplaceAllString(ag.stageTemplate, "x")) {
+		return fmt.Errorf("invalid stage template %q", ag.stageTemplate)
+	}
+	return nil
+}
+
+// restStageName is the stage of new REST APIs when no stage template is set.
+func (ag *ApiGateway) restStageName() string {
+	if ag.stageName != "" {
+		return ag.stageName
+	}
+	return DefaultStageName
+}
+
+// newNames returns the API and stage name of a new REST API.
+func (ag *ApiGateway) newNames() (name, stage string) {
+	name, stage = ag.Name, ag.restStageName()
+	if ag.nameTemplate != "" {
+		name = expandTemplate(ag.nameTemplate)
+	}
+	if ag.stageTemplate != "" {
+		stage = expandTemplate(ag.stageTemplate)
+	}
+	return name, stage
+}
+
+// expandTemplate replaces every placeholder of tmpl with a random value.
+func expandTemplate(tmpl string) string {
+	return placeholderPattern.ReplaceAllStringFunc(tmpl, func(p string) string {
+		switch p {
+		case PlaceholderWord:
+			return nameWords[rand.Intn(len(nameWords))]
+		case PlaceholderEnv:
+			return nameEnvs[rand.Intn(len(nameEnvs))]
+		case PlaceholderHex:
+			return fmt.Sprintf("%06x", rand.Intn(1<<24))
+		case PlaceholderNum:
+			return fmt.Sprint(rand.Intn(99) + 1)
+		}
+		return strings.Trim(p, "{}")
+	})
+}
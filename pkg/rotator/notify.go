@@ -0,0 +1,238 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultNotifyBatch is how long Notifier collects events before sending them
+// in one message, so that a pool created in twenty regions is one message.
+const DefaultNotifyBatch = 5 * time.Second
+
+// DefaultNotifyTimeout bounds the delivery of a message to a webhook.
+const DefaultNotifyTimeout = 10 * time.Second
+
+// DefaultNotifyEvents are the events a Webhook without Events is sent: every
+// event but EventRequestFailed, which is too frequent to notify.
+var DefaultNotifyEvents = []EventType{
+	EventEndpointCreated,
+	EventEndpointDeleted,
+	EventEndpointUnhealthy,
+	EventEndpointBanned,
+	EventBudgetExceeded,
+	EventTeardownFinished,
+}
+
+// WebhookFormat is the body a Webhook posts.
+type WebhookFormat string
+
+const (
+	// WebhookJSON posts {"events": [...]} with the Event of every event. It
+	// is the default.
+	WebhookJSON WebhookFormat = "json"
+
+	// WebhookSlack posts {"text": ...} with a summary of the events, for
+	// Slack incoming webhooks and the services compatible with them.
+	WebhookSlack WebhookFormat = "slack"
+)
+
+// Webhook is a URL events are posted to.
+type Webhook struct {
+	URL    string
+	Format WebhookFormat
+	// Events are the types of the events sent, DefaultNotifyEvents if empty.
+	Events []EventType
+	// Client posts the messages, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// wants reports whether the events of type t are sent to w.
+func (w *Webhook) wants(t EventType) bool {
+	events := w.Events
+	if len(events) == 0 {
+		events = DefaultNotifyEvents
+	}
+	return slices.Contains(events, t)
+}
+
+// Send posts events to w in one message, leaving out those it does not want.
+func (w *Webhook) Send(ctx context.Context, events []Event) error {
+	events = slices.DeleteFunc(slices.Clone(events), func(e Event) bool { return !w.wants(e.Type) })
+	if len(events) == 0 {
+		return nil
+	}
+
+	var body any
+	switch w.Format {
+	case "", WebhookJSON:
+		body = struct {
+			Events []Event `json:"events"`
+		}{events}
+	case WebhookSlack:
+		body = struct {
+			Text string `json:"text"`
+		}{summarize(events)}
+	default:
+		return fmt.Errorf("unknown webhook format %q", w.Format)
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot notify webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("cannot notify webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// summarize describes events in a few lines of text, one per pool and type.
+func summarize(events []Event) string {
+	type group struct {
+		pool   string
+		typ    EventType
+		events []Event
+	}
+	var groups []*group
+	for _, e := range events {
+		i := slices.IndexFunc(groups, func(g *group) bool { return g.pool == e.Pool && g.typ == e.Type })
+		if i < 0 {
+			groups = append(groups, &group{pool: e.Pool, typ: e.Type})
+			i = len(groups) - 1
+		}
+		groups[i].events = append(groups[i].events, e)
+	}
+
+	lines := make([]string, 0, len(groups))
+	for _, g := range groups {
+		var regions, endpoints []string
+		for _, e := range g.events {
+			if e.Region != "" && !slices.Contains(regions, e.Region) {
+				regions = append(regions, e.Region)
+			}
+			if e.Endpoint != "" {
+				endpoints = append(endpoints, e.Endpoint)
+			}
+		}
+		n := len(g.events)
+		var line string
+		switch g.typ {
+		case EventEndpointCreated:
+			line = fmt.Sprintf("%d gateways created in %s", n, strings.Join(regions, ", "))
+		case EventEndpointDeleted:
+			line = fmt.Sprintf("%d gateways deleted in %s", n, strings.Join(regions, ", "))
+		case EventEndpointUnhealthy:
+			line = fmt.Sprintf("%d endpoints unhealthy: %s", n, strings.Join(endpoints, ", "))
+		case EventEndpointBanned:
+			line = fmt.Sprintf("%d endpoints banned: %s (%s)", n, strings.Join(endpoints, ", "), g.events[0].Error)
+		case EventBudgetExceeded:
+			line = "budget exceeded: " + g.events[0].Error
+		case EventTeardownFinished:
+			e := g.events[len(g.events)-1]
+			line = fmt.Sprintf("cleanup completed, %d gateways deleted", e.Count)
+			if e.Error != "" {
+				line += ", " + e.Error
+			}
+		default:
+			line = fmt.Sprintf("%d %s events", n, g.typ)
+		}
+		lines = append(lines, fmt.Sprintf("*%s*: %s", g.pool, line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Notifier posts the events of Gateway to Webhooks, in batches.
+type Notifier struct {
+	Gateway  *ApiGateway
+	Webhooks []*Webhook
+	// Batch is how long events are collected before they are sent.
+	Batch time.Duration
+}
+
+// NewNotifier returns a Notifier posting the events of ag to webhooks.
+func NewNotifier(ag *ApiGateway, webhooks ...*Webhook) *Notifier {
+	return &Notifier{Gateway: ag, Webhooks: webhooks, Batch: DefaultNotifyBatch}
+}
+
+// notifyBuffer is the number of events queued for the webhooks before the
+// following ones are dropped.
+const notifyBuffer = 1024
+
+// Run sends the events of the pool until ctx is done, then sends those that
+// are left.
+func (n *Notifier) Run(ctx context.Context) {
+	n.Deliver(ctx, n.Gateway.Subscribe(ctx, notifyBuffer))
+}
+
+// Deliver sends the events read from events, as returned by
+// ApiGateway.Subscribe with ctx, until it is closed. Subscribing before
+// starting Deliver in its own goroutine makes sure no event is missed.
+func (n *Notifier) Deliver(ctx context.Context, events <-chan Event) {
+	batch := n.Batch
+	if batch <= 0 {
+		batch = DefaultNotifyBatch
+	}
+
+	var pending []Event
+	var flush <-chan time.Time
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				n.send(ctx, pending)
+				return
+			}
+			pending = append(pending, e)
+			if flush == nil {
+				flush = time.After(batch)
+			}
+		case <-flush:
+			n.send(ctx, pending)
+			pending, flush = nil, nil
+		}
+	}
+}
+
+// send posts events to every webhook, even once ctx is done so that the last
+// events are not lost.
+func (n *Notifier) send(ctx context.Context, events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultNotifyTimeout)
+	defer cancel()
+	if err := n.Send(ctx, events); err != nil {
+		n.Gateway.logger.Warn("cannot send notifications", "events", len(events), "error", err)
+	}
+}
+
+// Send posts events to every webhook at once.
+func (n *Notifier) Send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, w := range n.Webhooks {
+		if err := w.Send(ctx, events); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,25 @@
+package rotator
+
+import (
+	"log/slog"
+)
+
+// Option configures an ApiGateway created by NewApiGateway.
+type Option func(*ApiGateway)
+
+// WithLogger sets the logger used for lifecycle and request logs. Logs are
+// discarded when no logger is set.
+func WithLogger(logger *slog.Logger) Option {
+	return func(ag *ApiGateway) {
+		ag.logger = logger
+	}
+}
+
+// WithHeaderDump controls whether Reroute logs the request headers before and
+// after rewriting them. Dumps are logged at debug level and are enabled by
+// default; disable them when headers may carry secrets.
+func WithHeaderDump(enabled bool) Option {
+	return func(ag *ApiGateway) {
+		ag.dumpHeaders = enabled
+	}
+}
@@ -0,0 +1,57 @@
+package rotator
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// WithJitter delays every request by a random time between min and max
+// before sending it, so that the requests of a scan are not spaced as
+// regularly as those of a script. A max of 0 disables the jitter.
+func WithJitter(min, max time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.jitterMin = min
+		ag.jitterMax = max
+	}
+}
+
+// WithPace spaces the requests sent through the pool, whatever the endpoint
+// and the host, by at least interval: requests sent at once are queued. An
+// interval of 0 disables the pacing.
+func WithPace(interval time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.pacer = nil
+		if interval > 0 {
+			ag.pacer = newTokenBucket(float64(time.Second)/float64(interval), 1)
+		}
+	}
+}
+
+// pace waits for the jitter and the pace of the pool before a request is
+// sent, or until ctx is done.
+func (ag *ApiGateway) pace(ctx context.Context) error {
+	if ag.pacer != nil {
+		if err := ag.pacer.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if ag.jitterMax <= 0 {
+		return nil
+	}
+	delay := ag.jitterMin
+	if spread := ag.jitterMax - ag.jitterMin; spread > 0 {
+		delay += time.Duration(rand.Int63n(int64(spread)))
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
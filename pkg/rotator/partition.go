@@ -0,0 +1,57 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+)
+
+// dnsSuffixes caches the DNS suffix of every region seen so far.
+var dnsSuffixes sync.Map
+
+// DNSSuffix returns the DNS suffix of the partition of region, such as
+// "amazonaws.com" or "amazonaws.com.cn", as resolved by the SDK endpoint
+// rules.
+func DNSSuffix(region string) string {
+	if suffix, ok := dnsSuffixes.Load(region); ok {
+		return suffix.(string)
+	}
+	suffix := "amazonaws.com"
+	endpoint, err := apigateway.NewDefaultEndpointResolverV2().ResolveEndpoint(context.Background(), apigateway.EndpointParameters{Region: &region})
+	if err == nil {
+		if host, ok := strings.CutPrefix(endpoint.URI.Hostname(), "apigateway."+region+"."); ok {
+			suffix = host
+		}
+	}
+	dnsSuffixes.Store(region, suffix)
+	return suffix
+}
+
+// ExecuteAPIHost returns the hostname of the API id in region.
+func ExecuteAPIHost(id, region string) string {
+	return fmt.Sprintf("%s.execute-api.%s.%s", id, region, DNSSuffix(region))
+}
+
+// Partition returns the ARN partition of region.
+func Partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	}
+	return "aws"
+}
+
+// apiARN returns the ARN of the API Gateway resource at path in region, e.g.
+// "/restapis/<id>".
+func apiARN(region, path string) string {
+	return fmt.Sprintf("arn:%s:apigateway:%s::%s", Partition(region), region, path)
+}
@@ -0,0 +1,199 @@
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxPayloadSize is the largest request or response body API Gateway passes
+// through, 10 MB.
+const MaxPayloadSize = 10 << 20
+
+// rangeChunkSize is the size of the ranges a PayloadRanged download is
+// fetched in, under MaxPayloadSize.
+const rangeChunkSize = 8 << 20
+
+// PayloadStrategy is what Transport does with payloads over MaxPayloadSize.
+type PayloadStrategy string
+
+const (
+	// PayloadReject fails requests whose body is over MaxPayloadSize with
+	// ErrPayloadTooLarge before sending them. It is the default.
+	PayloadReject PayloadStrategy = "reject"
+
+	// PayloadDirect sends requests whose body is over MaxPayloadSize straight
+	// to the site, bypassing the gateways: the site sees the address of this
+	// machine.
+	PayloadDirect PayloadStrategy = "direct"
+
+	// PayloadRanged rejects oversized request bodies like PayloadReject, and
+	// downloads every GET response in ranges under MaxPayloadSize, each
+	// through the pool, which the caller reads as one body. Sites that do not
+	// answer ranges are read in one go, as without it.
+	PayloadRanged PayloadStrategy = "ranged"
+)
+
+// WithPayloadStrategy sets what Transport does with requests and downloads
+// over the MaxPayloadSize API Gateway allows, see PayloadStrategy. Bodies of
+// unknown length are sent as they are, API Gateway refuses them with 413
+// Request Entity Too Large if they are over.
+func WithPayloadStrategy(strategy PayloadStrategy) Option {
+	return func(ag *ApiGateway) {
+		ag.payloads = strategy
+	}
+}
+
+// oversized reports whether the body of req is known to be over
+// MaxPayloadSize.
+func oversized(req *http.Request) bool {
+	return req.ContentLength > MaxPayloadSize
+}
+
+// oversizedRequest sends req, whose body is over MaxPayloadSize, the way the
+// payload strategy of the pool says.
+func (t *Transport) oversizedRequest(req *http.Request) (*http.Response, error) {
+	if t.Gateway.payloads != PayloadDirect {
+		return nil, fmt.Errorf("%w: request body of %d bytes, API Gateway allows %d", ErrPayloadTooLarge, req.ContentLength, MaxPayloadSize)
+	}
+	t.Gateway.logger.Warn("sending oversized request directly, bypassing the gateways", "url", req.URL.Redacted(), "size", req.ContentLength)
+	return t.direct(req)
+}
+
+// rangedRequest sends the GET request req as a request for its first range
+// and returns a response whose body fetches the following ranges as it is
+// read.
+func (t *Transport) rangedRequest(req *http.Request) (*http.Response, error) {
+	// ranges of a compressed body cannot be decompressed one by one
+	identity := req.Header.Get("Accept-Encoding") == ""
+	first := rangeRequest(req, 0, rangeChunkSize, "", identity)
+	resp, err := t.send(first)
+	if err != nil || resp.StatusCode != http.StatusPartialContent {
+		if err == nil && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			// an empty body has no first range
+			resp.Body.Close()
+			return t.send(req)
+		}
+		return resp, err
+	}
+	start, end, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || start != 0 {
+		resp.Body.Close()
+		return t.send(req)
+	}
+
+	resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+	resp.Header.Del("Content-Range")
+	resp.Header.Set("Content-Length", strconv.FormatInt(total, 10))
+	resp.ContentLength = total
+	if end+1 < total {
+		resp.Body = &rangedBody{
+			t:       t,
+			req:     req,
+			etag:    resp.Header.Get("ETag"),
+			current: resp.Body,
+			next:    end + 1,
+			total:   total,
+		}
+	}
+	return resp, nil
+}
+
+// send sends req through the pool once, or with the retries of WithRetry.
+func (t *Transport) send(req *http.Request) (*http.Response, error) {
+	if t.Gateway.retrier != nil && replayable(req) {
+		return t.retry(req)
+	}
+	resp, _, err := t.hedgedRoundTrip(req, nil)
+	return resp, err
+}
+
+// rangeRequest returns a copy of req for size bytes from start. With etag,
+// the site answers the whole body instead if it changed since.
+func rangeRequest(req *http.Request, start, size int64, etag string, identity bool) *http.Request {
+	out := req.Clone(req.Context())
+	out.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+size-1))
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		out.Header.Set("If-Range", etag)
+	}
+	if identity {
+		out.Header.Set("Accept-Encoding", "identity")
+	}
+	return out
+}
+
+// parseContentRange parses a Content-Range header of the form
+// "bytes start-end/total".
+func parseContentRange(header string) (start, end, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	span, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	first, last, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	var err1, err2, err3 error
+	start, err1 = strconv.ParseInt(first, 10, 64)
+	end, err2 = strconv.ParseInt(last, 10, 64)
+	total, err3 = strconv.ParseInt(size, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start > end || end >= total {
+		return 0, 0, 0, false
+	}
+	return start, end, total, true
+}
+
+// rangedBody reads the body of a ranged download, fetching the next range
+// through the pool when the current one is read.
+type rangedBody struct {
+	t       *Transport
+	req     *http.Request
+	etag    string
+	current io.ReadCloser
+	next    int64
+	total   int64
+}
+
+func (b *rangedBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.current.Read(p)
+		if err != io.EOF || b.next >= b.total {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		if err := b.fetch(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// fetch replaces the current range, read to the end, with the next one.
+func (b *rangedBody) fetch() error {
+	b.current.Close()
+	b.current = http.NoBody
+	identity := b.req.Header.Get("Accept-Encoding") == ""
+	resp, err := b.t.send(rangeRequest(b.req, b.next, min(rangeChunkSize, b.total-b.next), b.etag, identity))
+	if err != nil {
+		return fmt.Errorf("cannot download range from %d: %w", b.next, err)
+	}
+	start, end, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if resp.StatusCode != http.StatusPartialContent || !ok || start != b.next || total != b.total {
+		resp.Body.Close()
+		return fmt.Errorf("cannot download range from %d: the site answered %s, the body changed or ranges are not supported", b.next, resp.Status)
+	}
+	b.current = resp.Body
+	b.next = end + 1
+	return nil
+}
+
+func (b *rangedBody) Close() error {
+	return b.current.Close()
+}
@@ -0,0 +1,187 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// HostPolicy restricts the destinations of a pool. Patterns are exact host
+// names ("example.com"), wildcards matching every subdomain ("*.example.com"),
+// IP addresses or CIDR blocks ("10.0.0.0/8"). Host names are resolved to be
+// matched against addresses and blocks.
+type HostPolicy struct {
+	// Allow lists the destinations allowed. Every destination not denied is
+	// allowed when it is empty.
+	Allow []string
+	// Deny lists the destinations refused, even when they are allowed.
+	Deny []string
+}
+
+// WithHostPolicy refuses to create gateways for a site, or to send requests
+// to a host, that policy does not allow. The patterns of policy are added to
+// those of the config file. Requests are only sent for the host of the site,
+// whatever the allow list, except by the pools of a Manager, which picks them
+// by host.
+func WithHostPolicy(policy HostPolicy) Option {
+	return func(ag *ApiGateway) {
+		ag.hostPolicy = ag.hostPolicy.With(policy)
+	}
+}
+
+// With returns the policy with the patterns of both p and other.
+func (p HostPolicy) With(other HostPolicy) HostPolicy {
+	return HostPolicy{
+		Allow: append(slices.Clip(p.Allow), other.Allow...),
+		Deny:  append(slices.Clip(p.Deny), other.Deny...),
+	}
+}
+
+// Validate reports the first pattern of p that cannot be parsed.
+func (p HostPolicy) Validate() error {
+	for _, pattern := range slices.Concat(p.Allow, p.Deny) {
+		if strings.Contains(pattern, "/") {
+			if _, err := netip.ParsePrefix(pattern); err != nil {
+				return fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+			}
+			continue
+		}
+		if pattern == "" || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+			return fmt.Errorf("invalid host pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Check returns ErrHostNotAllowed when host, with or without a port, is
+// denied or not allowed by p. Host names are only resolved when an address
+// or block could decide.
+func (p HostPolicy) Check(ctx context.Context, host string) error {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return nil
+	}
+	name := strings.ToLower(hostname(host))
+
+	if matchName(p.Deny, name) {
+		return fmt.Errorf("%w: %s is denied", ErrHostNotAllowed, host)
+	}
+	allowedByName := len(p.Allow) == 0 || matchName(p.Allow, name)
+	deny, allow := prefixes(p.Deny), prefixes(p.Allow)
+	if len(deny) == 0 && (allowedByName || len(allow) == 0) {
+		if !allowedByName {
+			return fmt.Errorf("%w: %s is not allowed", ErrHostNotAllowed, host)
+		}
+		return nil
+	}
+
+	addrs, err := addresses(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrHostNotAllowed, host, err)
+	}
+	for _, addr := range addrs {
+		if containsAddr(deny, addr) {
+			return fmt.Errorf("%w: %s is denied", ErrHostNotAllowed, host)
+		}
+	}
+	if allowedByName {
+		return nil
+	}
+	// every address must be allowed, or the name could be allowed by one
+	// and reach another
+	for _, addr := range addrs {
+		if !containsAddr(allow, addr) {
+			return fmt.Errorf("%w: %s is not allowed", ErrHostNotAllowed, host)
+		}
+	}
+	return nil
+}
+
+// matchName reports whether name is one of the host names of patterns or a
+// subdomain of one of their wildcards.
+func matchName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(name, "."+suffix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixes returns the addresses and blocks of patterns.
+func prefixes(patterns []string) []netip.Prefix {
+	var blocks []netip.Prefix
+	for _, pattern := range patterns {
+		if prefix, err := netip.ParsePrefix(pattern); err == nil {
+			blocks = append(blocks, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(pattern); err == nil {
+			addr = addr.Unmap()
+			blocks = append(blocks, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return blocks
+}
+
+func containsAddr(blocks []netip.Prefix, addr netip.Addr) bool {
+	return slices.ContainsFunc(blocks, func(b netip.Prefix) bool { return b.Contains(addr) })
+}
+
+// addresses returns name if it is an address, or the addresses it resolves to.
+func addresses(ctx context.Context, name string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(name); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+	resolved, err := net.DefaultResolver.LookupNetIP(ctx, "ip", name)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range resolved {
+		resolved[i] = addr.Unmap()
+	}
+	return resolved, nil
+}
+
+// checkHost refuses requests for host when the policy of ag does not allow
+// it and, with siteOnly, when host is not the host of the site: the gateways
+// send every request to the site, whatever its host.
+func (ag *ApiGateway) checkHost(ctx context.Context, host string, siteOnly bool) error {
+	if err := ag.hostPolicy.Check(ctx, host); err != nil {
+		return err
+	}
+	site := ag.CurrentSite()
+	if !siteOnly || site == "" {
+		return nil
+	}
+	siteName, err := siteHost(site)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(hostname(host), hostname(siteName)) {
+		return fmt.Errorf("%w: %s is not the host of the site %s", ErrHostNotAllowed, host, site)
+	}
+	return nil
+}
+
+// hostname returns host without its port and brackets.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// checkSite refuses sites whose host the policy of ag does not allow.
+func (ag *ApiGateway) checkSite(ctx context.Context, site string) error {
+	host, err := siteHost(site)
+	if err != nil {
+		return err
+	}
+	return ag.hostPolicy.Check(ctx, host)
+}
@@ -0,0 +1,36 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	ag, err := NewApiGateway("https://example.com", "rotator-test",
+		WithHostPolicy(HostPolicy{Allow: []string{"example.com", "example.org"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host     string
+		siteOnly bool
+		allowed  bool
+	}{
+		{host: "example.com", siteOnly: true, allowed: true},
+		{host: "EXAMPLE.com:443", siteOnly: true, allowed: true},
+		// allowed, but the gateways would send it to the site
+		{host: "example.org", siteOnly: true, allowed: false},
+		{host: "example.org", siteOnly: false, allowed: true},
+		{host: "example.net", siteOnly: false, allowed: false},
+	}
+	for _, tt := range tests {
+		err := ag.checkHost(context.Background(), tt.host, tt.siteOnly)
+		if tt.allowed && err != nil {
+			t.Errorf("checkHost(%q, %v) = %v, want it allowed", tt.host, tt.siteOnly, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("checkHost(%q, %v) = %v, want ErrHostNotAllowed", tt.host, tt.siteOnly, err)
+		}
+	}
+}
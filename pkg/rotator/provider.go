@@ -0,0 +1,236 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Provider creates and removes proxy endpoints on one platform. A provider is
+// bound to the site it proxies when it is constructed, so several providers
+// for the same site can feed a single pool.
+type Provider interface {
+	// Name identifies the provider in deployments and state files.
+	Name() string
+	// CreateEndpoint creates a new endpoint in region.
+	CreateEndpoint(ctx context.Context, region string) (Deployment, error)
+	// ListEndpoints returns the endpoints this provider created in region.
+	ListEndpoints(ctx context.Context, region string) ([]Deployment, error)
+	// DeleteEndpoint deletes the endpoint id in region.
+	DeleteEndpoint(ctx context.Context, region, id string) error
+}
+
+// Deployment describes an endpoint created by a Provider.
+type Deployment struct {
+	Provider string `json:"provider"`
+	Region   string `json:"region"`
+	ID       string `json:"id"`
+	// Host is the hostname requests are sent to.
+	Host string `json:"host"`
+	// BasePath is prepended to the path of every rerouted request, for
+	// example the stage of a REST API.
+	BasePath  string    `json:"base_path,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// APIKey is sent in APIKeyHeader of the requests, see WithAPIKey.
+	APIKey string `json:"api_key,omitempty"`
+	// IAMAuth requests are signed with SigV4, see WithIAMAuth.
+	IAMAuth bool `json:"iam_auth,omitempty"`
+}
+
+// WithProvider sets the provider used by Initialize, InitializeAll and Replace.
+// By default the pool creates API Gateway APIs of the configured backend.
+func WithProvider(p Provider) Option {
+	return func(ag *ApiGateway) {
+		ag.provider = p
+	}
+}
+
+// Provider returns the provider new endpoints are created with.
+func (ag *ApiGateway) Provider() Provider {
+	return ag.provider
+}
+
+// InitializeWith creates an endpoint in region with p, which does not have to
+// be the default provider of the pool, and adds it to the pool.
+func (ag *ApiGateway) InitializeWith(p Provider, region string, ctx context.Context) error {
+	d, err := ag.createWith(p, region, ctx)
+	if err != nil {
+		return err
+	}
+	ag.AddDeployment(d)
+	return nil
+}
+
+// AddDeployment adds an endpoint created earlier to the pool.
+func (ag *ApiGateway) AddDeployment(d Deployment) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.addDeployment(d)
+}
+
+// addDeployment must be called with ag.mu held.
+func (ag *ApiGateway) addDeployment(d Deployment) {
+	ag.Endpoints.Add(endpointOf(d))
+	if ag.deployments == nil {
+		ag.deployments = make(map[string]Deployment)
+	}
+	ag.deployments[d.Host] = d
+}
+
+// Deployments returns the endpoints of the pool whose provider is known.
+func (ag *ApiGateway) Deployments() []Deployment {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return ag.knownDeployments()
+}
+
+// knownDeployments must be called with ag.mu held.
+func (ag *ApiGateway) knownDeployments() []Deployment {
+	endpoints := ag.Endpoints.Snapshot()
+	deployments := make([]Deployment, 0, len(endpoints))
+	for _, e := range endpoints {
+		if d, ok := ag.deployments[e.Host]; ok {
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments
+}
+
+// deployment returns what is known about endpoint. Endpoints added to
+// ag.Endpoints directly are assumed to belong to the default provider.
+func (ag *ApiGateway) deployment(endpoint string) (Deployment, bool) {
+	ag.mu.RLock()
+	d, ok := ag.deployments[endpoint]
+	ag.mu.RUnlock()
+	if ok {
+		return d, true
+	}
+
+	id, region, ok := parseEndpoint(endpoint)
+	if !ok {
+		return Deployment{}, false
+	}
+	return Deployment{
+		Provider: ag.provider.Name(),
+		Region:   region,
+		ID:       id,
+		Host:     endpoint,
+		BasePath: ag.stagePath(),
+	}, true
+}
+
+// basePath returns the path prefix of endpoint.
+func (ag *ApiGateway) basePath(endpoint string) string {
+	if d, ok := ag.deployment(endpoint); ok {
+		return d.BasePath
+	}
+	return ag.stagePath()
+}
+
+// apiKey returns the API key requests through endpoint need, "" for none.
+func (ag *ApiGateway) apiKey(endpoint string) string {
+	d, _ := ag.deployment(endpoint)
+	return d.APIKey
+}
+
+// Discover lists the endpoints the default provider, or the providers of every
+// account of WithAccounts, created in every region of ag.Regions and adds them
+// to the pool.
+func (ag *ApiGateway) Discover(ctx context.Context) error {
+	if err := ag.ResolveAutoRegions(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range ag.creationProviders() {
+		errs = append(errs, ag.DiscoverWith(p, ctx, ag.Regions...))
+	}
+	return errors.Join(errs...)
+}
+
+// DiscoverWith lists the endpoints p created in regions and adds them to the
+// pool, so they can be replaced with p later.
+func (ag *ApiGateway) DiscoverWith(p Provider, ctx context.Context, regions ...string) error {
+	ag.register(p)
+
+	var errs []error
+	for _, region := range regions {
+		deployments, err := p.ListEndpoints(ctx, region)
+		if err != nil {
+			errs = append(errs, &RegionError{Region: region, Err: err})
+			continue
+		}
+		ag.mu.Lock()
+		for _, d := range deployments {
+			ag.addDeployment(d)
+		}
+		ag.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// register makes p known to the pool so endpoints it created can be deleted
+// and replaced later.
+func (ag *ApiGateway) register(p Provider) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.providers == nil {
+		ag.providers = make(map[string]Provider)
+	}
+	ag.providers[p.Name()] = p
+}
+
+// providerFor returns the provider that created d.
+func (ag *ApiGateway) providerFor(d Deployment) (Provider, error) {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	if p, ok := ag.providers[d.Provider]; ok {
+		return p, nil
+	}
+	if d.Provider == ag.provider.Name() {
+		return ag.provider, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q for endpoint %s", d.Provider, d.Host)
+}
+
+// DeleteDeployment deletes d with the provider that created it and removes it
+// from the pool.
+func (ag *ApiGateway) DeleteDeployment(ctx context.Context, d Deployment) error {
+	p, err := ag.providerFor(d)
+	if err != nil {
+		return err
+	}
+	ag.RemoveEndpoint(d.Host)
+	if err := p.DeleteEndpoint(ctx, d.Region, d.ID); err != nil {
+		return err
+	}
+	ag.logger.Info("gateway deleted", "region", d.Region, "id", d.ID, "provider", p.Name())
+	ag.emitDeployment(EventEndpointDeleted, d)
+	return nil
+}
+
+// createWith creates an endpoint in region with p.
+func (ag *ApiGateway) createWith(p Provider, region string, ctx context.Context) (Deployment, error) {
+	ag.register(p)
+	ag.logger.Info("creating gateway", "region", region, "name", ag.Name, "site", ag.CurrentSite(), "provider", p.Name())
+	d, err := p.CreateEndpoint(ctx, region)
+	if err != nil {
+		return Deployment{}, err
+	}
+	ag.logger.Info("gateway created", "region", region, "id", d.ID, "endpoint", d.Host, "provider", p.Name())
+	// a canceled wait leaves the deployment to the caller, which deletes it
+	if !ag.waitReady(ctx, d) && ctx.Err() == nil {
+		ag.logger.Warn("endpoint not ready, adding it anyway", "region", region, "endpoint", d.Host, "timeout", ag.readyTimeout)
+	}
+
+	ag.mu.Lock()
+	adopted := ag.adopted[d.Host]
+	if !adopted {
+		ag.session = append(ag.session, d)
+	}
+	ag.mu.Unlock()
+	if !adopted {
+		ag.emitDeployment(EventEndpointCreated, d)
+	}
+	return d, nil
+}
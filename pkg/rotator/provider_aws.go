@@ -0,0 +1,159 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+)
+
+// Names of the API Gateway providers.
+const (
+	ProviderREST = "aws-rest"
+	ProviderHTTP = "aws-http"
+)
+
+// RESTProvider returns a Provider creating REST APIs with the settings of ag.
+func (ag *ApiGateway) RESTProvider() Provider {
+	return restProvider{ag: ag, account: account{creds: ag.creds}}
+}
+
+// HTTPProvider returns a Provider creating HTTP APIs with the settings of ag.
+func (ag *ApiGateway) HTTPProvider() Provider {
+	return httpProvider{ag: ag, account: account{creds: ag.creds}}
+}
+
+type restProvider struct {
+	ag      *ApiGateway
+	account account
+}
+
+func (p restProvider) Name() string {
+	return providerName(ProviderREST, p.account)
+}
+
+func (p restProvider) CreateEndpoint(ctx context.Context, region string) (Deployment, error) {
+	d, err := p.ag.createRestGateway(p.account.creds, region, ctx)
+	d.Provider = p.Name()
+	return d, err
+}
+
+func (p restProvider) ListEndpoints(ctx context.Context, region string) ([]Deployment, error) {
+	apis, err := p.ag.getGateways(p.account.creds, region, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var deployments []Deployment
+	for _, api := range *apis {
+		if !p.ag.inPool(aws.ToString(api.Name), api.Tags) {
+			continue
+		}
+		d := restDeployment(region, *api.Id, restStage(api), aws.ToTime(api.CreatedDate))
+		d.Provider = p.Name()
+		d.IAMAuth = p.ag.iamAuth
+		useDomain(&d, restDomain(api))
+		if p.ag.apiKeys {
+			client, err := p.ag.newClient(ctx, p.account.creds, region)
+			if err != nil {
+				return nil, err
+			}
+			if d.APIKey, err = findAPIKey(ctx, client, *api.Id); err != nil {
+				return nil, err
+			}
+		}
+		deployments = append(deployments, d)
+	}
+	if p.ag.sharedApi != "" {
+		client, err := p.ag.newClient(ctx, p.account.creds, region)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := p.ag.sharedDeployments(ctx, client, region, *apis)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range shared {
+			d.Provider = p.Name()
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments, nil
+}
+
+// restDeployment describes the REST API id in region deployed to stage.
+func restDeployment(region, id, stage string, created time.Time) Deployment {
+	return Deployment{
+		Provider:  ProviderREST,
+		Region:    region,
+		ID:        id,
+		Host:      ExecuteAPIHost(id, region),
+		BasePath:  "/" + stage,
+		CreatedAt: created,
+	}
+}
+
+func (p restProvider) DeleteEndpoint(ctx context.Context, region, id string) error {
+	client, err := p.ag.newClient(ctx, p.account.creds, region)
+	if err != nil {
+		return err
+	}
+	if p.ag.sharedApi != "" {
+		if shared, _, err := p.ag.deleteSharedStage(ctx, client, id); shared || err != nil {
+			return err
+		}
+	}
+	if p.ag.domainZone != "" {
+		if err := p.ag.deleteCustomDomain(ctx, p.account.creds, region, id+"."+p.ag.domainZone); err != nil {
+			return err
+		}
+	}
+	if err := deleteAPIKey(ctx, client, id); err != nil {
+		return err
+	}
+	if _, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: &id}); err != nil {
+		return fmt.Errorf("cannot delete rest api %s: %w", id, classify(err))
+	}
+	return nil
+}
+
+func (p restProvider) RetargetEndpoint(ctx context.Context, region, id, site string) error {
+	return p.ag.retargetRestGateway(ctx, p.account.creds, region, id, site)
+}
+
+func (p restProvider) SetEndpointTarget(ctx context.Context, region, id, site string) error {
+	return p.ag.setRestTarget(ctx, p.account.creds, region, id, site)
+}
+
+type httpProvider struct {
+	ag      *ApiGateway
+	account account
+}
+
+func (p httpProvider) Name() string {
+	return providerName(ProviderHTTP, p.account)
+}
+
+func (p httpProvider) CreateEndpoint(ctx context.Context, region string) (Deployment, error) {
+	d, err := p.ag.createHttpGateway(p.account.creds, region, ctx)
+	d.Provider = p.Name()
+	return d, err
+}
+
+func (p httpProvider) ListEndpoints(ctx context.Context, region string) ([]Deployment, error) {
+	deployments, err := p.ag.listHttpGateways(p.account.creds, region, ctx)
+	for i := range deployments {
+		deployments[i].Provider = p.Name()
+	}
+	return deployments, err
+}
+
+func (p httpProvider) DeleteEndpoint(ctx context.Context, region, id string) error {
+	return p.ag.deleteHttpGateway(p.account.creds, region, id, ctx)
+}
+
+func (p httpProvider) RetargetEndpoint(ctx context.Context, region, id, site string) error {
+	return p.ag.retargetHttpGateway(ctx, p.account.creds, region, id, site)
+}
@@ -0,0 +1,205 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+)
+
+// DefaultRESTAPIQuota is the default number of regional REST APIs of an
+// account in a region, used when Service Quotas cannot be read.
+const DefaultRESTAPIQuota = 600
+
+// restAPIQuotaName is the name of the quota of regional REST APIs in Service
+// Quotas, for the service code apigateway.
+const restAPIQuotaName = "regional apis per region"
+
+// Quota is how many regional REST APIs an account can have in a region and
+// how many it has.
+type Quota struct {
+	// Account is the name of the account, empty for the default one.
+	Account string
+	Region  string
+	Limit   int
+	Usage   int
+}
+
+// Available returns the number of REST APIs that can still be created.
+func (q Quota) Available() int {
+	return max(q.Limit-q.Usage, 0)
+}
+
+// WithQuotaCheck makes InitializeAll check the REST API quota of every region
+// before creating anything, and fail with ErrQuotaExceeded instead of running
+// into the quota halfway through. With spill, a region without room is
+// replaced by another region of RegionSets["all"] that has some.
+func WithQuotaCheck(spill bool) Option {
+	return func(ag *ApiGateway) {
+		ag.quotaCheck = true
+		ag.quotaSpill = spill
+	}
+}
+
+// Quotas returns the REST API quota of region in every account of the pool.
+func (ag *ApiGateway) Quotas(region string, ctx context.Context) ([]Quota, error) {
+	var quotas []Quota
+	for _, a := range ag.awsAccounts() {
+		q, err := ag.restQuota(ctx, a, region)
+		if err != nil {
+			return quotas, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// restQuota returns the REST API quota of a in region. The default quota is
+// assumed when Service Quotas cannot be read, the usage must be listed.
+func (ag *ApiGateway) restQuota(ctx context.Context, a account, region string) (Quota, error) {
+	q := Quota{Account: a.name, Region: region, Limit: DefaultRESTAPIQuota}
+
+	client, err := ag.newClient(ctx, a.creds, region)
+	if err != nil {
+		return q, err
+	}
+	apis, err := listRestApis(ctx, client, region, ListOptions{Filters: []GatewayFilter{regionalGateways}})
+	if err != nil {
+		return q, err
+	}
+	q.Usage = len(apis)
+
+	// the fake clients of WithRestClients have no quota
+	if ag.restClients != nil {
+		return q, nil
+	}
+	limit, err := ag.restQuotaLimit(ctx, a.creds, region)
+	if err != nil {
+		ag.logger.Debug("cannot read REST API quota, assuming the default", "region", region, "account", a.name, "error", err)
+		return q, nil
+	}
+	q.Limit = limit
+	return q, nil
+}
+
+// restQuotaLimit reads the REST API quota of region from Service Quotas.
+func (ag *ApiGateway) restQuotaLimit(ctx context.Context, creds *credentialSet, region string) (int, error) {
+	cfg, err := ag.awsConfig(ctx, creds, region)
+	if err != nil {
+		return 0, err
+	}
+	paginator := servicequotas.NewListServiceQuotasPaginator(servicequotas.NewFromConfig(cfg), &servicequotas.ListServiceQuotasInput{
+		ServiceCode: aws.String("apigateway"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("cannot list service quotas: %w", classify(err))
+		}
+		for _, quota := range page.Quotas {
+			if strings.EqualFold(aws.ToString(quota.QuotaName), restAPIQuotaName) && quota.Value != nil {
+				return int(*quota.Value), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no %q quota", restAPIQuotaName)
+}
+
+// regionalGateways selects the regional REST APIs, which the quota counts.
+func regionalGateways(api types.RestApi) bool {
+	return api.EndpointConfiguration == nil || slices.Contains(api.EndpointConfiguration.Types, types.EndpointTypeRegional)
+}
+
+// checkQuotas returns the regions to create REST APIs in with providers so
+// that no quota is exceeded: regions, or with spilling, regions where those
+// without room are replaced. Providers that do not create REST APIs are not
+// checked.
+func (ag *ApiGateway) checkQuotas(ctx context.Context, providers []Provider, regions []string) ([]string, error) {
+	var accounts []account
+	for _, p := range providers {
+		if rp, ok := p.(restProvider); ok {
+			accounts = append(accounts, rp.account)
+		}
+	}
+	if len(accounts) == 0 {
+		return regions, nil
+	}
+
+	// room reports whether every account can create the APIs of one more
+	// region in region
+	room := func(region string) (bool, error) {
+		for _, a := range accounts {
+			q, err := ag.restQuota(ctx, a, region)
+			if err != nil {
+				return false, &RegionError{Region: region, Err: err}
+			}
+			if q.Available() < ag.endpointsPerRegion() {
+				ag.logger.Warn("REST API quota reached", "region", region, "account", a.name, "limit", q.Limit, "usage", q.Usage)
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	var spare []string
+	if ag.quotaSpill {
+		// never spill to a region the pool already has an endpoint in
+		used := make(map[string]bool)
+		for _, d := range ag.Deployments() {
+			used[d.Region] = true
+		}
+		all, _ := ResolveRegions([]string{"all"}, nil)
+		for _, region := range all {
+			if !used[region] && !slices.Contains(regions, region) && !ag.excluded[region] {
+				spare = append(spare, region)
+			}
+		}
+	}
+
+	checked := make([]string, 0, len(regions))
+	for _, region := range regions {
+		ok, err := room(region)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			checked = append(checked, region)
+			continue
+		}
+		if !ag.quotaSpill {
+			return nil, &RegionError{Region: region, Err: fmt.Errorf("%w: no room for another REST API", ErrQuotaExceeded)}
+		}
+
+		// try the regions of the same area first, us-east-2 for us-east-1
+		area, _, _ := strings.Cut(region, "-")
+		slices.SortStableFunc(spare, func(a, b string) int {
+			return btoi(!strings.HasPrefix(a, area+"-")) - btoi(!strings.HasPrefix(b, area+"-"))
+		})
+		spilled := ""
+		for len(spare) > 0 && spilled == "" {
+			candidate := spare[0]
+			spare = spare[1:]
+			// regions that are not enabled cannot be listed, skip them
+			if ok, err := room(candidate); err == nil && ok {
+				spilled = candidate
+			}
+		}
+		if spilled == "" {
+			return nil, &RegionError{Region: region, Err: fmt.Errorf("%w: no room for another REST API here or in another region", ErrQuotaExceeded)}
+		}
+		ag.logger.Info("region full, spilling to another region", "region", region, "to", spilled)
+		checked = append(checked, spilled)
+	}
+	return checked, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy is what Transport does with requests over the client-side
+// rate limits of WithEndpointRateLimit and WithHostRateLimit.
+type RateLimitPolicy string
+
+const (
+	// RateLimitWait holds requests until the limits let them through, or
+	// their context is done. It is the default.
+	RateLimitWait RateLimitPolicy = "wait"
+
+	// RateLimitShed fails requests over the limits at once with
+	// ErrRateLimited.
+	RateLimitShed RateLimitPolicy = "shed"
+)
+
+// WithEndpointRateLimit bounds the requests per second sent through each
+// endpoint of the pool, burst at once, to stay under the throttling limits
+// of API Gateway: 10,000 requests per second for all the APIs of an account
+// and region. Requests go through the endpoints that are under their limit
+// first. A rate of 0 disables the limit.
+func WithEndpointRateLimit(rate float64, burst int) Option {
+	return func(ag *ApiGateway) {
+		ag.endpointLimit = newRateLimiter(rate, burst)
+	}
+}
+
+// WithHostRateLimit bounds the requests per second sent to each host of the
+// site, whatever the endpoint, burst at once, to be polite to the site. A
+// rate of 0 disables the limit.
+func WithHostRateLimit(rate float64, burst int) Option {
+	return func(ag *ApiGateway) {
+		ag.hostLimit = newRateLimiter(rate, burst)
+	}
+}
+
+// WithRateLimitPolicy sets what Transport does with requests over the rate
+// limits, see RateLimitPolicy.
+func WithRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(ag *ApiGateway) {
+		ag.limitPolicy = policy
+	}
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter returns a rateLimiter, nil if rate disables it.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *rateLimiter) bucket(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// under returns the keys that have a token left, or all of keys if none has.
+func (l *rateLimiter) under(keys []string) []string {
+	if l == nil {
+		return keys
+	}
+	var free []string
+	for _, key := range keys {
+		if l.bucket(key).ready() {
+			free = append(free, key)
+		}
+	}
+	if len(free) == 0 {
+		return keys
+	}
+	return free
+}
+
+// limit takes a token of the bucket of key for a request, waiting for it or
+// failing with ErrRateLimited, as policy says.
+func (l *rateLimiter) limit(ctx context.Context, key string, policy RateLimitPolicy) error {
+	if l == nil {
+		return nil
+	}
+	b := l.bucket(key)
+	if policy == RateLimitShed {
+		if !b.take() {
+			return fmt.Errorf("%w: %s over %g requests per second", ErrRateLimited, key, l.rate)
+		}
+		return nil
+	}
+	return b.wait(ctx)
+}
+
+// refill adds the tokens earned since the last call. b.mu must be held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// ready reports whether a token is available without taking it.
+func (b *tokenBucket) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= 1
+}
+
+// take takes a token if one is available.
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
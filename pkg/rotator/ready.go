@@ -0,0 +1,87 @@
+package rotator
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DefaultReadyTimeout is how long a new endpoint is waited for before it is
+// added to the pool, see WithReadyTimeout.
+const DefaultReadyTimeout = time.Minute
+
+const (
+	// readyFirstDelay is the delay between the first two readiness probes,
+	// doubled after every failed probe up to readyMaxDelay.
+	readyFirstDelay = 500 * time.Millisecond
+	readyMaxDelay   = 5 * time.Second
+)
+
+// WithReadyTimeout sets how long a new endpoint is probed through its stage
+// until it answers before being added to the pool. A new REST API answers 403
+// Forbidden for a few seconds after its deployment, which would fail the
+// first requests sent through it. An endpoint still not ready after timeout is
+// added anyway. A timeout of 0 adds new endpoints right away.
+func WithReadyTimeout(timeout time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.readyTimeout = timeout
+	}
+}
+
+// waitReady probes the new deployment d with a backoff until it answers, ctx
+// is done or the ready timeout expires, and reports whether it answered.
+func (ag *ApiGateway) waitReady(ctx context.Context, d Deployment) bool {
+	// neither made up nor fake endpoints can answer
+	if ag.readyTimeout <= 0 || ag.dryRun || ag.restClients != nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, ag.readyTimeout)
+	defer cancel()
+
+	start := time.Now()
+	delay := readyFirstDelay
+	for attempt := 1; ; attempt++ {
+		if ag.probeEndpoint(ctx, &http.Client{Transport: ag.conns}, d, d.BasePath, DefaultHealthTimeout) {
+			ag.logger.Debug("endpoint ready", "region", d.Region, "endpoint", d.Host, "attempts", attempt, "after", time.Since(start))
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, readyMaxDelay)
+	}
+}
+
+// probeEndpoint sends a HEAD request to the base path of the endpoint d, with
+// its API key and signature if it needs them, and reports whether it serves
+// requests. Errors raised by API Gateway itself carry an x-amzn-ErrorType
+// header, which tells a broken or not yet propagated deployment apart from a
+// target that merely refuses the request.
+func (ag *ApiGateway) probeEndpoint(ctx context.Context, client *http.Client, d Deployment, basePath string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://"+d.Host+basePath+"/", nil)
+	if err != nil {
+		return false
+	}
+	if d.APIKey != "" {
+		req.Header.Set(APIKeyHeader, d.APIKey)
+	}
+	if err := ag.sign(req, d); err != nil {
+		ag.logger.Debug("cannot sign probe", "endpoint", d.Host, "error", err)
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("X-Amzn-Errortype") != "" {
+		return false
+	}
+	return resp.StatusCode < http.StatusInternalServerError
+}
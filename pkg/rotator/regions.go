@@ -0,0 +1,225 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// RegionsEnv names the environment variable holding the default regions of
+// NewApiGateway, as a comma separated list of regions and region sets.
+const RegionsEnv = "ROTATOR_REGIONS"
+
+// RegionsAuto is the region spec replaced by the regions enabled in the
+// account, see ResolveAutoRegions.
+const RegionsAuto = "auto"
+
+// RegionSets are named groups of regions that can be used wherever a region is
+// expected. "all" is every commercial region of the other sets.
+var RegionSets = map[string][]string{
+	"us":   {"us-east-1", "us-east-2", "us-west-1", "us-west-2"},
+	"ca":   {"ca-central-1", "ca-west-1"},
+	"sa":   {"sa-east-1"},
+	"eu":   {"eu-central-1", "eu-central-2", "eu-west-1", "eu-west-2", "eu-west-3", "eu-north-1", "eu-south-1", "eu-south-2"},
+	"apac": {"ap-east-1", "ap-south-1", "ap-south-2", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3", "ap-southeast-1", "ap-southeast-2", "ap-southeast-3", "ap-southeast-4", "ap-southeast-5"},
+	"me":   {"me-south-1", "me-central-1", "il-central-1"},
+	"af":   {"af-south-1"},
+
+	// other partitions, which need their own credentials and are not in "all"
+	"cn":  {"cn-north-1", "cn-northwest-1"},
+	"gov": {"us-gov-west-1", "us-gov-east-1"},
+}
+
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+
+// ResolveRegions expands the region sets of specs, which may also be comma
+// separated, and returns the regions without duplicates in the order they
+// first appear. Sets are looked up in extra before RegionSets.
+func ResolveRegions(specs []string, extra map[string][]string) ([]string, error) {
+	var regions []string
+	seen := make(map[string]bool)
+	add := func(region string) {
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+
+	for _, spec := range specs {
+		for _, name := range strings.Split(spec, ",") {
+			name = strings.TrimSpace(strings.ToLower(name))
+			switch {
+			case name == "":
+			case name == RegionsAuto:
+				add(RegionsAuto)
+			case extra[name] != nil:
+				for _, region := range extra[name] {
+					add(region)
+				}
+			case name == "all":
+				for _, region := range allRegions() {
+					add(region)
+				}
+			case RegionSets[name] != nil:
+				for _, region := range RegionSets[name] {
+					add(region)
+				}
+			case regionPattern.MatchString(name):
+				add(name)
+			default:
+				return nil, fmt.Errorf("unknown region or region set %q", name)
+			}
+		}
+	}
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("no regions in %q", strings.Join(specs, ","))
+	}
+	return regions, nil
+}
+
+// allRegions returns every commercial region of RegionSets, sorted.
+func allRegions() []string {
+	var regions []string
+	for _, set := range RegionSets {
+		for _, region := range set {
+			if Partition(region) == "aws" {
+				regions = append(regions, region)
+			}
+		}
+	}
+	slices.Sort(regions)
+	return slices.Compact(regions)
+}
+
+// WithRegions sets the regions of the pool. Region sets are expanded.
+func WithRegions(specs ...string) Option {
+	return func(ag *ApiGateway) {
+		ag.regionSpecs = specs
+	}
+}
+
+// WithExcludeRegions leaves regions and region sets out of the regions of the
+// pool, however these are given, and out of those quota spill-over uses.
+func WithExcludeRegions(specs ...string) Option {
+	return func(ag *ApiGateway) {
+		ag.excludeSpecs = specs
+	}
+}
+
+// WithEndpointsPerRegion makes the pool create count gateways in every region
+// instead of one, each an API of its own: 3 per region in 10 regions for a
+// pool of 30 endpoints. Every gateway of a region counts against its quota of
+// REST APIs.
+func WithEndpointsPerRegion(count int) Option {
+	return func(ag *ApiGateway) {
+		ag.perRegion = count
+	}
+}
+
+// endpointsPerRegion returns the number of gateways the pool has in every
+// region.
+func (ag *ApiGateway) endpointsPerRegion() int {
+	return max(ag.perRegion, 1)
+}
+
+// withoutExcluded returns regions without those of WithExcludeRegions.
+func (ag *ApiGateway) withoutExcluded(regions []string) []string {
+	if len(ag.excluded) == 0 {
+		return regions
+	}
+	return slices.DeleteFunc(slices.Clone(regions), func(region string) bool { return ag.excluded[region] })
+}
+
+// resolveRegions sets ag.Regions from WithRegions, RegionsEnv, WithConfig or
+// DefaultRegions, in that order, without the regions of WithExcludeRegions.
+func (ag *ApiGateway) resolveRegions() error {
+	if len(ag.excludeSpecs) > 0 {
+		excluded, err := ResolveRegions(ag.excludeSpecs, ag.regionSets)
+		if err != nil {
+			return err
+		}
+		ag.excluded = make(map[string]bool, len(excluded))
+		for _, region := range excluded {
+			ag.excluded[region] = true
+		}
+	}
+	specs := ag.regionSpecs
+	if specs == nil {
+		if env := os.Getenv(RegionsEnv); env != "" {
+			specs = []string{env}
+		}
+	}
+	if specs == nil && len(ag.configRegions) > 0 {
+		specs = ag.configRegions
+	}
+	if specs == nil {
+		ag.Regions = ag.withoutExcluded(DefaultRegions)
+		return nil
+	}
+	regions, err := ResolveRegions(specs, ag.regionSets)
+	if err != nil {
+		return err
+	}
+	ag.Regions = ag.withoutExcluded(regions)
+	return nil
+}
+
+// ResolveAutoRegions replaces RegionsAuto in ag.Regions with the regions
+// enabled in the account, leaving out opt-in regions that were not activated.
+// It does nothing when ag.Regions does not contain RegionsAuto. With
+// WithGeoTarget, ag.Regions is then restricted to the regions nearest to the
+// site.
+func (ag *ApiGateway) ResolveAutoRegions(ctx context.Context) error {
+	i := slices.Index(ag.Regions, RegionsAuto)
+	if i < 0 {
+		return ag.resolveGeoRegions(ctx)
+	}
+	others := slices.Delete(slices.Clone(ag.Regions), i, i+1)
+
+	from := "us-east-1"
+	if len(others) > 0 {
+		from = others[0]
+	}
+	enabled, err := ag.EnabledRegions(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	regions, err := ResolveRegions(append(others, enabled...), nil)
+	if err != nil {
+		return err
+	}
+	regions = ag.withoutExcluded(regions)
+	ag.logger.Info("discovered enabled regions", "regions", regions)
+	ag.Regions = regions
+	return ag.resolveGeoRegions(ctx)
+}
+
+// EnabledRegions returns the regions enabled in the account, asking EC2 in
+// region from.
+func (ag *ApiGateway) EnabledRegions(ctx context.Context, from string) ([]string, error) {
+	cfg, err := ag.awsConfig(ctx, nil, from)
+	if err != nil {
+		return nil, err
+	}
+	output, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe regions: %w", classify(err))
+	}
+
+	var regions []string
+	for _, r := range output.Regions {
+		if aws.ToString(r.OptInStatus) == "not-opted-in" {
+			continue
+		}
+		regions = append(regions, aws.ToString(r.RegionName))
+	}
+	slices.Sort(regions)
+	return regions, nil
+}
@@ -0,0 +1,79 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDrainPeriod is how long Renew lets the requests in flight through the
+// old endpoints finish before deleting them: the longest API Gateway waits for
+// the site.
+const DefaultDrainPeriod = MaxIntegrationTimeout + time.Second
+
+// Renew replaces every endpoint of the pool with a fresh gateway, with a new
+// ID and hostname, at once. Where Replace swaps one endpoint for another,
+// Renew first creates the new set, in the regions and with the providers of
+// the old one, then takes the old endpoints out of rotation, waits drain for
+// the requests sent through them to finish and deletes them. If a new
+// endpoint cannot be created, the ones that were are deleted and the pool is
+// left as it was. It returns the new endpoint of every old one.
+func (ag *ApiGateway) Renew(ctx context.Context, drain time.Duration) (map[string]string, error) {
+	old := ag.Deployments()
+	if len(old) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	created := make([]Deployment, len(old))
+	errs := make([]error, len(old))
+	extra := context.WithValue(ctx, extraKey{}, true)
+	var wg sync.WaitGroup
+	for i, d := range old {
+		wg.Add(1)
+		go func(i int, d Deployment) {
+			defer wg.Done()
+			p, err := ag.providerFor(d)
+			if err == nil {
+				created[i], err = ag.createWith(p, d.Region, extra)
+			}
+			if err != nil {
+				errs[i] = &RegionError{Region: d.Region, Err: err}
+			}
+		}(i, d)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		for i, d := range created {
+			if errs[i] == nil {
+				err = errors.Join(err, ag.DeleteDeployment(context.WithoutCancel(ctx), d))
+			}
+		}
+		return nil, fmt.Errorf("cannot renew pool: %w", err)
+	}
+
+	renewed := make(map[string]string, len(old))
+	ag.mu.Lock()
+	for i, d := range created {
+		ag.addDeployment(d)
+		renewed[old[i].Host] = d.Host
+	}
+	ag.mu.Unlock()
+	for _, d := range old {
+		ag.RemoveEndpoint(d.Host)
+	}
+	ag.logger.Info("pool renewed, draining old endpoints", "endpoints", len(created), "drain", drain)
+
+	select {
+	case <-time.After(drain):
+	case <-ctx.Done():
+	}
+	var failed []error
+	for _, d := range old {
+		if err := ag.DeleteDeployment(context.WithoutCancel(ctx), d); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", d.Host, err))
+		}
+	}
+	return renewed, errors.Join(failed...)
+}
@@ -0,0 +1,134 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReplaceTimeout bounds how long an automatic replacement may take.
+const DefaultReplaceTimeout = 5 * time.Minute
+
+// WithAutoReplace retires an endpoint once the target answered threshold
+// requests in a row through it with 403 or 429, and replaces it with a fresh
+// gateway. Automatic replacement is disabled by default.
+func WithAutoReplace(threshold int) Option {
+	return func(ag *ApiGateway) {
+		ag.replacer = &replacer{threshold: threshold, blocked: make(map[string]int), busy: make(map[string]bool)}
+	}
+}
+
+// replacer counts consecutive blocked responses per endpoint.
+type replacer struct {
+	threshold int
+
+	mu      sync.Mutex
+	blocked map[string]int
+	busy    map[string]bool
+}
+
+// observe records the response of a request sent through endpoint and starts
+// a replacement in the background when the endpoint looks blocked. banned is
+// set when a BanDetector recognized the response as a ban.
+func (ag *ApiGateway) observe(endpoint string, resp *http.Response, banned bool) {
+	r := ag.replacer
+	if r == nil || resp == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if !banned && resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		delete(r.blocked, endpoint)
+		r.mu.Unlock()
+		return
+	}
+	r.blocked[endpoint]++
+	trigger := r.blocked[endpoint] >= r.threshold && !r.busy[endpoint]
+	if trigger {
+		r.busy[endpoint] = true
+	}
+	r.mu.Unlock()
+
+	if !trigger {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultReplaceTimeout)
+		defer cancel()
+
+		ag.logger.Warn("endpoint blocked, replacing", "endpoint", endpoint, "status", resp.StatusCode)
+		if _, err := ag.Replace(ctx, endpoint); err != nil {
+			ag.logger.Error("cannot replace endpoint", "endpoint", endpoint, "error", err)
+		}
+
+		r.mu.Lock()
+		delete(r.blocked, endpoint)
+		delete(r.busy, endpoint)
+		r.mu.Unlock()
+	}()
+}
+
+// Replace takes endpoint out of the pool, deletes it and creates a new endpoint
+// with the provider that created it, first in the same region and then, for
+// the default provider, in the other regions of ag.Regions. It returns the
+// endpoint that replaced it.
+func (ag *ApiGateway) Replace(ctx context.Context, endpoint string) (string, error) {
+	d, ok := ag.deployment(endpoint)
+	if !ok {
+		return "", fmt.Errorf("unknown endpoint %s", endpoint)
+	}
+	p, err := ag.providerFor(d)
+	if err != nil {
+		return "", err
+	}
+	if err := ag.DeleteDeployment(ctx, d); err != nil {
+		return "", err
+	}
+
+	regions := []string{d.Region}
+	if ag.isCreationProvider(p) {
+		for _, r := range ag.Regions {
+			if r != d.Region {
+				regions = append(regions, r)
+			}
+		}
+	}
+
+	var errs []error
+	for _, r := range regions {
+		replacement, err := ag.createWith(p, r, ctx)
+		if err != nil {
+			errs = append(errs, &RegionError{Region: r, Err: err})
+			continue
+		}
+		ag.AddDeployment(replacement)
+		ag.logger.Info("endpoint replaced", "old", endpoint, "new", replacement.Host)
+		return replacement.Host, nil
+	}
+	return "", fmt.Errorf("cannot create replacement for %s: %w", endpoint, errors.Join(errs...))
+}
+
+// RemoveEndpoint drops endpoint from the pool without deleting it.
+func (ag *ApiGateway) RemoveEndpoint(endpoint string) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	ag.Endpoints.Remove(endpoint)
+	delete(ag.unhealthy, endpoint)
+	delete(ag.deployments, endpoint)
+	if ag.breaker != nil {
+		ag.breaker.remove(endpoint)
+	}
+}
+
+// parseEndpoint splits an "<id>.execute-api.<region>.<dns suffix>" hostname.
+func parseEndpoint(endpoint string) (id, region string, ok bool) {
+	parts := strings.SplitN(endpoint, ".", 4)
+	if len(parts) < 4 || parts[1] != "execute-api" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
@@ -0,0 +1,289 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	v2types "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+// Retargeter is implemented by providers that can point an existing endpoint
+// at another site without recreating it.
+type Retargeter interface {
+	RetargetEndpoint(ctx context.Context, region, id, site string) error
+}
+
+// EndpointError reports a failure that happened while working on a single
+// endpoint.
+type EndpointError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Endpoint, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// Retarget points every endpoint of the pool at site, working on at most
+// ag.Concurrency endpoints at a time. ag.Site only changes when every endpoint
+// was updated; failures are returned as a joined error of *EndpointError and
+// Retarget can be called again to finish the job.
+func (ag *ApiGateway) Retarget(ctx context.Context, site string) error {
+	site, err := normalizeSite(site)
+	if err != nil {
+		return err
+	}
+	if site == "" {
+		return fmt.Errorf("%w: no site to retarget to", ErrInvalidSite)
+	}
+	return ag.retargetAll(ctx, site, ag.retarget)
+}
+
+// retargetAll points every endpoint of the pool at site with retarget and
+// sets ag.Site once they all were.
+func (ag *ApiGateway) retargetAll(ctx context.Context, site string, retarget func(ctx context.Context, d Deployment, site string) error) error {
+	if err := ag.checkSite(ctx, site); err != nil {
+		return err
+	}
+
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	// endpoints created during the fan-out may still proxy to the previous
+	// site, they are retargeted too before the site changes
+	var from string
+	done := make(map[string]bool)
+	pending := ag.Deployments()
+	for {
+		if err := retargetEach(ctx, pending, site, workers, retarget); err != nil {
+			return err
+		}
+		for _, d := range pending {
+			done[d.Host] = true
+		}
+		ag.mu.Lock()
+		pending = nil
+		for _, d := range ag.knownDeployments() {
+			if !done[d.Host] {
+				pending = append(pending, d)
+			}
+		}
+		if len(pending) == 0 {
+			from = ag.Site
+			ag.Site = site
+		}
+		ag.mu.Unlock()
+		if len(pending) == 0 {
+			break
+		}
+	}
+	ag.logger.Info("pool retargeted", "from", from, "to", site, "endpoints", len(done))
+	return nil
+}
+
+// retargetEach points deployments at site with retarget, workers at a time.
+func retargetEach(ctx context.Context, deployments []Deployment, site string, workers int, retarget func(ctx context.Context, d Deployment, site string) error) error {
+	errs := make([]error, len(deployments))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := retarget(ctx, deployments[i], site); err != nil {
+					errs[i] = &EndpointError{Endpoint: deployments[i].Host, Err: err}
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range deployments {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for ; i < len(deployments); i++ {
+				errs[i] = &EndpointError{Endpoint: deployments[i].Host, Err: ctx.Err()}
+			}
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// CurrentSite returns the site the pool proxies. Unlike ag.Site, it can be read
+// while Retarget or SetTarget change the site of a pool in use.
+func (ag *ApiGateway) CurrentSite() string {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return ag.Site
+}
+
+// retarget points d at site with the provider that created it.
+func (ag *ApiGateway) retarget(ctx context.Context, d Deployment, site string) error {
+	p, err := ag.providerFor(d)
+	if err != nil {
+		return err
+	}
+	r, ok := p.(Retargeter)
+	if !ok {
+		return fmt.Errorf("provider %s cannot retarget endpoints", p.Name())
+	}
+	if err := r.RetargetEndpoint(ctx, d.Region, d.ID, site); err != nil {
+		return err
+	}
+	ag.logger.Info("gateway retargeted", "region", d.Region, "id", d.ID, "site", site)
+	return nil
+}
+
+// siteTags returns the tags recording the site of an API.
+func siteTags(site string) map[string]string {
+	tags := map[string]string{}
+	if u, err := url.Parse(site); err == nil && u.Host != "" {
+		tags[TagSite] = u.Host
+	}
+	return tags
+}
+
+// retargetRestGateway updates the root and wildcard integrations of REST API
+// id to take site from targetVariable, and redeploys its stages with site as
+// the variable.
+func (ag *ApiGateway) retargetRestGateway(ctx context.Context, creds *credentialSet, region, id, site string) error {
+	if ag.sharedApi != "" && !strings.HasPrefix(site, "https://") {
+		return fmt.Errorf("%w: shared REST APIs only proxy to https sites", ErrInvalidSite)
+	}
+	client, err := ag.newClient(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+
+	resources, err := restResources(ctx, client, id)
+	if err != nil {
+		return err
+	}
+	root, wildcard, variables := targetURIs(site)
+	uris := map[string]string{"/": root, "/{proxy+}": wildcard}
+	updated := 0
+	for _, r := range resources {
+		uri, ok := uris[aws.ToString(r.Path)]
+		if !ok {
+			continue
+		}
+		_, err := client.UpdateIntegration(ctx, &apigateway.UpdateIntegrationInput{
+			RestApiId:  &id,
+			ResourceId: r.Id,
+			HttpMethod: aws.String("ANY"),
+			PatchOperations: []types.PatchOperation{
+				{Op: types.OpReplace, Path: aws.String("/uri"), Value: &uri},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot update integration of %s: %w", aws.ToString(r.Path), classify(err))
+		}
+		updated++
+	}
+	if updated != len(uris) {
+		return fmt.Errorf("api %s is missing its proxy resources", id)
+	}
+
+	stages, err := client.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: &id})
+	if err != nil {
+		return fmt.Errorf("cannot get stages of api %s: %w", id, classify(err))
+	}
+	shared := false
+	for _, stage := range stages.Item {
+		if ag.otherPool(stage) {
+			continue
+		}
+		if _, ok := stage.Variables[poolVariable]; ok {
+			shared = true
+			variables = ag.sharedVariables(site)
+		}
+		_, err = client.CreateDeployment(ctx, &apigateway.CreateDeploymentInput{
+			RestApiId: &id,
+			StageName: stage.StageName,
+			Variables: variables,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot create deployment: %w", classify(err))
+		}
+	}
+	// the site of a shared API is that of each stage
+	if shared {
+		return nil
+	}
+
+	_, err = client.TagResource(ctx, &apigateway.TagResourceInput{
+		ResourceArn: aws.String(apiARN(region, "/restapis/"+id)),
+		Tags:        siteTags(site),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot tag api %s: %w", id, classify(err))
+	}
+	return nil
+}
+
+// retargetHttpGateway updates the proxy integrations of HTTP API id. The
+// $default stage deploys the change by itself.
+func (ag *ApiGateway) retargetHttpGateway(ctx context.Context, creds *credentialSet, region, id, site string) error {
+	client, err := ag.newV2Client(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSite, err)
+	}
+
+	integrations, err := client.GetIntegrations(ctx, &apigatewayv2.GetIntegrationsInput{ApiId: &id})
+	if err != nil {
+		return fmt.Errorf("cannot get integrations of api %s: %w", id, classify(err))
+	}
+	updated := 0
+	for _, integration := range integrations.Items {
+		if integration.IntegrationType != v2types.IntegrationTypeHttpProxy || !strings.HasPrefix(aws.ToString(integration.IntegrationUri), "http") {
+			continue
+		}
+		_, err := client.UpdateIntegration(ctx, &apigatewayv2.UpdateIntegrationInput{
+			ApiId:          &id,
+			IntegrationId:  integration.IntegrationId,
+			IntegrationUri: &site,
+			RequestParameters: map[string]string{
+				"overwrite:path": u.Path + "$request.path",
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot update integration of api %s: %w", id, classify(err))
+		}
+		updated++
+	}
+	if updated == 0 {
+		return fmt.Errorf("api %s has no proxy integration", id)
+	}
+
+	_, err = client.TagResource(ctx, &apigatewayv2.TagResourceInput{
+		ResourceArn: aws.String(apiARN(region, "/apis/"+id)),
+		Tags:        siteTags(site),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot tag api %s: %w", id, classify(err))
+	}
+	return nil
+}
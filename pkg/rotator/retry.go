@@ -0,0 +1,208 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRetryBudget is in a RetryError when a request was not retried because
+// the retry budget of the policy was spent.
+var ErrRetryBudget = errors.New("retry budget exhausted")
+
+// RetryPolicy makes Transport send a request again through another endpoint
+// when the target or the gateway answers with one of StatusCodes, or when the
+// endpoint cannot be reached.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, the first one
+	// included.
+	MaxAttempts int
+	// StatusCodes are the responses worth trying another endpoint for.
+	StatusCodes []int
+	// BaseDelay is the wait before the first retry, doubled for every retry
+	// after it up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BudgetRatio bounds retries to this fraction of the requests sent, so
+	// that a target refusing everything does not multiply the traffic.
+	// Up to BudgetBurst retries can be made before any request earned them.
+	BudgetRatio float64
+	BudgetBurst float64
+}
+
+// DefaultRetryPolicy retries throttled, refused and failed requests twice.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	StatusCodes: []int{
+		http.StatusForbidden,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	BudgetRatio: 0.2,
+	BudgetBurst: 10,
+}
+
+// WithRetry makes Transport retry requests as described by policy. Requests
+// are not retried by default.
+func WithRetry(policy RetryPolicy) Option {
+	return func(ag *ApiGateway) {
+		ag.retrier = &retrier{policy: policy, tokens: policy.BudgetBurst}
+	}
+}
+
+// Attempt is one round trip of a retried request.
+type Attempt struct {
+	Endpoint   string
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// RetryError is returned by Transport when every attempt of a request failed.
+type RetryError struct {
+	Attempts []Attempt
+	// Err is why no more attempts were made, when it was not the last failure.
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "request failed after %d attempts", len(e.Attempts))
+	if e.Err != nil {
+		fmt.Fprintf(&b, " (%v)", e.Err)
+	}
+	for _, a := range e.Attempts {
+		if a.Err != nil {
+			fmt.Fprintf(&b, "; %s: %v", a.Endpoint, a.Err)
+		} else {
+			fmt.Fprintf(&b, "; %s: %d %s", a.Endpoint, a.StatusCode, http.StatusText(a.StatusCode))
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns why the retries stopped and the error of the last attempt.
+func (e *RetryError) Unwrap() []error {
+	errs := []error{e.Err}
+	if len(e.Attempts) > 0 {
+		errs = append(errs, e.Attempts[len(e.Attempts)-1].Err)
+	}
+	return slices.DeleteFunc(errs, func(err error) bool { return err == nil })
+}
+
+// retrier applies a RetryPolicy and keeps its retry budget.
+type retrier struct {
+	policy RetryPolicy
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// deposit earns the budget of one request.
+func (r *retrier) deposit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+r.policy.BudgetRatio, max(r.policy.BudgetBurst, 1))
+}
+
+// withdraw spends the budget of one retry, if there is any left.
+func (r *retrier) withdraw() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+func (r *retrier) retryable(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrGatewayTimeout) {
+		return slices.Contains(r.policy.StatusCodes, http.StatusGatewayTimeout)
+	}
+	if err != nil {
+		return true
+	}
+	return slices.Contains(r.policy.StatusCodes, resp.StatusCode)
+}
+
+// delay is the wait before retry n, starting at 1.
+func (r *retrier) delay(n int) time.Duration {
+	d := r.policy.BaseDelay << (n - 1)
+	if r.policy.MaxDelay > 0 && (d > r.policy.MaxDelay || d <= 0) {
+		d = r.policy.MaxDelay
+	}
+	return d
+}
+
+// replayable reports whether req can be sent again: its body is empty or
+// can be read again with GetBody.
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retry sends req through a different endpoint until it succeeds, the policy
+// gives up or the request context is done.
+func (t *Transport) retry(req *http.Request) (*http.Response, error) {
+	r := t.Gateway.retrier
+	r.deposit()
+
+	var attempts []Attempt
+	tried := make(map[string]bool)
+	for n := 1; ; n++ {
+		out := req
+		if n > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, &RetryError{Attempts: attempts, Err: err}
+			}
+			out = req.Clone(req.Context())
+			out.Body = body
+		}
+
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.Int("rotator.attempts", n))
+		start := time.Now()
+		resp, endpoint, err := t.hedgedRoundTrip(out, tried)
+		// another endpoint would time out on a long-running request too
+		if endpoint == "" || !r.retryable(resp, err) || (errors.Is(err, ErrGatewayTimeout) && longRunning(req)) {
+			return resp, err
+		}
+		tried[endpoint] = true
+		attempt := Attempt{Endpoint: endpoint, Err: err, Duration: time.Since(start)}
+		if resp != nil {
+			attempt.StatusCode = resp.StatusCode
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		attempts = append(attempts, attempt)
+
+		if n >= r.policy.MaxAttempts {
+			return nil, &RetryError{Attempts: attempts}
+		}
+		if !r.withdraw() {
+			return nil, &RetryError{Attempts: attempts, Err: ErrRetryBudget}
+		}
+		t.Gateway.logger.Debug("retrying request", "url", req.URL.String(), "endpoint", endpoint, "status", attempt.StatusCode, "error", err, "attempt", n)
+
+		timer := time.NewTimer(r.delay(n))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, &RetryError{Attempts: attempts, Err: req.Context().Err()}
+		case <-timer.C:
+		}
+	}
+}
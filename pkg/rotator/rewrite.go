@@ -0,0 +1,124 @@
+package rotator
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithResponseRewriting controls whether Transport maps the Location and
+// Set-Cookie headers of responses back to the host the caller asked for. It
+// is enabled by default.
+func WithResponseRewriting(enabled bool) Option {
+	return func(ag *ApiGateway) {
+		ag.rawResponses = !enabled
+	}
+}
+
+// responseRewriter maps URLs of the endpoint, under its stage path, and of the
+// site, under its base path, back to the URL the caller requested.
+type responseRewriter struct {
+	original *url.URL
+	endpoint string
+	stage    string
+	site     *url.URL
+}
+
+// rewriteResponse fixes the redirects and cookies of resp, the response to
+// original sent to endpoint as sent.
+func (ag *ApiGateway) rewriteResponse(resp *http.Response, original, sent *http.Request, endpoint string) {
+	if ag.rawResponses {
+		return
+	}
+	if resp.Header.Get("Location") == "" && len(resp.Header.Values("Set-Cookie")) == 0 {
+		return
+	}
+
+	r := &responseRewriter{endpoint: endpoint, stage: ag.basePath(endpoint)}
+	r.original = &url.URL{Scheme: original.URL.Scheme, Host: original.URL.Host}
+	if r.original.Host == "" {
+		r.original.Host = original.Host
+	}
+	if r.original.Scheme == "" {
+		r.original.Scheme = "http"
+	}
+	if site := ag.CurrentSite(); site != "" {
+		r.site, _ = url.Parse(site)
+	}
+
+	if location := resp.Header.Get("Location"); location != "" {
+		resp.Header.Set("Location", r.location(location, sent.URL))
+	}
+	cookies := resp.Header.Values("Set-Cookie")
+	for i, cookie := range cookies {
+		cookies[i] = r.cookie(cookie)
+	}
+}
+
+// location returns the redirect target seen by the caller. Relative locations
+// are resolved against base, the URL that was sent to the endpoint;
+// locations on other hosts are returned unchanged.
+func (r *responseRewriter) location(location string, base *url.URL) string {
+	u, err := base.Parse(location)
+	if err != nil {
+		return location
+	}
+	var prefix string
+	switch {
+	case strings.EqualFold(u.Host, r.endpoint):
+		prefix = r.stage
+	case r.site != nil && strings.EqualFold(u.Host, r.site.Host):
+		prefix = strings.TrimRight(r.site.Path, "/")
+	default:
+		return location
+	}
+
+	u.Scheme, u.Host = r.original.Scheme, r.original.Host
+	u.Path = trimPathPrefix(u.Path, prefix)
+	if u.RawPath != "" {
+		u.RawPath = trimPathPrefix(u.RawPath, prefix)
+	}
+	return u.String()
+}
+
+// cookie rewrites the Path and Domain attributes of a Set-Cookie value. The
+// stage and site base paths are removed from Path, and a Domain of the
+// endpoint or the site is dropped so the cookie belongs to the caller's host.
+func (r *responseRewriter) cookie(value string) string {
+	attrs := strings.Split(value, ";")
+	kept := attrs[:1]
+	for _, attr := range attrs[1:] {
+		name, val, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		switch strings.ToLower(name) {
+		case "path":
+			path := trimPathPrefix(val, r.stage)
+			if r.site != nil {
+				path = trimPathPrefix(path, strings.TrimRight(r.site.Path, "/"))
+			}
+			attr = " Path=" + path
+		case "domain":
+			domain := strings.TrimPrefix(strings.ToLower(val), ".")
+			if domain == strings.ToLower(r.endpoint) ||
+				(r.site != nil && domain == r.site.Hostname() && !strings.EqualFold(r.site.Hostname(), r.original.Hostname())) {
+				continue
+			}
+		}
+		kept = append(kept, attr)
+	}
+	return strings.Join(kept, ";")
+}
+
+// trimPathPrefix removes prefix from path when it is a whole leading segment
+// of it, keeping the result absolute.
+func trimPathPrefix(path, prefix string) string {
+	if prefix == "" || prefix == "/" {
+		return path
+	}
+	switch {
+	case path == prefix:
+		return "/"
+	case strings.HasPrefix(path, prefix+"/"):
+		return path[len(prefix):]
+	}
+	return path
+}
@@ -0,0 +1,201 @@
+package rotatortest
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+type usagePlan struct {
+	plan types.UsagePlan
+	keys map[string]bool
+}
+
+// ApiKeys returns the API keys of the region sorted by name.
+func (r *RestAPI) ApiKeys() []types.ApiKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]types.ApiKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return *keys[i].Name < *keys[j].Name })
+	return keys
+}
+
+// UsagePlans returns the usage plans of the region sorted by name.
+func (r *RestAPI) UsagePlans() []types.UsagePlan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plans := make([]types.UsagePlan, 0, len(r.plans))
+	for _, p := range r.plans {
+		plans = append(plans, p.plan)
+	}
+	sort.Slice(plans, func(i, j int) bool { return *plans[i].Name < *plans[j].Name })
+	return plans
+}
+
+func (r *RestAPI) CreateApiKey(ctx context.Context, params *apigateway.CreateApiKeyInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateApiKeyOutput, error) {
+	if err := r.begin("CreateApiKey"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	value := aws.ToString(params.Value)
+	if value == "" {
+		value = newID() + newID() + newID() + newID()
+	}
+	key := types.ApiKey{
+		Id:      aws.String(newID()),
+		Name:    params.Name,
+		Value:   &value,
+		Enabled: params.Enabled,
+		Tags:    params.Tags,
+	}
+	r.keys[*key.Id] = key
+	return &apigateway.CreateApiKeyOutput{Id: key.Id, Name: key.Name, Value: key.Value, Enabled: key.Enabled, Tags: key.Tags}, nil
+}
+
+func (r *RestAPI) GetApiKeys(ctx context.Context, params *apigateway.GetApiKeysInput, optFns ...func(*apigateway.Options)) (*apigateway.GetApiKeysOutput, error) {
+	if err := r.begin("GetApiKeys"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	var items []types.ApiKey
+	for _, k := range r.keys {
+		if !strings.HasPrefix(aws.ToString(k.Name), aws.ToString(params.NameQuery)) {
+			continue
+		}
+		if !aws.ToBool(params.IncludeValues) {
+			k.Value = nil
+		}
+		items = append(items, k)
+	}
+	sort.Slice(items, func(i, j int) bool { return *items[i].Name < *items[j].Name })
+	return &apigateway.GetApiKeysOutput{Items: items}, nil
+}
+
+func (r *RestAPI) DeleteApiKey(ctx context.Context, params *apigateway.DeleteApiKeyInput, optFns ...func(*apigateway.Options)) (*apigateway.DeleteApiKeyOutput, error) {
+	if err := r.begin("DeleteApiKey"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	id := aws.ToString(params.ApiKey)
+	if _, ok := r.keys[id]; !ok {
+		return nil, notFound("Invalid API Key identifier specified")
+	}
+	delete(r.keys, id)
+	for _, p := range r.plans {
+		delete(p.keys, id)
+	}
+	return &apigateway.DeleteApiKeyOutput{}, nil
+}
+
+func (r *RestAPI) CreateUsagePlan(ctx context.Context, params *apigateway.CreateUsagePlanInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateUsagePlanOutput, error) {
+	if err := r.begin("CreateUsagePlan"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	for _, stage := range params.ApiStages {
+		a, err := r.api(stage.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.stages[aws.ToString(stage.Stage)]; !ok {
+			return nil, notFound("Invalid stage identifier specified")
+		}
+	}
+	plan := types.UsagePlan{
+		Id:        aws.String(newID()),
+		Name:      params.Name,
+		ApiStages: params.ApiStages,
+		Tags:      params.Tags,
+	}
+	r.plans[*plan.Id] = &usagePlan{plan: plan, keys: make(map[string]bool)}
+	return &apigateway.CreateUsagePlanOutput{Id: plan.Id, Name: plan.Name, ApiStages: plan.ApiStages, Tags: plan.Tags}, nil
+}
+
+func (r *RestAPI) GetUsagePlans(ctx context.Context, params *apigateway.GetUsagePlansInput, optFns ...func(*apigateway.Options)) (*apigateway.GetUsagePlansOutput, error) {
+	if err := r.begin("GetUsagePlans"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	var items []types.UsagePlan
+	for _, p := range r.plans {
+		if params.KeyId != nil && !p.keys[*params.KeyId] {
+			continue
+		}
+		items = append(items, p.plan)
+	}
+	sort.Slice(items, func(i, j int) bool { return *items[i].Name < *items[j].Name })
+	return &apigateway.GetUsagePlansOutput{Items: items}, nil
+}
+
+// UpdateUsagePlan supports removing API stages only.
+func (r *RestAPI) UpdateUsagePlan(ctx context.Context, params *apigateway.UpdateUsagePlanInput, optFns ...func(*apigateway.Options)) (*apigateway.UpdateUsagePlanOutput, error) {
+	if err := r.begin("UpdateUsagePlan"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	p, ok := r.plans[aws.ToString(params.UsagePlanId)]
+	if !ok {
+		return nil, notFound("Invalid Usage Plan ID specified")
+	}
+	for _, op := range params.PatchOperations {
+		if op.Op != types.OpRemove || aws.ToString(op.Path) != "/apiStages" {
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch operation " + string(op.Op) + " " + aws.ToString(op.Path))}
+		}
+		kept := p.plan.ApiStages[:0]
+		for _, stage := range p.plan.ApiStages {
+			if aws.ToString(stage.ApiId)+":"+aws.ToString(stage.Stage) != aws.ToString(op.Value) {
+				kept = append(kept, stage)
+			}
+		}
+		p.plan.ApiStages = kept
+	}
+	return &apigateway.UpdateUsagePlanOutput{Id: p.plan.Id, Name: p.plan.Name, ApiStages: p.plan.ApiStages}, nil
+}
+
+func (r *RestAPI) DeleteUsagePlan(ctx context.Context, params *apigateway.DeleteUsagePlanInput, optFns ...func(*apigateway.Options)) (*apigateway.DeleteUsagePlanOutput, error) {
+	if err := r.begin("DeleteUsagePlan"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	p, ok := r.plans[aws.ToString(params.UsagePlanId)]
+	if !ok {
+		return nil, notFound("Invalid Usage Plan ID specified")
+	}
+	if len(p.plan.ApiStages) > 0 {
+		return nil, &types.BadRequestException{Message: aws.String("Cannot delete Usage Plan with API stages")}
+	}
+	delete(r.plans, *p.plan.Id)
+	return &apigateway.DeleteUsagePlanOutput{}, nil
+}
+
+func (r *RestAPI) CreateUsagePlanKey(ctx context.Context, params *apigateway.CreateUsagePlanKeyInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateUsagePlanKeyOutput, error) {
+	if err := r.begin("CreateUsagePlanKey"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	p, ok := r.plans[aws.ToString(params.UsagePlanId)]
+	if !ok {
+		return nil, notFound("Invalid Usage Plan ID specified")
+	}
+	key, ok := r.keys[aws.ToString(params.KeyId)]
+	if !ok || aws.ToString(params.KeyType) != "API_KEY" {
+		return nil, notFound("Invalid API Key identifier specified")
+	}
+	p.keys[*key.Id] = true
+	return &apigateway.CreateUsagePlanKeyOutput{Id: key.Id, Name: key.Name, Type: params.KeyType}, nil
+}
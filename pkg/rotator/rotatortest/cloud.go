@@ -0,0 +1,619 @@
+// Package rotatortest provides an in-memory API Gateway for exercising the
+// rotator without an AWS account.
+package rotatortest
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+)
+
+// Cloud holds the REST APIs of every region. Pass its Client method to
+// rotator.WithRestClients:
+//
+//	cloud := rotatortest.NewCloud()
+//	ag, err := rotator.NewApiGateway(site, name, rotator.WithRestClients(cloud.Client))
+type Cloud struct {
+	mu      sync.Mutex
+	regions map[string]*RestAPI
+}
+
+// NewCloud returns an empty Cloud.
+func NewCloud() *Cloud {
+	return &Cloud{regions: make(map[string]*RestAPI)}
+}
+
+// Client returns the fake REST API service of region.
+func (c *Cloud) Client(region string) (rotator.RestAPIClient, error) {
+	return c.Region(region), nil
+}
+
+// Region returns the fake REST API service of region, to inspect or seed it.
+func (c *Cloud) Region(region string) *RestAPI {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.regions[region]
+	if !ok {
+		r = &RestAPI{Region: region, apis: make(map[string]*restApi), keys: make(map[string]types.ApiKey), plans: make(map[string]*usagePlan)}
+		c.regions[region] = r
+	}
+	return r
+}
+
+// RestAPI is a fake REST API service of one region. It implements
+// rotator.RestAPIClient and keeps just enough state to check what the rotator
+// created.
+type RestAPI struct {
+	Region string
+
+	// Err, if set, is called before every operation and its error returned
+	// instead of running the operation, to inject failures.
+	Err func(operation string) error
+	// PageSize, if set, caps the pages of GetRestApis and GetResources below
+	// the limit asked for, to exercise pagination without creating hundreds
+	// of APIs.
+	PageSize int
+
+	mu    sync.Mutex
+	apis  map[string]*restApi
+	keys  map[string]types.ApiKey
+	plans map[string]*usagePlan
+}
+
+type restApi struct {
+	api       types.RestApi
+	resources map[string]*types.Resource
+	stages    map[string]types.Stage
+}
+
+// Apis returns the REST APIs of the region sorted by id.
+func (r *RestAPI) Apis() []types.RestApi {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sortedApis()
+}
+
+// Resources returns the resources of the API id, sorted by path.
+func (r *RestAPI) Resources(id string) []types.Resource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.apis[id]
+	if !ok {
+		return nil
+	}
+	return sortedResources(a)
+}
+
+func (r *RestAPI) sortedApis() []types.RestApi {
+	apis := make([]types.RestApi, 0, len(r.apis))
+	for _, a := range r.apis {
+		apis = append(apis, a.api)
+	}
+	sort.Slice(apis, func(i, j int) bool { return *apis[i].Id < *apis[j].Id })
+	return apis
+}
+
+func sortedResources(a *restApi) []types.Resource {
+	resources := make([]types.Resource, 0, len(a.resources))
+	for _, res := range a.resources {
+		resources = append(resources, *res)
+	}
+	sort.Slice(resources, func(i, j int) bool { return *resources[i].Path < *resources[j].Path })
+	return resources
+}
+
+// begin locks r and runs the failure injection of operation.
+func (r *RestAPI) begin(operation string) error {
+	if r.Err != nil {
+		if err := r.Err(operation); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	return nil
+}
+
+func (r *RestAPI) api(id *string) (*restApi, error) {
+	a, ok := r.apis[aws.ToString(id)]
+	if !ok {
+		return nil, notFound("Invalid API identifier specified %s", aws.ToString(id))
+	}
+	return a, nil
+}
+
+func (a *restApi) resource(id *string) (*types.Resource, error) {
+	res, ok := a.resources[aws.ToString(id)]
+	if !ok {
+		return nil, notFound("Invalid Resource identifier specified")
+	}
+	return res, nil
+}
+
+func (a *restApi) method(resource, method *string) (*types.Resource, types.Method, error) {
+	res, err := a.resource(resource)
+	if err != nil {
+		return nil, types.Method{}, err
+	}
+	m, ok := res.ResourceMethods[aws.ToString(method)]
+	if !ok {
+		return nil, types.Method{}, notFound("Invalid Method identifier specified")
+	}
+	return res, m, nil
+}
+
+func (r *RestAPI) GetRestApis(ctx context.Context, params *apigateway.GetRestApisInput, optFns ...func(*apigateway.Options)) (*apigateway.GetRestApisOutput, error) {
+	if err := r.begin("GetRestApis"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	apis := r.sortedApis()
+	start, end, next, err := r.page(len(apis), params.Position, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &apigateway.GetRestApisOutput{Items: apis[start:end], Position: next}, nil
+}
+
+// page returns the bounds of the page of n items starting at position and the
+// position of the next page, nil on the last one.
+func (r *RestAPI) page(n int, position *string, pageLimit *int32) (start, end int, next *string, err error) {
+	if position != nil {
+		p, err := strconv.Atoi(*position)
+		if err != nil {
+			return 0, 0, nil, &types.BadRequestException{Message: aws.String("Invalid position")}
+		}
+		start = min(p, n)
+	}
+	limit := int(aws.ToInt32(pageLimit))
+	if limit <= 0 {
+		limit = 25
+	}
+	if r.PageSize > 0 {
+		limit = min(limit, r.PageSize)
+	}
+	end = min(start+limit, n)
+	if end < n {
+		next = aws.String(strconv.Itoa(end))
+	}
+	return start, end, next, nil
+}
+
+func (r *RestAPI) CreateRestApi(ctx context.Context, params *apigateway.CreateRestApiInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateRestApiOutput, error) {
+	if err := r.begin("CreateRestApi"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	id, root := newID(), newID()
+	api := types.RestApi{
+		Id:                    &id,
+		Name:                  params.Name,
+		Description:           params.Description,
+		RootResourceId:        &root,
+		Tags:                  params.Tags,
+		EndpointConfiguration: params.EndpointConfiguration,
+		BinaryMediaTypes:      params.BinaryMediaTypes,
+		Policy:                params.Policy,
+		CreatedDate:           aws.Time(time.Now()),
+	}
+	r.apis[id] = &restApi{
+		api: api,
+		resources: map[string]*types.Resource{
+			root: {Id: &root, Path: aws.String("/"), ResourceMethods: map[string]types.Method{}},
+		},
+		stages: make(map[string]types.Stage),
+	}
+	return &apigateway.CreateRestApiOutput{
+		Id:                    api.Id,
+		Name:                  api.Name,
+		Description:           api.Description,
+		RootResourceId:        api.RootResourceId,
+		Tags:                  api.Tags,
+		EndpointConfiguration: api.EndpointConfiguration,
+		BinaryMediaTypes:      api.BinaryMediaTypes,
+		Policy:                api.Policy,
+		CreatedDate:           api.CreatedDate,
+	}, nil
+}
+
+func (r *RestAPI) DeleteRestApi(ctx context.Context, params *apigateway.DeleteRestApiInput, optFns ...func(*apigateway.Options)) (*apigateway.DeleteRestApiOutput, error) {
+	if err := r.begin("DeleteRestApi"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	if _, err := r.api(params.RestApiId); err != nil {
+		return nil, err
+	}
+	delete(r.apis, *params.RestApiId)
+	return &apigateway.DeleteRestApiOutput{}, nil
+}
+
+func (r *RestAPI) UpdateRestApi(ctx context.Context, params *apigateway.UpdateRestApiInput, optFns ...func(*apigateway.Options)) (*apigateway.UpdateRestApiOutput, error) {
+	if err := r.begin("UpdateRestApi"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range params.PatchOperations {
+		mediaType, ok := strings.CutPrefix(aws.ToString(op.Path), "/binaryMediaTypes/")
+		if !ok {
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch path " + aws.ToString(op.Path))}
+		}
+		mediaType = strings.ReplaceAll(mediaType, "~1", "/")
+		switch op.Op {
+		case types.OpAdd:
+			if !slices.Contains(a.api.BinaryMediaTypes, mediaType) {
+				a.api.BinaryMediaTypes = append(a.api.BinaryMediaTypes, mediaType)
+			}
+		case types.OpRemove:
+			a.api.BinaryMediaTypes = slices.DeleteFunc(a.api.BinaryMediaTypes, func(t string) bool { return t == mediaType })
+		default:
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch operation " + string(op.Op))}
+		}
+	}
+	api := a.api
+	return &apigateway.UpdateRestApiOutput{
+		Id:                    api.Id,
+		Name:                  api.Name,
+		Description:           api.Description,
+		RootResourceId:        api.RootResourceId,
+		Tags:                  api.Tags,
+		EndpointConfiguration: api.EndpointConfiguration,
+		BinaryMediaTypes:      api.BinaryMediaTypes,
+		Policy:                api.Policy,
+		CreatedDate:           api.CreatedDate,
+	}, nil
+}
+
+func (r *RestAPI) GetResources(ctx context.Context, params *apigateway.GetResourcesInput, optFns ...func(*apigateway.Options)) (*apigateway.GetResourcesOutput, error) {
+	if err := r.begin("GetResources"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	resources := sortedResources(a)
+	start, end, next, err := r.page(len(resources), params.Position, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &apigateway.GetResourcesOutput{Items: resources[start:end], Position: next}, nil
+}
+
+func (r *RestAPI) CreateResource(ctx context.Context, params *apigateway.CreateResourceInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateResourceOutput, error) {
+	if err := r.begin("CreateResource"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := a.resource(params.ParentId)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimSuffix(*parent.Path, "/") + "/" + aws.ToString(params.PathPart)
+	for _, res := range a.resources {
+		if *res.Path == path {
+			return nil, &types.ConflictException{Message: aws.String("Another resource with the same parent already has this name: " + aws.ToString(params.PathPart))}
+		}
+	}
+
+	id := newID()
+	res := &types.Resource{Id: &id, ParentId: parent.Id, Path: &path, PathPart: params.PathPart, ResourceMethods: map[string]types.Method{}}
+	a.resources[id] = res
+	return &apigateway.CreateResourceOutput{Id: res.Id, ParentId: res.ParentId, Path: res.Path, PathPart: res.PathPart}, nil
+}
+
+func (r *RestAPI) PutMethod(ctx context.Context, params *apigateway.PutMethodInput, optFns ...func(*apigateway.Options)) (*apigateway.PutMethodOutput, error) {
+	if err := r.begin("PutMethod"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.resource(params.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := res.ResourceMethods[aws.ToString(params.HttpMethod)]; ok {
+		return nil, &types.ConflictException{Message: aws.String("Method already exists for this resource")}
+	}
+	m := types.Method{
+		HttpMethod:        params.HttpMethod,
+		AuthorizationType: params.AuthorizationType,
+		ApiKeyRequired:    aws.Bool(params.ApiKeyRequired),
+		RequestParameters: params.RequestParameters,
+	}
+	res.ResourceMethods[*params.HttpMethod] = m
+	return &apigateway.PutMethodOutput{HttpMethod: m.HttpMethod, AuthorizationType: m.AuthorizationType, RequestParameters: m.RequestParameters}, nil
+}
+
+func (r *RestAPI) PutIntegration(ctx context.Context, params *apigateway.PutIntegrationInput, optFns ...func(*apigateway.Options)) (*apigateway.PutIntegrationOutput, error) {
+	if err := r.begin("PutIntegration"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	res, m, err := a.method(params.ResourceId, params.HttpMethod)
+	if err != nil {
+		return nil, err
+	}
+	integration := &types.Integration{
+		Type:              params.Type,
+		HttpMethod:        params.IntegrationHttpMethod,
+		Uri:               params.Uri,
+		ConnectionType:    params.ConnectionType,
+		RequestParameters: params.RequestParameters,
+		TimeoutInMillis:   aws.ToInt32(params.TimeoutInMillis),
+		ContentHandling:   params.ContentHandling,
+	}
+	m.MethodIntegration = integration
+	res.ResourceMethods[*params.HttpMethod] = m
+	return &apigateway.PutIntegrationOutput{
+		Type:              integration.Type,
+		HttpMethod:        integration.HttpMethod,
+		Uri:               integration.Uri,
+		ConnectionType:    integration.ConnectionType,
+		RequestParameters: integration.RequestParameters,
+	}, nil
+}
+
+func (r *RestAPI) GetIntegration(ctx context.Context, params *apigateway.GetIntegrationInput, optFns ...func(*apigateway.Options)) (*apigateway.GetIntegrationOutput, error) {
+	if err := r.begin("GetIntegration"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	_, m, err := a.method(params.ResourceId, params.HttpMethod)
+	if err != nil {
+		return nil, err
+	}
+	if m.MethodIntegration == nil {
+		return nil, notFound("No integration defined for method")
+	}
+	i := m.MethodIntegration
+	return &apigateway.GetIntegrationOutput{Type: i.Type, HttpMethod: i.HttpMethod, Uri: i.Uri, ConnectionType: i.ConnectionType, RequestParameters: i.RequestParameters, TimeoutInMillis: i.TimeoutInMillis}, nil
+}
+
+func (r *RestAPI) UpdateIntegration(ctx context.Context, params *apigateway.UpdateIntegrationInput, optFns ...func(*apigateway.Options)) (*apigateway.UpdateIntegrationOutput, error) {
+	if err := r.begin("UpdateIntegration"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	_, m, err := a.method(params.ResourceId, params.HttpMethod)
+	if err != nil {
+		return nil, err
+	}
+	if m.MethodIntegration == nil {
+		return nil, notFound("No integration defined for method")
+	}
+	for _, op := range params.PatchOperations {
+		if op.Op != types.OpReplace {
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch operation " + string(op.Op))}
+		}
+		switch aws.ToString(op.Path) {
+		case "/uri":
+			m.MethodIntegration.Uri = op.Value
+		case "/timeoutInMillis":
+			n, err := strconv.Atoi(aws.ToString(op.Value))
+			if err != nil {
+				return nil, &types.BadRequestException{Message: aws.String("invalid timeout")}
+			}
+			m.MethodIntegration.TimeoutInMillis = int32(n)
+		default:
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch path " + aws.ToString(op.Path))}
+		}
+	}
+	i := m.MethodIntegration
+	return &apigateway.UpdateIntegrationOutput{Type: i.Type, HttpMethod: i.HttpMethod, Uri: i.Uri, ConnectionType: i.ConnectionType, RequestParameters: i.RequestParameters, TimeoutInMillis: i.TimeoutInMillis}, nil
+}
+
+func (r *RestAPI) CreateDeployment(ctx context.Context, params *apigateway.CreateDeploymentInput, optFns ...func(*apigateway.Options)) (*apigateway.CreateDeploymentOutput, error) {
+	if err := r.begin("CreateDeployment"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	methods := 0
+	for _, res := range a.resources {
+		methods += len(res.ResourceMethods)
+	}
+	if methods == 0 {
+		return nil, &types.BadRequestException{Message: aws.String("The REST API doesn't contain any methods")}
+	}
+
+	id := newID()
+	now := time.Now()
+	if params.StageName != nil {
+		stage := a.stages[*params.StageName]
+		if stage.CreatedDate == nil {
+			stage.CreatedDate = &now
+		}
+		stage.StageName = params.StageName
+		stage.DeploymentId = &id
+		if len(params.Variables) > 0 {
+			stage.Variables = maps.Clone(stage.Variables)
+			if stage.Variables == nil {
+				stage.Variables = make(map[string]string)
+			}
+			maps.Copy(stage.Variables, params.Variables)
+		}
+		stage.LastUpdatedDate = &now
+		a.stages[*params.StageName] = stage
+	}
+	return &apigateway.CreateDeploymentOutput{Id: &id, CreatedDate: &now, Description: params.Description}, nil
+}
+
+func (r *RestAPI) GetStage(ctx context.Context, params *apigateway.GetStageInput, optFns ...func(*apigateway.Options)) (*apigateway.GetStageOutput, error) {
+	if err := r.begin("GetStage"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := a.stages[aws.ToString(params.StageName)]
+	if !ok {
+		return nil, notFound("Invalid Stage identifier specified")
+	}
+	return &apigateway.GetStageOutput{StageName: s.StageName, DeploymentId: s.DeploymentId, Variables: s.Variables, CreatedDate: s.CreatedDate, LastUpdatedDate: s.LastUpdatedDate}, nil
+}
+
+func (r *RestAPI) UpdateStage(ctx context.Context, params *apigateway.UpdateStageInput, optFns ...func(*apigateway.Options)) (*apigateway.UpdateStageOutput, error) {
+	if err := r.begin("UpdateStage"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := a.stages[aws.ToString(params.StageName)]
+	if !ok {
+		return nil, notFound("Invalid Stage identifier specified")
+	}
+	variables := maps.Clone(s.Variables)
+	if variables == nil {
+		variables = make(map[string]string)
+	}
+	for _, op := range params.PatchOperations {
+		name, ok := strings.CutPrefix(aws.ToString(op.Path), "/variables/")
+		if !ok {
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch path " + aws.ToString(op.Path))}
+		}
+		switch op.Op {
+		case types.OpAdd, types.OpReplace:
+			variables[name] = aws.ToString(op.Value)
+		case types.OpRemove:
+			delete(variables, name)
+		default:
+			return nil, &types.BadRequestException{Message: aws.String("unsupported patch operation " + string(op.Op))}
+		}
+	}
+	now := time.Now()
+	s.Variables = variables
+	s.LastUpdatedDate = &now
+	a.stages[*s.StageName] = s
+	return &apigateway.UpdateStageOutput{StageName: s.StageName, DeploymentId: s.DeploymentId, Variables: s.Variables, CreatedDate: s.CreatedDate, LastUpdatedDate: s.LastUpdatedDate}, nil
+}
+
+func (r *RestAPI) DeleteStage(ctx context.Context, params *apigateway.DeleteStageInput, optFns ...func(*apigateway.Options)) (*apigateway.DeleteStageOutput, error) {
+	if err := r.begin("DeleteStage"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := a.stages[aws.ToString(params.StageName)]; !ok {
+		return nil, notFound("Invalid Stage identifier specified")
+	}
+	delete(a.stages, *params.StageName)
+	return &apigateway.DeleteStageOutput{}, nil
+}
+
+func (r *RestAPI) GetStages(ctx context.Context, params *apigateway.GetStagesInput, optFns ...func(*apigateway.Options)) (*apigateway.GetStagesOutput, error) {
+	if err := r.begin("GetStages"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	a, err := r.api(params.RestApiId)
+	if err != nil {
+		return nil, err
+	}
+	stages := make([]types.Stage, 0, len(a.stages))
+	for _, s := range a.stages {
+		stages = append(stages, s)
+	}
+	sort.Slice(stages, func(i, j int) bool { return *stages[i].StageName < *stages[j].StageName })
+	return &apigateway.GetStagesOutput{Item: stages}, nil
+}
+
+func (r *RestAPI) TagResource(ctx context.Context, params *apigateway.TagResourceInput, optFns ...func(*apigateway.Options)) (*apigateway.TagResourceOutput, error) {
+	if err := r.begin("TagResource"); err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	_, id, ok := strings.Cut(aws.ToString(params.ResourceArn), "::/restapis/")
+	if !ok {
+		return nil, &types.BadRequestException{Message: aws.String("unsupported resource " + aws.ToString(params.ResourceArn))}
+	}
+	a, err := r.api(&id)
+	if err != nil {
+		return nil, err
+	}
+	if a.api.Tags == nil {
+		a.api.Tags = make(map[string]string)
+	}
+	for k, v := range params.Tags {
+		a.api.Tags[k] = v
+	}
+	return &apigateway.TagResourceOutput{}, nil
+}
+
+func notFound(format string, args ...any) error {
+	return &types.NotFoundException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+// newID returns a random 10 character identifier like the ones of API Gateway.
+func newID() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 10)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
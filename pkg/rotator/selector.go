@@ -0,0 +1,215 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNoEndpoints is returned when a request has to be routed but the pool has
+// no endpoint to route it through.
+var ErrNoEndpoints = errors.New("no endpoints available")
+
+// EndpointSelector picks the endpoint a request is sent through.
+// Implementations must be safe for concurrent use.
+type EndpointSelector interface {
+	// Select returns one of endpoints for req. It returns ErrNoEndpoints when
+	// endpoints is empty.
+	Select(req *http.Request, endpoints []string) (string, error)
+}
+
+// OutcomeReporter is implemented by selectors that learn from the result of
+// the requests they routed. Transport calls Report after every round trip.
+type OutcomeReporter interface {
+	Report(endpoint string, success bool)
+}
+
+// Names of the built-in selection strategies accepted by NewSelector.
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+	StrategyLRU        = "lru"
+	StrategyWeighted   = "weighted"
+)
+
+// NewSelector returns the built-in selector registered under name.
+func NewSelector(name string) (EndpointSelector, error) {
+	switch name {
+	case StrategyRoundRobin:
+		return NewRoundRobinSelector(), nil
+	case StrategyRandom, "":
+		return NewRandomSelector(), nil
+	case StrategyLRU:
+		return NewLRUSelector(), nil
+	case StrategyWeighted:
+		return NewWeightedSelector(), nil
+	case StrategyLatency:
+		return NewLatencySelector(0), nil
+	}
+	return nil, fmt.Errorf("unknown selection strategy %q", name)
+}
+
+// WithSelector sets the strategy used to pick an endpoint for each request.
+// A uniform random selector is used by default.
+func WithSelector(selector EndpointSelector) Option {
+	return func(ag *ApiGateway) {
+		ag.selector = selector
+		ag.explicitSelector = true
+	}
+}
+
+// setSelector makes selector, wrapped in a StickySelector with
+// WithStickySessions, pick the endpoints of the requests from now on.
+func (ag *ApiGateway) setSelector(selector EndpointSelector) {
+	if ag.stickyTTL > 0 {
+		selector = NewStickySelector(selector, ag.stickyTTL)
+	}
+	ag.mu.Lock()
+	ag.selector = selector
+	ag.mu.Unlock()
+}
+
+func (ag *ApiGateway) endpointSelector() EndpointSelector {
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	return ag.selector
+}
+
+// RoundRobinSelector cycles through the endpoints in order.
+type RoundRobinSelector struct {
+	mu   sync.Mutex
+	next int
+}
+
+// NewRoundRobinSelector returns a RoundRobinSelector starting at the first endpoint.
+func NewRoundRobinSelector() *RoundRobinSelector {
+	return &RoundRobinSelector{}
+}
+
+// Select implements EndpointSelector.
+func (s *RoundRobinSelector) Select(_ *http.Request, endpoints []string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint := endpoints[s.next%len(endpoints)]
+	s.next = (s.next + 1) % len(endpoints)
+	return endpoint, nil
+}
+
+// RandomSelector picks an endpoint uniformly at random.
+type RandomSelector struct{}
+
+// NewRandomSelector returns a RandomSelector.
+func NewRandomSelector() *RandomSelector {
+	return &RandomSelector{}
+}
+
+// Select implements EndpointSelector.
+func (s *RandomSelector) Select(_ *http.Request, endpoints []string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+	return endpoints[rand.Intn(len(endpoints))], nil
+}
+
+// LRUSelector picks the endpoint that has gone unused the longest. Endpoints
+// that were never used are picked first.
+type LRUSelector struct {
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+// NewLRUSelector returns an empty LRUSelector.
+func NewLRUSelector() *LRUSelector {
+	return &LRUSelector{lastUsed: make(map[string]time.Time)}
+}
+
+// Select implements EndpointSelector.
+func (s *LRUSelector) Select(_ *http.Request, endpoints []string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := endpoints[0]
+	for _, endpoint := range endpoints[1:] {
+		if s.lastUsed[endpoint].Before(s.lastUsed[best]) {
+			best = endpoint
+		}
+	}
+	s.lastUsed[best] = time.Now()
+	return best, nil
+}
+
+// WeightedSelector picks endpoints at random, weighted by their success rate.
+// Rates are smoothed so new endpoints start at 50% and an endpoint that only
+// failed keeps a small chance of being picked again.
+type WeightedSelector struct {
+	mu       sync.Mutex
+	outcomes map[string]*outcome
+}
+
+type outcome struct {
+	success, total int
+}
+
+// NewWeightedSelector returns a WeightedSelector with no history.
+func NewWeightedSelector() *WeightedSelector {
+	return &WeightedSelector{outcomes: make(map[string]*outcome)}
+}
+
+// Select implements EndpointSelector.
+func (s *WeightedSelector) Select(_ *http.Request, endpoints []string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	weights := make([]float64, len(endpoints))
+	var sum float64
+	for i, endpoint := range endpoints {
+		weights[i] = s.rate(endpoint)
+		sum += weights[i]
+	}
+
+	pick := rand.Float64() * sum
+	for i, w := range weights {
+		if pick < w {
+			return endpoints[i], nil
+		}
+		pick -= w
+	}
+	return endpoints[len(endpoints)-1], nil
+}
+
+// Report implements OutcomeReporter.
+func (s *WeightedSelector) Report(endpoint string, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.outcomes[endpoint]
+	if !ok {
+		o = &outcome{}
+		s.outcomes[endpoint] = o
+	}
+	o.total++
+	if success {
+		o.success++
+	}
+}
+
+// rate returns the Laplace smoothed success rate of endpoint.
+func (s *WeightedSelector) rate(endpoint string) float64 {
+	o, ok := s.outcomes[endpoint]
+	if !ok {
+		return 0.5
+	}
+	return float64(o.success+1) / float64(o.total+2)
+}
@@ -0,0 +1,210 @@
+package rotator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEchoURL is the service SelfTest asks for the source address of the
+// requests when none is given. It answers {"origin": "<ip>"}.
+const DefaultEchoURL = "https://httpbin.org/ip"
+
+// DefaultSelfTestRequests is the number of requests of a SelfTest without one.
+const DefaultSelfTestRequests = 20
+
+// SelfTestOptions configure SelfTest.
+type SelfTestOptions struct {
+	// Path of the echo service under the site of the pool, such as "/ip" for
+	// a pool of https://httpbin.org. The service must answer the address the
+	// request came from, as plain text or as the "origin" or "ip" field of a
+	// JSON object.
+	Path string
+	// Requests is the number of requests sent, DefaultSelfTestRequests when 0.
+	Requests int
+}
+
+// SelfTestResult is what a SelfTest observed.
+type SelfTestResult struct {
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// IPs are the distinct source addresses seen by the echo service.
+	IPs []string `json:"ips"`
+	// Regions are the distinct regions of the endpoints that answered.
+	Regions   []string           `json:"regions"`
+	Endpoints []SelfTestEndpoint `json:"endpoints"`
+	// Failures counts the errors of the failed requests by message.
+	Failures map[string]int `json:"failures,omitempty"`
+}
+
+// SelfTestEndpoint is what a SelfTest observed through one endpoint.
+type SelfTestEndpoint struct {
+	Endpoint string    `json:"endpoint"`
+	Region   string    `json:"region"`
+	Requests int       `json:"requests"`
+	Errors   int       `json:"errors"`
+	IPs      []string  `json:"ips"`
+	Latency  Histogram `json:"latency"`
+}
+
+// SelfTest sends requests through the pool to an echo service on the site of
+// the pool, ag.Concurrency at a time, and reports the source addresses and
+// regions seen and the latency of every endpoint. It checks that the pool
+// actually rotates: a healthy pool shows about one address per endpoint. An
+// error is returned only when no request could be sent.
+func (ag *ApiGateway) SelfTest(ctx context.Context, opts SelfTestOptions) (*SelfTestResult, error) {
+	site := ag.CurrentSite()
+	if site == "" {
+		return nil, fmt.Errorf("%w: the pool has no site to send test requests to", ErrInvalidSite)
+	}
+	requests := opts.Requests
+	if requests <= 0 {
+		requests = DefaultSelfTestRequests
+	}
+	workers := ag.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	target := site + "/" + strings.TrimPrefix(opts.Path, "/")
+
+	var mu sync.Mutex
+	endpoints := make(map[string]*SelfTestEndpoint)
+	failures := make(map[string]int)
+	ips := make(map[string]bool)
+	regions := make(map[string]bool)
+	sent, errs := 0, 0
+	var lastErr error
+
+	transport := ag.Transport()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				endpoint, ip, latency, err := selfTestRequest(ctx, transport, target)
+
+				mu.Lock()
+				if endpoint != "" {
+					e := endpoints[endpoint]
+					if e == nil {
+						d, _ := ag.deployment(endpoint)
+						e = &SelfTestEndpoint{Endpoint: endpoint, Region: d.Region, Latency: newHistogram()}
+						endpoints[endpoint] = e
+					}
+					e.Requests++
+					e.Latency.observe(latency)
+					if err != nil {
+						e.Errors++
+					} else {
+						if !slices.Contains(e.IPs, ip) {
+							e.IPs = append(e.IPs, ip)
+						}
+						ips[ip] = true
+						if e.Region != "" {
+							regions[e.Region] = true
+						}
+					}
+				}
+				if err != nil {
+					errs++
+					failures[err.Error()]++
+					lastErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+send:
+	for i := 0; i < requests; i++ {
+		select {
+		case jobs <- i:
+			sent++
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &SelfTestResult{Requests: sent, Errors: errs, IPs: sortedKeys(ips), Regions: sortedKeys(regions)}
+	if len(failures) > 0 {
+		result.Failures = failures
+	}
+	for _, e := range endpoints {
+		slices.Sort(e.IPs)
+		result.Endpoints = append(result.Endpoints, *e)
+	}
+	slices.SortFunc(result.Endpoints, func(a, b SelfTestEndpoint) int { return strings.Compare(a.Endpoint, b.Endpoint) })
+	if len(endpoints) == 0 && lastErr != nil {
+		return result, fmt.Errorf("no test request could be sent: %w", lastErr)
+	}
+	return result, nil
+}
+
+// selfTestRequest sends a GET request to target through transport and returns
+// the endpoint it went through, the source address the echo service saw and
+// the latency.
+func selfTestRequest(ctx context.Context, transport *Transport, target string) (string, string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", "", 0, err
+	}
+	start := time.Now()
+	resp, endpoint, err := transport.roundTrip(req, nil)
+	latency := time.Since(start)
+	if err != nil {
+		return endpoint, "", latency, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return endpoint, "", latency, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return endpoint, "", latency, fmt.Errorf("echo service answered %s", resp.Status)
+	}
+	ip, err := echoedIP(body)
+	return endpoint, ip, latency, err
+}
+
+// echoedIP returns the source address in the answer of an echo service. When
+// the service lists the whole X-Forwarded-For chain, the last address is the
+// one that connected to it.
+func echoedIP(body []byte) (string, error) {
+	text := strings.TrimSpace(string(body))
+	var fields struct {
+		Origin string `json:"origin"`
+		IP     string `json:"ip"`
+	}
+	if json.Unmarshal(body, &fields) == nil {
+		text = fields.Origin
+		if text == "" {
+			text = fields.IP
+		}
+	}
+	chain := strings.Split(text, ",")
+	ip := strings.TrimSpace(chain[len(chain)-1])
+	if net.ParseIP(ip) == nil {
+		return "", errors.New("no address in the answer of the echo service")
+	}
+	return ip, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,185 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+// poolVariable is the stage variable a stage of a shared REST API records the
+// pool it belongs to in.
+const poolVariable = "pool"
+
+// stageNameChars matches the characters stage names cannot have.
+var stageNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// WithSharedApi makes the pool deploy its gateways as stages of REST APIs
+// shared by every pool given the same name, instead of an API per gateway:
+// one API per region and account, created by the first pool that needs it,
+// with a stage per pool whose stage variables point at the site of the pool.
+// One API ID then proxies many sites and the pools stay far under the REST
+// API quota of the region; API Gateway allows 10 stages per API by default.
+// The methods and the resource policy of a shared API are those of the pool
+// that created it, and sites must use https since the scheme is part of the
+// methods. Deleting the gateway of a pool deletes its stage, and the API with
+// its last stage. Shared APIs cannot have custom domains or API keys.
+func WithSharedApi(name string) Option {
+	return func(ag *ApiGateway) {
+		ag.sharedApi = name
+	}
+}
+
+// sharedStageName returns the stage of the pool in shared REST APIs, its name
+// with the characters stage names cannot have replaced.
+func sharedStageName(pool string) string {
+	return stageNameChars.ReplaceAllString(pool, "_")
+}
+
+// isShared reports whether api is a REST API shared by the pool.
+func (ag *ApiGateway) isShared(api types.RestApi) bool {
+	return OwnedGateways(api) && api.Tags[TagShared] == ag.sharedApi
+}
+
+// sharedVariables returns the stage variables of the stage of the pool in a
+// shared REST API, pointing at site.
+func (ag *ApiGateway) sharedVariables(site string) map[string]string {
+	_, _, variables := targetURIs(site)
+	variables[poolVariable] = ag.Name
+	return variables
+}
+
+// createSharedStage deploys the stage of the pool on the shared REST API of
+// region, creating the API if there is none.
+func (ag *ApiGateway) createSharedStage(ctx context.Context, creds *credentialSet, client RestAPIClient, region, site string) (_ Deployment, err error) {
+	api, err := findRestApi(ctx, client, region, ag.isShared)
+	if err != nil {
+		return Deployment{}, err
+	}
+	if api == nil {
+		tags := map[string]string{TagCreatedBy: CreatedByValue, TagShared: ag.sharedApi}
+		created, err := ag.createRestApi(ctx, client, region, ag.sharedApi, site, tags)
+		if err != nil {
+			return Deployment{}, err
+		}
+		api = &types.RestApi{Id: created.Id, Name: created.Name, Tags: created.Tags, CreatedDate: created.CreatedDate}
+		ag.logger.Info("shared api created", "region", region, "id", *api.Id, "name", ag.sharedApi)
+		// a stage of another pool may be deployed in the meantime, the API
+		// is only deleted with the stage of the pool
+		defer func() {
+			if err != nil {
+				err = ag.rollback(ctx, region, *api.Id, err, func(ctx context.Context) error {
+					_, _, err := ag.deleteSharedStage(ctx, client, *api.Id)
+					return err
+				})
+			}
+		}()
+	}
+
+	stage := sharedStageName(ag.Name)
+	current, err := client.GetStage(ctx, &apigateway.GetStageInput{RestApiId: api.Id, StageName: &stage})
+	var notFound *types.NotFoundException
+	adopted := err == nil
+	switch {
+	case errors.As(err, &notFound):
+	case err != nil:
+		return Deployment{}, fmt.Errorf("cannot get stage of api %s: %w", *api.Id, classify(err))
+	case current.Variables[poolVariable] != ag.Name:
+		return Deployment{}, fmt.Errorf("%w: stage %s of shared api %s in region %s belongs to pool %s", ErrApiExists, stage, *api.Id, region, current.Variables[poolVariable])
+	case !ag.adopt:
+		return Deployment{}, fmt.Errorf("%w: shared api %s in region %s already has a stage for pool %s", ErrApiExists, *api.Id, region, ag.Name)
+	}
+
+	// an adopted stage is deployed again, pointing at the site
+	_, err = client.CreateDeployment(ctx, &apigateway.CreateDeploymentInput{
+		RestApiId: api.Id,
+		StageName: &stage,
+		Variables: ag.sharedVariables(site),
+	})
+	if err != nil {
+		return Deployment{}, fmt.Errorf("cannot create deployment: %w", classify(err))
+	}
+	if !adopted {
+		if err := ag.associateWebACL(ctx, creds, region, *api.Id, stage); err != nil {
+			return Deployment{}, err
+		}
+	}
+
+	created := aws.ToTime(api.CreatedDate)
+	if adopted {
+		created = aws.ToTime(current.CreatedDate)
+	}
+	d := restDeployment(region, *api.Id, stage, created)
+	d.IAMAuth = ag.iamAuth
+	if adopted {
+		ag.markAdopted(d)
+	}
+	return d, nil
+}
+
+// sharedDeployments returns the stages of the pool in the shared REST APIs
+// among apis.
+func (ag *ApiGateway) sharedDeployments(ctx context.Context, client RestAPIClient, region string, apis []types.RestApi) ([]Deployment, error) {
+	var deployments []Deployment
+	for _, api := range apis {
+		if !ag.isShared(api) {
+			continue
+		}
+		stages, err := client.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: api.Id})
+		if err != nil {
+			return nil, fmt.Errorf("cannot get stages of api %s: %w", *api.Id, classify(err))
+		}
+		for _, stage := range stages.Item {
+			if stage.Variables[poolVariable] == ag.Name {
+				d := restDeployment(region, *api.Id, *stage.StageName, aws.ToTime(stage.CreatedDate))
+				d.IAMAuth = ag.iamAuth
+				deployments = append(deployments, d)
+			}
+		}
+	}
+	return deployments, nil
+}
+
+// deleteSharedStage deletes the stages of the pool in the REST API id, and
+// the API if it has no other stage left. It reports whether id is shared,
+// nothing is deleted otherwise, and the number of stages left.
+func (ag *ApiGateway) deleteSharedStage(ctx context.Context, client RestAPIClient, id string) (bool, int, error) {
+	stages, err := client.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: &id})
+	if err != nil {
+		return false, 0, fmt.Errorf("cannot get stages of api %s: %w", id, classify(err))
+	}
+	shared, left := false, 0
+	for _, stage := range stages.Item {
+		pool, ok := stage.Variables[poolVariable]
+		shared = shared || ok
+		if pool != ag.Name {
+			left++
+			continue
+		}
+		if _, err := client.DeleteStage(ctx, &apigateway.DeleteStageInput{RestApiId: &id, StageName: stage.StageName}); err != nil {
+			return true, left, fmt.Errorf("cannot delete stage %s of api %s: %w", *stage.StageName, id, classify(err))
+		}
+	}
+	switch {
+	case !shared && left > 0:
+		return false, left, nil
+	case left > 0:
+		ag.logger.Debug("stage deleted from shared api", "id", id, "stages", left)
+		return true, left, nil
+	}
+	if _, err := client.DeleteRestApi(ctx, &apigateway.DeleteRestApiInput{RestApiId: &id}); err != nil {
+		return true, 0, fmt.Errorf("cannot delete rest api %s: %w", id, classify(err))
+	}
+	return true, 0, nil
+}
+
+// otherPool reports whether stage is a stage of another pool in a shared REST
+// API, which retargeting the pool must leave alone.
+func (ag *ApiGateway) otherPool(stage types.Stage) bool {
+	pool, ok := stage.Variables[poolVariable]
+	return ok && pool != ag.Name
+}
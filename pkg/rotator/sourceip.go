@@ -0,0 +1,93 @@
+package rotator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// EgressIPURL answers the address requests to it come from, as plain text.
+const EgressIPURL = "https://checkip.amazonaws.com"
+
+// WithSourceIPs attaches a resource policy to the REST APIs created for the
+// pool that only lets callers from cidrs, IP addresses or CIDR blocks, invoke
+// them; everyone else gets 403 Forbidden. The policy is set when an API is
+// created, adopted gateways keep theirs. The health checks and the readiness
+// wait of WithReadyTimeout must come from an allowed address too. HTTP APIs
+// have no resource policies.
+func WithSourceIPs(cidrs ...string) Option {
+	return func(ag *ApiGateway) {
+		ag.sourceIPs = append(ag.sourceIPs, cidrs...)
+	}
+}
+
+// sourceIPPolicy returns the resource policy allowing cidrs only, with single
+// addresses turned into blocks.
+func sourceIPPolicy(cidrs []string) (string, error) {
+	blocks := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return "", fmt.Errorf("invalid source IP %q: not an address or a CIDR block", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		blocks = append(blocks, prefix.Masked().String())
+	}
+
+	type statement struct {
+		Effect    string         `json:"Effect"`
+		Principal string         `json:"Principal"`
+		Action    string         `json:"Action"`
+		Resource  string         `json:"Resource"`
+		Condition map[string]any `json:"Condition,omitempty"`
+	}
+	policy := struct {
+		Version   string      `json:"Version"`
+		Statement []statement `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+		Statement: []statement{
+			{Effect: "Allow", Principal: "*", Action: "execute-api:Invoke", Resource: "execute-api:/*"},
+			{
+				Effect: "Deny", Principal: "*", Action: "execute-api:Invoke", Resource: "execute-api:/*",
+				Condition: map[string]any{"NotIpAddress": map[string][]string{"aws:SourceIp": blocks}},
+			},
+		},
+	}
+	data, err := json.Marshal(policy)
+	return string(data), err
+}
+
+// EgressIP returns the public address the requests of this machine come
+// from, as seen by EgressIPURL.
+func EgressIP(ctx context.Context) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, EgressIPURL, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cannot detect egress IP: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("cannot detect egress IP: %s answered %s", EgressIPURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cannot detect egress IP: %w", err)
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cannot detect egress IP: %w", err)
+	}
+	return addr, nil
+}
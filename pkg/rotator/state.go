@@ -0,0 +1,78 @@
+package rotator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// State is the persisted form of a pool: the site it proxies and every
+// endpoint created for it, so later runs reuse the gateways instead of
+// creating new ones.
+type State struct {
+	Site        string       `json:"site"`
+	Name        string       `json:"name"`
+	Regions     []string     `json:"regions"`
+	Deployments []Deployment `json:"deployments"`
+	SavedAt     time.Time    `json:"saved_at"`
+}
+
+// State returns a snapshot of the pool.
+func (ag *ApiGateway) State() State {
+	return State{
+		Site:        ag.CurrentSite(),
+		Name:        ag.Name,
+		Regions:     ag.Regions,
+		Deployments: ag.Deployments(),
+		SavedAt:     time.Now().UTC(),
+	}
+}
+
+// Restore adds the deployments of s to the pool. The pool takes the site and
+// name of s when it has none, and refuses a state saved for another site.
+func (ag *ApiGateway) Restore(s State) error {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+	if ag.Site != "" && s.Site != "" && ag.Site != s.Site {
+		return fmt.Errorf("state is for site %s, not %s", s.Site, ag.Site)
+	}
+	if ag.Site == "" {
+		ag.Site = s.Site
+	}
+	if ag.Name == "" {
+		ag.Name = s.Name
+	}
+	for _, d := range s.Deployments {
+		ag.addDeployment(d)
+	}
+	return nil
+}
+
+// Save writes the state of the pool to path as JSON. The file is replaced
+// atomically so a crash never leaves a truncated state behind.
+func (ag *ApiGateway) Save(path string) error {
+	data, err := json.MarshalIndent(ag.State(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot save state: %w", err)
+	}
+	return nil
+}
+
+// Load restores the pool from a state file written by Save. The returned
+// error wraps fs.ErrNotExist when there is no state file yet.
+func (ag *ApiGateway) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot load state: %w", err)
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("cannot load state %s: %w", path, err)
+	}
+	return ag.Restore(s)
+}
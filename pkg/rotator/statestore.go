@@ -0,0 +1,226 @@
+package rotator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var (
+	// ErrStateNotFound is returned by StateStore.Load when nothing was saved yet.
+	ErrStateNotFound = errors.New("no state stored")
+
+	// ErrStateConflict is returned by StateStore.Save when another process
+	// saved the state after it was loaded.
+	ErrStateConflict = errors.New("state was changed by another process")
+)
+
+// StateStore persists the state of a pool so it can be shared by several
+// machines and recovered after a restart. Saves are optimistically locked:
+// every Load returns an opaque version and Save only succeeds if the stored
+// state still has that version.
+type StateStore interface {
+	// Load returns the stored state and its version, or ErrStateNotFound.
+	Load(ctx context.Context) (State, string, error)
+	// Save stores s if the stored version is still version, "" meaning that
+	// nothing may be stored yet, and returns the new version. It returns
+	// ErrStateConflict when the version does not match.
+	Save(ctx context.Context, s State, version string) (string, error)
+}
+
+// LoadFrom restores the pool from store and remembers the version loaded, so
+// that the next SaveTo fails if someone else saved in between. A store with no
+// state is not an error.
+func (ag *ApiGateway) LoadFrom(ctx context.Context, store StateStore) error {
+	s, version, err := store.Load(ctx)
+	if errors.Is(err, ErrStateNotFound) {
+		ag.setStateVersion("")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := ag.Restore(s); err != nil {
+		return err
+	}
+	ag.setStateVersion(version)
+	return nil
+}
+
+// SaveTo saves the pool to store. It returns ErrStateConflict when the stored
+// state changed since the last LoadFrom or SaveTo of this pool.
+func (ag *ApiGateway) SaveTo(ctx context.Context, store StateStore) error {
+	ag.mu.RLock()
+	version := ag.stateVersion
+	ag.mu.RUnlock()
+
+	version, err := store.Save(ctx, ag.State(), version)
+	if err != nil {
+		return err
+	}
+	ag.setStateVersion(version)
+	return nil
+}
+
+func (ag *ApiGateway) setStateVersion(version string) {
+	ag.mu.Lock()
+	ag.stateVersion = version
+	ag.mu.Unlock()
+}
+
+// OpenStateStore returns the store described by location:
+//
+//	s3://bucket/key          an S3 object
+//	dynamodb://table/key     an item of a DynamoDB table keyed by "id"
+//	anything else            a local file
+//
+// AWS stores use the default AWS configuration.
+func OpenStateStore(ctx context.Context, location string) (StateStore, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "dynamodb") {
+		return NewFileStore(location), nil
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("state location %s needs a %s://<name>/<key> form", location, u.Scheme)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot load AWS config: %w", ErrCredentials, err)
+	}
+	if u.Scheme == "s3" {
+		return NewS3Store(s3.NewFromConfig(cfg), u.Host, key), nil
+	}
+	return NewDynamoDBStore(dynamodb.NewFromConfig(cfg), u.Host, key), nil
+}
+
+// FileStore is a StateStore backed by a local JSON file, in the format written
+// by ApiGateway.Save. Its versions are content hashes and concurrent saves
+// from processes on the same machine are serialized with a lock file.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a FileStore for path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// staleLock is the age after which a lock file is assumed to be left behind
+// by a crashed process.
+const staleLock = 30 * time.Second
+
+// Load implements StateStore.
+func (store *FileStore) Load(ctx context.Context) (State, string, error) {
+	s, version, err := store.read()
+	if err != nil {
+		return State{}, "", err
+	}
+	if version == "" {
+		return State{}, "", ErrStateNotFound
+	}
+	return s, version, nil
+}
+
+// Save implements StateStore.
+func (store *FileStore) Save(ctx context.Context, s State, version string) (string, error) {
+	unlock, err := store.lock(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	_, current, err := store.read()
+	if err != nil {
+		return "", err
+	}
+	if current != version {
+		return "", ErrStateConflict
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	if err := writeFileAtomic(store.Path, data); err != nil {
+		return "", fmt.Errorf("cannot save state: %w", err)
+	}
+	return contentVersion(data), nil
+}
+
+// read returns the state in the file and its version, "" if there is no file.
+func (store *FileStore) read() (State, string, error) {
+	data, err := os.ReadFile(store.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, "", nil
+	}
+	if err != nil {
+		return State{}, "", fmt.Errorf("cannot load state: %w", err)
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, "", fmt.Errorf("cannot load state %s: %w", store.Path, err)
+	}
+	return s, contentVersion(data), nil
+}
+
+// lock creates the lock file next to the state, waiting for other holders.
+func (store *FileStore) lock(ctx context.Context) (func(), error) {
+	path := store.Path + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("cannot lock state: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("cannot lock state: %w", ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic replaces path with data through a temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,96 @@
+package rotator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBStore is a StateStore keeping the state in one item of a DynamoDB
+// table whose partition key is the string attribute "id". The item carries a
+// numeric version checked by a condition expression on every save.
+type DynamoDBStore struct {
+	Client *dynamodb.Client
+	Table  string
+	Key    string
+}
+
+// NewDynamoDBStore returns a DynamoDBStore for the item key in table.
+func NewDynamoDBStore(client *dynamodb.Client, table, key string) *DynamoDBStore {
+	return &DynamoDBStore{Client: client, Table: table, Key: key}
+}
+
+// Load implements StateStore.
+func (store *DynamoDBStore) Load(ctx context.Context) (State, string, error) {
+	output, err := store.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &store.Table,
+		Key:            map[string]dbtypes.AttributeValue{"id": &dbtypes.AttributeValueMemberS{Value: store.Key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return State{}, "", fmt.Errorf("cannot load state from dynamodb table %s: %w", store.Table, classify(err))
+	}
+	if output.Item == nil {
+		return State{}, "", ErrStateNotFound
+	}
+
+	data, ok := output.Item["state"].(*dbtypes.AttributeValueMemberS)
+	if !ok {
+		return State{}, "", fmt.Errorf("item %s of dynamodb table %s has no state", store.Key, store.Table)
+	}
+	version, ok := output.Item["version"].(*dbtypes.AttributeValueMemberN)
+	if !ok {
+		return State{}, "", fmt.Errorf("item %s of dynamodb table %s has no version", store.Key, store.Table)
+	}
+	var s State
+	if err := json.Unmarshal([]byte(data.Value), &s); err != nil {
+		return State{}, "", fmt.Errorf("cannot load state from dynamodb table %s: %w", store.Table, err)
+	}
+	return s, version.Value, nil
+}
+
+// Save implements StateStore.
+func (store *DynamoDBStore) Save(ctx context.Context, s State, version string) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	next := int64(1)
+	input := &dynamodb.PutItemInput{
+		TableName: &store.Table,
+		Item: map[string]dbtypes.AttributeValue{
+			"id":    &dbtypes.AttributeValueMemberS{Value: store.Key},
+			"state": &dbtypes.AttributeValueMemberS{Value: string(data)},
+		},
+	}
+	if version == "" {
+		input.ConditionExpression = aws.String("attribute_not_exists(id)")
+	} else {
+		current, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid dynamodb state version %q", version)
+		}
+		next = current + 1
+		input.ConditionExpression = aws.String("version = :version")
+		input.ExpressionAttributeValues = map[string]dbtypes.AttributeValue{
+			":version": &dbtypes.AttributeValueMemberN{Value: version},
+		}
+	}
+	input.Item["version"] = &dbtypes.AttributeValueMemberN{Value: strconv.FormatInt(next, 10)}
+
+	if _, err := store.Client.PutItem(ctx, input); err != nil {
+		var conditionErr *dbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return "", ErrStateConflict
+		}
+		return "", fmt.Errorf("cannot save state to dynamodb table %s: %w", store.Table, classify(err))
+	}
+	return strconv.FormatInt(next, 10), nil
+}
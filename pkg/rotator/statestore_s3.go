@@ -0,0 +1,83 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3Store is a StateStore backed by an S3 object. Versions are ETags and saves
+// use S3 conditional writes, so two machines cannot overwrite each other.
+type S3Store struct {
+	Client *s3.Client
+	Bucket string
+	Key    string
+}
+
+// NewS3Store returns an S3Store for the object key in bucket.
+func NewS3Store(client *s3.Client, bucket, key string) *S3Store {
+	return &S3Store{Client: client, Bucket: bucket, Key: key}
+}
+
+// Load implements StateStore.
+func (store *S3Store) Load(ctx context.Context) (State, string, error) {
+	output, err := store.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &store.Bucket,
+		Key:    &store.Key,
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			return State{}, "", ErrStateNotFound
+		}
+		return State{}, "", fmt.Errorf("cannot load state from s3://%s/%s: %w", store.Bucket, store.Key, classify(err))
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return State{}, "", fmt.Errorf("cannot load state from s3://%s/%s: %w", store.Bucket, store.Key, err)
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, "", fmt.Errorf("cannot load state from s3://%s/%s: %w", store.Bucket, store.Key, err)
+	}
+	return s, aws.ToString(output.ETag), nil
+}
+
+// Save implements StateStore.
+func (store *S3Store) Save(ctx context.Context, s State, version string) (string, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      &store.Bucket,
+		Key:         &store.Key,
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}
+	if version == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(version)
+	}
+
+	output, err := store.Client.PutObject(ctx, input)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+			return "", ErrStateConflict
+		}
+		return "", fmt.Errorf("cannot save state to s3://%s/%s: %w", store.Bucket, store.Key, classify(err))
+	}
+	return aws.ToString(output.ETag), nil
+}
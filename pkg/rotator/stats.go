@@ -0,0 +1,223 @@
+package rotator
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms of Stats.
+var LatencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// Histogram counts latencies in LatencyBuckets. Counts has one more entry than
+// Buckets for the latencies above the last bound.
+type Histogram struct {
+	Buckets []time.Duration `json:"buckets"`
+	Counts  []uint64        `json:"counts"`
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+}
+
+func newHistogram() Histogram {
+	return Histogram{Buckets: LatencyBuckets, Counts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i, _ := slices.BinarySearch(h.Buckets, d)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h *Histogram) merge(o Histogram) {
+	for i, n := range o.Counts {
+		h.Counts[i] += n
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Mean returns the average latency, 0 when nothing was observed.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile, for
+// q between 0 and 1. Latencies above the last bucket are reported as the last
+// bound.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen > rank && i < len(h.Buckets) {
+			return h.Buckets[i]
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// EndpointStats are the requests sent through one endpoint. Errors counts the
+// requests that failed, were throttled or refused, or were detected as bans;
+// Throttled those answered 429 Too Many Requests. Bytes adds up the bytes of
+// the response bodies read or closed so far.
+type EndpointStats struct {
+	Endpoint  string    `json:"endpoint"`
+	Region    string    `json:"region"`
+	Provider  string    `json:"provider"`
+	Requests  uint64    `json:"requests"`
+	Errors    uint64    `json:"errors"`
+	Throttled uint64    `json:"throttled"`
+	Bytes     uint64    `json:"bytes"`
+	Latency   Histogram `json:"latency"`
+}
+
+// RegionStats add up the EndpointStats of a region.
+type RegionStats struct {
+	Region    string    `json:"region"`
+	Requests  uint64    `json:"requests"`
+	Errors    uint64    `json:"errors"`
+	Throttled uint64    `json:"throttled"`
+	Bytes     uint64    `json:"bytes"`
+	Latency   Histogram `json:"latency"`
+}
+
+// Stats is a snapshot of the traffic Transport sent since the pool was created.
+type Stats struct {
+	Since     time.Time       `json:"since"`
+	Requests  uint64          `json:"requests"`
+	Errors    uint64          `json:"errors"`
+	Throttled uint64          `json:"throttled"`
+	Bytes     uint64          `json:"bytes"`
+	Endpoints []EndpointStats `json:"endpoints"`
+	Regions   []RegionStats   `json:"regions"`
+}
+
+// stats records the outcome of every round trip of Transport.
+type stats struct {
+	mu        sync.Mutex
+	since     time.Time
+	endpoints map[string]*EndpointStats
+}
+
+// record adds a request that went through endpoint of d in latency. The bytes
+// of its response are added by addBytes once the body is read.
+func (s *stats) record(d Deployment, success, throttled bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]*EndpointStats)
+	}
+	e := s.endpoints[d.Host]
+	if e == nil {
+		e = &EndpointStats{Endpoint: d.Host, Region: d.Region, Provider: d.Provider, Latency: newHistogram()}
+		s.endpoints[d.Host] = e
+	}
+	e.Requests++
+	if !success {
+		e.Errors++
+	}
+	if throttled {
+		e.Throttled++
+	}
+	e.Latency.observe(latency)
+}
+
+// addBytes adds bytes of a response body read from the endpoint of d.
+func (s *stats) addBytes(d Deployment, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.endpoints[d.Host]; e != nil && bytes > 0 {
+		e.Bytes += uint64(bytes)
+	}
+}
+
+// countingBody counts the bytes read from a response body, whose length is
+// unknown until then for chunked bodies, and calls done with them once, at
+// EOF or on Close.
+type countingBody struct {
+	io.ReadCloser
+	n    atomic.Int64
+	once sync.Once
+	done func(bytes int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *countingBody) finish() {
+	b.once.Do(func() { b.done(b.n.Load()) })
+}
+
+// Stats returns the request counts and latencies per endpoint and per region,
+// sorted by endpoint and region. Endpoints that left the pool are kept.
+func (ag *ApiGateway) Stats() Stats {
+	s := &ag.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := Stats{Since: s.since}
+	regions := make(map[string]*RegionStats)
+	for _, e := range s.endpoints {
+		copied := *e
+		copied.Latency = e.Latency.clone()
+		snapshot.Endpoints = append(snapshot.Endpoints, copied)
+		snapshot.Requests += e.Requests
+		snapshot.Errors += e.Errors
+		snapshot.Throttled += e.Throttled
+		snapshot.Bytes += e.Bytes
+
+		r := regions[e.Region]
+		if r == nil {
+			r = &RegionStats{Region: e.Region, Latency: newHistogram()}
+			regions[e.Region] = r
+		}
+		r.Requests += e.Requests
+		r.Errors += e.Errors
+		r.Throttled += e.Throttled
+		r.Bytes += e.Bytes
+		r.Latency.merge(e.Latency)
+	}
+	for _, r := range regions {
+		snapshot.Regions = append(snapshot.Regions, *r)
+	}
+	slices.SortFunc(snapshot.Endpoints, func(a, b EndpointStats) int { return strings.Compare(a.Endpoint, b.Endpoint) })
+	slices.SortFunc(snapshot.Regions, func(a, b RegionStats) int { return strings.Compare(a.Region, b.Region) })
+	return snapshot
+}
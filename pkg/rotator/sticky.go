@@ -0,0 +1,129 @@
+package rotator
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SessionHeader lets clients that cannot set a context, such as tools going
+// through the local proxy, name the session a request belongs to. It is removed
+// before the request is sent.
+const SessionHeader = "X-Rotator-Session"
+
+type sessionKey struct{}
+
+// WithSession returns a context that marks requests made with it as belonging
+// to session id. Use one id per cookie jar so that sticky routing and session
+// scoped settings follow the jar.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionFromRequest returns the session id of req, taken from its context or
+// from SessionHeader, or "" when the request has no session.
+func SessionFromRequest(req *http.Request) string {
+	if id, ok := req.Context().Value(sessionKey{}).(string); ok {
+		return id
+	}
+	return req.Header.Get(SessionHeader)
+}
+
+// StickyKey is the default key of StickySelector: the target host and the
+// session of the request.
+func StickyKey(req *http.Request) string {
+	host := req.Host
+	if req.URL != nil && req.URL.Host != "" {
+		host = req.URL.Host
+	}
+	return host + "|" + SessionFromRequest(req)
+}
+
+// WithStickySessions pins every (host, session) pair to the same endpoint for
+// ttl before letting the configured selector pick a new one.
+func WithStickySessions(ttl time.Duration) Option {
+	return func(ag *ApiGateway) {
+		ag.stickyTTL = ttl
+	}
+}
+
+// StickySelector wraps another selector and keeps returning the endpoint it
+// picked for a key until the pin expires or the endpoint leaves the pool.
+type StickySelector struct {
+	// Base picks the endpoint when a key has no live pin.
+	Base EndpointSelector
+	// TTL is how long a key stays pinned after its endpoint was picked.
+	TTL time.Duration
+	// Key groups requests that must share an endpoint. StickyKey is used when nil.
+	Key func(*http.Request) string
+
+	mu        sync.Mutex
+	pins      map[string]pin
+	lastSweep time.Time
+}
+
+type pin struct {
+	endpoint string
+	expires  time.Time
+}
+
+// NewStickySelector returns a StickySelector pinning keys for ttl on top of base.
+func NewStickySelector(base EndpointSelector, ttl time.Duration) *StickySelector {
+	return &StickySelector{Base: base, TTL: ttl, pins: make(map[string]pin)}
+}
+
+// Select implements EndpointSelector.
+func (s *StickySelector) Select(req *http.Request, endpoints []string) (string, error) {
+	keyFunc := s.Key
+	if keyFunc == nil {
+		keyFunc = StickyKey
+	}
+	key := keyFunc(req)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pins == nil {
+		s.pins = make(map[string]pin)
+	}
+	if p, ok := s.pins[key]; ok && now.Before(p.expires) && slices.Contains(endpoints, p.endpoint) {
+		return p.endpoint, nil
+	}
+
+	endpoint, err := s.Base.Select(req, endpoints)
+	if err != nil {
+		return "", err
+	}
+	s.pins[key] = pin{endpoint: endpoint, expires: now.Add(s.TTL)}
+	s.sweep(now)
+	return endpoint, nil
+}
+
+// Report implements OutcomeReporter by forwarding to Base.
+func (s *StickySelector) Report(endpoint string, success bool) {
+	if reporter, ok := s.Base.(OutcomeReporter); ok {
+		reporter.Report(endpoint, success)
+	}
+}
+
+// ObserveLatency implements LatencyObserver by forwarding to Base.
+func (s *StickySelector) ObserveLatency(endpoint string, rtt time.Duration) {
+	if observer, ok := s.Base.(LatencyObserver); ok {
+		observer.ObserveLatency(endpoint, rtt)
+	}
+}
+
+// sweep drops expired pins, at most once per TTL.
+func (s *StickySelector) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.TTL {
+		return
+	}
+	for key, p := range s.pins {
+		if now.After(p.expires) {
+			delete(s.pins, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,120 @@
+package rotator
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+// Tags put on every API created by the rotator.
+const (
+	// TagCreatedBy marks an API as created by this tool, with the value
+	// CreatedByValue.
+	TagCreatedBy   = "created-by"
+	CreatedByValue = "apigateway-rotator"
+
+	// TagSite records the host of the site an API proxies.
+	TagSite = "rotator-site"
+
+	// TagPool records the name of the pool an API belongs to, which is also
+	// its API name unless WithRandomNames is used.
+	TagPool = "rotator-pool"
+
+	// TagStage records the stage of a REST API.
+	TagStage = "rotator-stage"
+
+	// TagDomain records the hosted zone the custom domain name of a REST API
+	// is in, see WithCustomDomain.
+	TagDomain = "rotator-domain"
+
+	// TagShared records the name of a REST API shared by pools, see
+	// WithSharedApi.
+	TagShared = "rotator-shared"
+)
+
+// tags returns the tags of a new API of the pool proxying to site.
+func (ag *ApiGateway) tags(site string) map[string]string {
+	tags := siteTags(site)
+	tags[TagCreatedBy] = CreatedByValue
+	tags[TagPool] = ag.Name
+	if ag.ttl > 0 {
+		tags[TagExpiresAt] = time.Now().Add(ag.ttl).UTC().Format(time.RFC3339)
+	}
+	return tags
+}
+
+// inPool reports whether an API with name and tags belongs to the pool.
+func (ag *ApiGateway) inPool(name string, tags map[string]string) bool {
+	if name == ag.Name {
+		return true
+	}
+	return tags[TagCreatedBy] == CreatedByValue && tags[TagPool] == ag.Name
+}
+
+// restStage returns the stage api was deployed to. APIs created before
+// TagStage existed use DefaultStageName.
+func restStage(api types.RestApi) string {
+	if stage := api.Tags[TagStage]; stage != "" {
+		return stage
+	}
+	return DefaultStageName
+}
+
+// GatewayFilter selects the REST APIs an operation applies to.
+type GatewayFilter func(api types.RestApi) bool
+
+// OwnedGateways selects the REST APIs created by the rotator. It is the
+// default filter of DeleteGateways.
+func OwnedGateways(api types.RestApi) bool {
+	return api.Tags[TagCreatedBy] == CreatedByValue
+}
+
+// AllGateways selects every REST API, including those that have nothing to do
+// with the rotator.
+func AllGateways(types.RestApi) bool {
+	return true
+}
+
+// SiteGateways selects the REST APIs created by the rotator for the site with
+// the given host.
+func SiteGateways(host string) GatewayFilter {
+	return func(api types.RestApi) bool {
+		return OwnedGateways(api) && api.Tags[TagSite] == host
+	}
+}
+
+// NamePrefixGateways selects the REST APIs whose name starts with prefix.
+func NamePrefixGateways(prefix string) GatewayFilter {
+	return func(api types.RestApi) bool {
+		return strings.HasPrefix(aws.ToString(api.Name), prefix)
+	}
+}
+
+// OlderThanGateways selects the REST APIs created more than age ago.
+func OlderThanGateways(age time.Duration) GatewayFilter {
+	cutoff := time.Now().Add(-age)
+	return func(api types.RestApi) bool {
+		return api.CreatedDate != nil && api.CreatedDate.Before(cutoff)
+	}
+}
+
+// TagGateways selects the REST APIs tagged with key and value, or with key
+// and any value when value is empty.
+func TagGateways(key, value string) GatewayFilter {
+	return func(api types.RestApi) bool {
+		v, ok := api.Tags[key]
+		return ok && (value == "" || v == value)
+	}
+}
+
+// matchAll reports whether api passes every filter.
+func matchAll(api types.RestApi, filters []GatewayFilter) bool {
+	for _, filter := range filters {
+		if !filter(api) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+)
+
+// targetVariable is the stage variable the integrations of REST APIs take the
+// host and base path of the site from, so that retargeting is a change of the
+// stage rather than of every integration followed by a deployment.
+const targetVariable = "target"
+
+// TargetSetter is implemented by providers whose endpoints take their site
+// from a variable that can be changed at once, without redeploying.
+type TargetSetter interface {
+	SetEndpointTarget(ctx context.Context, region, id, site string) error
+}
+
+// SetTarget points every endpoint of the pool at site by changing the stage
+// variable their integrations read the site from, which takes effect within
+// seconds. The scheme of the site cannot change and only REST APIs created or
+// retargeted since stage variables are used can be set; use Retarget for the
+// others. Like Retarget, ag.Site only changes when every endpoint was updated.
+func (ag *ApiGateway) SetTarget(ctx context.Context, site string) error {
+	site, err := normalizeSite(site)
+	if err != nil {
+		return err
+	}
+	if site == "" {
+		return fmt.Errorf("%w: no site to set as target", ErrInvalidSite)
+	}
+	current := ag.CurrentSite()
+	from, _ := url.Parse(current)
+	to, _ := url.Parse(site)
+	if from == nil || to == nil || from.Scheme != to.Scheme {
+		return fmt.Errorf("%w: %s does not have the scheme of %s, use Retarget", ErrInvalidSite, site, current)
+	}
+	return ag.retargetAll(ctx, site, ag.setTarget)
+}
+
+// setTarget points d at site with the provider that created it, if it can
+// set targets.
+func (ag *ApiGateway) setTarget(ctx context.Context, d Deployment, site string) error {
+	p, err := ag.providerFor(d)
+	if err != nil {
+		return err
+	}
+	s, ok := p.(TargetSetter)
+	if !ok {
+		return fmt.Errorf("provider %s cannot set the target of endpoints, use Retarget", p.Name())
+	}
+	if err := s.SetEndpointTarget(ctx, d.Region, d.ID, site); err != nil {
+		return err
+	}
+	ag.logger.Info("gateway target set", "region", d.Region, "id", d.ID, "site", site)
+	return nil
+}
+
+// targetURIs returns the integration URIs of the root and wildcard resources
+// of a REST API proxying to site through targetVariable, and the value of the
+// variable.
+func targetURIs(site string) (root, wildcard string, variables map[string]string) {
+	u, err := url.Parse(site)
+	if err != nil || u.Host == "" {
+		return site + "/", site + "/{proxy}", nil
+	}
+	prefix := u.Scheme + "://${stageVariables." + targetVariable + "}/"
+	return prefix, prefix + "{proxy}", map[string]string{targetVariable: u.Host + u.Path}
+}
+
+// setRestTarget changes targetVariable of the stages of REST API id to site.
+func (ag *ApiGateway) setRestTarget(ctx context.Context, creds *credentialSet, region, id, site string) error {
+	client, err := ag.newClient(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+	_, _, variables := targetURIs(site)
+
+	stages, err := client.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: &id})
+	if err != nil {
+		return fmt.Errorf("cannot get stages of api %s: %w", id, classify(err))
+	}
+	updated, shared := 0, false
+	for _, stage := range stages.Item {
+		if _, ok := stage.Variables[targetVariable]; !ok || ag.otherPool(stage) {
+			continue
+		}
+		_, ok := stage.Variables[poolVariable]
+		shared = shared || ok
+		_, err := client.UpdateStage(ctx, &apigateway.UpdateStageInput{
+			RestApiId: &id,
+			StageName: stage.StageName,
+			PatchOperations: []types.PatchOperation{{
+				Op:    types.OpReplace,
+				Path:  aws.String("/variables/" + targetVariable),
+				Value: aws.String(variables[targetVariable]),
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot update stage %s of api %s: %w", aws.ToString(stage.StageName), id, classify(err))
+		}
+		updated++
+	}
+	if updated == 0 {
+		return fmt.Errorf("api %s does not take its target from a stage variable, use Retarget", id)
+	}
+	// the site of a shared API is that of each stage
+	if shared {
+		return nil
+	}
+
+	_, err = client.TagResource(ctx, &apigateway.TagResourceInput{
+		ResourceArn: aws.String(apiARN(region, "/restapis/"+id)),
+		Tags:        siteTags(site),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot tag api %s: %w", id, classify(err))
+	}
+	return nil
+}
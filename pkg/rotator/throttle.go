@@ -0,0 +1,118 @@
+package rotator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var (
+	// DefaultAWSMaxAttempts is the number of attempts of an AWS API call,
+	// retries of throttled calls included.
+	DefaultAWSMaxAttempts = 10
+
+	// DefaultAWSRate and DefaultAWSBurst bound the AWS API calls per second
+	// made in each account and region, below the API Gateway control plane
+	// limits, so that bulk creations and deletions are not throttled.
+	DefaultAWSRate  = 5.0
+	DefaultAWSBurst = 10
+)
+
+// awsMaxBackoff bounds the wait between two attempts of an AWS API call.
+const awsMaxBackoff = 20 * time.Second
+
+// WithAWSRetries sets the number of attempts of every AWS API call. Throttled
+// calls are retried with the adaptive retryer of the SDK, which also slows
+// down the following calls.
+func WithAWSRetries(maxAttempts int) Option {
+	return func(ag *ApiGateway) {
+		ag.awsMaxAttempts = maxAttempts
+	}
+}
+
+// WithAWSRateLimit bounds the AWS API calls per second made in each account
+// and region; burst calls may be made at once. A rate of 0 disables the limit.
+func WithAWSRateLimit(rate float64, burst int) Option {
+	return func(ag *ApiGateway) {
+		ag.awsRate = rate
+		ag.awsBurst = burst
+	}
+}
+
+// throttleAWS adds the retryer and the rate limit of ag to cfg, the AWS
+// configuration of one account and region.
+func (ag *ApiGateway) throttleAWS(cfg *aws.Config) {
+	attempts := ag.awsMaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultAWSMaxAttempts
+	}
+	cfg.Retryer = func() aws.Retryer {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				so.MaxAttempts = attempts
+				so.MaxBackoff = awsMaxBackoff
+				// back off on throttling instead of failing once the retry
+				// quota is spent
+				so.RateLimiter = ratelimit.None
+			})
+		})
+	}
+
+	if ag.awsRate <= 0 {
+		return
+	}
+	limiter := newTokenBucket(ag.awsRate, ag.awsBurst)
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("RotatorRateLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if err := limiter.wait(ctx); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+	})
+}
+
+// tokenBucket paces calls to rate per second after a burst.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(max(burst, 1))
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// wait takes a token, waiting until one is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	b.refill()
+	// the token is reserved now, callers queue up behind each other
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
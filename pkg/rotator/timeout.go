@@ -0,0 +1,132 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxIntegrationTimeout is how long API Gateway waits for the site before
+// answering 504 Gateway Timeout. It cannot be raised: requests that take
+// longer only succeed when sent directly, see WithLongRunningFallback.
+const MaxIntegrationTimeout = 29 * time.Second
+
+// TimeoutHeader sets the timeout of a request, as a Go duration such as "10s"
+// or a number of seconds, for clients that cannot set a context. It is
+// removed before the request is sent.
+const TimeoutHeader = "X-Rotator-Timeout"
+
+// LongRunningHeader flags a request as long-running, like WithLongRunning,
+// for clients that cannot set a context. Any value but "false" or "0" flags
+// it. It is removed before the request is sent.
+const LongRunningHeader = "X-Rotator-Long-Running"
+
+type timeoutKey struct{}
+
+type longRunningKey struct{}
+
+// WithRequestTimeout returns a context that gives up on requests made with
+// it, retries included, after timeout. Through a gateway a request cannot
+// take longer than MaxIntegrationTimeout whatever the timeout.
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// WithLongRunning returns a context that flags requests made with it as
+// expected to run over MaxIntegrationTimeout, like long polls. When a gateway
+// times out on them they are not retried through other endpoints, which would
+// time out as well, and with WithLongRunningFallback they are sent directly.
+func WithLongRunning(ctx context.Context) context.Context {
+	return context.WithValue(ctx, longRunningKey{}, true)
+}
+
+// WithLongRunningFallback sends long-running requests, see WithLongRunning,
+// again directly to the site when a gateway times out on them. The site then
+// sees the address of this machine. Requests whose body cannot be read again
+// are not sent again.
+func WithLongRunningFallback() Option {
+	return func(ag *ApiGateway) {
+		ag.longDirect = true
+	}
+}
+
+// requestTimeout returns the timeout of req, from its context or from
+// TimeoutHeader, 0 for none.
+func requestTimeout(req *http.Request) time.Duration {
+	if timeout, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	value := req.Header.Get(TimeoutHeader)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	timeout, _ := time.ParseDuration(value)
+	return timeout
+}
+
+// longRunning reports whether req is flagged as long-running, by its context
+// or by LongRunningHeader.
+func longRunning(req *http.Request) bool {
+	if _, ok := req.Context().Value(longRunningKey{}).(bool); ok {
+		return true
+	}
+	value := req.Header.Get(LongRunningHeader)
+	return value != "" && value != "false" && value != "0"
+}
+
+// gatewayTimedOut reports whether resp is the 504 answered by API Gateway
+// itself when the site did not answer in time, rather than one of the site.
+// API Gateway marks its own errors with x-amzn-ErrorType, HTTP APIs with
+// apigw-requestid.
+func gatewayTimedOut(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusGatewayTimeout &&
+		(resp.Header.Get("X-Amzn-Errortype") != "" || resp.Header.Get("Apigw-Requestid") != "")
+}
+
+// GatewayTimeoutError is returned by Transport when the gateway a request went
+// through timed out waiting for the site. It matches ErrGatewayTimeout.
+type GatewayTimeoutError struct {
+	Endpoint string
+	// After is how long the request waited for the answer of the gateway.
+	After time.Duration
+}
+
+func (e *GatewayTimeoutError) Error() string {
+	return fmt.Sprintf("%s after %s", ErrGatewayTimeout, e.After.Round(time.Millisecond))
+}
+
+func (e *GatewayTimeoutError) Unwrap() error {
+	return ErrGatewayTimeout
+}
+
+// Timeout reports that the error is a timeout, like those of net.Error.
+func (e *GatewayTimeoutError) Timeout() bool {
+	return true
+}
+
+// gatewayTimeoutError closes resp, the gateway timeout of endpoint after
+// latency, and returns the error reported instead.
+func gatewayTimeoutError(resp *http.Response, endpoint string, latency time.Duration) error {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return &GatewayTimeoutError{Endpoint: endpoint, After: latency}
+}
+
+// cancelBody cancels the context of a request with a timeout once its
+// response is read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,45 @@
+package rotator
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of the package.
+const tracerName = "github.com/mductran/apigateway-rotator/pkg/rotator"
+
+// WithTracerProvider sets where spans of proxied requests and of AWS API calls
+// are sent. The global OpenTelemetry tracer provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(ag *ApiGateway) {
+		ag.tracerProvider = tp
+	}
+}
+
+// setupTracing creates the tracer of ag once its options are applied.
+func (ag *ApiGateway) setupTracing() {
+	if ag.tracerProvider == nil {
+		ag.tracerProvider = otel.GetTracerProvider()
+	}
+	ag.tracer = ag.tracerProvider.Tracer(tracerName)
+}
+
+// traceAWS adds a span to every AWS API call made with cfg.
+func (ag *ApiGateway) traceAWS(cfg *aws.Config) {
+	otelaws.AppendMiddlewares(&cfg.APIOptions, otelaws.WithTracerProvider(ag.tracerProvider))
+}
+
+// endRequestSpan records the outcome of a proxied request on span and ends it.
+func endRequestSpan(span trace.Span, status int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	span.End()
+}
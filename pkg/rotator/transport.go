@@ -0,0 +1,280 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport is an http.RoundTripper that sends every request through one of
+// the endpoints of Gateway. Bodies go through unchanged: the response to a
+// request with an Accept-Encoding header keeps the encoding the site chose,
+// gzip, br or other, and Base decompresses the gzip it asks for on its own
+// when the request has none.
+type Transport struct {
+	Gateway *ApiGateway
+
+	// Base performs the rerouted request. A transport with the connection
+	// pool of Gateway, see WithConnPool, is used when nil.
+	Base http.RoundTripper
+
+	// managed is set for the pools of a Manager, which already sends each
+	// request through the pool of its host.
+	managed bool
+}
+
+// Transport returns a Transport that routes requests through ag.
+func (ag *ApiGateway) Transport() *Transport {
+	return &Transport{Gateway: ag}
+}
+
+// Client returns an http.Client whose requests are routed through ag.
+func (ag *ApiGateway) Client() *http.Client {
+	return &http.Client{Transport: ag.Transport()}
+}
+
+// RoundTrip implements http.RoundTripper. The request is cloned before being
+// rerouted so the caller's request is never modified. With WithRetry, failed
+// requests whose body can be replayed are sent again through other endpoints.
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	ctx, span := t.Gateway.tracer.Start(req.Context(), "rotator.request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+		))
+	defer func() {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		endRequestSpan(span, status, err)
+	}()
+	req = req.WithContext(ctx)
+	// a timeout would close the upgraded connection
+	if timeout := requestTimeout(req); timeout > 0 && upgradeType(req) == "" {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		req = req.WithContext(ctx)
+		defer func() {
+			if resp == nil {
+				cancel()
+			} else {
+				resp.Body = cancelBody{resp.Body, cancel}
+			}
+		}()
+	}
+
+	// the pool only reaches its site, refuse requests meant for another host
+	// rather than sending them there
+	if req.URL.Host != "" {
+		if err := t.Gateway.checkHost(ctx, req.URL.Host, !t.managed); err != nil {
+			return nil, err
+		}
+	}
+	if t.Gateway.cache != nil {
+		return t.cached(req, t.forward)
+	}
+	return t.forward(req)
+}
+
+// forward sends req, whose host is allowed, to the site through the pool.
+func (t *Transport) forward(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.Gateway.hostLimit.limit(ctx, req.URL.Host, t.Gateway.limitPolicy); err != nil {
+		return nil, err
+	}
+	if err := t.Gateway.pace(ctx); err != nil {
+		return nil, err
+	}
+	if t.Gateway.budget != nil {
+		if err, first := t.Gateway.budget.check(time.Now()); err != nil {
+			return t.overBudget(req, err, first)
+		}
+	}
+	if t.Gateway.fallback != "" && t.Gateway.fallback != FallbackFail && len(t.Gateway.availableEndpoints()) == 0 {
+		if resp, done, err := t.noEndpoint(req); done {
+			return resp, err
+		}
+	}
+	if upgradeType(req) != "" {
+		return t.upgradeRequest(req)
+	}
+	if oversized(req) {
+		return t.oversizedRequest(req)
+	}
+	if t.Gateway.payloads == PayloadRanged && req.Method == http.MethodGet && req.Header.Get("Range") == "" {
+		return t.rangedRequest(req)
+	}
+	resp, err := t.send(req)
+	if errors.Is(err, ErrGatewayTimeout) && t.Gateway.longDirect && longRunning(req) && replayable(req) {
+		out := req
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out = req.Clone(req.Context())
+			out.Body = body
+		}
+		t.Gateway.logger.Warn("gateway timed out on long-running request, sending it directly", "url", req.URL.Redacted())
+		return t.direct(out)
+	}
+	return resp, err
+}
+
+// roundTrip sends req once through an endpoint not in exclude, if the pool
+// has one, and returns the endpoint used. The endpoint is "" when the request
+// could not be rerouted.
+func (t *Transport) roundTrip(req *http.Request, exclude map[string]bool) (*http.Response, string, error) {
+	ctx, span := t.Gateway.tracer.Start(req.Context(), "rotator.attempt", trace.WithSpanKind(trace.SpanKindClient))
+	out := req.Clone(ctx)
+	out.RequestURI = ""
+	if t.Gateway.userAgents != nil {
+		out.Header.Set("User-Agent", t.Gateway.userAgents.UserAgent(out))
+	}
+	out, endpoint, err := t.Gateway.reroute(out, exclude)
+	if err != nil {
+		endRequestSpan(span, 0, err)
+		return nil, "", err
+	}
+	endpointPicked(ctx, endpoint)
+	if err := t.Gateway.endpointLimit.limit(ctx, endpoint, t.Gateway.limitPolicy); err != nil {
+		endRequestSpan(span, 0, err)
+		return nil, endpoint, err
+	}
+	d, known := t.Gateway.deployment(endpoint)
+	if known {
+		span.SetAttributes(
+			attribute.String("rotator.endpoint", endpoint),
+			attribute.String("rotator.provider", d.Provider),
+			attribute.String("cloud.region", d.Region),
+		)
+	}
+
+	t.Gateway.hooks.onRequest(out)
+	if err := t.Gateway.sign(out, d); err != nil {
+		endRequestSpan(span, 0, err)
+		return nil, endpoint, err
+	}
+	start := time.Now()
+	resp, err := t.base().RoundTrip(out)
+	latency := time.Since(start)
+	if err == nil && gatewayTimedOut(resp) {
+		resp, err = nil, gatewayTimeoutError(resp, endpoint, latency)
+	}
+	t.Gateway.auditRequest(req, d, endpoint, resp, err, latency)
+	if err != nil && hedgeLost(ctx) {
+		endRequestSpan(span, 0, err)
+		return nil, endpoint, err
+	}
+	var ban string
+	if err == nil {
+		ban = t.Gateway.detectBan(resp)
+		t.Gateway.sanitize(resp)
+		t.Gateway.rewriteResponse(resp, req, out, endpoint)
+		t.Gateway.hooks.onResponse(resp)
+	}
+	if ban != "" {
+		span.SetAttributes(attribute.String("rotator.ban", ban))
+		t.Gateway.logger.Warn("ban detected", "endpoint", endpoint, "url", req.URL.String(), "status", resp.StatusCode, "reason", ban)
+		t.Gateway.emit(Event{Type: EventEndpointBanned, Endpoint: endpoint, Region: d.Region, Provider: d.Provider, ID: d.ID, URL: req.URL.Redacted(), Status: resp.StatusCode, Error: ban})
+	}
+	success := succeeded(resp, err) && ban == ""
+	if reporter, ok := t.Gateway.endpointSelector().(OutcomeReporter); ok {
+		reporter.Report(endpoint, success)
+	}
+	t.Gateway.reportCircuit(endpoint, success)
+	if !success {
+		failure := err
+		if ban != "" {
+			failure = fmt.Errorf("ban detected: %s", ban)
+		}
+		t.Gateway.emitFailure(req, d, endpoint, resp, failure)
+	}
+	if known {
+		throttled := resp != nil && resp.StatusCode == http.StatusTooManyRequests
+		t.Gateway.stats.record(d, success, throttled, latency)
+		t.countBytes(d, resp)
+	}
+	t.Gateway.observe(endpoint, resp, ban != "")
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	endRequestSpan(span, status, err)
+	return resp, endpoint, err
+}
+
+// countBytes adds the bytes of the body of resp, answered through d, to the
+// stats and the budget once it is read. The body of an upgraded connection is
+// not counted, it has to stay writable.
+func (t *Transport) countBytes(d Deployment, resp *http.Response) {
+	done := func(bytes int64) {
+		t.Gateway.stats.addBytes(d, bytes)
+		if t.Gateway.budget != nil {
+			t.Gateway.budget.charge(d.Provider, bytes)
+		}
+	}
+	if resp == nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		done(0)
+		return
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: done}
+}
+
+// EndpointOf returns the endpoint of the pool resp was answered through, ""
+// when the request was sent directly or answered from the cache.
+func (ag *ApiGateway) EndpointOf(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	ag.mu.RLock()
+	defer ag.mu.RUnlock()
+	if _, ok := ag.deployments[resp.Request.URL.Host]; ok {
+		return resp.Request.URL.Host
+	}
+	return ""
+}
+
+// direct sends req straight to the site, bypassing the gateways.
+func (t *Transport) direct(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	out.Header.Del(SessionHeader)
+	out.Header.Del(TimeoutHeader)
+	out.Header.Del(LongRunningHeader)
+	start := time.Now()
+	resp, err := t.base().RoundTrip(out)
+	t.Gateway.auditRequest(req, Deployment{}, "", resp, err, time.Since(start))
+	return resp, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	if t.Gateway.conns != nil {
+		return t.Gateway.conns
+	}
+	return http.DefaultTransport
+}
+
+// succeeded reports whether a round trip reached the target and was not
+// throttled or refused, which is what selectors and health tracking care about.
+func succeeded(resp *http.Response, err error) bool {
+	if err != nil {
+		return false
+	}
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package rotator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mductran/apigateway-rotator/pkg/rotator"
+	"github.com/mductran/apigateway-rotator/pkg/rotator/rotatortest"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransportCountsChunkedBytes(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	ag := newTestGateway(t, cloud)
+	if err := ag.InitializeAll(ctx); err != nil {
+		t.Fatalf("InitializeAll: %v", err)
+	}
+
+	const body = "a chunked body of unknown length"
+	tr := ag.Transport()
+	tr.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: -1,
+			Request:       req,
+		}, nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if stats := ag.Stats(); stats.Requests != 1 || stats.Bytes != 0 {
+		t.Errorf("stats have %d requests and %d bytes before the body is read, want 1 and 0", stats.Requests, stats.Bytes)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if stats := ag.Stats(); stats.Bytes != uint64(len(body)) {
+		t.Errorf("stats have %d bytes once the body is read, want %d", stats.Bytes, len(body))
+	}
+}
+
+// upgradingProvider creates a single endpoint that can upgrade connections.
+type upgradingProvider struct{}
+
+func (upgradingProvider) Name() string { return "upgrading" }
+
+func (upgradingProvider) CreateEndpoint(ctx context.Context, region string) (rotator.Deployment, error) {
+	return rotator.Deployment{Provider: "upgrading", Region: region, ID: "ws", Host: "ws.example.net"}, nil
+}
+
+func (upgradingProvider) ListEndpoints(ctx context.Context, region string) ([]rotator.Deployment, error) {
+	return nil, nil
+}
+
+func (upgradingProvider) DeleteEndpoint(ctx context.Context, region, id string) error { return nil }
+
+func (upgradingProvider) Upgrades() bool { return true }
+
+func TestTransportUpgradeOnlyThroughUpgradingEndpoints(t *testing.T) {
+	ctx := context.Background()
+	cloud := rotatortest.NewCloud()
+	ag := newTestGateway(t, cloud)
+	if err := ag.InitializeAll(ctx); err != nil {
+		t.Fatalf("InitializeAll: %v", err)
+	}
+	if err := ag.InitializeWith(upgradingProvider{}, "us-east-1", ctx); err != nil {
+		t.Fatalf("InitializeWith: %v", err)
+	}
+
+	var sentTo []string
+	tr := ag.Transport()
+	tr.Base = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sentTo = append(sentTo, req.URL.Host)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	upgrade := func() error {
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/socket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		resp, err := tr.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := upgrade(); err != nil {
+			t.Fatalf("upgrade request: %v", err)
+		}
+	}
+	for _, host := range sentTo {
+		if host != "ws.example.net" {
+			t.Errorf("upgrade request sent through %s, which cannot upgrade connections", host)
+		}
+	}
+
+	// the REST APIs are not used in its place once it is out of rotation
+	sentTo = nil
+	ag.SetHealthy("ws.example.net", false)
+	if err := upgrade(); !errors.Is(err, rotator.ErrUpgradeUnsupported) {
+		t.Errorf("upgrade request without an upgrading endpoint returned %v, want ErrUpgradeUnsupported", err)
+	}
+	if len(sentTo) != 0 {
+		t.Errorf("upgrade request sent through %v", sentTo)
+	}
+}
@@ -0,0 +1,79 @@
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Upgrader is implemented by providers whose endpoints pass connection
+// upgrades, like WebSocket handshakes, through to the site. API Gateway does
+// not: REST and HTTP APIs drop the Upgrade header and answer the handshake as
+// a plain request.
+type Upgrader interface {
+	Upgrades() bool
+}
+
+// WithUpgradeDirect sends upgrade requests, like the WebSocket handshakes of
+// ws:// and wss:// connections, straight to the site when no endpoint of the
+// pool can upgrade connections, see Upgrader. The site then sees the address
+// of this machine. Without it, such requests fail with ErrUpgradeUnsupported.
+func WithUpgradeDirect() Option {
+	return func(ag *ApiGateway) {
+		ag.upgradeDirect = true
+	}
+}
+
+// upgradeType returns the protocol req asks to upgrade its connection to,
+// like "websocket", or "" if it does not.
+func upgradeType(req *http.Request) string {
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return req.Header.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// upgradeRequest sends req, which asks to upgrade its connection, through an
+// endpoint whose provider can upgrade connections, or else directly with
+// WithUpgradeDirect. The body of a 101 Switching Protocols response is the
+// upgraded connection, an io.ReadWriteCloser. Upgrade requests are not
+// retried.
+func (t *Transport) upgradeRequest(req *http.Request) (*http.Response, error) {
+	if t.Gateway.upgradingEndpoints() > 0 {
+		resp, _, err := t.roundTrip(req, nil)
+		// the endpoints counted may have become unavailable since
+		if !errors.Is(err, ErrUpgradeUnsupported) {
+			return resp, err
+		}
+	}
+	if t.Gateway.upgradeDirect {
+		t.Gateway.logger.Warn("no endpoint can upgrade connections, sending upgrade request directly", "url", req.URL.Redacted(), "upgrade", upgradeType(req))
+		return t.direct(req)
+	}
+	return nil, fmt.Errorf("%w: no endpoint of the pool passes %s upgrades through", ErrUpgradeUnsupported, upgradeType(req))
+}
+
+// upgradingEndpoints returns the number of available endpoints of the pool
+// that can upgrade connections.
+func (ag *ApiGateway) upgradingEndpoints() int {
+	n := 0
+	for _, endpoint := range ag.availableEndpoints() {
+		if ag.upgrades(endpoint) {
+			n++
+		}
+	}
+	return n
+}
+
+// upgrades reports whether the provider of endpoint can upgrade connections.
+func (ag *ApiGateway) upgrades(endpoint string) bool {
+	d, _ := ag.deployment(endpoint)
+	p, err := ag.providerFor(d)
+	u, ok := p.(Upgrader)
+	return err == nil && ok && u.Upgrades()
+}
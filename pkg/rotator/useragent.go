@@ -0,0 +1,134 @@
+package rotator
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgents is the built-in pool of current desktop and mobile
+// browsers used by a UserAgentRotator without a custom list.
+var DefaultUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36 Edg/130.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.7; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (iPad; CPU OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+	"Mozilla/5.0 (Linux; Android 14; SM-S928B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+}
+
+// WithUserAgents makes Transport set the User-Agent of every request to one
+// picked by r before rerouting it.
+func WithUserAgents(r *UserAgentRotator) Option {
+	return func(ag *ApiGateway) {
+		ag.userAgents = r
+	}
+}
+
+// UserAgentRotator picks a random user agent for every request. Requests of
+// the same session get the same user agent until the session has been idle
+// for TTL, so that a session does not switch browsers halfway.
+type UserAgentRotator struct {
+	// Agents is the pool to pick from, DefaultUserAgents if empty.
+	Agents []string
+	// TTL is how long an idle session keeps its user agent. Sessions are not
+	// sticky when it is 0.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]sessionAgent
+	lastSweep time.Time
+}
+
+type sessionAgent struct {
+	agent    string
+	lastUsed time.Time
+}
+
+// NewUserAgentRotator returns a UserAgentRotator picking from agents, or from
+// DefaultUserAgents when none are given.
+func NewUserAgentRotator(ttl time.Duration, agents ...string) *UserAgentRotator {
+	return &UserAgentRotator{Agents: agents, TTL: ttl, sessions: make(map[string]sessionAgent)}
+}
+
+// LoadUserAgents reads a user agent per line from path. Blank lines and lines
+// starting with # are skipped.
+func LoadUserAgents(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read user agents: %w", err)
+	}
+	defer f.Close()
+
+	var agents []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		agents = append(agents, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read user agents: %w", err)
+	}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("cannot read user agents: %s has none", path)
+	}
+	return agents, nil
+}
+
+// UserAgent returns the user agent to send req with.
+func (r *UserAgentRotator) UserAgent(req *http.Request) string {
+	session := SessionFromRequest(req)
+	if session == "" || r.TTL <= 0 {
+		return r.pick()
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[string]sessionAgent)
+	}
+	entry, ok := r.sessions[session]
+	if !ok || now.Sub(entry.lastUsed) > r.TTL {
+		entry.agent = r.pick()
+	}
+	entry.lastUsed = now
+	r.sessions[session] = entry
+	r.sweep(now)
+	return entry.agent
+}
+
+func (r *UserAgentRotator) pick() string {
+	agents := r.Agents
+	if len(agents) == 0 {
+		agents = DefaultUserAgents
+	}
+	return agents[rand.Intn(len(agents))]
+}
+
+// sweep drops idle sessions, at most once per TTL.
+func (r *UserAgentRotator) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.TTL {
+		return
+	}
+	for session, entry := range r.sessions {
+		if now.Sub(entry.lastUsed) > r.TTL {
+			delete(r.sessions, session)
+		}
+	}
+	r.lastSweep = now
+}
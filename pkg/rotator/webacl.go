@@ -0,0 +1,110 @@
+package rotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/wafv2"
+	waftypes "github.com/aws/aws-sdk-go-v2/service/wafv2/types"
+)
+
+const (
+	// webACLAttempts is how many times a web ACL is associated with a new
+	// stage, which WAF may not see yet, waiting webACLFirstDelay after the
+	// first attempt and twice as long after every other.
+	webACLAttempts   = 5
+	webACLFirstDelay = time.Second
+)
+
+// WithWebACL associates an existing WAF web ACL with the stage of every REST
+// API created for the pool, so that its rules rate limit or geo restrict who
+// can invoke the endpoints. A regional web ACL only protects resources of its
+// own region: acls are ARNs of web ACLs, each used in the region of its ARN,
+// or names of web ACLs looked up in the regions no ARN is given for. Creating
+// a gateway in a region with no matching web ACL fails. Adopted gateways keep
+// their web ACL, if any. HTTP APIs cannot be associated with web ACLs.
+func WithWebACL(acls ...string) Option {
+	return func(ag *ApiGateway) {
+		ag.webACLs = append(ag.webACLs, acls...)
+	}
+}
+
+// associateWebACL associates the web ACL of region with the stage of the REST
+// API id, if the pool has web ACLs.
+func (ag *ApiGateway) associateWebACL(ctx context.Context, creds *credentialSet, region, id, stage string) error {
+	// the fake clients of WithRestClients have no WAF
+	if len(ag.webACLs) == 0 || ag.restClients != nil {
+		return nil
+	}
+	cfg, err := ag.awsConfig(ctx, creds, region)
+	if err != nil {
+		return err
+	}
+	client := wafv2.NewFromConfig(cfg)
+	acl, err := ag.webACL(ctx, client, region)
+	if err != nil {
+		return err
+	}
+
+	resource := apiARN(region, "/restapis/"+id+"/stages/"+stage)
+	delay := webACLFirstDelay
+	for attempt := 1; ; attempt++ {
+		_, err = client.AssociateWebACL(ctx, &wafv2.AssociateWebACLInput{WebACLArn: &acl, ResourceArn: &resource})
+		var unavailable *waftypes.WAFUnavailableEntityException
+		if !errors.As(err, &unavailable) || attempt == webACLAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("cannot associate web acl %s: %w", acl, classify(err))
+	}
+	ag.logger.Debug("web acl associated", "region", region, "id", id, "acl", acl)
+	return nil
+}
+
+// webACL returns the ARN of the web ACL of the pool in region: the ARN given
+// for region, or the ARN of the first web ACL of region with a name given.
+func (ag *ApiGateway) webACL(ctx context.Context, client *wafv2.Client, region string) (string, error) {
+	var names []string
+	for _, acl := range ag.webACLs {
+		if parsed, err := arn.Parse(acl); err == nil {
+			if parsed.Region == region {
+				return acl, nil
+			}
+			continue
+		}
+		names = append(names, acl)
+	}
+
+	if len(names) > 0 {
+		input := &wafv2.ListWebACLsInput{Scope: waftypes.ScopeRegional}
+		for {
+			output, err := client.ListWebACLs(ctx, input)
+			if err != nil {
+				return "", fmt.Errorf("cannot list web acls in %s: %w", region, classify(err))
+			}
+			for _, acl := range output.WebACLs {
+				if slices.Contains(names, aws.ToString(acl.Name)) {
+					return aws.ToString(acl.ARN), nil
+				}
+			}
+			if output.NextMarker == nil {
+				break
+			}
+			input.NextMarker = output.NextMarker
+		}
+	}
+	return "", fmt.Errorf("no web acl %s in region %s", strings.Join(ag.webACLs, ", "), region)
+}